@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Realistic browser user agents, rotated through by the random agent mode
+var browserAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:131.0) Gecko/20100101 Firefox/131.0",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36 Edg/129.0.0.0",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.0 Safari/605.1.15",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 14.7; rv:131.0) Gecko/20100101 Firefox/131.0",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0",
+	"Mozilla/5.0 (iPhone; CPU iPhone OS 18_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.0 Mobile/15E148 Safari/604.1",
+	"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Mobile Safari/537.36",
+}
+
+// Accept-Language values sent alongside the random agents
+var browserLanguages = []string{
+	"en-US,en;q=0.9",
+	"en-GB,en;q=0.9",
+	"en-US,en;q=0.8,es;q=0.6",
+	"en-CA,en;q=0.9,fr-CA;q=0.7",
+	"en-AU,en;q=0.9",
+}
+
+// The browser-like Accept header sent with every request
+const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+// Function randomAgent picks a browser user agent and language at random.
+func randomAgent(random *rand.Rand) (userAgent string, language string) {
+	return browserAgents[random.Intn(len(browserAgents))], browserLanguages[random.Intn(len(browserLanguages))]
+}
+
+// Function parseHeaderFlag parses a header given on the command line, in the
+// form "Header: value".
+func parseHeaderFlag(value string) (key string, headerValue string, err error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return "", "", errors.New("invalid header " + value + "; expected Header: value")
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
+
+// The request headers that carry a session
+var sessionHeaders = []string{"Authorization", "Cookie"}
+
+// The names of the request headers that carry credentials, such as
+// Authorization, Cookie, X-Api-Key and X-Session-Token, checked
+// case-insensitively
+var credentialHeader = regexp.MustCompile(`(?i)(auth|cookie|token|session|secret|passw|api[_\-]?key|access[_\-]?key|signature|credential)`)
+
+// Function redactHeaders returns a copy of a set of headers with the values
+// of those that carry credentials replaced, so that they can be shown.
+func redactHeaders(headers http.Header) http.Header {
+	if headers == nil {
+		return nil
+	}
+	redacted := make(http.Header, len(headers))
+	for name, values := range headers {
+		if !credentialHeader.MatchString(name) {
+			redacted[name] = append([]string(nil), values...)
+			continue
+		}
+		redacted[name] = make([]string, len(values))
+		for i := range values {
+			redacted[name][i] = redactedSecret
+		}
+	}
+	return redacted
+}
+
+// Method authProfile returns the auth profile a URL found from a seed is
+// requested with: the seed's own, or else that of the URL's target, if any.
+func (c *Crawler) authProfile(seed *Seed, urlValue *url.URL) string {
+	if seed.Auth != "" {
+		return seed.Auth
+	}
+	if target := c.targetFor(urlValue); target != nil {
+		return target.Auth
+	}
+	return ""
+}
+
+// Method isAuthenticated checks whether a URL found from a seed is requested
+// with a session: the headers of an auth profile, or a Cookie or
+// Authorization header sent with every request.
+func (c *Crawler) isAuthenticated(seed *Seed, urlValue *url.URL) bool {
+	if c.authProfile(seed, urlValue) != "" {
+		return true
+	}
+	for _, header := range sessionHeaders {
+		if c.options.Headers.Get(header) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Method applyHeaders adds the request context of a task to a request: the
+// configured headers, the user agent and language, and the headers of the
+// auth profile used by the task's seed (or its target), in that order of
+// precedence.
+func (c *Crawler) applyHeaders(request *http.Request, task Task) {
+	c.applyRequestContext(request, task)
+
+	if profile := c.authProfile(task.Seed, task.URL); profile != "" {
+		for key, values := range c.options.AuthProfiles[profile].Headers {
+			request.Header.Del(key)
+			for _, value := range values {
+				request.Header.Add(key, value)
+			}
+		}
+	}
+}
+
+// Method applyRequestContext adds the request context of a task to a request,
+// leaving out its auth profile: the configured headers, and the user agent
+// and language.
+func (c *Crawler) applyRequestContext(request *http.Request, task Task) {
+	request.Header.Set("Accept", browserAccept)
+
+	for key, values := range c.options.Headers {
+		request.Header.Del(key)
+		for _, value := range values {
+			request.Header.Add(key, value)
+		}
+	}
+
+	if task.UserAgent != "" {
+		request.Header.Set("User-Agent", task.UserAgent)
+	}
+	if task.AcceptLanguage != "" {
+		request.Header.Set("Accept-Language", task.AcceptLanguage)
+	}
+
+	// Ask for fragments the same way the page's JavaScript would, as some
+	// servers only return the fragment to AJAX requests
+	if task.FragmentOf != "" {
+		request.Header.Set("X-Requested-With", "XMLHttpRequest")
+		request.Header.Set("HX-Request", "true")
+		request.Header.Set("Referer", task.FragmentOf)
+	}
+}
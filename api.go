@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// The common locations of OpenAPI (Swagger) specs, tried on each whitelisted origin
+var openAPIPaths = []string{
+	"/openapi.json",
+	"/swagger.json",
+	"/v3/api-docs",
+	"/v2/api-docs",
+	"/api/openapi.json",
+	"/api/swagger.json",
+	"/swagger/v1/swagger.json",
+}
+
+// The common locations of GraphQL endpoints
+var graphQLPaths = []string{
+	"/graphql",
+	"/api/graphql",
+}
+
+// The HTTP methods that can appear as operations in an OpenAPI spec
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// The GraphQL introspection query, asking only for what is needed to list
+// the operations and their arguments
+const graphQLIntrospection = `{"query":"query { __schema { queryType { name } mutationType { name } types { name fields { name args { name type { name kind ofType { name kind ofType { name kind ofType { name kind } } } } } } } } }"}`
+
+// openAPISpec holds the parts of an OpenAPI 2 or 3 spec needed to list its
+// operations and their parameters. Parts are kept raw, to resolve $refs.
+type openAPISpec struct {
+	Swagger  string `json:"swagger"`
+	OpenAPI  string `json:"openapi"`
+	Host     string `json:"host"`
+	BasePath string `json:"basePath"`
+	Servers  []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Parameters map[string]json.RawMessage            `json:"parameters"`
+	Defs       map[string]json.RawMessage            `json:"definitions"`
+	Components struct {
+		Parameters    map[string]json.RawMessage `json:"parameters"`
+		Schemas       map[string]json.RawMessage `json:"schemas"`
+		RequestBodies map[string]json.RawMessage `json:"requestBodies"`
+	} `json:"components"`
+}
+
+// openAPIParameter is a single parameter of an OpenAPI operation, or a
+// reference to one.
+type openAPIParameter struct {
+	Ref      string     `json:"$ref"`
+	Name     string     `json:"name"`
+	In       string     `json:"in"`
+	Required bool       `json:"required"`
+	Type     string     `json:"type"`
+	Schema   *apiSchema `json:"schema"`
+}
+
+// apiSchema is the part of a JSON schema needed to list the fields of a request body.
+type apiSchema struct {
+	Ref        string                `json:"$ref"`
+	Type       string                `json:"type"`
+	Properties map[string]*apiSchema `json:"properties"`
+	Required   []string              `json:"required"`
+}
+
+// openAPIOperation is a single operation of an OpenAPI spec.
+type openAPIOperation struct {
+	Parameters  []openAPIParameter  `json:"parameters"`
+	RequestBody *openAPIRequestBody `json:"requestBody"`
+}
+
+// openAPIRequestBody is the request body of an OpenAPI 3 operation, or a
+// reference to one.
+type openAPIRequestBody struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema *apiSchema `json:"schema"`
+	} `json:"content"`
+}
+
+// Method startAPIProbe looks for APIs on an origin in the background. The
+// crawl does not finish until the probe does.
+func (c *Crawler) startAPIProbe(originURL *url.URL, seed *Seed) {
+	c.URLsInProcess.Add(1)
+	c.spawn(&c.goroutines.probing, func() {
+		defer c.URLsInProcess.Done()
+		if err := isolate(func() {
+			c.probeAPIs(originURL, seed)
+		}); err != nil {
+			c.log.Errorf("[%s] Probing for APIs: %s", origin(originURL), err.Error())
+		}
+	})
+}
+
+// Method probeAPIs looks for OpenAPI specs and GraphQL endpoints on an
+// origin, reporting the operations they expose, and their parameters, as
+// input fields.
+func (c *Crawler) probeAPIs(originURL *url.URL, seed *Seed) {
+	for _, path := range openAPIPaths {
+		specURL := originURL.ResolveReference(&url.URL{Path: path})
+		body, ok := c.fetchAPI(http.MethodGet, specURL, seed, nil)
+		if !ok {
+			continue
+		}
+		results, err := parseOpenAPI(body, specURL)
+		if err != nil {
+			c.log.Debugf("[%s] Not an OpenAPI spec: %s", specURL.String(), err.Error())
+			continue
+		}
+		c.log.Infof("[%s] Found an OpenAPI spec with %d operation(s)", specURL.String(), len(results))
+		c.addAPIResults(results, seed)
+
+		// One spec per origin is enough; the others are usually copies
+		break
+	}
+
+	for _, path := range graphQLPaths {
+		endpoint := originURL.ResolveReference(&url.URL{Path: path})
+		body, ok := c.fetchAPI(http.MethodPost, endpoint, seed, []byte(graphQLIntrospection))
+		if !ok {
+			continue
+		}
+		results, err := parseGraphQL(body, endpoint)
+		if err != nil {
+			c.log.Debugf("[%s] Not a GraphQL endpoint: %s", endpoint.String(), err.Error())
+			continue
+		}
+		c.log.Infof("[%s] Found a GraphQL endpoint with %d operation(s)", endpoint.String(), len(results))
+		c.addAPIResults(results, seed)
+		break
+	}
+}
+
+// Method fetchAPI requests an API location, returning the body if it
+// responds with a JSON success.
+func (c *Crawler) fetchAPI(method string, apiURL *url.URL, seed *Seed, body []byte) ([]byte, bool) {
+	request, err := http.NewRequest(method, apiURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, false
+	}
+	c.applyHeaders(request, Task{URL: apiURL, Seed: seed, UserAgent: c.options.UserAgent, AcceptLanguage: c.options.AcceptLanguage})
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	atomic.AddInt64(&c.stats.requests, 1)
+	response, err := c.client.Do(request)
+	if err != nil {
+		c.log.Debugf("[%s] %s", apiURL.String(), err.Error())
+		return nil, false
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 || !strings.Contains(response.Header.Get("Content-Type"), "json") {
+		io.Copy(ioutil.Discard, io.LimitReader(response.Body, 4096))
+		return nil, false
+	}
+
+	var reader io.Reader = response.Body
+	if c.options.MaxBodySize > 0 {
+		reader = io.LimitReader(response.Body, c.options.MaxBodySize)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Method addAPIResults records the operations found in an API.
+func (c *Crawler) addAPIResults(results []PageResult, seed *Seed) {
+	for _, result := range results {
+		result.Tags = seed.Tags
+		resultURL, _ := url.Parse(result.URL)
+		result.Authenticated, result.AuthProfile = c.isAuthenticated(seed, resultURL), c.authProfile(seed, resultURL)
+		atomic.AddInt64(&c.stats.inputsFound, int64(len(result.Inputs)))
+		c.addResult(result)
+		c.addEndpoint(resultEndpoint(result))
+	}
+}
+
+// Function apiInput creates an input field for an API parameter. The
+// attributes are those of the parameter, with the method and location.
+func apiInput(source string, attributes ...Attribute) Input {
+	var kept []Attribute
+	for _, attribute := range attributes {
+		if attribute.Val != "" {
+			kept = append(kept, attribute)
+		}
+	}
+	return Input{HTML: renderInput(kept), Attributes: kept, Source: source}
+}
+
+// Function parseOpenAPI lists the operations of an OpenAPI 2 or 3 spec, with
+// their parameters as input fields. Each operation is reported as a page,
+// with the URL the operation is served at.
+func parseOpenAPI(data []byte, specURL *url.URL) ([]PageResult, error) {
+	var spec openAPISpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+	if (spec.Swagger == "" && spec.OpenAPI == "") || len(spec.Paths) == 0 {
+		return nil, fmt.Errorf("no swagger or openapi version, or no paths")
+	}
+
+	// Work out where the operations are served from
+	base := specURL.ResolveReference(&url.URL{Path: "/"})
+	if len(spec.Servers) > 0 && spec.Servers[0].URL != "" {
+		if serverURL, err := url.Parse(spec.Servers[0].URL); err == nil {
+			base = specURL.ResolveReference(serverURL)
+		}
+	} else if spec.BasePath != "" || spec.Host != "" {
+		base = &url.URL{Scheme: specURL.Scheme, Host: specURL.Host, Path: spec.BasePath}
+		if spec.Host != "" {
+			base.Host = spec.Host
+		}
+	}
+
+	// Operations are sorted by path, for stable output
+	paths := make([]string, 0, len(spec.Paths))
+	for path := range spec.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var results []PageResult
+	for _, path := range paths {
+		item := spec.Paths[path]
+
+		// Parameters can be shared by every operation of a path
+		var shared []openAPIParameter
+		if raw, exists := item["parameters"]; exists {
+			json.Unmarshal(raw, &shared)
+		}
+
+		for _, method := range openAPIMethods {
+			raw, exists := item[method]
+			if !exists {
+				continue
+			}
+			var operation openAPIOperation
+			if err := json.Unmarshal(raw, &operation); err != nil {
+				continue
+			}
+
+			operationMethod := strings.ToUpper(method)
+			var inputs []Input
+			for _, parameter := range append(append([]openAPIParameter{}, shared...), operation.Parameters...) {
+				parameter = spec.resolveParameter(parameter)
+				if parameter.Name == "" {
+					continue
+				}
+				parameterType := parameter.Type
+				if parameter.Schema != nil {
+					if schema := spec.resolveSchema(parameter.Schema, 0); schema != nil && parameterType == "" {
+						parameterType = schema.Type
+					}
+				}
+				// In OpenAPI 2, a body parameter holds the schema of the whole body
+				if parameter.In == "body" && parameter.Schema != nil {
+					inputs = append(inputs, spec.bodyInputs(parameter.Schema, operationMethod)...)
+					continue
+				}
+				inputs = append(inputs, apiInput(EndpointOpenAPI,
+					Attribute{Key: "name", Val: parameter.Name},
+					Attribute{Key: "in", Val: parameter.In},
+					Attribute{Key: "type", Val: parameterType},
+					Attribute{Key: "method", Val: operationMethod},
+					Attribute{Key: "required", Val: requiredValue(parameter.Required)},
+				))
+			}
+			if requestBody := spec.resolveRequestBody(operation.RequestBody); requestBody != nil {
+				for contentType, content := range requestBody.Content {
+					if strings.Contains(contentType, "json") || strings.Contains(contentType, "form") {
+						inputs = append(inputs, spec.bodyInputs(content.Schema, operationMethod)...)
+						break
+					}
+				}
+			}
+
+			if len(inputs) > 0 {
+				results = append(results, PageResult{
+					URL:    strings.TrimSuffix(base.String(), "/") + path,
+					Inputs: inputs,
+				})
+			}
+		}
+	}
+	return results, nil
+}
+
+// Method resolveParameter follows a parameter's $ref, if it has one.
+func (spec *openAPISpec) resolveParameter(parameter openAPIParameter) openAPIParameter {
+	if parameter.Ref == "" {
+		return parameter
+	}
+	name := parameter.Ref[strings.LastIndex(parameter.Ref, "/")+1:]
+	raw, exists := spec.Components.Parameters[name]
+	if !exists {
+		raw = spec.Parameters[name]
+	}
+	var resolved openAPIParameter
+	json.Unmarshal(raw, &resolved)
+	return resolved
+}
+
+// Method resolveRequestBody follows a request body's $ref, if it has one.
+func (spec *openAPISpec) resolveRequestBody(requestBody *openAPIRequestBody) *openAPIRequestBody {
+	if requestBody == nil || requestBody.Ref == "" {
+		return requestBody
+	}
+	name := requestBody.Ref[strings.LastIndex(requestBody.Ref, "/")+1:]
+	var resolved openAPIRequestBody
+	if json.Unmarshal(spec.Components.RequestBodies[name], &resolved) != nil {
+		return nil
+	}
+	return &resolved
+}
+
+// Method resolveSchema follows a schema's $ref, if it has one. References are
+// only followed a few levels deep, to stop reference loops.
+func (spec *openAPISpec) resolveSchema(schema *apiSchema, depth int) *apiSchema {
+	for schema != nil && schema.Ref != "" {
+		if depth > 5 {
+			return nil
+		}
+		depth++
+
+		name := schema.Ref[strings.LastIndex(schema.Ref, "/")+1:]
+		raw, exists := spec.Components.Schemas[name]
+		if !exists {
+			raw = spec.Defs[name]
+		}
+		var resolved apiSchema
+		if json.Unmarshal(raw, &resolved) != nil {
+			return nil
+		}
+		schema = &resolved
+	}
+	return schema
+}
+
+// Method bodyInputs lists the top-level fields of a request body's schema as
+// input fields.
+func (spec *openAPISpec) bodyInputs(schema *apiSchema, method string) (inputs []Input) {
+	schema = spec.resolveSchema(schema, 0)
+	if schema == nil {
+		return nil
+	}
+
+	required := make(map[string]bool)
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var fieldType string
+		if property := spec.resolveSchema(schema.Properties[name], 0); property != nil {
+			fieldType = property.Type
+		}
+		inputs = append(inputs, apiInput(EndpointOpenAPI,
+			Attribute{Key: "name", Val: name},
+			Attribute{Key: "in", Val: "body"},
+			Attribute{Key: "type", Val: fieldType},
+			Attribute{Key: "method", Val: method},
+			Attribute{Key: "required", Val: requiredValue(required[name])},
+		))
+	}
+	return inputs
+}
+
+// Function requiredValue returns the attribute value for a required parameter.
+func requiredValue(required bool) string {
+	if required {
+		return "true"
+	}
+	return ""
+}
+
+// graphQLType is a (possibly wrapped) GraphQL type reference.
+type graphQLType struct {
+	Name   string       `json:"name"`
+	Kind   string       `json:"kind"`
+	OfType *graphQLType `json:"ofType"`
+}
+
+// Method String writes the type as it appears in GraphQL, such as [ID!]!.
+func (t *graphQLType) String() string {
+	if t == nil {
+		return ""
+	}
+	switch t.Kind {
+	case "NON_NULL":
+		return t.OfType.String() + "!"
+	case "LIST":
+		return "[" + t.OfType.String() + "]"
+	default:
+		return t.Name
+	}
+}
+
+// Function parseGraphQL lists the queries and mutations of a GraphQL schema,
+// from the response to an introspection query, with their arguments as
+// input fields. Each operation is reported as a page at the endpoint's URL,
+// with the operation in the fragment.
+func parseGraphQL(data []byte, endpoint *url.URL) ([]PageResult, error) {
+	var response struct {
+		Data *struct {
+			Schema struct {
+				QueryType    *struct{ Name string } `json:"queryType"`
+				MutationType *struct{ Name string } `json:"mutationType"`
+				Types        []struct {
+					Name   string `json:"name"`
+					Fields []struct {
+						Name string `json:"name"`
+						Args []struct {
+							Name string       `json:"name"`
+							Type *graphQLType `json:"type"`
+						} `json:"args"`
+					} `json:"fields"`
+				} `json:"types"`
+			} `json:"__schema"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	if response.Data == nil || response.Data.Schema.QueryType == nil {
+		return nil, fmt.Errorf("no schema in the response; introspection may be disabled")
+	}
+
+	schema := response.Data.Schema
+	operations := map[string]string{schema.QueryType.Name: "query"}
+	if schema.MutationType != nil {
+		operations[schema.MutationType.Name] = "mutation"
+	}
+
+	var results []PageResult
+	for _, graphType := range schema.Types {
+		operation, exists := operations[graphType.Name]
+		if !exists {
+			continue
+		}
+		for _, field := range graphType.Fields {
+			var inputs []Input
+			for _, arg := range field.Args {
+				inputs = append(inputs, apiInput(EndpointGraphQL,
+					Attribute{Key: "name", Val: arg.Name},
+					Attribute{Key: "in", Val: operation},
+					Attribute{Key: "type", Val: arg.Type.String()},
+					Attribute{Key: "method", Val: http.MethodPost},
+					Attribute{Key: "required", Val: requiredValue(arg.Type != nil && arg.Type.Kind == "NON_NULL")},
+				))
+			}
+			if len(inputs) > 0 {
+				operationURL := *endpoint
+				operationURL.Fragment = operation + "." + field.Name
+				results = append(results, PageResult{URL: operationURL.String(), Inputs: inputs})
+			}
+		}
+	}
+	return results, nil
+}
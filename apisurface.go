@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The sources that API endpoints are found from
+const (
+	EndpointOpenAPI    = "openapi"
+	EndpointGraphQL    = "graphql"
+	EndpointJavaScript = "javascript"
+	EndpointHAR        = "har"
+)
+
+// APIEndpoint is an API endpoint found during a crawl, with the parameters
+// it was seen with.
+type APIEndpoint struct {
+	// Method is the HTTP method the endpoint is called with, if it is known
+	Method string `json:"method,omitempty"`
+	// URL is where the endpoint is served, without a query string
+	URL        string   `json:"url"`
+	Parameters []string `json:"parameters,omitempty"`
+	// Sources are how the endpoint was found, such as "javascript"
+	Sources []string `json:"sources"`
+	// FoundIn are the scripts, specs or capture files the endpoint was found in
+	FoundIn []string `json:"found_in,omitempty"`
+}
+
+// APISurfaceReport is the JSON document written by -api-report.
+type APISurfaceReport struct {
+	Endpoints []APIEndpoint `json:"endpoints"`
+}
+
+// APISurface holds the API endpoints found during a crawl, merged by method
+// and URL.
+type APISurface struct {
+	Endpoints map[string]*APIEndpoint
+	mutex     sync.Mutex
+}
+
+// Function addUnique appends the values that are not already in a list.
+func addUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		exists := false
+		for _, existing := range list {
+			if existing == value {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// Method addEndpoint records an API endpoint, merging it with any found
+// before at the same method and URL. It returns true if the endpoint had not
+// been found before.
+func (c *Crawler) addEndpoint(endpoint APIEndpoint) bool {
+	key := endpoint.Method + " " + endpoint.URL
+
+	c.surface.mutex.Lock()
+	defer c.surface.mutex.Unlock()
+	if c.surface.Endpoints == nil {
+		c.surface.Endpoints = make(map[string]*APIEndpoint)
+	}
+	existing, exists := c.surface.Endpoints[key]
+	if !exists {
+		existing = &APIEndpoint{Method: endpoint.Method, URL: endpoint.URL}
+		c.surface.Endpoints[key] = existing
+	}
+	existing.Parameters = addUnique(existing.Parameters, endpoint.Parameters...)
+	existing.Sources = addUnique(existing.Sources, endpoint.Sources...)
+	existing.FoundIn = addUnique(existing.FoundIn, endpoint.FoundIn...)
+	return !exists
+}
+
+// Method AddEndpoints records API endpoints found outside of the crawl, such
+// as in a capture of the browser's network traffic.
+func (c *Crawler) AddEndpoints(endpoints []APIEndpoint) {
+	for _, endpoint := range endpoints {
+		c.addEndpoint(endpoint)
+	}
+}
+
+// Method APISurface returns the API endpoints found, sorted by URL and then
+// method, each with its parameters sorted.
+func (c *Crawler) APISurface() []APIEndpoint {
+	c.surface.mutex.Lock()
+	endpoints := make([]APIEndpoint, 0, len(c.surface.Endpoints))
+	for _, endpoint := range c.surface.Endpoints {
+		copied := *endpoint
+		copied.Parameters = append([]string(nil), endpoint.Parameters...)
+		sort.Strings(copied.Parameters)
+		copied.Sources = append([]string(nil), endpoint.Sources...)
+		copied.FoundIn = append([]string(nil), endpoint.FoundIn...)
+		endpoints = append(endpoints, copied)
+	}
+	c.surface.mutex.Unlock()
+
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].URL != endpoints[j].URL {
+			return endpoints[i].URL < endpoints[j].URL
+		}
+		return endpoints[i].Method < endpoints[j].Method
+	})
+	return endpoints
+}
+
+// Function resultEndpoint turns an operation found in an OpenAPI spec or a
+// GraphQL schema into an endpoint.
+func resultEndpoint(result PageResult) APIEndpoint {
+	endpoint := APIEndpoint{URL: result.URL}
+	if resultURL, err := url.Parse(result.URL); err == nil {
+		resultURL.RawQuery = ""
+		endpoint.URL = resultURL.String()
+	}
+	for _, input := range result.Inputs {
+		if endpoint.Method == "" {
+			endpoint.Method = input.Attr("method")
+		}
+		endpoint.Parameters = addUnique(endpoint.Parameters, input.Attr("name"))
+		endpoint.Sources = addUnique(endpoint.Sources, input.Source)
+	}
+	return endpoint
+}
+
+// Function printAPISurface outputs the API endpoints found to the console.
+func printAPISurface(endpoints []APIEndpoint) {
+	for _, endpoint := range endpoints {
+		method := endpoint.Method
+		if method == "" {
+			method = "*"
+		}
+		fmt.Printf("[API] %s %s (%s)\n", method, endpoint.URL, strings.Join(endpoint.Sources, ", "))
+		if len(endpoint.Parameters) > 0 {
+			fmt.Printf("\tparameters: %s\n", strings.Join(endpoint.Parameters, ", "))
+		}
+		for _, foundIn := range endpoint.FoundIn {
+			fmt.Printf("\tfound in: %s\n", foundIn)
+		}
+	}
+	if len(endpoints) > 0 {
+		fmt.Println()
+	}
+}
+
+// Function writeAPISurface writes the API endpoints found to the file at the
+// given path, as JSON.
+func writeAPISurface(endpoints []APIEndpoint, path string) error {
+	if endpoints == nil {
+		endpoints = []APIEndpoint{}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(APISurfaceReport{Endpoints: endpoints}); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// harLog is a capture of a browser's network traffic, in the HTTP Archive
+// format exported by the developer tools of browsers and by proxies. Only
+// the fields needed to list the API calls are read.
+type harLog struct {
+	Log struct {
+		Entries []struct {
+			// Set by Chrome, as "xhr", "fetch", "document" and so on
+			ResourceType string `json:"_resourceType"`
+			Request      struct {
+				Method      string `json:"method"`
+				URL         string `json:"url"`
+				QueryString []struct {
+					Name string `json:"name"`
+				} `json:"queryString"`
+				PostData *struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+					Params   []struct {
+						Name string `json:"name"`
+					} `json:"params"`
+				} `json:"postData"`
+			} `json:"request"`
+			Response struct {
+				Content struct {
+					MimeType string `json:"mimeType"`
+				} `json:"content"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// Function loadHAR reads the API calls from a HAR capture of a browser's
+// network traffic: the XHR and fetch requests, or, in captures that do not
+// say, the requests with a JSON response. The parameters are those of the
+// query string and the form or JSON body.
+func loadHAR(path string) ([]APIEndpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var capture harLog
+	if err := json.Unmarshal(data, &capture); err != nil {
+		return nil, fmt.Errorf("invalid HAR file: %s", err.Error())
+	}
+
+	var endpoints []APIEndpoint
+	for _, entry := range capture.Log.Entries {
+		switch entry.ResourceType {
+		case "xhr", "fetch":
+		case "":
+			if !strings.Contains(entry.Response.Content.MimeType, "json") {
+				continue
+			}
+		default:
+			continue
+		}
+
+		requestURL, err := url.Parse(entry.Request.URL)
+		if err != nil || (requestURL.Scheme != "http" && requestURL.Scheme != "https") {
+			continue
+		}
+		endpoint := APIEndpoint{Method: strings.ToUpper(entry.Request.Method), Sources: []string{EndpointHAR}, FoundIn: []string{path}}
+		for _, parameter := range entry.Request.QueryString {
+			endpoint.Parameters = addUnique(endpoint.Parameters, parameter.Name)
+		}
+		for name := range requestURL.Query() {
+			endpoint.Parameters = addUnique(endpoint.Parameters, name)
+		}
+		if postData := entry.Request.PostData; postData != nil {
+			for _, parameter := range postData.Params {
+				endpoint.Parameters = addUnique(endpoint.Parameters, parameter.Name)
+			}
+			if strings.Contains(postData.MimeType, "json") {
+				var body map[string]interface{}
+				if json.Unmarshal([]byte(postData.Text), &body) == nil {
+					for name := range body {
+						endpoint.Parameters = addUnique(endpoint.Parameters, name)
+					}
+				}
+			}
+		}
+		requestURL.RawQuery, requestURL.Fragment = "", ""
+		endpoint.URL = requestURL.String()
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints, nil
+}
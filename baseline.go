@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Diff holds the changes between a baseline scan and the current scan.
+type Diff struct {
+	NewPages     []PageResult `json:"new_pages"`
+	RemovedPages []PageResult `json:"removed_pages"`
+	ChangedPages []PageDiff   `json:"changed_pages"`
+}
+
+// PageDiff holds the changes to the input fields of a page found in both
+// scans. Method, Source and AuthProfile tell it apart from the other results
+// for the same URL, as on the page results.
+type PageDiff struct {
+	URL           string        `json:"url"`
+	Method        string        `json:"method,omitempty"`
+	Source        string        `json:"source,omitempty"`
+	AuthProfile   string        `json:"auth_profile,omitempty"`
+	NewInputs     []Input       `json:"new_inputs,omitempty"`
+	RemovedInputs []Input       `json:"removed_inputs,omitempty"`
+	ChangedInputs []InputChange `json:"changed_inputs,omitempty"`
+}
+
+// InputChange is an input field that exists in both scans, but differs.
+type InputChange struct {
+	Before Input `json:"before"`
+	After  Input `json:"after"`
+}
+
+// Method Empty reports whether nothing changed between the scans.
+func (d Diff) Empty() bool {
+	return len(d.NewPages) == 0 && len(d.RemovedPages) == 0 && len(d.ChangedPages) == 0
+}
+
+// Function loadResults reads the page results from a file written with the
+// JSON or JSON Lines output formats, or saved from the scan API.
+func loadResults(path string) ([]PageResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// A report holds all the results, while JSON Lines holds one result per line
+	var pages []PageResult
+	decoder := json.NewDecoder(file)
+	for {
+		var value struct {
+			Results []PageResult `json:"results"`
+			PageResult
+		}
+		if err := decoder.Decode(&value); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read results from %s: %s", path, err.Error())
+		}
+
+		if value.Results != nil {
+			pages = append(pages, value.Results...)
+		} else if value.URL != "" {
+			pages = append(pages, value.PageResult)
+		}
+	}
+
+	return pages, nil
+}
+
+// Function diffResults compares the current results against a baseline.
+// Results are matched by their URL and their identity among the other
+// results for that URL (see resultKey), so that, say, the GET and POST
+// operations of an API path are compared with their own counterparts.
+func diffResults(baseline []PageResult, current []PageResult) (diff Diff) {
+	before := make(map[string]PageResult)
+	for _, page := range baseline {
+		before[resultKey(page)] = page
+	}
+	after := make(map[string]PageResult)
+	for _, page := range current {
+		after[resultKey(page)] = page
+	}
+
+	for key, page := range after {
+		previous, exists := before[key]
+		if !exists {
+			diff.NewPages = append(diff.NewPages, page)
+			continue
+		}
+		if pageDiff := diffInputs(previous, page); pageDiff != nil {
+			diff.ChangedPages = append(diff.ChangedPages, *pageDiff)
+		}
+	}
+	for key, page := range before {
+		if _, exists := after[key]; !exists {
+			diff.RemovedPages = append(diff.RemovedPages, page)
+		}
+	}
+
+	// Keep the output stable between runs
+	sort.Slice(diff.NewPages, func(i, j int) bool { return resultKey(diff.NewPages[i]) < resultKey(diff.NewPages[j]) })
+	sort.Slice(diff.RemovedPages, func(i, j int) bool { return resultKey(diff.RemovedPages[i]) < resultKey(diff.RemovedPages[j]) })
+	sort.Slice(diff.ChangedPages, func(i, j int) bool {
+		a, b := diff.ChangedPages[i], diff.ChangedPages[j]
+		if a.URL != b.URL {
+			return a.URL < b.URL
+		}
+		return strings.Join([]string{a.Method, a.Source, a.AuthProfile}, " ") < strings.Join([]string{b.Method, b.Source, b.AuthProfile}, " ")
+	})
+
+	return
+}
+
+// Function diffInputs compares the input fields of a page found in both scans.
+// It returns nil if the input fields are the same.
+func diffInputs(before PageResult, after PageResult) *PageDiff {
+	pageDiff := PageDiff{URL: after.URL, AuthProfile: after.AuthProfile}
+	pageDiff.Method, pageDiff.Source = resultRequest(after)
+
+	beforeInputs, beforeKeys := keyInputs(before.Inputs)
+	afterInputs, afterKeys := keyInputs(after.Inputs)
+
+	for _, key := range afterKeys {
+		previous, exists := beforeInputs[key]
+		if !exists {
+			pageDiff.NewInputs = append(pageDiff.NewInputs, afterInputs[key])
+		} else if inputChanged(previous, afterInputs[key]) {
+			pageDiff.ChangedInputs = append(pageDiff.ChangedInputs, InputChange{Before: previous, After: afterInputs[key]})
+		}
+	}
+	for _, key := range beforeKeys {
+		if _, exists := afterInputs[key]; !exists {
+			pageDiff.RemovedInputs = append(pageDiff.RemovedInputs, beforeInputs[key])
+		}
+	}
+
+	if len(pageDiff.NewInputs) == 0 && len(pageDiff.RemovedInputs) == 0 && len(pageDiff.ChangedInputs) == 0 {
+		return nil
+	}
+	return &pageDiff
+}
+
+// Function inputChanged reports whether an input field found in both scans
+// differs: its markup, where and how its form is submitted, or how many times
+// it is repeated on the page.
+func inputChanged(before Input, after Input) bool {
+	return before.HTML != after.HTML || before.Action != after.Action || !strings.EqualFold(before.Method, after.Method) || repeats(before) != repeats(after)
+}
+
+// Function repeats returns how many times an input field is repeated exactly
+// on its page; results written before repeats were counted have no count.
+func repeats(input Input) int {
+	if input.Count == 0 {
+		return 1
+	}
+	return input.Count
+}
+
+// Function diffInputLine describes an input field in the console's list of
+// changes: its markup, where its form is submitted, and how many times it is
+// repeated.
+func diffInputLine(input Input) string {
+	line := input.HTML
+	if input.Action != "" {
+		line += fmt.Sprintf(" (%s %s)", strings.ToUpper(input.Method), input.Action)
+	}
+	if repeats(input) > 1 {
+		line += fmt.Sprintf(" (x%d)", input.Count)
+	}
+	return line
+}
+
+// Function diffPageLabel describes a page in the console's list of changes:
+// its URL, and what tells it apart from the other results for that URL.
+func diffPageLabel(page PageResult) string {
+	method, source := resultRequest(page)
+	return diffLabel(page.URL, method, source, page.AuthProfile)
+}
+
+// Function diffLabel describes a page by its URL, how it was found and its
+// auth profile.
+func diffLabel(url string, method string, source string, authProfile string) string {
+	var details []string
+	if method != "" {
+		details = append(details, method)
+	}
+	if source != "" {
+		details = append(details, source)
+	}
+	if authProfile != "" {
+		details = append(details, "auth profile: "+authProfile)
+	}
+	if len(details) == 0 {
+		return "[" + url + "]"
+	}
+	return fmt.Sprintf("[%s] (%s)", url, strings.Join(details, ", "))
+}
+
+// Function keyInputs identifies each input field by its name (or id), so that
+// an input field whose other attributes change is reported as changed rather
+// than as removed and added. Input fields sharing a name, such as radio
+// buttons, are told apart by the order they appear in.
+func keyInputs(inputs []Input) (byKey map[string]Input, keys []string) {
+	byKey = make(map[string]Input)
+	seen := make(map[string]int)
+
+	for _, input := range inputs {
+		identity := "html:" + input.HTML
+		if name := input.Attr("name"); name != "" {
+			identity = "name:" + name
+		} else if id := input.Attr("id"); id != "" {
+			identity = "id:" + id
+		}
+
+		key := identity + "#" + strconv.Itoa(seen[identity])
+		seen[identity]++
+
+		byKey[key] = input
+		keys = append(keys, key)
+	}
+	return
+}
+
+// Function printDiff outputs the changes since the baseline to the console.
+func printDiff(diff Diff, baselinePath string) {
+	if diff.Empty() {
+		fmt.Printf("[BASELINE] No changes since %s\n\n", baselinePath)
+		return
+	}
+
+	fmt.Printf("[BASELINE] Changes since %s: %d new, %d removed, %d changed page(s)\n\n",
+		baselinePath, len(diff.NewPages), len(diff.RemovedPages), len(diff.ChangedPages))
+
+	for _, page := range diff.NewPages {
+		fmt.Printf("[NEW] %s\n", diffPageLabel(page))
+		for _, input := range page.Inputs {
+			fmt.Printf("\t+ %s\n", diffInputLine(input))
+		}
+		fmt.Println()
+	}
+	for _, page := range diff.RemovedPages {
+		fmt.Printf("[REMOVED] %s\n", diffPageLabel(page))
+		for _, input := range page.Inputs {
+			fmt.Printf("\t- %s\n", diffInputLine(input))
+		}
+		fmt.Println()
+	}
+	for _, page := range diff.ChangedPages {
+		fmt.Printf("[CHANGED] %s\n", diffLabel(page.URL, page.Method, page.Source, page.AuthProfile))
+		for _, input := range page.NewInputs {
+			fmt.Printf("\t+ %s\n", diffInputLine(input))
+		}
+		for _, input := range page.RemovedInputs {
+			fmt.Printf("\t- %s\n", diffInputLine(input))
+		}
+		for _, change := range page.ChangedInputs {
+			fmt.Printf("\t~ %s\n\t  => %s\n", diffInputLine(change.Before), diffInputLine(change.After))
+		}
+		fmt.Println()
+	}
+}
+
+// Function writeDiff writes the changes since the baseline to a JSON file.
+func writeDiff(diff Diff, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(diff); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
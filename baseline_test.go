@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestDiffResultsKeepsResultsForTheSameURLApart(t *testing.T) {
+	operation := func(method string, name string) PageResult {
+		return PageResult{URL: "https://api.example.com/users", Inputs: []Input{{
+			HTML:       `<input name="` + name + `">`,
+			Source:     EndpointOpenAPI,
+			Attributes: []Attribute{{Key: "name", Val: name}, {Key: "method", Val: method}},
+		}}}
+	}
+	page := func(authProfile string, action string, count int) PageResult {
+		return PageResult{URL: "https://www.example.com/account", AuthProfile: authProfile, Inputs: []Input{{
+			HTML:       `<input name="email">`,
+			Attributes: []Attribute{{Key: "name", Val: "email"}},
+			Action:     action,
+			Method:     "post",
+			Count:      count,
+		}}}
+	}
+
+	baseline := []PageResult{
+		operation("get", "id"),
+		operation("post", "name"),
+		page("", "https://www.example.com/account", 0),
+		page("admin", "https://www.example.com/account", 0),
+	}
+	current := []PageResult{
+		operation("get", "id"),
+		operation("post", "name"),
+		page("", "https://www.example.com/account", 0),
+		page("admin", "https://www.example.com/account/save", 2),
+	}
+
+	diff := diffResults(baseline, current)
+	if len(diff.NewPages) != 0 || len(diff.RemovedPages) != 0 {
+		t.Errorf("results for the same URL were reported as new or removed: %+v", diff)
+	}
+	if len(diff.ChangedPages) != 1 {
+		t.Fatalf("got %d changed page(s), expected only the page of the admin auth profile: %+v", len(diff.ChangedPages), diff.ChangedPages)
+	}
+	changed := diff.ChangedPages[0]
+	if changed.AuthProfile != "admin" || len(changed.ChangedInputs) != 1 {
+		t.Errorf("got %+v, expected the changed action and count of the admin page's input field", changed)
+	}
+
+	diff = diffResults(baseline, current[1:])
+	if len(diff.RemovedPages) != 1 || diff.RemovedPages[0].Inputs[0].Attr("method") != "get" {
+		t.Errorf("got removed pages %+v, expected only the GET operation", diff.RemovedPages)
+	}
+}
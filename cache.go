@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ResponseCache is an HTTP transport that keeps the responses fetched in a
+// directory, so that a repeat scan of the same site can reuse them. Cached
+// responses are revalidated with a conditional request (If-None-Match or
+// If-Modified-Since), and only downloaded again if they changed; responses
+// cached less than TTL ago are reused without asking the server at all.
+// Only successful GET responses that are read to the end are cached, and not
+// those marked Cache-Control: no-store. The cache holds pages fetched with a
+// session, so its files can only be read by their owner, and the cookies a
+// response sets are never stored or replayed.
+type ResponseCache struct {
+	Dir string
+	TTL time.Duration
+	// The transport that sends the requests
+	Next http.RoundTripper
+	// Whether to ignore session ID and tracking parameters in the cache key
+	StripSessionParams bool
+
+	// The number of responses served from the cache
+	hits int64
+}
+
+// cacheEntry is the metadata stored for a cached response, alongside its body.
+type cacheEntry struct {
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Stored time.Time   `json:"stored"`
+}
+
+// The request headers that change the response, as well as the URL; pages
+// requested with different auth profiles are cached separately
+var cacheVaryHeaders = []string{"Authorization", "Cookie"}
+
+// Function noStore checks whether a response is marked Cache-Control:
+// no-store, and must not be cached.
+func noStore(header http.Header) bool {
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Function storedHeader returns the headers of a response to cache, without
+// the cookies it sets, which only the response itself should set.
+func storedHeader(header http.Header) http.Header {
+	stored := header.Clone()
+	stored.Del("Set-Cookie")
+	return stored
+}
+
+// Method path returns the path of the files a request is cached in, without
+// their extension.
+func (c *ResponseCache) path(request *http.Request) string {
+	key := canonicalURL(request.URL, c.StripSessionParams)
+	for _, header := range cacheVaryHeaders {
+		key += "\n" + request.Header.Get(header)
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(key)))
+	return filepath.Join(c.Dir, hash[:2], hash)
+}
+
+// Method load returns the cached response for a request, if there is one.
+func (c *ResponseCache) load(path string) (*cacheEntry, bool) {
+	data, err := ioutil.ReadFile(path + ".json")
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	if _, err := os.Stat(path + ".body"); err != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// Method save writes the metadata of a cached response.
+func (c *ResponseCache) save(path string, entry *cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	temporary := path + ".json.tmp"
+	if err := ioutil.WriteFile(temporary, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temporary, path+".json")
+}
+
+// Method RoundTrip sends a request, using the cache where it can.
+func (c *ResponseCache) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Method != http.MethodGet {
+		return c.Next.RoundTrip(request)
+	}
+
+	path := c.path(request)
+	entry, cached := c.load(path)
+	if cached && c.TTL > 0 && time.Since(entry.Stored) < c.TTL {
+		return c.respond(request, path, entry, nil, false)
+	}
+
+	// Ask the server whether the cached response is still current
+	if cached {
+		request = request.Clone(request.Context())
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			request.Header.Set("If-None-Match", etag)
+		}
+		if modified := entry.Header.Get("Last-Modified"); modified != "" {
+			request.Header.Set("If-Modified-Since", modified)
+		}
+	}
+
+	response, err := c.Next.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached && response.StatusCode == http.StatusNotModified {
+		response.Body.Close()
+
+		// Keep any updated validators the server sent with its answer
+		for _, header := range []string{"ETag", "Last-Modified", "Cache-Control", "Expires", "Date"} {
+			if value := response.Header.Get(header); value != "" {
+				entry.Header.Set(header, value)
+			}
+		}
+		// A response that must no longer be stored is served this once, and
+		// then dropped from the cache
+		if noStore(response.Header) {
+			os.Remove(path + ".json")
+			return c.respond(request, path, entry, response.Header, true)
+		}
+		entry.Stored = time.Now()
+		if err := c.save(path, entry); err != nil {
+			logger.Warnf("[cache] [%s] %s", request.URL.String(), err.Error())
+		}
+		return c.respond(request, path, entry, response.Header, false)
+	}
+
+	if response.StatusCode != http.StatusOK || noStore(response.Header) {
+		return response, nil
+	}
+
+	// Save the response as it is read
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		logger.Warnf("[cache] [%s] %s", request.URL.String(), err.Error())
+		return response, nil
+	}
+	file, err := ioutil.TempFile(filepath.Dir(path), ".body-")
+	if err != nil {
+		logger.Warnf("[cache] [%s] %s", request.URL.String(), err.Error())
+		return response, nil
+	}
+	response.Body = &cachingBody{
+		body:  response.Body,
+		file:  file,
+		cache: c,
+		path:  path,
+		entry: cacheEntry{
+			URL:    request.URL.String(),
+			Status: response.StatusCode,
+			Header: storedHeader(response.Header),
+			Stored: time.Now(),
+		},
+	}
+	return response, nil
+}
+
+// Method respond builds a response from the cache. The cookies of the
+// server's answer to a conditional request, if there was one, are set again;
+// the ones stored by earlier versions are not. With forget, the cached body
+// is removed once the response is closed.
+func (c *ResponseCache) respond(request *http.Request, path string, entry *cacheEntry, answer http.Header, forget bool) (*http.Response, error) {
+	body, err := os.Open(path + ".body")
+	if err != nil {
+		return nil, err
+	}
+	info, err := body.Stat()
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	atomic.AddInt64(&c.hits, 1)
+
+	header := storedHeader(entry.Header)
+	for _, cookie := range answer.Values("Set-Cookie") {
+		header.Add("Set-Cookie", cookie)
+	}
+	header.Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	var closer io.Closer = body
+	if forget {
+		closer = forgettingFile{body}
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", entry.Status, http.StatusText(entry.Status)),
+		StatusCode: entry.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Body: struct {
+			io.Reader
+			io.Closer
+		}{bufio.NewReader(body), closer},
+		ContentLength: info.Size(),
+		Request:       request,
+	}, nil
+}
+
+// Method Hits returns the number of responses served from the cache. A nil
+// cache has served none.
+func (c *ResponseCache) Hits() int64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&c.hits)
+}
+
+// forgettingFile is a cached body that is removed from the cache once it has
+// been closed.
+type forgettingFile struct {
+	file *os.File
+}
+
+// Method Close closes the file, and removes it.
+func (f forgettingFile) Close() error {
+	err := f.file.Close()
+	os.Remove(f.file.Name())
+	return err
+}
+
+// cachingBody copies a response body to the cache as it is read. The copy is
+// only kept if the whole body was read, so that responses cut short (such as
+// those over the body size limit) are not cached.
+type cachingBody struct {
+	body     io.ReadCloser
+	file     *os.File
+	cache    *ResponseCache
+	path     string
+	entry    cacheEntry
+	complete bool
+	failed   bool
+}
+
+// Method Read reads from the response body, copying it to the cache.
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 && !b.failed {
+		if _, writeErr := b.file.Write(p[:n]); writeErr != nil {
+			b.failed = true
+		}
+	}
+	if err == io.EOF {
+		b.complete = true
+	}
+	return n, err
+}
+
+// Method Close closes the response body, keeping the cached copy if it is complete.
+func (b *cachingBody) Close() error {
+	err := b.body.Close()
+	b.file.Close()
+
+	if !b.complete || b.failed {
+		os.Remove(b.file.Name())
+		return err
+	}
+	if renameErr := os.Rename(b.file.Name(), b.path+".body"); renameErr != nil {
+		os.Remove(b.file.Name())
+		logger.Warnf("[cache] [%s] %s", b.entry.URL, renameErr.Error())
+		return err
+	}
+	if saveErr := b.cache.save(b.path, &b.entry); saveErr != nil {
+		logger.Warnf("[cache] [%s] %s", b.entry.URL, saveErr.Error())
+	}
+	return err
+}
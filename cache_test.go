@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cookieTransport answers every request with a page that sets a session
+// cookie, with the given extra headers, and counts the requests sent.
+type cookieTransport struct {
+	header   http.Header
+	requests int
+}
+
+// Method RoundTrip answers the request.
+func (t *cookieTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	t.requests++
+	header := t.header.Clone()
+	header.Set("Content-Type", "text/html")
+	header.Set("Set-Cookie", "session=fresh")
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader("<input name=q>")),
+		Request:    request,
+	}, nil
+}
+
+// Function fetchCached sends a GET request through the cache, and reads the
+// response to the end.
+func fetchCached(t *testing.T, cache *ResponseCache) *http.Response {
+	request, _ := http.NewRequest(http.MethodGet, "http://example.com/search", nil)
+	response, err := cache.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(response.Body); err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	return response
+}
+
+func TestResponseCacheStoresNoCookies(t *testing.T) {
+	next := &cookieTransport{header: http.Header{"Etag": {`"v1"`}}}
+	cache := &ResponseCache{Dir: t.TempDir(), TTL: time.Hour, Next: next}
+
+	fetchCached(t, cache)
+	response := fetchCached(t, cache)
+	if next.requests != 1 {
+		t.Fatalf("sent %d requests, want 1", next.requests)
+	}
+	if cookie := response.Header.Get("Set-Cookie"); cookie != "" {
+		t.Errorf("cached response sets the cookie %q", cookie)
+	}
+
+	err := filepath.Walk(cache.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == cache.Dir {
+			return err
+		}
+		if info.IsDir() {
+			if info.Mode().Perm() != 0700 {
+				t.Errorf("%s has mode %v, want 0700", path, info.Mode().Perm())
+			}
+			return nil
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("%s has mode %v, want 0600", path, info.Mode().Perm())
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(data), "session=fresh") {
+			t.Errorf("%s holds the session cookie", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResponseCacheSkipsNoStore(t *testing.T) {
+	next := &cookieTransport{header: http.Header{"Cache-Control": {"private, no-store"}}}
+	cache := &ResponseCache{Dir: t.TempDir(), TTL: time.Hour, Next: next}
+
+	fetchCached(t, cache)
+	response := fetchCached(t, cache)
+	if next.requests != 2 {
+		t.Errorf("sent %d requests, want 2", next.requests)
+	}
+	if cookie := response.Header.Get("Set-Cookie"); cookie != "session=fresh" {
+		t.Errorf("response sets the cookie %q, want the server's", cookie)
+	}
+	files, err := ioutil.ReadDir(cache.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("cache holds %d entries, want none", len(files))
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Query parameters that hold a session ID or only track where a visitor came
+// from, and so never change the page served. Names are in lower case.
+var sessionParams = map[string]bool{
+	"jsessionid":        true,
+	"phpsessid":         true,
+	"aspsessionid":      true,
+	"asp.net_sessionid": true,
+	"cfid":              true,
+	"cftoken":           true,
+	"sid":               true,
+	"sessionid":         true,
+	"session_id":        true,
+	"gclid":             true,
+	"fbclid":            true,
+	"msclkid":           true,
+	"mc_cid":            true,
+	"mc_eid":            true,
+	"_ga":               true,
+}
+
+// Prefixes of query parameter names that are treated as session parameters
+var sessionParamPrefixes = []string{"utm_"}
+
+// Function canonicalHost returns the host of a URL in lower case, without the
+// port if it is the default port for the scheme.
+func canonicalHost(urlValue *url.URL) string {
+	scheme := strings.ToLower(urlValue.Scheme)
+	host := strings.ToLower(urlValue.Host)
+
+	if hostname, port, err := net.SplitHostPort(host); err == nil {
+		if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+			if strings.Contains(hostname, ":") {
+				// IPv6 addresses keep their brackets
+				return "[" + hostname + "]"
+			}
+			return hostname
+		}
+	}
+	return host
+}
+
+// Function canonicalURL returns the form of a URL used to tell whether it
+// has already been visited, so that trivially different URLs for the same
+// page are only crawled once. The scheme and host are lower-cased, default
+// ports are removed, dot segments in the path are resolved, a trailing slash
+// is ignored, and the query parameters are sorted. If stripSession is true,
+// session ID and tracking parameters are removed too.
+func canonicalURL(urlValue *url.URL, stripSession bool) string {
+	canonical := url.URL{
+		Scheme: strings.ToLower(urlValue.Scheme),
+		Host:   canonicalHost(urlValue),
+		Opaque: urlValue.Opaque,
+		User:   urlValue.User,
+	}
+
+	// Resolve the path, keeping it escaped as it was given
+	escapedPath := urlValue.EscapedPath()
+	if stripSession {
+		// Remove path parameters such as ";jsessionid=..."
+		if index := strings.Index(strings.ToLower(escapedPath), ";jsessionid="); index >= 0 {
+			escapedPath = escapedPath[:index]
+		}
+	}
+	if escapedPath == "" {
+		escapedPath = "/"
+	}
+	escapedPath = path.Clean(escapedPath)
+	canonical.RawPath = escapedPath
+	if unescaped, err := url.PathUnescape(escapedPath); err == nil {
+		canonical.Path = unescaped
+	}
+
+	// Sort the query parameters, keeping the order of repeated values
+	values := urlValue.Query()
+	if stripSession {
+		for key := range values {
+			if isSessionParam(key) {
+				delete(values, key)
+			}
+		}
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var query []string
+	for _, key := range keys {
+		for _, value := range values[key] {
+			query = append(query, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+	canonical.RawQuery = strings.Join(query, "&")
+
+	return canonical.String()
+}
+
+// Function isSessionParam checks whether a query parameter holds a session ID
+// or tracking value.
+func isSessionParam(name string) bool {
+	name = strings.ToLower(name)
+	if sessionParams[name] {
+		return true
+	}
+	for _, prefix := range sessionParamPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
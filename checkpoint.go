@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The format and version of frontier files. The version is only raised for
+// changes that older versions cannot read; new record types and fields are
+// skipped by versions that do not know them.
+const (
+	frontierFormat  = "input-field-finder/frontier"
+	frontierVersion = 1
+)
+
+// The types of records in a frontier file
+const (
+	// The first line: the format and version of the file
+	frontierHeader = "header"
+	// An origin on the whitelist
+	frontierScope = "scope"
+	// A URL that has been queued or searched
+	frontierVisited = "visited"
+	// A URL waiting to be searched
+	frontierPending = "pending"
+)
+
+// frontierRecord is a line of a frontier file. Which fields are set depends
+// on the type of the record.
+type frontierRecord struct {
+	Type string `json:"type"`
+
+	// Header records
+	Format  string     `json:"format,omitempty"`
+	Version int        `json:"version,omitempty"`
+	Created *time.Time `json:"created,omitempty"`
+
+	// Scope records
+	Origin string `json:"origin,omitempty"`
+
+	// Visited and pending records
+	URL string `json:"url,omitempty"`
+
+	// Visited records: the method of a seed requested with a method other
+	// than GET; the URL requested with GET is counted as visited separately
+	Method string `json:"method,omitempty"`
+
+	// Pending records
+	Depth      int    `json:"depth,omitempty"`
+	SeedURL    string `json:"seed_url,omitempty"`
+	Seed       *Seed  `json:"seed,omitempty"`
+	FragmentOf string `json:"fragment_of,omitempty"`
+}
+
+// Checkpoint is the state of a crawl read from a frontier file, to pick the
+// crawl up where it left off.
+type Checkpoint struct {
+	Origins []*url.URL
+	Visited []string
+	Pending []Task
+}
+
+// Method ExportFrontier writes the state of the crawl to w, as JSON lines: a
+// header, the whitelisted origins, the URLs that have been visited, and the
+// URLs still waiting to be searched, with the seed each was found from. It is
+// meant for a crawl that was stopped before it finished, so that another
+// instance can carry on with ImportFrontier.
+func (c *Crawler) ExportFrontier(w io.Writer) error {
+	frontier, ok := c.frontier.(*Frontier)
+	if !ok {
+		return errors.New("the frontier of a shared crawl is kept in Redis, and cannot be exported")
+	}
+	pending := frontier.Tasks()
+
+	writer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+
+	created := time.Now().UTC()
+	if err := encoder.Encode(frontierRecord{Type: frontierHeader, Format: frontierFormat, Version: frontierVersion, Created: &created}); err != nil {
+		return err
+	}
+
+	// Only the targets of a single origin can be written down; the others
+	// come from the targets the crawl carrying on is configured with
+	origins := make(map[string]bool)
+	for _, pattern := range c.scopePatterns() {
+		if pattern.origin() != "" {
+			origins[pattern.origin()] = true
+		}
+	}
+	for _, targetOrigin := range sortedKeys(origins) {
+		if err := encoder.Encode(frontierRecord{Type: frontierScope, Origin: targetOrigin}); err != nil {
+			return err
+		}
+	}
+
+	// Pending URLs are counted as visited as soon as they are queued; leave
+	// them out of the visited URLs, so that removing a pending line from the
+	// file drops the URL, rather than leaving it visited but never searched
+	pendingKeys := make(map[string]bool)
+	for _, task := range pending {
+		pendingKeys[c.visitedKey(task)] = true
+	}
+	visited := c.visited.Keys()
+	sort.Strings(visited)
+	for _, key := range visited {
+		if pendingKeys[key] {
+			continue
+		}
+		method, urlString := splitVisitedKey(key)
+		if err := encoder.Encode(frontierRecord{Type: frontierVisited, URL: urlString, Method: method}); err != nil {
+			return err
+		}
+	}
+
+	for _, task := range pending {
+		seed := *task.Seed
+		if err := encoder.Encode(frontierRecord{
+			Type:       frontierPending,
+			URL:        task.URL.String(),
+			Depth:      task.Depth,
+			SeedURL:    task.Seed.URL.String(),
+			Seed:       &seed,
+			FragmentOf: task.FragmentOf,
+		}); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// Function sortedKeys returns the keys of a set, in order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Function writeFrontier writes the state of a crawl to the file at the
+// given path (see ExportFrontier).
+func writeFrontier(path string, crawler *Crawler) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := crawler.ExportFrontier(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Function loadFrontier reads the state of a crawl from the frontier file at
+// the given path. Lines that are blank are skipped, as are records of types
+// added by later versions, with a warning.
+func loadFrontier(path string) (*Checkpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	checkpoint := &Checkpoint{}
+	seeds := make(map[string]*Seed)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	headerSeen := false
+	for number := 1; scanner.Scan(); number++ {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var record frontierRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, number, err.Error())
+		}
+
+		if !headerSeen {
+			if record.Type != frontierHeader || record.Format != frontierFormat {
+				return nil, fmt.Errorf("%s:%d: not a frontier file; expected a %q header", path, number, frontierFormat)
+			}
+			if record.Version > frontierVersion {
+				return nil, fmt.Errorf("%s: frontier file version %d is newer than this version of the program supports (%d)", path, record.Version, frontierVersion)
+			}
+			headerSeen = true
+			continue
+		}
+
+		switch record.Type {
+		case frontierScope:
+			originURL, err := url.Parse(record.Origin)
+			if err != nil || originURL.Scheme == "" || originURL.Host == "" {
+				return nil, fmt.Errorf("%s:%d: invalid origin %q", path, number, record.Origin)
+			}
+			checkpoint.Origins = append(checkpoint.Origins, originURL)
+		case frontierVisited:
+			if record.URL == "" {
+				return nil, fmt.Errorf("%s:%d: visited record without a url", path, number)
+			}
+			key := record.URL
+			if method := strings.ToUpper(record.Method); method != "" && method != http.MethodGet {
+				key = method + " " + key
+			}
+			checkpoint.Visited = append(checkpoint.Visited, key)
+		case frontierPending:
+			taskURL, err := url.Parse(record.URL)
+			if err != nil || taskURL.Scheme == "" || taskURL.Host == "" {
+				return nil, fmt.Errorf("%s:%d: invalid url %q", path, number, record.URL)
+			}
+			seedURL := record.SeedURL
+			if seedURL == "" {
+				seedURL = taskURL.String()
+			}
+			seed, exists := seeds[seedURL]
+			if !exists {
+				// Tasks without a seed, such as those added by hand, have no
+				// depth limit
+				seed = &Seed{MaxDepth: -1}
+				if record.Seed != nil {
+					*seed = *record.Seed
+				}
+				if seed.URL, err = url.Parse(seedURL); err != nil {
+					return nil, fmt.Errorf("%s:%d: invalid seed_url %q", path, number, seedURL)
+				}
+				seeds[seedURL] = seed
+			}
+			checkpoint.Pending = append(checkpoint.Pending, Task{
+				URL:        taskURL,
+				Depth:      record.Depth,
+				Seed:       seed,
+				FragmentOf: record.FragmentOf,
+			})
+		default:
+			logger.Warnf("[%s:%d] Skipping a record of unknown type %q", path, number, record.Type)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !headerSeen {
+		return nil, fmt.Errorf("%s: empty frontier file", path)
+	}
+	return checkpoint, nil
+}
+
+// Method ImportFrontier sets the crawl up to carry on from a checkpoint,
+// once it starts: the checkpoint's origins are whitelisted, its visited URLs
+// are not visited again, and its pending URLs are queued up, along with any
+// seeds the crawler was given that were not visited yet.
+func (c *Crawler) ImportFrontier(checkpoint *Checkpoint) {
+	c.checkpoint = checkpoint
+}
+
+// Method restoreCheckpoint applies the imported checkpoint, if any, before
+// the seeds are queued.
+func (c *Crawler) restoreCheckpoint() {
+	if c.checkpoint == nil {
+		return
+	}
+
+	for _, originURL := range c.checkpoint.Origins {
+		c.scope.addOrigin(originURL)
+	}
+	for _, key := range c.checkpoint.Visited {
+		c.visited.Add(key)
+	}
+	c.log.Infof("Resuming a crawl with %d visited and %d pending URL(s)", len(c.checkpoint.Visited), len(c.checkpoint.Pending))
+}
+
+// Method queueCheckpoint queues up the pending URLs of the imported
+// checkpoint, if any.
+func (c *Crawler) queueCheckpoint() {
+	if c.checkpoint == nil {
+		return
+	}
+	for _, task := range c.checkpoint.Pending {
+		// Tasks from seeds the crawler was also given use the crawler's seed,
+		// and so its current directives
+		if seed := c.findSeed(task.Seed.URL.String()); seed != nil {
+			task.Seed = seed
+		}
+		c.addTask(task)
+	}
+}
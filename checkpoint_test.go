@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFrontierRoundTripKeepsQueuedPostSeed(t *testing.T) {
+	loginURL, _ := url.Parse("http://www.example.com/login")
+	postSeed := newSeed(loginURL)
+	postSeed.Method, postSeed.Body = http.MethodPost, "user=admin"
+	homeURL, _ := url.Parse("http://www.example.com/")
+	getSeed := newSeed(homeURL)
+
+	options := DefaultOptions()
+	exporter := NewCrawler([]Seed{postSeed, getSeed}, options)
+	exporter.scope.addOrigin(loginURL)
+	for i := range exporter.seeds {
+		exporter.addURL(exporter.seeds[i].URL, 0, &exporter.seeds[i])
+	}
+
+	path := filepath.Join(t.TempDir(), "frontier.jsonl")
+	if err := writeFrontier(path, exporter); err != nil {
+		t.Fatalf("writeFrontier: %s", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"type":"visited"`) {
+		t.Errorf("queued URLs were exported as visited:\n%s", data)
+	}
+
+	checkpoint, err := loadFrontier(path)
+	if err != nil {
+		t.Fatalf("loadFrontier: %s", err)
+	}
+	importer := NewCrawler(nil, options)
+	importer.ImportFrontier(checkpoint)
+	importer.restoreCheckpoint()
+	importer.queueCheckpoint()
+
+	queued := make(map[string]Task)
+	for _, task := range importer.frontier.(*Frontier).Tasks() {
+		queued[task.URL.String()] = task
+	}
+	task, exists := queued[loginURL.String()]
+	if !exists {
+		t.Fatalf("the POST seed was not queued again after the import; queued: %v", queued)
+	}
+	if !task.isSeedRequest() || task.Seed.Method != http.MethodPost || task.Seed.Body != "user=admin" {
+		t.Errorf("the POST seed lost its method or body: %+v", *task.Seed)
+	}
+	if _, exists := queued[homeURL.String()]; !exists {
+		t.Errorf("the GET seed was not queued again after the import")
+	}
+}
+
+func TestFrontierVisitedRecordsKeepTheMethodApart(t *testing.T) {
+	loginURL, _ := url.Parse("http://www.example.com/login")
+	crawler := NewCrawler(nil, DefaultOptions())
+	crawler.visited.Add("POST " + canonicalURL(loginURL, false))
+	crawler.visited.Add(canonicalURL(loginURL, false))
+
+	path := filepath.Join(t.TempDir(), "frontier.jsonl")
+	if err := writeFrontier(path, crawler); err != nil {
+		t.Fatalf("writeFrontier: %s", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range []string{`{"type":"visited","url":"http://www.example.com/login"}`, `{"type":"visited","url":"http://www.example.com/login","method":"POST"}`} {
+		if !strings.Contains(string(data), record+"\n") {
+			t.Errorf("the frontier does not contain %s:\n%s", record, data)
+		}
+	}
+
+	checkpoint, err := loadFrontier(path)
+	if err != nil {
+		t.Fatalf("loadFrontier: %s", err)
+	}
+	sort.Strings(checkpoint.Visited)
+	expected := []string{"POST http://www.example.com/login", "http://www.example.com/login"}
+	if !reflect.DeepEqual(checkpoint.Visited, expected) {
+		t.Errorf("got the visited keys %q, expected %q", checkpoint.Visited, expected)
+	}
+}
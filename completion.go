@@ -0,0 +1,224 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// The subcommands, with their descriptions, for completion
+var subcommands = [][2]string{
+	{"help", "Show help on a topic"},
+	{"completion", "Print a shell completion script"},
+	{"export", "Regenerate an output file from saved results"},
+}
+
+// The shells that completion scripts can be generated for
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// Characters that cannot be part of a shell function name
+var notFunctionName = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Function runCompletion runs the `completion` subcommand, printing the
+// completion script for the shell given. It returns the exit status.
+func runCompletion(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s completion %s\n", os.Args[0], strings.Join(completionShells, "|"))
+		return 1
+	}
+
+	command := filepath.Base(os.Args[0])
+	switch args[0] {
+	case "bash":
+		writeBashCompletion(os.Stdout, command)
+	case "zsh":
+		writeZshCompletion(os.Stdout, command)
+	case "fish":
+		writeFishCompletion(os.Stdout, command)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown shell: %s (expected %s)\n", args[0], strings.Join(completionShells, ", "))
+		return 1
+	}
+	return 0
+}
+
+// Function topicNames returns the names of the help topics.
+func topicNames() []string {
+	var names []string
+	for _, topic := range helpTopics {
+		names = append(names, topic.Name)
+	}
+	return names
+}
+
+// Function flagSummary returns the first sentence of a flag's usage, for the
+// shells that show a description next to each flag.
+func flagSummary(f *flag.Flag) string {
+	_, usage := flag.UnquoteUsage(f)
+	for start := 0; ; {
+		end := strings.Index(usage[start:], ". ")
+		if end < 0 {
+			break
+		}
+		end += start
+		// Abbreviations such as "e.g." do not end the sentence
+		if !strings.HasSuffix(usage[:end], "e.g") && !strings.HasSuffix(usage[:end], "i.e") {
+			usage = usage[:end]
+			break
+		}
+		start = end + 2
+	}
+	return strings.TrimSuffix(usage, ".")
+}
+
+// Function writeBashCompletion writes the bash completion script, to be
+// loaded with `source <(input-field-finder completion bash)`.
+func writeBashCompletion(w io.Writer, command string) {
+	function := "_" + notFunctionName.ReplaceAllString(command, "_")
+
+	var flagNames, fileFlags, valueFlags []string
+	valueCases := ""
+	flag.VisitAll(func(f *flag.Flag) {
+		name := "-" + f.Name
+		flagNames = append(flagNames, name)
+		info := flagInfo[f.Name]
+		switch {
+		case len(info.Values) > 0:
+			valueCases += fmt.Sprintf("\t%s)\n\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n\t\treturn\n\t\t;;\n", name, strings.Join(info.Values, " "))
+		case info.File:
+			fileFlags = append(fileFlags, name)
+		case !isBoolFlag(f):
+			valueFlags = append(valueFlags, name)
+		}
+	})
+
+	fmt.Fprintf(w, "# bash completion for %s\n", command)
+	fmt.Fprintf(w, "%s() {\n", function)
+	fmt.Fprint(w, "\tlocal cur prev option\n")
+	fmt.Fprint(w, "\tcur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	fmt.Fprint(w, "\tprev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n\n")
+
+	// Subcommands come first, before any flags
+	var names []string
+	for _, subcommand := range subcommands {
+		names = append(names, subcommand[0])
+	}
+	fmt.Fprint(w, "\tif [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then\n")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n\t\treturn\n\tfi\n", strings.Join(names, " "))
+	fmt.Fprint(w, "\tcase \"${COMP_WORDS[1]}\" in\n")
+	fmt.Fprintf(w, "\thelp)\n\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n\t\treturn\n\t\t;;\n", strings.Join(topicNames(), " "))
+	fmt.Fprintf(w, "\tcompletion)\n\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n\t\treturn\n\t\t;;\n", strings.Join(completionShells, " "))
+	fmt.Fprint(w, "\tesac\n\n")
+
+	// Complete the value of the flag before the cursor, given as either
+	// `-flag value` or `-flag=value` (which bash splits at the =)
+	fmt.Fprint(w, "\toption=\"$prev\"\n")
+	fmt.Fprint(w, "\tif [[ $cur == \"=\" ]]; then\n\t\tcur=\"\"\n")
+	fmt.Fprint(w, "\telif [[ $prev == \"=\" ]]; then\n\t\toption=\"${COMP_WORDS[COMP_CWORD-2]}\"\n\tfi\n")
+	fmt.Fprint(w, "\tcase \"$option\" in\n")
+	fmt.Fprint(w, valueCases)
+	if len(fileFlags) > 0 {
+		fmt.Fprintf(w, "\t%s)\n\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n\t\treturn\n\t\t;;\n", strings.Join(fileFlags, "|"))
+	}
+	if len(valueFlags) > 0 {
+		fmt.Fprintf(w, "\t%s)\n\t\tCOMPREPLY=()\n\t\treturn\n\t\t;;\n", strings.Join(valueFlags, "|"))
+	}
+	fmt.Fprint(w, "\tesac\n\n")
+
+	fmt.Fprintf(w, "\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(flagNames, " "))
+	fmt.Fprint(w, "}\n")
+	fmt.Fprintf(w, "complete -o default -F %s %s\n", function, command)
+}
+
+// Function zshQuote escapes text for a single-quoted zsh _arguments spec.
+func zshQuote(text string) string {
+	text = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(text)
+	return strings.Replace(text, "'", `'\''`, -1)
+}
+
+// Function writeZshCompletion writes the zsh completion script, to be loaded
+// with `source <(input-field-finder completion zsh)`, or saved as
+// `_input-field-finder` in a directory on $fpath.
+func writeZshCompletion(w io.Writer, command string) {
+	function := "_" + notFunctionName.ReplaceAllString(command, "_")
+
+	fmt.Fprintf(w, "#compdef %s\n\n", command)
+	fmt.Fprintf(w, "%s() {\n", function)
+
+	fmt.Fprint(w, "\tif (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then\n\t\t_values 'command'")
+	for _, subcommand := range subcommands {
+		fmt.Fprintf(w, " '%s[%s]'", subcommand[0], zshQuote(subcommand[1]))
+	}
+	fmt.Fprint(w, "\n\t\treturn\n\tfi\n")
+
+	fmt.Fprint(w, "\tcase $words[2] in\n\thelp)\n\t\t(( CURRENT == 3 )) && _values 'topic'")
+	for _, topic := range helpTopics {
+		fmt.Fprintf(w, " '%s[%s]'", topic.Name, zshQuote(topic.Summary))
+	}
+	fmt.Fprint(w, "\n\t\treturn\n\t\t;;\n")
+	fmt.Fprintf(w, "\tcompletion)\n\t\t(( CURRENT == 3 )) && _values 'shell' %s\n\t\treturn\n\t\t;;\n\tesac\n\n", strings.Join(completionShells, " "))
+
+	fmt.Fprint(w, "\t_arguments")
+	flag.VisitAll(func(f *flag.Flag) {
+		info := flagInfo[f.Name]
+		spec := fmt.Sprintf("-%s[%s]", f.Name, zshQuote(flagSummary(f)))
+		switch {
+		case isBoolFlag(f):
+		case len(info.Values) > 0:
+			spec = fmt.Sprintf("-%s=[%s]:value:(%s)", f.Name, zshQuote(flagSummary(f)), strings.Join(info.Values, " "))
+		case info.File:
+			spec = fmt.Sprintf("-%s=[%s]:file:_files", f.Name, zshQuote(flagSummary(f)))
+		default:
+			valueName, _ := flag.UnquoteUsage(f)
+			spec = fmt.Sprintf("-%s=[%s]:%s: ", f.Name, zshQuote(flagSummary(f)), valueName)
+		}
+		// Flags that can be repeated are offered again after they are given
+		if _, repeated := f.Value.(*StringList); repeated {
+			spec = "*" + spec
+		}
+		fmt.Fprintf(w, " \\\n\t\t'%s'", spec)
+	})
+	fmt.Fprint(w, "\n}\n\n")
+
+	fmt.Fprintf(w, "compdef %s %s\n", function, command)
+}
+
+// Function fishQuote escapes text for a single-quoted fish string.
+func fishQuote(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(text)
+}
+
+// Function writeFishCompletion writes the fish completion script, to be
+// loaded with `input-field-finder completion fish | source`, or saved as
+// `input-field-finder.fish` in ~/.config/fish/completions.
+func writeFishCompletion(w io.Writer, command string) {
+	fmt.Fprintf(w, "# fish completion for %s\n", command)
+	fmt.Fprintf(w, "complete -c %s -f\n", command)
+
+	for _, subcommand := range subcommands {
+		fmt.Fprintf(w, "complete -c %s -n '__fish_use_subcommand' -a %s -d '%s'\n", command, subcommand[0], fishQuote(subcommand[1]))
+	}
+	for _, topic := range helpTopics {
+		fmt.Fprintf(w, "complete -c %s -n '__fish_seen_subcommand_from help' -a %s -d '%s'\n", command, topic.Name, fishQuote(topic.Summary))
+	}
+	fmt.Fprintf(w, "complete -c %s -n '__fish_seen_subcommand_from completion' -a '%s'\n", command, strings.Join(completionShells, " "))
+
+	flag.VisitAll(func(f *flag.Flag) {
+		info := flagInfo[f.Name]
+		arguments := ""
+		switch {
+		case isBoolFlag(f):
+		case len(info.Values) > 0:
+			arguments = fmt.Sprintf(" -x -a '%s'", strings.Join(info.Values, " "))
+		case info.File:
+			arguments = " -r -F"
+		default:
+			arguments = " -x"
+		}
+		fmt.Fprintf(w, "complete -c %s -o %s%s -d '%s'\n", command, f.Name, arguments, fishQuote(flagSummary(f)))
+	})
+}
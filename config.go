@@ -0,0 +1,519 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The top-level keys of a configuration file that are not flags, or that
+// hold more than a flag's value
+const (
+	configProfiles = "profiles"
+	configProfile  = "profile"
+	// The targets in scope, in place of a -targets file
+	configTargets = "targets"
+	// The headers of each auth profile, as -auth-profile flags
+	configAuthProfiles = "auth-profiles"
+)
+
+// ConfigSetting is the value of a flag set in a configuration file. Flags
+// that can be repeated, and -urls, can be given a list of values.
+type ConfigSetting struct {
+	Name   string
+	Values []string
+	Line   int
+}
+
+// Config is a scan configuration file: the flags to set for a target, and
+// named profiles of further flags (such as "stealth" or "aggressive") that
+// can be picked with -profile.
+type Config struct {
+	Path     string
+	Settings []ConfigSetting
+	Profiles map[string][]ConfigSetting
+	// The profile used when -profile is not given; "" = none
+	DefaultProfile string
+	// Targets are the targets in scope, if the file defines them, in the
+	// order they are given in
+	Targets []Target
+}
+
+// configLine is a line of a configuration file, without its comment or indentation.
+type configLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// configNode is a value in a configuration file: a scalar, a list of
+// scalars, or a mapping of keys to values in file order.
+type configNode struct {
+	line    int
+	scalar  string
+	list    []string
+	isList  bool
+	entries []configEntry
+}
+
+// configEntry is a key and its value in a mapping.
+type configEntry struct {
+	key   string
+	value *configNode
+}
+
+// Function loadConfig reads the configuration file at the given path.
+func loadConfig(path string) (*Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, err := parseConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s", path, err.Error())
+	}
+	config.Path = path
+	return config, nil
+}
+
+// Function parseConfig parses a configuration file. The file is written in
+// a subset of YAML: a mapping of flag names to values, where each value is a
+// plain or quoted string, a list of them (as "- item" lines or [a, b]), or,
+// for the profiles key, a mapping of profile names to more flags. The targets
+// and auth-profiles keys map the names of targets and auth profiles to their
+// settings and headers.
+func parseConfig(reader io.Reader) (*Config, error) {
+	var lines []configLine
+	scanner := bufio.NewScanner(reader)
+	for number := 1; scanner.Scan(); number++ {
+		text := stripConfigComment(scanner.Text())
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("%d: indent with spaces rather than tabs", number)
+		}
+		trimmed = strings.TrimSpace(trimmed)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		lines = append(lines, configLine{number: number, indent: len(text) - len(strings.TrimLeft(text, " ")), text: trimmed})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	config := &Config{Profiles: make(map[string][]ConfigSetting)}
+	if len(lines) == 0 {
+		return config, nil
+	}
+	root, next, err := parseConfigBlock(lines, 0, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if next < len(lines) {
+		return nil, fmt.Errorf("%d: unexpected indentation", lines[next].number)
+	}
+	if root.isList {
+		return nil, fmt.Errorf("%d: expected flag names and values, not a list", root.line)
+	}
+
+	for _, entry := range root.entries {
+		key := strings.Replace(entry.key, "_", "-", -1)
+		switch {
+		case key == configTargets && len(entry.value.entries) > 0:
+			// A targets key holding a single value is the -targets flag
+			if config.Targets, err = configTargetList(entry.value); err != nil {
+				return nil, err
+			}
+		case key == configAuthProfiles:
+			setting, err := configAuthProfileSetting(entry.value)
+			if err != nil {
+				return nil, err
+			}
+			config.Settings = append(config.Settings, setting)
+		case key == configProfiles:
+			if entry.value.isList || len(entry.value.entries) == 0 {
+				return nil, fmt.Errorf("%d: profiles must map profile names to flags", entry.value.line)
+			}
+			for _, profile := range entry.value.entries {
+				settings, err := configSettings(profile.value)
+				if err != nil {
+					return nil, err
+				}
+				config.Profiles[profile.key] = settings
+			}
+		case key == configProfile:
+			if entry.value.isList || len(entry.value.entries) > 0 {
+				return nil, fmt.Errorf("%d: profile must be the name of a profile", entry.value.line)
+			}
+			config.DefaultProfile = entry.value.scalar
+		default:
+			setting, err := configSetting(entry)
+			if err != nil {
+				return nil, err
+			}
+			config.Settings = append(config.Settings, setting)
+		}
+	}
+	return config, nil
+}
+
+// Function configTargetList returns the targets defined in a mapping of
+// target names to their hosts, auth profile, rate limit and tags, as in a
+// -targets file.
+func configTargetList(node *configNode) ([]Target, error) {
+	var targets []Target
+	for _, entry := range node.entries {
+		target := Target{Name: entry.key}
+		if len(entry.value.entries) == 0 {
+			return nil, fmt.Errorf("%d: target %s must set its hosts, and optionally its auth, rate-limit and tags", entry.value.line, entry.key)
+		}
+		for _, field := range entry.value.entries {
+			setting, err := configSetting(field)
+			if err != nil {
+				return nil, err
+			}
+			name := strings.Replace(field.key, "_", "-", -1)
+			if name != "hosts" && name != "tags" && len(setting.Values) != 1 {
+				return nil, fmt.Errorf("%d: %s takes a single value, not a list", setting.Line, field.key)
+			}
+			switch name {
+			case "hosts":
+				target.Hosts = setting.Values
+			case "tags":
+				target.Tags = setting.Values
+			case "auth":
+				target.Auth = setting.Values[0]
+			case "rate-limit":
+				if target.RateLimit, err = strconv.ParseFloat(setting.Values[0], 64); err != nil {
+					return nil, fmt.Errorf("%d: invalid rate-limit %q for target %s", setting.Line, setting.Values[0], entry.key)
+				}
+			default:
+				return nil, fmt.Errorf("%d: unknown setting %q for target %s; expected hosts, auth, rate-limit or tags", setting.Line, field.key, entry.key)
+			}
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// Function configAuthProfileSetting returns the -auth-profile flags for a
+// mapping of auth profile names to their headers, each with a value or a
+// list of values.
+func configAuthProfileSetting(node *configNode) (ConfigSetting, error) {
+	setting := ConfigSetting{Name: "auth-profile", Line: node.line}
+	if len(node.entries) == 0 {
+		return setting, fmt.Errorf("%d: auth-profiles must map profile names to headers", node.line)
+	}
+	for _, profile := range node.entries {
+		if len(profile.value.entries) == 0 {
+			return setting, fmt.Errorf("%d: auth profile %s must map header names to values", profile.value.line, profile.key)
+		}
+		for _, header := range profile.value.entries {
+			values, err := configSetting(header)
+			if err != nil {
+				return setting, err
+			}
+			for _, value := range values.Values {
+				setting.Values = append(setting.Values, profile.key+"="+header.key+": "+value)
+			}
+		}
+	}
+	return setting, nil
+}
+
+// Function configSettings returns the flags set in a mapping.
+func configSettings(node *configNode) ([]ConfigSetting, error) {
+	if node.isList || (len(node.entries) == 0 && node.scalar != "") {
+		return nil, fmt.Errorf("%d: expected flag names and values", node.line)
+	}
+	var settings []ConfigSetting
+	for _, entry := range node.entries {
+		if key := strings.Replace(entry.key, "_", "-", -1); key == configAuthProfiles || (key == configTargets && len(entry.value.entries) > 0) {
+			return nil, fmt.Errorf("%d: %s can only be defined at the top of the file, not in a profile", entry.value.line, entry.key)
+		}
+		setting, err := configSetting(entry)
+		if err != nil {
+			return nil, err
+		}
+		settings = append(settings, setting)
+	}
+	return settings, nil
+}
+
+// Function configSetting returns the flag set by a key and its value.
+func configSetting(entry configEntry) (ConfigSetting, error) {
+	setting := ConfigSetting{Name: entry.key, Line: entry.value.line}
+	switch {
+	case len(entry.value.entries) > 0:
+		return setting, fmt.Errorf("%d: %s must be a value or a list of values", entry.value.line, entry.key)
+	case entry.value.isList:
+		setting.Values = entry.value.list
+	default:
+		setting.Values = []string{entry.value.scalar}
+	}
+	return setting, nil
+}
+
+// Function parseConfigBlock parses the lines at the given indentation,
+// starting from line i, as a list or a mapping. It returns the index of the
+// first line after the block.
+func parseConfigBlock(lines []configLine, i int, indent int) (*configNode, int, error) {
+	node := &configNode{line: lines[i].number}
+
+	// A list of "- item" lines
+	if isConfigListItem(lines[i].text) {
+		node.isList = true
+		for i < len(lines) && lines[i].indent == indent && isConfigListItem(lines[i].text) {
+			item := strings.TrimSpace(strings.TrimPrefix(lines[i].text, "-"))
+			value, err := parseConfigScalar(item)
+			if err != nil {
+				return nil, i, fmt.Errorf("%d: %s", lines[i].number, err.Error())
+			}
+			node.list = append(node.list, value)
+			i++
+		}
+		if i < len(lines) && lines[i].indent > indent {
+			return nil, i, fmt.Errorf("%d: lists can only hold plain values", lines[i].number)
+		}
+		return node, i, nil
+	}
+
+	// A mapping of "key: value" lines
+	seen := make(map[string]bool)
+	for i < len(lines) && lines[i].indent == indent {
+		line := lines[i]
+		if isConfigListItem(line.text) {
+			return nil, i, fmt.Errorf("%d: unexpected list item", line.number)
+		}
+		key, rest, ok := splitConfigKey(line.text)
+		if !ok {
+			return nil, i, fmt.Errorf("%d: expected \"name: value\"", line.number)
+		}
+		if seen[key] {
+			return nil, i, fmt.Errorf("%d: %s is given more than once", line.number, key)
+		}
+		seen[key] = true
+		i++
+
+		var value *configNode
+		switch {
+		case rest != "":
+			value = &configNode{line: line.number}
+			if strings.HasPrefix(rest, "[") {
+				list, err := parseConfigInlineList(rest)
+				if err != nil {
+					return nil, i, fmt.Errorf("%d: %s", line.number, err.Error())
+				}
+				value.list, value.isList = list, true
+			} else {
+				scalar, err := parseConfigScalar(rest)
+				if err != nil {
+					return nil, i, fmt.Errorf("%d: %s", line.number, err.Error())
+				}
+				value.scalar = scalar
+			}
+		case i < len(lines) && (lines[i].indent > indent || (lines[i].indent == indent && isConfigListItem(lines[i].text))):
+			// A nested block, or a list at the same indentation as its key
+			var err error
+			if value, i, err = parseConfigBlock(lines, i, lines[i].indent); err != nil {
+				return nil, i, err
+			}
+		default:
+			value = &configNode{line: line.number}
+		}
+		node.entries = append(node.entries, configEntry{key: key, value: value})
+	}
+	if i < len(lines) && lines[i].indent > indent {
+		return nil, i, fmt.Errorf("%d: unexpected indentation", lines[i].number)
+	}
+	return node, i, nil
+}
+
+// Function isConfigListItem checks whether a line is an item of a list.
+func isConfigListItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// Function splitConfigKey splits a "key: value" line into its key and value.
+// The value is "" for a key followed by a nested block.
+func splitConfigKey(text string) (string, string, bool) {
+	var index int
+	if strings.HasSuffix(text, ":") && !strings.Contains(text, ": ") {
+		index = len(text) - 1
+	} else if index = strings.Index(text, ": "); index < 0 {
+		return "", "", false
+	}
+	key, err := parseConfigScalar(strings.TrimSpace(text[:index]))
+	if err != nil || key == "" {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(text[index+1:]), true
+}
+
+// Function parseConfigScalar parses a plain, 'single-quoted' or
+// "double-quoted" value.
+func parseConfigScalar(text string) (string, error) {
+	switch {
+	case strings.HasPrefix(text, `"`):
+		value, err := strconv.Unquote(text)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted value %s", text)
+		}
+		return value, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return "", fmt.Errorf("invalid quoted value %s", text)
+		}
+		return strings.Replace(text[1:len(text)-1], "''", "'", -1), nil
+	case text == "~" || text == "null":
+		return "", nil
+	default:
+		return text, nil
+	}
+}
+
+// Function parseConfigInlineList parses a list of values written as [a, b, c].
+func parseConfigInlineList(text string) ([]string, error) {
+	if !strings.HasSuffix(text, "]") {
+		return nil, errors.New("unterminated list " + text)
+	}
+	inner := strings.TrimSpace(text[1 : len(text)-1])
+	if inner == "" {
+		return []string{}, nil
+	}
+
+	// Split on the commas that are not in quotes
+	var values []string
+	var quote rune
+	start := 0
+	for index, character := range inner + "," {
+		switch {
+		case quote != 0:
+			if character == quote {
+				quote = 0
+			}
+		case character == '"' || character == '\'':
+			quote = character
+		case character == ',':
+			value, err := parseConfigScalar(strings.TrimSpace(inner[start:index]))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			start = index + 1
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote in " + text)
+	}
+	return values, nil
+}
+
+// Function stripConfigComment removes a # comment from a line, unless the #
+// is in quotes or part of a value (such as a URL fragment).
+func stripConfigComment(text string) string {
+	var quote rune
+	for index, character := range text {
+		switch {
+		case quote != 0:
+			if character == quote {
+				quote = 0
+			}
+		case character == '"' || character == '\'':
+			// Quotes only start a quoted value at the start of one
+			if index == 0 || strings.ContainsRune(" [,:-", rune(text[index-1])) {
+				quote = character
+			}
+		case character == '#' && (index == 0 || text[index-1] == ' ' || text[index-1] == '\t'):
+			return text[:index]
+		}
+	}
+	return text
+}
+
+// Method Apply sets the flags in the configuration file, followed by those in
+// the named profile (or the default profile, if name is ""), so that a
+// profile's settings take precedence over the rest of the file. Flags set on
+// the command line take precedence over both, except for flags that can be
+// repeated, such as -header, whose values are added to those on the command
+// line. Relative file paths are relative to the configuration file.
+func (c *Config) Apply(name string) error {
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	var profile []ConfigSetting
+	if name != "" {
+		var ok bool
+		if profile, ok = c.Profiles[name]; !ok {
+			var names []string
+			for profileName := range c.Profiles {
+				names = append(names, profileName)
+			}
+			sort.Strings(names)
+			if len(names) == 0 {
+				return fmt.Errorf("%s: there is no profile named %q, as no profiles are defined", c.Path, name)
+			}
+			return fmt.Errorf("%s: there is no profile named %q (profiles: %s)", c.Path, name, strings.Join(names, ", "))
+		}
+	}
+
+	commandLine := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		commandLine[f.Name] = true
+	})
+
+	for _, settings := range [][]ConfigSetting{c.Settings, profile} {
+		for _, setting := range settings {
+			if err := c.set(setting, commandLine); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Method set sets a single flag from the configuration file, unless it was
+// set on the command line.
+func (c *Config) set(setting ConfigSetting, commandLine map[string]bool) error {
+	name := strings.Replace(setting.Name, "_", "-", -1)
+	f := flag.Lookup(name)
+	if f == nil || name == "config" || name == "profile" {
+		return fmt.Errorf("%s:%d: unknown setting %q", c.Path, setting.Line, setting.Name)
+	}
+	values := setting.Values
+	if flagInfo[name].File {
+		for i, value := range values {
+			if value != "" && value != "-" && !filepath.IsAbs(value) {
+				values[i] = filepath.Join(filepath.Dir(c.Path), value)
+			}
+		}
+	}
+
+	_, repeatable := f.Value.(*StringList)
+	switch {
+	case repeatable:
+		// Add to the values given on the command line
+	case commandLine[name]:
+		return nil
+	case name == "urls":
+		values = []string{strings.Join(values, ",")}
+	case len(values) != 1:
+		return fmt.Errorf("%s:%d: %s takes a single value, not a list", c.Path, setting.Line, setting.Name)
+	}
+
+	for _, value := range values {
+		if err := f.Value.Set(value); err != nil {
+			return fmt.Errorf("%s:%d: invalid value %q for %s: %s", c.Path, setting.Line, value, setting.Name, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigTargetsAndAuthProfiles(t *testing.T) {
+	config, err := parseConfig(strings.NewReader(`
+urls: https://shop.example.com/
+targets:
+  shop:
+    hosts: [https://shop.example.com, "*.cdn.example.com"]
+    auth: admin
+    rate_limit: 2
+    tags:
+      - client-a
+  blog:
+    hosts: blog.example.org
+auth-profiles:
+  admin:
+    Cookie: session=abc123
+    X-Tenant: [one, two]
+`))
+	if err != nil {
+		t.Fatalf("parseConfig: %s", err)
+	}
+
+	expected := []Target{
+		{Name: "shop", Hosts: []string{"https://shop.example.com", "*.cdn.example.com"}, Auth: "admin", RateLimit: 2, Tags: []string{"client-a"}},
+		{Name: "blog", Hosts: []string{"blog.example.org"}},
+	}
+	if !reflect.DeepEqual(config.Targets, expected) {
+		t.Errorf("got targets %+v, expected %+v", config.Targets, expected)
+	}
+
+	var profiles []string
+	for _, setting := range config.Settings {
+		if setting.Name == "auth-profile" {
+			profiles = append(profiles, setting.Values...)
+		}
+	}
+	expectedProfiles := []string{"admin=Cookie: session=abc123", "admin=X-Tenant: one", "admin=X-Tenant: two"}
+	if !reflect.DeepEqual(profiles, expectedProfiles) {
+		t.Errorf("got auth profiles %q, expected %q", profiles, expectedProfiles)
+	}
+}
+
+func TestParseConfigRejectsUnknownNestedKeys(t *testing.T) {
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{"targets:\n  shop:\n    hostz: a.example.com\n", `3: unknown setting "hostz" for target shop`},
+		{"targets:\n  shop:\n    hosts: a.example.com\n    auth: [a, b]\n", "4: auth takes a single value"},
+		{"targets:\n  shop: a.example.com\n", "2: target shop must set its hosts"},
+		{"auth-profiles: admin\n", "1: auth-profiles must map profile names to headers"},
+		{"auth-profiles:\n  admin:\n    Cookie:\n      session: abc\n", "4: Cookie must be a value"},
+		{"profiles:\n  stealth:\n    targets:\n      shop:\n        hosts: a\n", "4: targets can only be defined at the top of the file"},
+		{"header:\n  X-Scan:\n    nested: value\n", "2: header must be a value"},
+	}
+	for _, test := range tests {
+		_, err := parseConfig(strings.NewReader(test.config))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("parseConfig(%q) = %v, expected an error containing %q", test.config, err, test.err)
+		}
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		settings []ConfigSetting
+		profiles map[string][]ConfigSetting
+		profile  string
+	}{
+		{
+			name:     "empty",
+			config:   "# Nothing set\n\n---\n",
+			settings: nil,
+			profiles: map[string][]ConfigSetting{},
+		},
+		{
+			name:   "values",
+			config: "rate-limit: 5\noutput: 'results.json'\nuser_agent: \"Mozilla/5.0 (scan)\"\njitter: ~\n",
+			settings: []ConfigSetting{
+				{Name: "rate-limit", Values: []string{"5"}, Line: 1},
+				{Name: "output", Values: []string{"results.json"}, Line: 2},
+				{Name: "user_agent", Values: []string{"Mozilla/5.0 (scan)"}, Line: 3},
+				{Name: "jitter", Values: []string{""}, Line: 4},
+			},
+			profiles: map[string][]ConfigSetting{},
+		},
+		{
+			name:   "lists",
+			config: "urls:\n- https://a.example.com/\n- https://b.example.com/\nheader: [\"X-Scan: a, b\", 'X-Team: it''s us']\nattributes: []\n",
+			settings: []ConfigSetting{
+				{Name: "urls", Values: []string{"https://a.example.com/", "https://b.example.com/"}, Line: 2},
+				{Name: "header", Values: []string{"X-Scan: a, b", "X-Team: it's us"}, Line: 4},
+				{Name: "attributes", Values: []string{}, Line: 5},
+			},
+			profiles: map[string][]ConfigSetting{},
+		},
+		{
+			name:   "comments",
+			config: "urls: https://www.example.com/#top  # The start page\nheader: \"X-Tag: #1\" # Quoted\n",
+			settings: []ConfigSetting{
+				{Name: "urls", Values: []string{"https://www.example.com/#top"}, Line: 1},
+				{Name: "header", Values: []string{"X-Tag: #1"}, Line: 2},
+			},
+			profiles: map[string][]ConfigSetting{},
+		},
+		{
+			name:   "profiles",
+			config: "concurrency: 2\nprofile: stealth\nprofiles:\n  stealth:\n    concurrency: 0\n    random-agent: true\n  aggressive:\n    concurrency: 5\n",
+			settings: []ConfigSetting{
+				{Name: "concurrency", Values: []string{"2"}, Line: 1},
+			},
+			profiles: map[string][]ConfigSetting{
+				"stealth": {
+					{Name: "concurrency", Values: []string{"0"}, Line: 5},
+					{Name: "random-agent", Values: []string{"true"}, Line: 6},
+				},
+				"aggressive": {
+					{Name: "concurrency", Values: []string{"5"}, Line: 8},
+				},
+			},
+			profile: "stealth",
+		},
+		{
+			name:   "targets file",
+			config: "targets: scope.json\n",
+			settings: []ConfigSetting{
+				{Name: "targets", Values: []string{"scope.json"}, Line: 1},
+			},
+			profiles: map[string][]ConfigSetting{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := parseConfig(strings.NewReader(test.config))
+			if err != nil {
+				t.Fatalf("parseConfig: %s", err)
+			}
+			if !reflect.DeepEqual(config.Settings, test.settings) {
+				t.Errorf("got settings %+v, expected %+v", config.Settings, test.settings)
+			}
+			if !reflect.DeepEqual(config.Profiles, test.profiles) {
+				t.Errorf("got profiles %+v, expected %+v", config.Profiles, test.profiles)
+			}
+			if config.DefaultProfile != test.profile {
+				t.Errorf("got default profile %q, expected %q", config.DefaultProfile, test.profile)
+			}
+		})
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{"urls:\n\t- https://www.example.com/\n", "2: indent with spaces rather than tabs"},
+		{"- https://www.example.com/\n", "1: expected flag names and values, not a list"},
+		{"output: a.json\noutput: b.json\n", "2: output is given more than once"},
+		{"urls https://www.example.com/\n", `1: expected "name: value"`},
+		{"output: a.json\n  format: csv\n", "2: unexpected indentation"},
+		{"header: [X-Scan: a\n", "1: unterminated list"},
+		{"header: [\"X-Scan: a]\n", "1: unterminated quote"},
+		{"output: 'a.json\n", "1: invalid quoted value"},
+		{"output: \"a.json\n", "1: invalid quoted value"},
+		{"urls:\n  - a\n  - b\n    - c\n", "4: lists can only hold plain values"},
+		{"profiles: stealth\n", "1: profiles must map profile names to flags"},
+		{"profile: [stealth, aggressive]\n", "1: profile must be the name of a profile"},
+		{"rate-limit:\n  max: 5\n", "2: rate-limit must be a value or a list of values"},
+	}
+	for _, test := range tests {
+		_, err := parseConfig(strings.NewReader(test.config))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("parseConfig(%q) = %v, expected an error containing %q", test.config, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The attributes that describe how an input field is validated in the
+// browser; fields with the same name and form action should agree on them
+var validationAttributes = []string{"type", "required", "pattern", "minlength", "maxlength", "min", "max", "step", "accept", "multiple"}
+
+// The number of pages listed for each variant of a conflicting field
+const conflictExamples = 5
+
+// Conflict is a parameter that is submitted to the same form action from
+// different pages, but with different types or validation on some of them.
+// This often means the server handles the parameter inconsistently too.
+type Conflict struct {
+	Action   string            `json:"action"`
+	Method   string            `json:"method"`
+	Name     string            `json:"name"`
+	Variants []ConflictVariant `json:"variants"`
+}
+
+// ConflictVariant is one of the ways a conflicting parameter is declared,
+// and the pages it is declared that way on.
+type ConflictVariant struct {
+	Attributes []Attribute `json:"attributes"`
+	Pages      []string    `json:"pages"`
+	PageCount  int         `json:"page_count"`
+}
+
+// Function inputSignature returns the validation attributes of an input
+// field, in a fixed order, with the defaults browsers apply filled in.
+func inputSignature(input Input) []Attribute {
+	var signature []Attribute
+	for _, key := range validationAttributes {
+		value := strings.ToLower(input.Attr(key))
+		if key == "type" && value == "" {
+			value = "text"
+		}
+		hasAttribute := value != ""
+		for _, attribute := range input.Attributes {
+			if attribute.Key == key {
+				hasAttribute = true
+			}
+		}
+		if hasAttribute {
+			signature = append(signature, Attribute{Key: key, Val: value})
+		}
+	}
+	return signature
+}
+
+// Function findConflicts looks through the results of a crawl for input
+// fields with the same name, submitted to the same form action with the same
+// method, that are declared with different types or validation on different
+// pages. Fields outside of a form, and API parameters, are not compared.
+func findConflicts(results []PageResult) []Conflict {
+	type variant struct {
+		attributes []Attribute
+		pages      map[string]bool
+	}
+	type field struct {
+		conflict Conflict
+		variants map[string]*variant
+	}
+	fields := make(map[string]*field)
+
+	for _, page := range results {
+		for _, input := range page.Inputs {
+			name := input.Attr("name")
+			if input.Source != "" || input.Action == "" || name == "" {
+				continue
+			}
+
+			// Forms are submitted to the action without its fragment
+			action := input.Action
+			if actionURL, err := url.Parse(input.Action); err == nil {
+				actionURL.Fragment = ""
+				action = actionURL.String()
+			}
+
+			key := input.Method + " " + action + " " + name
+			found, exists := fields[key]
+			if !exists {
+				found = &field{
+					conflict: Conflict{Action: action, Method: input.Method, Name: name},
+					variants: make(map[string]*variant),
+				}
+				fields[key] = found
+			}
+
+			signature := inputSignature(input)
+			signatureKey := renderInput(signature)
+			if _, exists := found.variants[signatureKey]; !exists {
+				found.variants[signatureKey] = &variant{attributes: signature, pages: make(map[string]bool)}
+			}
+			found.variants[signatureKey].pages[page.URL] = true
+		}
+	}
+
+	var conflicts []Conflict
+	for _, found := range fields {
+		if len(found.variants) < 2 {
+			continue
+		}
+
+		for _, fieldVariant := range found.variants {
+			pages := make([]string, 0, len(fieldVariant.pages))
+			for page := range fieldVariant.pages {
+				pages = append(pages, page)
+			}
+			sort.Strings(pages)
+
+			conflictVariant := ConflictVariant{Attributes: fieldVariant.attributes, PageCount: len(pages)}
+			if len(pages) > conflictExamples {
+				pages = pages[:conflictExamples]
+			}
+			conflictVariant.Pages = pages
+			found.conflict.Variants = append(found.conflict.Variants, conflictVariant)
+		}
+
+		// The most common variant comes first, as the odd ones out are the interesting ones
+		sort.Slice(found.conflict.Variants, func(i, j int) bool {
+			a, b := found.conflict.Variants[i], found.conflict.Variants[j]
+			if a.PageCount != b.PageCount {
+				return a.PageCount > b.PageCount
+			}
+			return renderInput(a.Attributes) < renderInput(b.Attributes)
+		})
+		conflicts = append(conflicts, found.conflict)
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Action != conflicts[j].Action {
+			return conflicts[i].Action < conflicts[j].Action
+		}
+		if conflicts[i].Name != conflicts[j].Name {
+			return conflicts[i].Name < conflicts[j].Name
+		}
+		return conflicts[i].Method < conflicts[j].Method
+	})
+	return conflicts
+}
+
+// Function printConflicts outputs the conflicting input fields to the console.
+func printConflicts(conflicts []Conflict) {
+	if len(conflicts) == 0 {
+		fmt.Printf("[CONFLICTS] No input fields with conflicting types or validation\n\n")
+		return
+	}
+
+	fmt.Printf("[CONFLICTS] %d input field(s) are declared differently on different pages\n\n", len(conflicts))
+	for _, conflict := range conflicts {
+		fmt.Printf("[CONFLICT] %s (%s %s)\n", conflict.Name, conflict.Method, conflict.Action)
+		for _, variant := range conflict.Variants {
+			var attributes []string
+			for _, attribute := range variant.Attributes {
+				attributes = append(attributes, fmt.Sprintf("%s=%q", attribute.Key, attribute.Val))
+			}
+			fmt.Printf("\t%s on %d page(s): %s\n", strings.Join(attributes, " "), variant.PageCount, strings.Join(variant.Pages, ", "))
+		}
+		fmt.Println()
+	}
+}
+
+// Function writeConflicts writes the conflicting input fields to the file at
+// the given path, as JSON.
+func writeConflicts(conflicts []Conflict, path string) error {
+	if conflicts == nil {
+		conflicts = []Conflict{}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(conflicts); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,1236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTTP transport that ignores TLS errors, shared by all crawlers so that
+// connections can be pooled between them. Hosts are resolved through the DNS
+// failure cache.
+var transport = &http.Transport{
+	TLSClientConfig: &tls.Config{
+		InsecureSkipVerify: true,
+	},
+	DialContext: dnsCache.DialContext,
+}
+
+// Options holds the settings for a single crawl.
+type Options struct {
+	// Concurrency is the level of concurrency, from 0 (none) to 5 (very high)
+	Concurrency int `json:"concurrency"`
+	// Seed, if non-zero, shuffles the order URLs are visited in, and seeds
+	// the request jitter, so that runs with the same seed are reproducible
+	Seed int64 `json:"seed,omitempty"`
+	// Jitter is the maximum random delay added before each request
+	Jitter Duration `json:"jitter,omitempty"`
+	// RateLimit is the most requests sent each second; 0 = no limit
+	RateLimit float64 `json:"rate_limit,omitempty"`
+	// RampUp starts each host at RampStart requests per second, raising the
+	// rate while the host keeps up and lowering it when the host slows down
+	// or fails, up to RampMax (0 = no limit)
+	RampUp    bool    `json:"ramp_up"`
+	RampStart float64 `json:"ramp_start"`
+	RampMax   float64 `json:"ramp_max,omitempty"`
+	// Windows are the times of day requests can be sent in, such as
+	// "01:00-05:00", and Blackouts the dates they cannot be sent on, such as
+	// "2026-12-24" or "2026-12-24..2026-12-26", both in TimeZone ("" = the
+	// local time zone). The crawl pauses outside of them; see ParseSchedule
+	Windows   []string `json:"windows,omitempty"`
+	Blackouts []string `json:"blackouts,omitempty"`
+	TimeZone  string   `json:"time_zone,omitempty"`
+	// WebhookURL, if set, is posted the input fields found as they are found
+	WebhookURL string `json:"webhook_url,omitempty"`
+	// WebhookPerInput posts each input field on its own, rather than per page
+	WebhookPerInput bool `json:"webhook_per_input,omitempty"`
+	// Targets are the parts of the crawl's scope, each with its own hosts,
+	// auth profile, rate limit and tags; the origins of the seeds are in
+	// scope as well. See Target
+	Targets []Target `json:"targets,omitempty"`
+	// Signing is how the requests to each host are signed, for hosts that
+	// need signed requests, such as APIs behind AWS API Gateway; see
+	// validateSigning
+	Signing map[string]SigningConfig `json:"signing,omitempty"`
+	// AuthProfiles are the named auth profiles that seeds can use
+	AuthProfiles map[string]AuthProfile `json:"auth_profiles,omitempty"`
+	// Headers are sent with every request
+	Headers http.Header `json:"headers,omitempty"`
+	// UserAgent, if set, replaces the default Go user agent
+	UserAgent string `json:"user_agent,omitempty"`
+	// AcceptLanguage, if set, is sent as the Accept-Language header
+	AcceptLanguage string `json:"accept_language,omitempty"`
+	// RandomAgent sends a different realistic browser user agent (and
+	// Accept-Language, unless one is set) with each request
+	RandomAgent bool `json:"random_agent,omitempty"`
+	// ProbeBoth whitelists both https and http for seeds without a scheme,
+	// if both respond, rather than only the first to respond
+	ProbeBoth bool `json:"probe_both,omitempty"`
+	// MaxRedirects is the number of redirects followed for each request
+	MaxRedirects int `json:"max_redirects"`
+	// FollowCrossOriginRedirects follows redirects to origins that are not whitelisted
+	FollowCrossOriginRedirects bool `json:"follow_cross_origin_redirects,omitempty"`
+	// MaxBodySize is the number of bytes of each response read; 0 = no limit
+	MaxBodySize int64 `json:"max_body_size"`
+	// Precheck makes sure every seed resolves and responds before crawling
+	Precheck bool `json:"precheck"`
+	// Diagnose checks the DNS, TCP, TLS and HTTP of hosts that keep failing,
+	// and of seeds that fail the pre-check, to tell why they fail
+	Diagnose bool `json:"diagnose"`
+	// OutOfScopeBuffer is the number of URLs kept for each origin that is not
+	// whitelisted, to be crawled if the origin is added to the whitelist
+	// during the crawl; 0 = none are kept
+	OutOfScopeBuffer int `json:"out_of_scope_buffer"`
+	// StripSessionParams ignores session ID and tracking query parameters
+	// when checking whether a URL has already been visited
+	StripSessionParams bool `json:"strip_session_params,omitempty"`
+	// MaxPages is the number of pages requested before the crawl stops,
+	// leaving the rest of its URLs queued; 0 = no limit
+	MaxPages int `json:"max_pages,omitempty"`
+	// MaxDuration is how long the crawl runs for before it stops, leaving
+	// the rest of its URLs queued; 0 = no limit
+	MaxDuration Duration `json:"max_duration,omitempty"`
+	// MaxSimilar is the number of pages searched for each URL pattern once
+	// they are found to share the same template; 0 = no limit
+	MaxSimilar int `json:"max_similar,omitempty"`
+	// SampleTemplates is the number of pages of each form template (pages of
+	// the same URL pattern with the same form fields) searched for input
+	// fields; the rest are fetched for their links, and only counted; 0 = no
+	// limit
+	SampleTemplates int `json:"sample_templates,omitempty"`
+	// TemplateSamples sets SampleTemplates for the templates of single URL
+	// patterns, by pattern (see urlPattern); 0 = no limit for the pattern
+	TemplateSamples map[string]int `json:"template_samples,omitempty"`
+	// MaxNodeDepth is the deepest level of nesting searched in each page; 0 = no limit
+	MaxNodeDepth int `json:"max_node_depth"`
+	// MaxNodes is the number of nodes searched in each page; 0 = no limit
+	MaxNodes int `json:"max_nodes"`
+	// ProbeAPI looks for OpenAPI specs and GraphQL endpoints on each
+	// whitelisted origin, reporting their parameters as input fields
+	ProbeAPI bool `json:"probe_api,omitempty"`
+	// APIOnly skips the input fields of HTML pages, and looks for API
+	// endpoints instead: in the scripts pages load, as well as with ProbeAPI
+	APIOnly bool `json:"api_only,omitempty"`
+	// Fragments also searches the HTML fragments that pages load in with
+	// JavaScript, from URLs in attributes such as hx-get and data-url
+	Fragments bool `json:"fragments,omitempty"`
+	// ExtractionTimeout is the time limit for reading and searching each
+	// page; pages that take longer are quarantined. 0 = no limit
+	ExtractionTimeout Duration `json:"extraction_timeout"`
+	// AuthState, if set, only reports the pages requested with a session
+	// (AuthStateAuthenticated), or without one (AuthStateUnauthenticated)
+	AuthState string `json:"auth_state,omitempty"`
+	// CacheDir is a directory to cache the responses fetched in, for repeat
+	// scans; "" = no cache. It can only be set on the command line, rather
+	// than through the scan API, as it writes to the server's disk
+	CacheDir string `json:"-"`
+	// CacheTTL is how long cached responses are reused for without asking
+	// the server whether they changed; 0 = always ask
+	CacheTTL Duration `json:"-"`
+}
+
+// Method Validate checks that the options are usable.
+func (o Options) Validate() error {
+	if o.Jitter < 0 {
+		return errors.New("jitter must not be negative")
+	}
+	if o.RateLimit < 0 {
+		return errors.New("rate limit must not be negative")
+	}
+	if o.RampUp && o.RampStart <= 0 {
+		return errors.New("ramp start must be above 0")
+	}
+	if o.RampMax < 0 {
+		return errors.New("ramp max must not be negative")
+	}
+	if o.RampUp && o.RampMax > 0 && o.RampMax < o.RampStart {
+		return errors.New("ramp max must not be below ramp start")
+	}
+	if _, err := ParseSchedule(o.Windows, o.Blackouts, o.TimeZone); err != nil {
+		return err
+	}
+	if err := validateSigning(o.Signing); err != nil {
+		return err
+	}
+	if err := validateTargets(o.Targets, o.AuthProfiles); err != nil {
+		return err
+	}
+	if o.MaxRedirects < 0 {
+		return errors.New("max redirects must not be negative")
+	}
+	if o.MaxBodySize < 0 {
+		return errors.New("max body size must not be negative")
+	}
+	if o.MaxNodeDepth < 0 || o.MaxNodes < 0 {
+		return errors.New("max node depth and max nodes must not be negative")
+	}
+	if o.ExtractionTimeout < 0 {
+		return errors.New("extraction timeout must not be negative")
+	}
+	switch o.AuthState {
+	case "", AuthStateAuthenticated, AuthStateUnauthenticated:
+	default:
+		return errors.New("auth state must be " + AuthStateAuthenticated + " or " + AuthStateUnauthenticated)
+	}
+	if o.CacheTTL < 0 {
+		return errors.New("cache TTL must not be negative")
+	}
+	if o.MaxSimilar < 0 {
+		return errors.New("max similar must not be negative")
+	}
+	if o.MaxPages < 0 {
+		return errors.New("max pages must not be negative")
+	}
+	if o.MaxDuration < 0 {
+		return errors.New("max duration must not be negative")
+	}
+	if o.SampleTemplates < 0 {
+		return errors.New("sample templates must not be negative")
+	}
+	for pattern, limit := range o.TemplateSamples {
+		if limit < 0 {
+			return errors.New("template samples for " + pattern + " must not be negative")
+		}
+	}
+	if o.OutOfScopeBuffer < 0 {
+		return errors.New("out of scope buffer must not be negative")
+	}
+	if o.RandomAgent && o.UserAgent != "" {
+		return errors.New("a user agent cannot be set along with the random agent mode")
+	}
+	if o.WebhookURL != "" {
+		webhookURL, err := url.Parse(o.WebhookURL)
+		if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Host == "" {
+			return errors.New("invalid webhook URL: " + o.WebhookURL)
+		}
+	}
+	return nil
+}
+
+// Duration is a time.Duration that is represented in JSON as a string,
+// such as "1.5s" or "300ms".
+type Duration time.Duration
+
+// Method MarshalJSON encodes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Method UnmarshalJSON decodes the duration from a string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// DefaultOptions returns the options used when none are provided.
+func DefaultOptions() Options {
+	return Options{
+		Concurrency:      3,
+		MaxRedirects:     10,
+		MaxBodySize:      defaultMaxBodySize,
+		Precheck:         true,
+		Diagnose:         true,
+		OutOfScopeBuffer: 1000,
+		RampUp:           true,
+		RampStart:        defaultRampStart,
+
+		MaxNodeDepth:      defaultMaxNodeDepth,
+		MaxNodes:          defaultMaxNodes,
+		ExtractionTimeout: Duration(defaultExtractionTimeout),
+	}
+}
+
+// VisitedSet tracks the URLs that have been visited, by their canonical
+// form. A set can be shared by several crawlers, working through one crawl
+// together.
+type VisitedSet interface {
+	// Add adds a URL, returning false if it was already in the set
+	Add(key string) bool
+	// Len returns the number of URLs in the set
+	Len() int
+	// Keys returns every URL in the set, in no particular order
+	Keys() []string
+}
+
+// Visited tracks visited URLs, to avoid redundancy & loops
+type Visited struct {
+	URLs  map[string]bool
+	mutex sync.RWMutex
+}
+
+// Method Add adds a URL to the visited URLs, returning false if it was
+// already visited.
+func (v *Visited) Add(key string) bool {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.URLs[key] {
+		return false
+	}
+	v.URLs[key] = true
+	return true
+}
+
+// Method Len returns the number of visited URLs.
+func (v *Visited) Len() int {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	return len(v.URLs)
+}
+
+// Method Keys returns every visited URL.
+func (v *Visited) Keys() []string {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	keys := make([]string, 0, len(v.URLs))
+	for key := range v.URLs {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Crawler holds all of the state for a single crawl, so that multiple crawls
+// can run side by side without interfering with each other.
+type Crawler struct {
+	options Options
+	log     *Logger
+	client  *http.Client
+	// The transport the requests are sent through, below the crawl's own
+	// layers: the shared transport, unless a test swaps it out
+	network http.RoundTripper
+	// The cache of responses from earlier scans, if any
+	cache *ResponseCache
+	// The history the crawl records what it finds in, if any
+	history *History
+	// How each page was requested, to request it again from elsewhere
+	manifest Manifest
+	// Signs the requests to the hosts that need it, if any do
+	signer *Signer
+	// The per-host rates of the politeness ramp-up, if it is on
+	politeness *Politeness
+	// When the crawl is allowed to send requests, if it is limited
+	schedule *Schedule
+	// When the crawl will resume, while it is paused outside of its schedule
+	paused struct {
+		until time.Time
+		mutex sync.Mutex
+	}
+	visited VisitedSet
+	// The URLs of the pages requested with GET, as they were sent
+	requested VisitedSet
+	// The targets that are allowed to be crawled (the whitelist)
+	scope Scope
+	// The URLs found that are not on the whitelist, by origin
+	outOfScope OutOfScope
+	// The pages fetched for each URL pattern, to spot templated pages
+	similarity Similarity
+	// The pages found for each form template, to stop searching them
+	sampling  Sampling
+	seeds     []Seed
+	deadSeeds []DeadSeed
+	frontier  Queue
+
+	// The Redis server shared with other crawlers, if any, and the prefix of
+	// the keys the crawl is stored under
+	shared    *RedisClient
+	sharedKey string
+
+	// Random number generator for the request jitter; only used by the dispatcher
+	random *rand.Rand
+
+	// Set a limit to the number of concurrent workers
+	maxWorkers chan struct{}
+
+	// URLsInProcess is a wait group to ensure that all URLs are processed
+	URLsInProcess sync.WaitGroup
+
+	// The number of URLs currently being processed
+	inFlight int64
+
+	// Every goroutine started by the crawler
+	goroutines Goroutines
+
+	// Counts of the work done, for progress reporting and metrics
+	stats Stats
+
+	// What the crawler is doing right now, for status dumps
+	activity activity
+
+	// The API endpoints found
+	surface APISurface
+
+	// Wakes up the dispatcher when a URL is queued or finishes processing
+	wake chan struct{}
+
+	// Set by the dispatcher once there is nothing left to process; URLs
+	// queued from outside of the crawl check it first, under the lock
+	finished  bool
+	lifecycle sync.Mutex
+
+	// Set by Stop, to stop handing out URLs; 1 = stopping
+	stopping int32
+	// Why the crawl stopped, once it has
+	termination terminationState
+	// Set once the sinks are closed, after which results are not written to them
+	sinkState struct {
+		closed bool
+		mutex  sync.Mutex
+	}
+
+	// The state of an earlier crawl to carry on from, if any
+	checkpoint *Checkpoint
+
+	// The outputs for pages that contain input fields
+	sinks []Sink
+
+	// The pages found to contain input fields
+	results struct {
+		Pages []PageResult
+		mutex sync.Mutex
+	}
+
+	// The pages that could not be searched
+	quarantined struct {
+		Pages []QuarantinedPage
+		mutex sync.Mutex
+	}
+	// The requests that failed for each host, to diagnose the hosts that keep failing
+	failing FailingHosts
+}
+
+// Function NewCrawler creates a crawler for the given seeds.
+// When the crawl starts, the scheme and host of each seed's URL is added to
+// the whitelist, as a target of its own unless a configured target covers it.
+func NewCrawler(seeds []Seed, options Options) *Crawler {
+	// The API endpoints of specs and schemas are found the same way in API-only mode
+	if options.APIOnly {
+		options.ProbeAPI = true
+	}
+
+	crawler := &Crawler{
+		options: options,
+		log:     logger,
+		visited: &Visited{
+			URLs: make(map[string]bool),
+		},
+		requested: &Visited{
+			URLs: make(map[string]bool),
+		},
+		outOfScope: OutOfScope{
+			ByOrigin: make(map[string]*outOfScopeOrigin),
+		},
+		similarity: Similarity{
+			Patterns: make(map[string]*patternBucket),
+		},
+		maxWorkers: make(chan struct{}, concurrencyLimit(options.Concurrency)),
+		wake:       make(chan struct{}, 1),
+		manifest: Manifest{
+			Entries: make(map[string]ManifestEntry),
+		},
+		sampling: Sampling{
+			Templates: make(map[string]*TemplateSample),
+		},
+		failing: FailingHosts{
+			ByHost: make(map[string]*FailingHost),
+		},
+	}
+
+	// Sign the requests to the hosts that need it, as they are sent
+	crawler.network = transport
+	var network http.RoundTripper = networkTransport{crawler: crawler}
+	if len(options.Signing) > 0 {
+		signer := Signer{Next: network, Hosts: make(map[string]SigningConfig, len(options.Signing))}
+		for host, config := range options.Signing {
+			signer.Hosts[strings.ToLower(host)] = config
+		}
+		network = signer
+		crawler.signer = &signer
+	}
+
+	// Space requests out, for each host and in all, if asked to
+	var roundTripper http.RoundTripper = hostCounter{crawler: crawler, next: network}
+	if options.RampUp {
+		crawler.politeness = NewPoliteness(options.RampStart, options.RampMax, crawler.log, roundTripper)
+		roundTripper = crawler.politeness
+	}
+	if options.RateLimit > 0 {
+		roundTripper = NewRateLimiter(options.RateLimit, roundTripper)
+	}
+	var limited bool
+	for _, target := range options.Targets {
+		scopeTarget := newScopeTarget(target)
+		if target.RateLimit > 0 {
+			scopeTarget.limiter = NewRateLimiter(target.RateLimit, roundTripper)
+			limited = true
+		}
+		crawler.scope.Targets = append(crawler.scope.Targets, scopeTarget)
+	}
+	if limited {
+		roundTripper = targetLimits{crawler: crawler, next: roundTripper}
+	}
+
+	// Hold requests outside of the crawl's windows, before they take up a
+	// slot of the rate limits
+	if schedule, err := ParseSchedule(options.Windows, options.Blackouts, options.TimeZone); err != nil {
+		crawler.log.Errorf("%s; ignoring the crawl windows", err.Error())
+	} else if schedule != nil {
+		crawler.schedule = schedule
+		roundTripper = ScheduleGate{Next: roundTripper, Schedule: schedule}
+	}
+
+	// Reuse the responses from earlier scans, if asked to; responses reused
+	// without asking the server do not count towards the rate limit
+	if options.CacheDir != "" {
+		crawler.cache = &ResponseCache{
+			Dir:                options.CacheDir,
+			TTL:                time.Duration(options.CacheTTL),
+			Next:               roundTripper,
+			StripSessionParams: options.StripSessionParams,
+		}
+		roundTripper = crawler.cache
+	}
+
+	crawler.client = &http.Client{
+		Transport:     roundTripper,
+		CheckRedirect: crawler.checkRedirect,
+	}
+
+	// Visit URLs in a reproducible random order when a seed is provided,
+	// otherwise visit them in the order they are found
+	if options.Seed != 0 {
+		crawler.random = rand.New(rand.NewSource(options.Seed))
+		crawler.frontier = NewFrontier(rand.New(rand.NewSource(options.Seed)))
+	} else {
+		crawler.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+		crawler.frontier = NewFrontier(nil)
+	}
+
+	if options.WebhookURL != "" {
+		crawler.AddSink(NewWebhookSink(options.WebhookURL, options.WebhookPerInput))
+	}
+
+	for _, seed := range seeds {
+		// Remove hashes from the URL
+		seed.URL.Fragment = ""
+		crawler.seeds = append(crawler.seeds, seed)
+	}
+
+	return crawler
+}
+
+// Function concurrencyLimit converts a concurrency level (0 - 5) into the
+// number of concurrent workers allowed.
+func concurrencyLimit(level int) int {
+	switch level {
+	case 0:
+		// No concurrency
+		return 1
+	case 1:
+		return 2
+	case 2:
+		return 5
+	case 4:
+		return 20
+	case 5:
+		return 50
+	default:
+		// Default, == value of 3
+		return 10
+	}
+}
+
+// Method AddSink adds an output for the pages found to contain input fields.
+// It must be called before Run.
+func (c *Crawler) AddSink(sink Sink) {
+	c.sinks = append(c.sinks, sink)
+}
+
+// Method Run queues up the starting URLs and blocks until every URL found
+// has been processed, or the crawl is stopped (see Termination), then closes
+// the crawler's sinks. The sinks are closed however the crawl ends, even if
+// it panics.
+// URLs are handed out to workers by a single dispatcher, so that the order
+// they are visited in is decided in one place. With no concurrency and the
+// same seed, two runs against the same site visit URLs in the same order.
+func (c *Crawler) Run() {
+	c.stats.markStarted()
+	defer func() {
+		recovered := recover()
+		if recovered != nil {
+			c.fail(fmt.Errorf("panic: %v", recovered))
+		}
+		c.finish()
+		if recovered != nil {
+			panic(recovered)
+		}
+	}()
+
+	// Stop handing out URLs once the crawl has run for long enough
+	if c.options.MaxDuration > 0 {
+		deadline := time.AfterFunc(time.Duration(c.options.MaxDuration), func() {
+			c.log.Warnf("Reached the time limit of %s; stopping the crawl once the pages in progress are searched", time.Duration(c.options.MaxDuration))
+			c.StopFor(StopDeadline, nil)
+		})
+		defer deadline.Stop()
+	}
+
+	// Wait for the crawl window before checking the seeds, as the checks
+	// would time out while their requests are held; the wait ends early if
+	// the crawl is stopped
+	c.waitForWindow()
+
+	// Work out the scheme of any seeds given without one, and check the rest are up
+	if !c.Stopping() {
+		c.seeds = c.probeSeeds(c.seeds)
+	}
+
+	// Add the seeds to the whitelist, and queue them up
+	for _, seed := range c.seeds {
+		c.scope.addOrigin(seed.URL)
+	}
+	c.restoreCheckpoint()
+	for i := range c.seeds {
+		c.addURL(c.seeds[i].URL, 0, &c.seeds[i])
+	}
+	c.queueCheckpoint()
+
+	// Look for APIs alongside the crawl
+	if c.options.ProbeAPI {
+		probed := make(map[string]bool)
+		for i := range c.seeds {
+			if seedOrigin := origin(c.seeds[i].URL); !probed[seedOrigin] {
+				probed[seedOrigin] = true
+				c.startAPIProbe(c.seeds[i].URL, &c.seeds[i])
+			}
+		}
+	}
+
+	dispatched := 0
+	for {
+		// Wait for a free worker before picking the next URL, so that the
+		// choice only depends on the URLs found by finished workers
+		c.maxWorkers <- struct{}{}
+
+		// Pause outside of the crawl's windows while there is something to
+		// hand out, and leave the rest of the URLs queued up, once asked to
+		// stop
+		if c.frontier.Len() > 0 {
+			c.waitForWindow()
+		}
+		if c.options.MaxPages > 0 && dispatched >= c.options.MaxPages && c.frontier.Len() > 0 && !c.Stopping() {
+			c.log.Warnf("Reached the limit of %d pages; stopping the crawl once the pages in progress are searched", c.options.MaxPages)
+			c.StopFor(StopMaxPages, nil)
+		}
+		if c.Stopping() {
+			<-c.maxWorkers
+			c.lifecycle.Lock()
+			c.finished = true
+			c.lifecycle.Unlock()
+			break
+		}
+
+		task, ok := c.frontier.Pop()
+		if !ok {
+			<-c.maxWorkers
+
+			// Nothing left to process, and nothing in process that could find more
+			if atomic.LoadInt64(&c.inFlight) == 0 && c.frontier.Len() == 0 && !c.frontier.Busy() {
+				// Check again under the lock, in case the whitelist was just expanded
+				c.lifecycle.Lock()
+				if c.frontier.Len() == 0 {
+					c.finished = true
+				}
+				c.lifecycle.Unlock()
+				if c.finished {
+					break
+				}
+				continue
+			}
+
+			// Wait for a URL to be queued, or a worker to finish. URLs queued
+			// by other crawlers sharing the queue do not wake the dispatcher,
+			// so check for them every so often.
+			if c.shared != nil {
+				select {
+				case <-c.wake:
+				case <-time.After(sharedPollInterval):
+				}
+				continue
+			}
+			<-c.wake
+			continue
+		}
+
+		// Pick the jitter and user agent here rather than in the worker, so
+		// that they are drawn from the random number generator in a
+		// reproducible order
+		var delay time.Duration
+		if c.options.Jitter > 0 {
+			delay = time.Duration(c.random.Int63n(int64(c.options.Jitter)))
+		}
+		task.UserAgent, task.AcceptLanguage = c.options.UserAgent, c.options.AcceptLanguage
+		if c.options.RandomAgent {
+			var language string
+			task.UserAgent, language = randomAgent(c.random)
+			if task.AcceptLanguage == "" {
+				task.AcceptLanguage = language
+			}
+		}
+
+		// Start processing the URL on a separate thread
+		dispatched++
+		c.URLsInProcess.Add(1)
+		atomic.AddInt64(&c.inFlight, 1)
+		c.spawn(nil, func() {
+			c.dataRouter(task, delay)
+		})
+	}
+
+}
+
+// Method Stop stops the crawl from handing out any more URLs, as asked to
+// by a signal (see StopFor). The pages already being searched are finished,
+// and the URLs still queued up are left in the frontier, so that they can be
+// exported with ExportFrontier.
+func (c *Crawler) Stop() {
+	c.StopFor(StopSignal, nil)
+}
+
+// Method stop stops the crawl from handing out any more URLs.
+func (c *Crawler) stop() {
+	atomic.StoreInt32(&c.stopping, 1)
+	c.signal()
+}
+
+// Method Stopping checks whether the crawl has been asked to stop.
+func (c *Crawler) Stopping() bool {
+	return atomic.LoadInt32(&c.stopping) == 1
+}
+
+// Method signal wakes up the dispatcher, if it is waiting.
+func (c *Crawler) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+		// The dispatcher already has a wake up pending
+	}
+}
+
+// Method Results returns a copy of the pages found to contain input fields so far.
+// When the crawl is shared with other crawlers, these include the pages they found.
+func (c *Crawler) Results() []PageResult {
+	if c.shared != nil {
+		pages, err := c.sharedResults()
+		if err == nil {
+			return pages
+		}
+		c.log.Errorf("[redis] Unable to fetch the shared results, so only returning this crawler's own: %s", err.Error())
+	}
+
+	c.results.mutex.Lock()
+	defer c.results.mutex.Unlock()
+
+	pages := make([]PageResult, len(c.results.Pages))
+	copy(pages, c.results.Pages)
+	return pages
+}
+
+// Method PagesVisited returns the number of URLs queued or processed so far.
+func (c *Crawler) PagesVisited() int {
+	return c.visited.Len()
+}
+
+// Method dataRouter requests the given URL after the given delay, and passes
+// it to various helper functions.
+// It returns any errors it receives throughout this process.
+func (c *Crawler) dataRouter(task Task, delay time.Duration) (err error) {
+	// Set up an internal wait group for processing responses locally in a concurrent manner
+	var wg sync.WaitGroup
+
+	urlValue := task.URL
+
+	defer c.URLsInProcess.Done() // clean up
+
+	// Release the worker, and let the dispatcher know it is free
+	defer func() {
+		c.frontier.Done(task)
+		<-c.maxWorkers
+		atomic.AddInt64(&c.inFlight, -1)
+		c.signal()
+	}() // Clean up
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	// Enough pages like this one may have been searched since it was queued
+	if c.skipSimilar(urlValue) {
+		return
+	}
+	defer c.markActive(urlValue)()
+
+	// Get the first URL's document body
+	request, err := c.newRequest(task)
+	if err != nil {
+		atomic.AddInt64(&c.stats.errors, 1)
+		c.log.Errorf("[%s] %s", urlValue.String(), err.Error())
+		return
+	}
+	c.recordRequest(task, request)
+	request, chain := withRedirectChain(request)
+	atomic.AddInt64(&c.stats.requests, 1)
+
+	// Count the request as in flight until the whole response has been read
+	fetched := c.track(&c.goroutines.fetching)
+	defer fetched()
+	response, err := c.client.Do(request)
+	if err != nil {
+		atomic.AddInt64(&c.stats.errors, 1)
+		c.log.Errorf("[%s] %s", urlValue.String(), err.Error())
+		if !errors.Is(err, context.Canceled) {
+			c.recordFailure(urlValue, err)
+		}
+		return
+	}
+	defer response.Body.Close() // Make sure the response gets closed
+	c.recordSuccess(urlValue)
+	c.recordRequested(request, response)
+
+	// Only parse HTML responses, and only so much of them
+	body, err := c.htmlBody(response)
+	if err != nil {
+		atomic.AddInt64(&c.stats.skipped, 1)
+		c.log.Infof("[%s] Skipping: %s", urlValue.String(), err.Error())
+		return nil
+	}
+
+	// Limit the time spent on the page, and recover from any panic, so that
+	// one pathological document cannot hold up or crash the whole crawl
+	ctx, cancel := c.extractionContext()
+	defer cancel()
+
+	// Keep the markup as it is parsed, to work out which forms its input
+	// fields belong to
+	var source bytes.Buffer
+	var document *html.Node
+	if panicErr := isolate(func() {
+		document, err = html.Parse(contextReader{ctx: ctx, reader: io.TeeReader(body, &source)})
+	}); panicErr != nil {
+		c.quarantine(urlValue, panicErr.Error())
+		return
+	}
+	fetched()
+	if limited, ok := body.(*limitedBody); ok && limited.truncated {
+		c.log.Warnf("[%s] Response is over the limit of %d bytes; only the start was searched", urlValue.String(), c.options.MaxBodySize)
+	}
+	if ctx.Err() != nil {
+		c.quarantine(urlValue, fmt.Sprintf("timed out after %s while parsing", time.Duration(c.options.ExtractionTimeout)))
+		return
+	}
+	if err != nil {
+		atomic.AddInt64(&c.stats.errors, 1)
+		c.log.Errorf("[%s] %s", urlValue.String(), err.Error())
+		return
+	}
+	atomic.AddInt64(&c.stats.pagesFetched, 1)
+	if c.options.MaxSimilar > 0 {
+		var fingerprint uint64
+		if panicErr := isolate(func() {
+			fingerprint = structureHash(ctx, document, c.walkLimits())
+		}); panicErr != nil {
+			c.quarantine(urlValue, panicErr.Error())
+			return
+		}
+		c.recordStructure(urlValue, fingerprint)
+	}
+
+	// Work from where the content actually came from, if the request was redirected
+	var redirects []string
+	if len(chain.URLs) > 1 {
+		redirects = chain.URLs
+		task.URL = response.Request.URL
+		task.URL.Fragment = ""
+		urlValue = task.URL
+		c.markVisited(urlValue)
+	}
+
+	// Only count the page, rather than searching it, if enough pages with the
+	// same forms have already been searched
+	sampled := false
+	if c.isSampling() && !c.options.APIOnly {
+		var fingerprint uint64
+		var hasFields bool
+		if panicErr := isolate(func() {
+			fingerprint, hasFields = formFingerprint(ctx, document, c.walkLimits(), urlValue)
+		}); panicErr != nil {
+			c.quarantine(urlValue, panicErr.Error())
+			return
+		}
+		sampled = hasFields && c.sampleTemplate(urlValue, fingerprint)
+	}
+
+	// Run the spidering function on the html document
+	var anchorsErr, inputsErr error
+	var links []Link
+	wg.Add(1)
+	c.spawn(&c.goroutines.parsing, func() {
+		defer wg.Done()
+		anchorsErr = isolate(func() {
+			links = c.getAnchors(ctx, document, task)
+		})
+	})
+
+	// Search for input fields in the html document, or for the scripts
+	// that call APIs in API-only mode
+	var inputs []Input
+	var scripts []*url.URL
+	wg.Add(1)
+	c.spawn(&c.goroutines.parsing, func() {
+		defer wg.Done()
+		inputsErr = isolate(func() {
+			if c.options.APIOnly {
+				scripts = c.getScripts(ctx, document, task)
+			} else if !sampled {
+				inputs = c.getInputs(ctx, document, source.Bytes(), urlValue)
+			}
+		})
+	})
+
+	// Wait for all the concurrent processes to finish
+	wg.Wait()
+
+	// Leave out the results of pages that could not be searched in full
+	if anchorsErr != nil {
+		c.quarantine(urlValue, anchorsErr.Error())
+		return
+	}
+	if inputsErr != nil {
+		c.quarantine(urlValue, inputsErr.Error())
+		return
+	}
+	if ctx.Err() != nil {
+		c.quarantine(urlValue, fmt.Sprintf("timed out after %s while searching", time.Duration(c.options.ExtractionTimeout)))
+		return
+	}
+
+	// Search the scripts the page loads for the APIs they call
+	for _, scriptURL := range scripts {
+		c.mineScript(scriptURL, task)
+	}
+
+	// Record the input elements found on the current URL, if any are found
+	if len(inputs) > 0 {
+		method := ""
+		if task.isSeedRequest() && task.Seed.Method != http.MethodGet {
+			method = task.Seed.Method
+		}
+		atomic.AddInt64(&c.stats.inputsFound, int64(len(inputs)))
+		c.addResult(PageResult{
+			URL:        urlValue.String(),
+			Tags:       task.Seed.Tags,
+			Redirects:  redirects,
+			FragmentOf: task.FragmentOf,
+
+			Authenticated: c.isAuthenticated(task.Seed, urlValue),
+			AuthProfile:   c.authProfile(task.Seed, urlValue),
+			Method:        method,
+			Links:         links,
+			Inputs:        inputs,
+		})
+	}
+
+	return
+}
+
+// Method newRequest creates the request for a task, with the task's request context.
+func (c *Crawler) newRequest(task Task) (*http.Request, error) {
+	method, body := http.MethodGet, io.Reader(nil)
+	if task.isSeedRequest() {
+		method = task.Seed.Method
+		if task.Seed.Body != "" {
+			body = strings.NewReader(task.Seed.Body)
+		}
+	}
+	request, err := http.NewRequest(method, task.URL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.applyHeaders(request, task)
+	if task.isSeedRequest() && task.Seed.ContentType != "" {
+		request.Header.Set("Content-Type", task.Seed.ContentType)
+	}
+	return request, nil
+}
+
+// Method addResult stores a page result and passes it on to the sinks.
+// Pages left out by the AuthState option are dropped.
+func (c *Crawler) addResult(result PageResult) {
+	c.keyToTarget(&result)
+	if !matchesAuthState(result, c.options.AuthState) {
+		c.log.Debugf("[%s] Leaving out the page, as it is not %s", result.URL, c.options.AuthState)
+		return
+	}
+	if c.history != nil {
+		c.history.Record(&result, c.options.StripSessionParams)
+	}
+
+	c.results.mutex.Lock()
+	c.results.Pages = append(c.results.Pages, result)
+	c.results.mutex.Unlock()
+
+	c.writeSinks(result)
+}
+
+// Method getAnchors parses out the links from anchor elements found in the
+// provided HTML node, and queues them up for processing.
+// task is the task for the current URL; the links found are one level deeper.
+// Relative links are resolved against the current URL, or the document's
+// <base href> if it has one.
+// It returns the links that open somewhere other than the page itself, or
+// that have a rel attribute.
+// The search stops early once ctx is done.
+func (c *Crawler) getAnchors(ctx context.Context, document *html.Node, task Task) (links []Link) {
+	currentURL := task.URL
+	baseURL := documentBase(ctx, document, currentURL, c.walkLimits())
+	contexts := findBrowsingContexts(ctx, document, c.walkLimits())
+
+	c.log.Debugf("[%s] Processing HTML for links", currentURL.String())
+
+	// Search the document tree for anchor values
+	walk(ctx, document, c.walkLimits(), func(node *html.Node, depth int) bool {
+		if node.Type == html.ElementNode && node.DataAtom == atom.A {
+			// We've found an anchor tag, get the href value
+			for _, attribute := range node.Attr {
+				if attribute.Key == "href" {
+
+					// Check for useless links
+					href := strings.TrimSpace(attribute.Val)
+					if href == "#" || href == "" {
+						continue
+					}
+
+					// Make sure it's a valid URL
+					urlValue, err := url.Parse(href)
+					if err != nil {
+						c.log.Warnf("[%s] Error parsing URL: %s", currentURL.String(), attribute.Val)
+						continue
+					}
+
+					// Resolve relative URLs, including paths relative to the
+					// current document (page2.html, ../admin/), the root (/login)
+					// and the scheme (//www.example.com/)
+					urlValue = baseURL.ResolveReference(urlValue)
+
+					// Keep the links that open elsewhere, or say how they relate to the page
+					target := contexts.baseTarget
+					if value, exists := attributeLookup(node, "target"); exists {
+						target = strings.TrimSpace(value)
+					}
+					rel := strings.TrimSpace(attributeValue(node, "rel"))
+					if opens := contexts.opens(target); opens != "" || rel != "" {
+						links = append(links, Link{URL: urlValue.String(), Target: target, Rel: rel, Opens: opens})
+					}
+
+					// Queue up the URL
+					c.addURL(urlValue, task.Depth+1, task.Seed)
+				}
+			}
+		}
+
+		// Queue up the HTML fragments the page loads in, if asked to
+		if c.options.Fragments && node.Type == html.ElementNode {
+			c.addFragments(node, baseURL, task)
+		}
+		return true
+	})
+	return links
+}
+
+// Function documentBase returns the URL that relative links in the document
+// are resolved against: the first <base href> in the document, itself
+// resolved against the current URL, or the current URL if there is none.
+func documentBase(ctx context.Context, document *html.Node, currentURL *url.URL, limits walkLimits) *url.URL {
+	var base *url.URL
+
+	// Search the document tree for the first base element with an href
+	walk(ctx, document, limits, func(node *html.Node, depth int) bool {
+		if base != nil {
+			return false
+		}
+		if node.Type == html.ElementNode && node.DataAtom == atom.Base {
+			for _, attribute := range node.Attr {
+				if attribute.Key != "href" {
+					continue
+				}
+				if href, err := url.Parse(strings.TrimSpace(attribute.Val)); err == nil {
+					base = currentURL.ResolveReference(href)
+					return false
+				}
+			}
+		}
+		return true
+	})
+
+	if base == nil {
+		return currentURL
+	}
+	return base
+}
+
+// Method addURL queues up the URL for processing if it is whitelisted, has
+// not already been visited, and is within the depth limit of its seed.
+// depth is the number of links followed from the seed to reach the URL.
+// URLs that are not whitelisted are kept in the out-of-scope buffer instead.
+// It returns true if the URL was queued.
+func (c *Crawler) addURL(urlValue *url.URL, depth int, seed *Seed) (queued bool) {
+	return c.addTask(Task{URL: urlValue, Depth: depth, Seed: seed})
+}
+
+// Method addTask queues up a task, in the same way as addURL.
+func (c *Crawler) addTask(task Task) (queued bool) {
+	urlValue, depth, seed := task.URL, task.Depth, task.Seed
+
+	// Respect the seed's depth limit
+	if seed.MaxDepth >= 0 && depth > seed.MaxDepth {
+		return
+	}
+
+	// Make sure the URL is in the whitelisted domains list
+	if c.isWhitelisted(urlValue) {
+		// Rebuild the url string, removing any hashes from the link
+		urlValue.Fragment = ""
+		urlString := urlValue.String()
+
+		// Make sure the URL has not been visited, in any of its equivalent forms
+		// Add the URL to visited now, to prevent race issues
+		if c.visited.Add(c.visitedKey(task)) {
+			c.log.Infof("[%s] URL found", urlString)
+
+			if c.skipSimilar(urlValue) {
+				return
+			}
+
+			// Queue up the URL for the dispatcher
+			c.frontier.Push(task)
+			c.signal()
+			queued = true
+		}
+
+	} else {
+		// Keep the URL, in case its origin is added to the whitelist later
+		urlValue.Fragment = ""
+		c.bufferOutOfScope(task)
+	}
+	return
+}
+
+// Method visitedKey returns the key a task is recorded under in the visited
+// URLs: its canonical URL. A seed requested with another method is kept
+// apart, so that a GET of the same URL is still made if a link to it is found.
+func (c *Crawler) visitedKey(task Task) string {
+	key := canonicalURL(task.URL, c.options.StripSessionParams)
+	if task.isSeedRequest() && task.Seed.Method != http.MethodGet {
+		key = task.Seed.Method + " " + key
+	}
+	return key
+}
+
+// Function splitVisitedKey splits a key of the visited URLs into the method
+// and the canonical URL of the request it stands for (see visitedKey). The
+// method is "" for the URLs of GET requests.
+func splitVisitedKey(key string) (method string, urlString string) {
+	if i := strings.IndexByte(key, ' '); i > 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
+}
+
+// Method markVisited adds a URL to the visited URLs, without queueing it up.
+func (c *Crawler) markVisited(urlValue *url.URL) {
+	c.visited.Add(canonicalURL(urlValue, c.options.StripSessionParams))
+}
+
+// Method isWhitelisted checks if a provided URL is on the whitelist: that
+// it is covered by one of the crawl's targets.
+func (c *Crawler) isWhitelisted(urlValue *url.URL) bool {
+	return c.targetFor(urlValue) != nil
+}
+
+// Method getInputs parses out the input elements from the provided HTML node.
+// source is the markup the node was parsed from, used to attribute input
+// fields to their forms when the markup is broken; it can be nil.
+// urlValue is the current URL that it is working with; this is used for contextual logging.
+// Input fields repeated exactly are only returned once, with a count.
+// The search stops early once ctx is done.
+func (c *Crawler) getInputs(ctx context.Context, document *html.Node, source []byte, urlValue *url.URL) (inputs []Input) {
+	c.log.Debugf("[%s] Processing HTML for inputs", urlValue.String())
+	baseURL := documentBase(ctx, document, urlValue, c.walkLimits())
+	forms := newFormIndex(ctx, document, source, c.walkLimits())
+	contexts := findBrowsingContexts(ctx, document, c.walkLimits())
+
+	// Search the document tree for input fields
+	result := walk(ctx, document, c.walkLimits(), func(node *html.Node, depth int) bool {
+		if node.Type == html.ElementNode && (node.DataAtom == atom.Input || node.DataAtom == atom.Button) {
+			// We've found an input or button tag, add it to the inputs slice
+			input := newInput(node)
+			input.Action, input.Method = formTarget(node, baseURL, forms)
+			input.FormTarget, input.FormRel = formWindow(node, forms, contexts)
+			input.SubmitsInto = contexts.opens(input.FormTarget)
+			input.FormWarning = forms.warnings[node]
+			input.Flags = inspectValue(input)
+			inputs = append(inputs, input)
+		}
+		return true
+	})
+	inputs = collapseDuplicates(inputs)
+
+	// Let the user know if part of the document was left out, or if its
+	// forms were ambiguous
+	if len(forms.warnings) > 0 {
+		c.log.Warnf("[%s] %d input field(s) are in broken form markup, such as nested forms; browsers may not submit them with the form they appear to be in", urlValue.String(), len(forms.warnings))
+	}
+	if result.TooDeep {
+		c.log.Warnf("[%s] Document is nested more than %d levels deep; the deeper elements were not searched", urlValue.String(), c.options.MaxNodeDepth)
+	}
+	if result.TooMany {
+		c.log.Warnf("[%s] Document has more than %d nodes; only the first %d were searched", urlValue.String(), c.options.MaxNodes, c.options.MaxNodes)
+	}
+
+	return
+}
+
+// networkTransport is the bottom of a crawler's HTTP transport, that sends the
+// requests through the crawler's network transport, as it is when they are
+// sent. This lets the network transport be swapped out, such as by tests,
+// after the rest of the transport has been put together on top of it.
+type networkTransport struct {
+	crawler *Crawler
+}
+
+// Method RoundTrip sends a request through the crawler's network transport.
+func (t networkTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	return t.crawler.network.RoundTrip(request)
+}
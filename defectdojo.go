@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The scan type DefectDojo imports generic findings files as
+const dojoScanType = "Generic Findings Import"
+
+// dojoReport is a findings file in DefectDojo's generic findings import format.
+type dojoReport struct {
+	Findings []dojoFinding `json:"findings"`
+}
+
+// dojoFinding is a single finding in DefectDojo's generic findings import format.
+type dojoFinding struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Mitigation  string         `json:"mitigation,omitempty"`
+	Severity    string         `json:"severity"`
+	CWE         int            `json:"cwe,omitempty"`
+	Date        string         `json:"date"`
+	Active      bool           `json:"active"`
+	Verified    bool           `json:"verified"`
+	UniqueID    string         `json:"unique_id_from_tool"`
+	Endpoints   []dojoEndpoint `json:"endpoints,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	// Service is the target the finding belongs to
+	Service string `json:"service,omitempty"`
+}
+
+// dojoEndpoint is a URL a finding was found on, split up as DefectDojo expects.
+type dojoEndpoint struct {
+	Protocol string `json:"protocol"`
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Query    string `json:"query,omitempty"`
+}
+
+// Function dojoReportFor converts findings to DefectDojo's generic findings
+// import format, dated the given day.
+func dojoReportFor(findings []Finding, date time.Time) dojoReport {
+	report := dojoReport{Findings: []dojoFinding{}}
+	for _, finding := range findings {
+		converted := dojoFinding{
+			Title:       finding.Title,
+			Description: finding.Description,
+			Mitigation:  finding.Mitigation,
+			Severity:    finding.Severity.String(),
+			CWE:         finding.CWE,
+			Date:        date.Format("2006-01-02"),
+			Active:      true,
+			UniqueID:    finding.ID,
+			Tags:        finding.Tags,
+			Service:     finding.Target,
+		}
+		for _, urlString := range finding.URLs {
+			endpointURL, err := url.Parse(urlString)
+			if err != nil {
+				continue
+			}
+			endpoint := dojoEndpoint{
+				Protocol: endpointURL.Scheme,
+				Host:     endpointURL.Hostname(),
+				Path:     strings.TrimPrefix(endpointURL.EscapedPath(), "/"),
+				Query:    endpointURL.RawQuery,
+			}
+			if port := endpointURL.Port(); port != "" {
+				endpoint.Port, _ = strconv.Atoi(port)
+			}
+			converted.Endpoints = append(converted.Endpoints, endpoint)
+		}
+		report.Findings = append(report.Findings, converted)
+	}
+	return report
+}
+
+// Function encodeDojoReport returns findings as a DefectDojo generic findings
+// file, dated the given day.
+func encodeDojoReport(findings []Finding, date time.Time) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(dojoReportFor(findings, date)); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Function writeDefectDojo writes findings to the file at the given path, in
+// DefectDojo's generic findings import format.
+func writeDefectDojo(path string, findings []Finding) error {
+	report, err := encodeDojoReport(findings, time.Now())
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, report, 0644)
+}
+
+// Function pushDefectDojo imports findings into an engagement through the
+// DefectDojo API at the given base URL (e.g. https://defectdojo.example.com),
+// authenticating with an API v2 key.
+func pushDefectDojo(baseURL string, token string, engagement int, findings []Finding) error {
+	report, err := encodeDojoReport(findings, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	fields := map[string]string{
+		"scan_type":        dojoScanType,
+		"engagement":       strconv.Itoa(engagement),
+		"active":           "true",
+		"verified":         "false",
+		"minimum_severity": SeverityInfo.String(),
+		"scan_date":        time.Now().Format("2006-01-02"),
+	}
+	for key, value := range fields {
+		if err := form.WriteField(key, value); err != nil {
+			return err
+		}
+	}
+	file, err := form.CreateFormFile("file", "input-field-finder.json")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(report); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/api/v2/import-scan/", &body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Token "+token)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+
+	client := &http.Client{Timeout: time.Minute}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("DefectDojo responded with %s: %s", response.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// Function defectDojoToken returns the DefectDojo API key to use: the one given,
+// or otherwise the DEFECTDOJO_API_KEY environment variable, so that the key
+// does not need to appear on the command line.
+func defectDojoToken(token string) (string, error) {
+	if token == "" {
+		token = os.Getenv("DEFECTDOJO_API_KEY")
+	}
+	if token == "" {
+		return "", errors.New("-defectdojo-url requires an API key, with -defectdojo-token or the DEFECTDOJO_API_KEY environment variable")
+	}
+	return token, nil
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The number of requests in a row to a host that must fail before the host
+// is diagnosed
+const diagnoseAfter = 5
+
+// Timeout for each step of a diagnosis
+const diagnoseTimeout = 10 * time.Second
+
+// HostDiagnosis is what a one-shot check of a failing host found, one step
+// at a time: what its name resolves to, whether it accepts a TCP connection,
+// how its TLS handshake goes, and how it answers a HEAD request. The steps
+// stop at the first that fails, and the verdict explains what the failure
+// most likely means.
+type HostDiagnosis struct {
+	URL     string         `json:"url"`
+	Time    time.Time      `json:"time"`
+	DNS     *DNSDiagnosis  `json:"dns,omitempty"`
+	TCP     *TCPDiagnosis  `json:"tcp,omitempty"`
+	TLS     *TLSDiagnosis  `json:"tls,omitempty"`
+	HTTP    *HTTPDiagnosis `json:"http,omitempty"`
+	Verdict string         `json:"verdict"`
+}
+
+// DNSDiagnosis is the answer to a fresh lookup of a host, bypassing the DNS
+// failure cache. Hosts given as IP addresses are not looked up.
+type DNSDiagnosis struct {
+	Addresses    []string `json:"addresses,omitempty"`
+	NotFound     bool     `json:"not_found,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	Milliseconds int64    `json:"ms"`
+}
+
+// TCPDiagnosis is the outcome of connecting to each of a host's addresses,
+// until one accepts the connection.
+type TCPDiagnosis struct {
+	Address      string `json:"address"`
+	Refused      bool   `json:"refused,omitempty"`
+	TimedOut     bool   `json:"timed_out,omitempty"`
+	Error        string `json:"error,omitempty"`
+	Milliseconds int64  `json:"ms"`
+}
+
+// TLSDiagnosis is the outcome of a TLS handshake with an https host, and the
+// certificate it presented. The certificate is checked against the system's
+// roots, but is accepted either way, as when crawling.
+type TLSDiagnosis struct {
+	Version      string   `json:"version,omitempty"`
+	CipherSuite  string   `json:"cipher_suite,omitempty"`
+	ALPN         string   `json:"alpn,omitempty"`
+	Subject      string   `json:"subject,omitempty"`
+	Issuer       string   `json:"issuer,omitempty"`
+	DNSNames     []string `json:"dns_names,omitempty"`
+	NotAfter     string   `json:"not_after,omitempty"`
+	VerifyError  string   `json:"verify_error,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	Milliseconds int64    `json:"ms"`
+}
+
+// HTTPDiagnosis is the answer to a HEAD request for the failing URL, sent
+// with the crawl's headers. Redirects are not followed.
+type HTTPDiagnosis struct {
+	Status       int    `json:"status,omitempty"`
+	Server       string `json:"server,omitempty"`
+	Error        string `json:"error,omitempty"`
+	Milliseconds int64  `json:"ms"`
+}
+
+// FailingHost is a host that requests failed for repeatedly during a crawl.
+type FailingHost struct {
+	Host string `json:"host"`
+	// Failures is the number of requests to the host that failed in all
+	Failures  int            `json:"failures"`
+	LastError string         `json:"last_error"`
+	Diagnosis *HostDiagnosis `json:"diagnosis,omitempty"`
+	// The number of requests in a row that have failed
+	consecutive int
+}
+
+// FailingHosts tracks the requests that fail for each host, to diagnose the
+// hosts that keep failing.
+type FailingHosts struct {
+	ByHost map[string]*FailingHost
+	mutex  sync.Mutex
+}
+
+// Function milliseconds returns the time since start, in milliseconds.
+func milliseconds(start time.Time) int64 {
+	return int64(time.Since(start) / time.Millisecond)
+}
+
+// Method diagnose checks each layer of the connection to a URL's host in
+// turn: DNS, TCP, TLS (for https) and HTTP.
+func (c *Crawler) diagnose(target *url.URL) *HostDiagnosis {
+	diagnosis := &HostDiagnosis{URL: target.String(), Time: time.Now().UTC()}
+	host, port := target.Hostname(), target.Port()
+	if port == "" {
+		port = "80"
+		if strings.EqualFold(target.Scheme, "https") {
+			port = "443"
+		}
+	}
+
+	// Resolve the host afresh, rather than through the DNS failure cache
+	addresses := []string{host}
+	if net.ParseIP(host) == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), diagnoseTimeout)
+		start := time.Now()
+		found, err := net.DefaultResolver.LookupHost(ctx, host)
+		cancel()
+		diagnosis.DNS = &DNSDiagnosis{Addresses: found, Milliseconds: milliseconds(start)}
+		if err != nil {
+			var dnsErr *net.DNSError
+			diagnosis.DNS.NotFound = errors.As(err, &dnsErr) && dnsErr.IsNotFound
+			diagnosis.DNS.Error = err.Error()
+			diagnosis.Verdict = diagnosis.verdict()
+			return diagnosis
+		}
+		addresses = found
+	}
+
+	// Connect to each address in turn, until one accepts
+	connector := net.Dialer{Timeout: diagnoseTimeout}
+	var conn net.Conn
+	for _, address := range addresses {
+		start := time.Now()
+		var err error
+		diagnosis.TCP = &TCPDiagnosis{Address: net.JoinHostPort(address, port)}
+		conn, err = connector.Dial("tcp", diagnosis.TCP.Address)
+		diagnosis.TCP.Milliseconds = milliseconds(start)
+		if err == nil {
+			break
+		}
+		var netErr net.Error
+		diagnosis.TCP.Refused = errors.Is(err, syscall.ECONNREFUSED)
+		diagnosis.TCP.TimedOut = errors.As(err, &netErr) && netErr.Timeout()
+		diagnosis.TCP.Error = err.Error()
+	}
+	if conn == nil {
+		diagnosis.Verdict = diagnosis.verdict()
+		return diagnosis
+	}
+
+	if strings.EqualFold(target.Scheme, "https") {
+		diagnosis.TLS = handshake(conn, host)
+	}
+	conn.Close()
+	if diagnosis.TLS != nil && diagnosis.TLS.Error != "" {
+		diagnosis.Verdict = diagnosis.verdict()
+		return diagnosis
+	}
+
+	// Ask for the URL itself, as the crawl would, but without the rest of
+	// the crawl's transport (such as its rate limits and cache)
+	diagnosis.HTTP = &HTTPDiagnosis{}
+	start := time.Now()
+	request, err := http.NewRequest(http.MethodHead, target.String(), nil)
+	if err == nil {
+		c.applyHeaders(request, Task{URL: target, UserAgent: c.options.UserAgent, AcceptLanguage: c.options.AcceptLanguage, Seed: &Seed{}})
+		client := &http.Client{
+			Transport: networkTransport{crawler: c},
+			Timeout:   diagnoseTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		var response *http.Response
+		if response, err = client.Do(request); err == nil {
+			response.Body.Close()
+			diagnosis.HTTP.Status = response.StatusCode
+			diagnosis.HTTP.Server = response.Header.Get("Server")
+		}
+	}
+	if err != nil {
+		diagnosis.HTTP.Error = err.Error()
+	}
+	diagnosis.HTTP.Milliseconds = milliseconds(start)
+	diagnosis.Verdict = diagnosis.verdict()
+	return diagnosis
+}
+
+// Function handshake runs a TLS handshake over a connection, and describes
+// how it went and the certificate presented.
+func handshake(conn net.Conn, serverName string) *TLSDiagnosis {
+	diagnosis := &TLSDiagnosis{}
+	ctx, cancel := context.WithTimeout(context.Background(), diagnoseTimeout)
+	defer cancel()
+
+	start := time.Now()
+	client := tls.Client(conn, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2", "http/1.1"},
+	})
+	err := client.HandshakeContext(ctx)
+	diagnosis.Milliseconds = milliseconds(start)
+	if err != nil {
+		diagnosis.Error = err.Error()
+		return diagnosis
+	}
+
+	state := client.ConnectionState()
+	diagnosis.Version = tls.VersionName(state.Version)
+	diagnosis.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+	diagnosis.ALPN = state.NegotiatedProtocol
+	if len(state.PeerCertificates) > 0 {
+		certificate := state.PeerCertificates[0]
+		diagnosis.Subject = certificate.Subject.String()
+		diagnosis.Issuer = certificate.Issuer.String()
+		diagnosis.DNSNames = certificate.DNSNames
+		diagnosis.NotAfter = certificate.NotAfter.UTC().Format(time.RFC3339)
+
+		intermediates := x509.NewCertPool()
+		for _, intermediate := range state.PeerCertificates[1:] {
+			intermediates.AddCert(intermediate)
+		}
+		if _, err := certificate.Verify(x509.VerifyOptions{DNSName: serverName, Intermediates: intermediates}); err != nil {
+			diagnosis.VerifyError = err.Error()
+		}
+	}
+	return diagnosis
+}
+
+// Method verdict explains what the diagnosis most likely means, from the
+// first step that failed.
+func (d *HostDiagnosis) verdict() string {
+	switch {
+	case d.DNS != nil && d.DNS.NotFound:
+		return "the host does not exist in DNS; check the scope for a typo"
+	case d.DNS != nil && d.DNS.Error != "":
+		return "the host could not be looked up; the resolver may be unreachable, or blocking the name"
+	case d.TCP != nil && d.TCP.Error != "" && d.TCP.Refused:
+		return "the connection was refused; nothing is listening on the port, or a firewall is rejecting connections"
+	case d.TCP != nil && d.TCP.Error != "" && d.TCP.TimedOut:
+		return "the connection timed out; a firewall or network policy is likely dropping traffic to the host"
+	case d.TCP != nil && d.TCP.Error != "":
+		return "the host could not be connected to"
+	case d.TLS != nil && d.TLS.Error != "":
+		return "the TLS handshake failed; the port may not serve TLS, or something in between is interfering"
+	case d.HTTP != nil && d.HTTP.Error != "":
+		return "the host accepts connections, but did not answer the HTTP request"
+	case d.HTTP != nil:
+		return fmt.Sprintf("the host answers (HTTP %d); the crawl's requests are failing for another reason, such as being rate limited or blocked", d.HTTP.Status)
+	}
+	return "the diagnosis did not run"
+}
+
+// Method lines describes each step of the diagnosis, for the log.
+func (d *HostDiagnosis) lines() []string {
+	var lines []string
+	if d.DNS != nil {
+		if d.DNS.Error != "" {
+			lines = append(lines, fmt.Sprintf("DNS: %s (%dms)", d.DNS.Error, d.DNS.Milliseconds))
+		} else {
+			lines = append(lines, fmt.Sprintf("DNS: %s (%dms)", strings.Join(d.DNS.Addresses, ", "), d.DNS.Milliseconds))
+		}
+	}
+	if d.TCP != nil {
+		if d.TCP.Error != "" {
+			lines = append(lines, fmt.Sprintf("TCP: %s (%dms)", d.TCP.Error, d.TCP.Milliseconds))
+		} else {
+			lines = append(lines, fmt.Sprintf("TCP: connected to %s (%dms)", d.TCP.Address, d.TCP.Milliseconds))
+		}
+	}
+	if d.TLS != nil {
+		if d.TLS.Error != "" {
+			lines = append(lines, fmt.Sprintf("TLS: %s (%dms)", d.TLS.Error, d.TLS.Milliseconds))
+		} else {
+			line := fmt.Sprintf("TLS: %s, %s, certificate for %s issued by %s (%dms)", d.TLS.Version, d.TLS.CipherSuite, d.TLS.Subject, d.TLS.Issuer, d.TLS.Milliseconds)
+			if d.TLS.VerifyError != "" {
+				line += "; not trusted: " + d.TLS.VerifyError
+			}
+			lines = append(lines, line)
+		}
+	}
+	if d.HTTP != nil {
+		if d.HTTP.Error != "" {
+			lines = append(lines, fmt.Sprintf("HTTP: %s (%dms)", d.HTTP.Error, d.HTTP.Milliseconds))
+		} else {
+			lines = append(lines, fmt.Sprintf("HTTP: HEAD answered %d (%dms)", d.HTTP.Status, d.HTTP.Milliseconds))
+		}
+	}
+	return lines
+}
+
+// Method logDiagnosis writes a diagnosis to the log, as a warning.
+func (c *Crawler) logDiagnosis(diagnosis *HostDiagnosis) {
+	c.log.Warnf("[DIAGNOSIS] [%s] %s", diagnosis.URL, diagnosis.Verdict)
+	for _, line := range diagnosis.lines() {
+		c.log.Warnf("[DIAGNOSIS] \t%s", line)
+	}
+}
+
+// Method recordFailure counts a failed request against its host. Once
+// diagnoseAfter requests in a row to the host have failed, the host is
+// diagnosed, once, if the Diagnose option is set. The diagnosis runs in the
+// goroutine of the failed request, so the crawl does not finish before it.
+func (c *Crawler) recordFailure(target *url.URL, err error) {
+	host := canonicalHost(target)
+
+	c.failing.mutex.Lock()
+	failing, exists := c.failing.ByHost[host]
+	if !exists {
+		failing = &FailingHost{Host: host}
+		c.failing.ByHost[host] = failing
+	}
+	failing.Failures++
+	failing.consecutive++
+	failing.LastError = err.Error()
+	diagnose := c.options.Diagnose && failing.consecutive == diagnoseAfter && failing.Diagnosis == nil
+	if diagnose {
+		// Hold the place of the diagnosis, so that it only runs once
+		failing.Diagnosis = &HostDiagnosis{URL: target.String(), Verdict: "being diagnosed"}
+	}
+	c.failing.mutex.Unlock()
+
+	if !diagnose {
+		return
+	}
+	c.log.Warnf("[%s] %d requests in a row have failed; diagnosing the host", host, diagnoseAfter)
+	diagnosis := c.diagnose(target)
+	c.logDiagnosis(diagnosis)
+
+	c.failing.mutex.Lock()
+	failing.Diagnosis = diagnosis
+	c.failing.mutex.Unlock()
+}
+
+// Method recordSuccess marks a host as answering again.
+func (c *Crawler) recordSuccess(target *url.URL) {
+	c.failing.mutex.Lock()
+	defer c.failing.mutex.Unlock()
+	if failing, exists := c.failing.ByHost[canonicalHost(target)]; exists {
+		failing.consecutive = 0
+	}
+}
+
+// Method FailingHosts returns the hosts that diagnoseAfter requests in a row
+// failed for at some point in the crawl, with their diagnoses, by host.
+func (c *Crawler) FailingHosts() []FailingHost {
+	c.failing.mutex.Lock()
+	defer c.failing.mutex.Unlock()
+
+	hosts := []FailingHost{}
+	for _, failing := range c.failing.ByHost {
+		if failing.Diagnosis != nil || failing.consecutive >= diagnoseAfter {
+			hosts = append(hosts, *failing)
+		}
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].Host < hosts[j].Host
+	})
+	return hosts
+}
+
+// Function writeFailingHosts writes the hosts that kept failing to the file
+// at the given path, with their diagnoses, as JSON lines.
+func writeFailingHosts(path string, hosts []FailingHost) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	for _, host := range hosts {
+		if err := encoder.Encode(host); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
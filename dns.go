@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a failed DNS lookup is remembered for after the first failure.
+// The time doubles with each further failure, up to the maximum.
+const (
+	dnsFailureTTL    = 30 * time.Second
+	dnsFailureMaxTTL = 10 * time.Minute
+)
+
+// DNSCache remembers the hosts that failed to resolve, so that repeated links
+// to a dead host fail straight away instead of waiting on the resolver again.
+// Concurrent lookups of the same host share a single query.
+type DNSCache struct {
+	Failures map[string]*dnsFailure
+	pending  map[string]*dnsLookup
+	mutex    sync.Mutex
+}
+
+// A lookup in progress, that other lookups of the same host wait on
+type dnsLookup struct {
+	done      chan struct{}
+	addresses []string
+	err       error
+}
+
+// A host that failed to resolve
+type dnsFailure struct {
+	err      error
+	failures int
+	until    time.Time
+}
+
+// The DNS failure cache shared by all crawlers, alongside the transport
+var dnsCache = &DNSCache{
+	Failures: make(map[string]*dnsFailure),
+	pending:  make(map[string]*dnsLookup),
+}
+
+// The dialer used for connections, once the host has been resolved
+var dialer = &net.Dialer{
+	Timeout:   30 * time.Second,
+	KeepAlive: 30 * time.Second,
+}
+
+// Method Lookup resolves a host, failing straight away if the host failed
+// to resolve recently. Only failures that come from the DNS itself (such as
+// NXDOMAIN or SERVFAIL) are remembered; a cancelled lookup is not.
+func (d *DNSCache) Lookup(ctx context.Context, host string) ([]string, error) {
+	host = strings.ToLower(host)
+
+	d.mutex.Lock()
+	failure, exists := d.Failures[host]
+	if exists && time.Now().Before(failure.until) {
+		d.mutex.Unlock()
+		return nil, failure.err
+	}
+
+	// Wait on the lookup already in progress for the host, if there is one
+	if lookup, exists := d.pending[host]; exists {
+		d.mutex.Unlock()
+		select {
+		case <-lookup.done:
+			return lookup.addresses, lookup.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	lookup := &dnsLookup{done: make(chan struct{})}
+	d.pending[host] = lookup
+	d.mutex.Unlock()
+
+	addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	lookup.addresses, lookup.err = addresses, err
+	delete(d.pending, host)
+	close(lookup.done)
+	if err == nil {
+		delete(d.Failures, host)
+		return addresses, nil
+	}
+
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || ctx.Err() != nil {
+		return nil, err
+	}
+
+	// Back off for longer each time the host fails again
+	failure, exists = d.Failures[host]
+	if !exists {
+		failure = &dnsFailure{}
+		d.Failures[host] = failure
+	}
+	failure.failures++
+	ttl := dnsFailureTTL << uint(failure.failures-1)
+	if ttl > dnsFailureMaxTTL || ttl <= 0 {
+		ttl = dnsFailureMaxTTL
+	}
+	failure.until = time.Now().Add(ttl)
+	failure.err = &net.DNSError{
+		Err:         dnsErr.Err + " (cached for " + ttl.String() + ")",
+		Name:        dnsErr.Name,
+		Server:      dnsErr.Server,
+		IsNotFound:  dnsErr.IsNotFound,
+		IsTemporary: dnsErr.IsTemporary,
+	}
+	return nil, err
+}
+
+// Method DialContext connects to the address, resolving the host through the
+// cache. Each of the host's addresses is tried in turn.
+func (d *DNSCache) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	addresses, err := d.Lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	lastErr := errors.New("no addresses found for " + host)
+	for _, ip := range addresses {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
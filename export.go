@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The export format for DefectDojo's generic findings import
+const FormatDefectDojo = "defectdojo"
+
+// The formats results can be exported in
+var exportFormats = []string{FormatJSON, FormatJSONL, FormatCSV, FormatDefectDojo}
+
+// The orders results can be exported in
+const (
+	OrderURL  = "url"
+	OrderRisk = "risk"
+)
+
+// bufferCloser is a buffer that sinks can write to, and close.
+type bufferCloser struct {
+	*bytes.Buffer
+}
+
+// Method Close does nothing, as the buffer is read once the sink is closed.
+func (b bufferCloser) Close() error {
+	return nil
+}
+
+// Function runExport runs the `export` subcommand, regenerating an output
+// file from the results saved by an earlier crawl, without crawling again.
+// The same results always give the same bytes, so that a report can be
+// issued again later, and checked against the hash recorded when it was
+// first issued. It returns the exit status.
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", FormatJSON, "The format to export: "+strings.Join(exportFormats, ", ")+".")
+	output := flags.String("output", "", "The file to write the export to. Defaults to stdout.")
+	checksums := flags.String("checksums", "", "A file of SHA-256 hashes, in the format of sha256sum, to record the hash of the -output in, replacing any hash recorded for it before.")
+	verify := flags.Bool("verify", false, "Check the export against the hash recorded for the -output in -checksums, rather than writing it.")
+	date := flags.String("date", "", "The date of the findings in the defectdojo format, such as 2026-10-14; needed so that the export is the same every time.")
+	order := flags.String("sort", OrderURL, "The order to export the pages in: url, or risk for the riskiest first (see -risk).")
+	since := flags.String("first-seen-since", "", "Only export the input fields first seen since a date (such as 2026-09-14), or within an age (such as 30d), from results recorded with -history.")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s export [flags] <results file>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Regenerates an output file from the results of an earlier crawl, saved with -output (in the json or jsonl format) or from the scan API.\n\n")
+		flags.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "\t%s export -format=csv -output=report.csv -checksums=SHA256SUMS results.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s export -format=csv -output=report.csv -checksums=SHA256SUMS -verify results.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s export -format=csv -first-seen-since=2026-09-14 -output=new.csv results.json\n", os.Args[0])
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 1
+	}
+	if (*checksums != "" || *verify) && *output == "" {
+		logger.Errorf("-checksums and -verify need an -output, to record the hash under")
+		return 1
+	}
+	if *verify && *checksums == "" {
+		logger.Errorf("-verify needs the -checksums file to check against")
+		return 1
+	}
+
+	pages, err := loadResults(flags.Arg(0))
+	if err != nil {
+		logger.Errorf("%s", err.Error())
+		return 1
+	}
+	if *since != "" {
+		start, err := parseSince(*since, time.Now())
+		if err != nil {
+			logger.Errorf("%s", err.Error())
+			return 1
+		}
+		pages = firstSeenSince(pages, start)
+	}
+	data, err := exportResults(pages, *format, *date, *order)
+	if err != nil {
+		logger.Errorf("%s", err.Error())
+		return 1
+	}
+	sum := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	if *verify {
+		recorded, err := readChecksums(*checksums)
+		if err != nil {
+			logger.Errorf("Unable to read %s: %s", *checksums, err.Error())
+			return 1
+		}
+		expected, exists := recorded[*output]
+		if !exists {
+			logger.Errorf("No hash is recorded for %s in %s", *output, *checksums)
+			return 1
+		}
+		if expected != sum {
+			fmt.Printf("%s: FAILED (the export hashes to %s, but %s was recorded)\n", *output, sum, expected)
+			return 1
+		}
+		fmt.Printf("%s: OK\n", *output)
+		return 0
+	}
+
+	if *output == "" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	if err := ioutil.WriteFile(*output, data, 0644); err != nil {
+		logger.Errorf("Unable to write %s: %s", *output, err.Error())
+		return 1
+	}
+	if *checksums != "" {
+		if err := recordChecksum(*checksums, *output, sum); err != nil {
+			logger.Errorf("Unable to record the hash of %s in %s: %s", *output, *checksums, err.Error())
+			return 1
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%s  %s\n", sum, *output)
+	return 0
+}
+
+// Function exportResults encodes page results in an export format. The
+// pages are sorted first, by URL or riskiest first (see sortByRisk), so that
+// the output only depends on the results, and not on the order they were
+// found in. The defectdojo format is dated with date, in the form 2006-01-02.
+func exportResults(pages []PageResult, format string, date string, order string) ([]byte, error) {
+	pages = append([]PageResult(nil), pages...)
+	sortPages := sortResults
+	switch order {
+	case OrderURL:
+	case OrderRisk:
+		sortPages = sortByRisk
+	default:
+		return nil, fmt.Errorf("unknown order: %s (expected %s or %s)", order, OrderURL, OrderRisk)
+	}
+	sortPages(pages)
+
+	switch format {
+	case FormatJSON, FormatJSONL, FormatCSV:
+		var buffer bytes.Buffer
+		sink := newFileSink(bufferCloser{&buffer}, format)
+		sink.Order = sortPages
+		for _, page := range pages {
+			if err := sink.Write(page); err != nil {
+				return nil, err
+			}
+		}
+		if err := sink.Close(); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	case FormatDefectDojo:
+		if date == "" {
+			return nil, errors.New("the defectdojo format needs a -date, so that the findings are dated the same every time")
+		}
+		day, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return nil, errors.New("invalid date " + date + ": must be in the form 2006-01-02")
+		}
+		return encodeDojoReport(collectFindings(pages, findConflicts(pages)), day)
+	default:
+		return nil, fmt.Errorf("unknown export format: %s (expected %s)", format, strings.Join(exportFormats, ", "))
+	}
+}
+
+// Function readChecksums reads a file of SHA-256 hashes in the format of
+// sha256sum, returning the hash of each file named in it.
+func readChecksums(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if text == "" {
+			continue
+		}
+		// The hash, a space, then a space (text mode) or * (binary mode)
+		if len(text) < 67 || text[64] != ' ' || (text[65] != ' ' && text[65] != '*') {
+			return nil, fmt.Errorf("line %d is not in the format of sha256sum", line)
+		}
+		sums[text[66:]] = strings.ToLower(text[:64])
+	}
+	return sums, scanner.Err()
+}
+
+// Function recordChecksum records the hash of a file in a file of SHA-256
+// hashes, replacing any hash recorded for it before. The file is written
+// sorted by name, and can be checked with `sha256sum -c`.
+func recordChecksum(path string, name string, sum string) error {
+	sums, err := readChecksums(path)
+	if os.IsNotExist(err) {
+		sums, err = make(map[string]string), nil
+	}
+	if err != nil {
+		return err
+	}
+	sums[name] = sum
+
+	names := make([]string, 0, len(sums))
+	for recorded := range sums {
+		names = append(names, recorded)
+	}
+	sort.Strings(names)
+	var buffer bytes.Buffer
+	for _, recorded := range names {
+		fmt.Fprintf(&buffer, "%s  %s\n", sums[recorded], recorded)
+	}
+	return ioutil.WriteFile(path, buffer.Bytes(), 0644)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// The default time limit for reading and searching each page
+const defaultExtractionTimeout = 30 * time.Second
+
+// QuarantinedPage is a page that could not be searched, as searching it took
+// too long or crashed, kept for analysing offline.
+type QuarantinedPage struct {
+	URL    string    `json:"url"`
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+// Method extractionContext returns the context that limits the time spent
+// reading and searching a page, according to the ExtractionTimeout option.
+func (c *Crawler) extractionContext() (context.Context, context.CancelFunc) {
+	if c.options.ExtractionTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), time.Duration(c.options.ExtractionTimeout))
+}
+
+// Function isolate runs part of a page's extraction, recovering from any
+// panic so that one page cannot crash the whole crawl. The panic is returned
+// as an error, including the stack trace.
+func isolate(function func()) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v\n%s", recovered, debug.Stack())
+		}
+	}()
+
+	function()
+	return nil
+}
+
+// Method quarantine records a page that could not be searched.
+func (c *Crawler) quarantine(urlValue *url.URL, reason string) {
+	atomic.AddInt64(&c.stats.quarantined, 1)
+	c.log.Warnf("[QUARANTINE] [%s] %s", urlValue.String(), reason)
+
+	c.quarantined.mutex.Lock()
+	defer c.quarantined.mutex.Unlock()
+	c.quarantined.Pages = append(c.quarantined.Pages, QuarantinedPage{
+		URL:    urlValue.String(),
+		Reason: reason,
+		Time:   time.Now(),
+	})
+}
+
+// Method Quarantined returns a copy of the pages that could not be searched so far.
+func (c *Crawler) Quarantined() []QuarantinedPage {
+	c.quarantined.mutex.Lock()
+	defer c.quarantined.mutex.Unlock()
+
+	pages := make([]QuarantinedPage, len(c.quarantined.Pages))
+	copy(pages, c.quarantined.Pages)
+	return pages
+}
+
+// Function writeQuarantine writes the quarantined pages to the file at the
+// given path, as JSON lines.
+func writeQuarantine(path string, pages []QuarantinedPage) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	for _, page := range pages {
+		if err := encoder.Encode(page); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// contextReader stops reading once its context is done, so that the parser
+// gives up on a page that has run out of time.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+// Method Read reads from the underlying reader, unless the context is done.
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
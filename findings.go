@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Severity is how serious a finding is, from informational to critical.
+type Severity int
+
+// The severities of findings, from least to most serious
+const (
+	SeverityInfo Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+// Method String returns the name of the severity, as used by vulnerability
+// management tools: Info, Low, Medium, High or Critical.
+func (s Severity) String() string {
+	switch s {
+	case SeverityLow:
+		return "Low"
+	case SeverityMedium:
+		return "Medium"
+	case SeverityHigh:
+		return "High"
+	case SeverityCritical:
+		return "Critical"
+	default:
+		return "Info"
+	}
+}
+
+// Finding is something found by a crawl that is worth tracking in a
+// vulnerability management tool, such as the attack surface of a page or a
+// weakness in how an input field is handled.
+type Finding struct {
+	Title       string
+	Description string
+	Mitigation  string
+	Severity    Severity
+	// CWE is the number of the Common Weakness Enumeration entry the
+	// finding is an example of; 0 = none
+	CWE int
+	// URLs are the pages the finding was found on
+	URLs []string
+	Tags []string
+	// Target is the name of the target the pages belong to, if they all
+	// belong to the same one
+	Target string
+	// ID identifies the finding across scans, so that tools can spot that
+	// a finding was already reported
+	ID string
+}
+
+// Function findingID returns a stable identifier for a finding, from the
+// kind of finding and what it was found on.
+func findingID(kind string, parts ...string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(kind+"\n"+strings.Join(parts, "\n"))))
+}
+
+// Function collectFindings turns the results of a crawl into findings:
+//   - each page with input fields, as informational attack surface;
+//   - each password field on a page served, or submitted, over plain HTTP;
+//   - each form that submits into an iframe or another window, as informational;
+//   - each credential or debug switch in the value of an input field (see inspectValue);
+//   - each input field with conflicting types or validation (see findConflicts).
+func collectFindings(results []PageResult, conflicts []Conflict) []Finding {
+	var findings []Finding
+
+	targets := make(map[string]string)
+	for _, page := range results {
+		targets[page.URL] = page.Target
+		if len(page.Inputs) == 0 {
+			continue
+		}
+
+		// Pages sent with another method, body or auth profile are results
+		// of their own, with findings of their own; for a plain GET the key
+		// is the URL, as it always was
+		key := resultKey(page)
+		path := page.URL
+		if pageURL, err := url.Parse(page.URL); err == nil {
+			path = pageURL.EscapedPath()
+		}
+
+		var fields []string
+		for _, input := range page.Inputs {
+			fields = append(fields, "- `"+input.HTML+"`")
+		}
+		findings = append(findings, Finding{
+			Title:       fmt.Sprintf("%d input field(s) found on %s", len(page.Inputs), path),
+			Description: fmt.Sprintf("The page at %s accepts user input through the following fields:\n\n%s", page.URL, strings.Join(fields, "\n")),
+			Severity:    SeverityInfo,
+			URLs:        []string{page.URL},
+			Tags:        page.Tags,
+			Target:      page.Target,
+			ID:          findingID("inputs", key),
+		})
+
+		for _, input := range page.Inputs {
+			if !strings.EqualFold(input.Attr("type"), "password") {
+				continue
+			}
+			if !strings.HasPrefix(page.URL, "http://") && !strings.HasPrefix(input.Action, "http://") {
+				continue
+			}
+			target := input.Action
+			if target == "" {
+				target = page.URL
+			}
+			findings = append(findings, Finding{
+				Title:       "Password field sent over unencrypted HTTP on " + path,
+				Description: fmt.Sprintf("The password field `%s` on %s is served or submitted (to %s) over plain HTTP, so the password can be read or changed by anyone on the network path.", input.HTML, page.URL, target),
+				Mitigation:  "Serve the page, and submit the form, over HTTPS only, and redirect HTTP requests to HTTPS.",
+				Severity:    SeverityMedium,
+				CWE:         319,
+				URLs:        []string{page.URL},
+				Tags:        page.Tags,
+				Target:      page.Target,
+				ID:          findingID("cleartext-password", key, input.Attr("name"), target),
+			})
+		}
+
+		windows := make(map[string]bool)
+		for _, input := range page.Inputs {
+			if input.SubmitsInto == "" || windows[input.Action+"\n"+input.FormTarget] {
+				continue
+			}
+			windows[input.Action+"\n"+input.FormTarget] = true
+			findings = append(findings, Finding{
+				Title:       fmt.Sprintf("Form submits into %s on %s", opensDescription(input.SubmitsInto), path),
+				Description: fmt.Sprintf("A form on %s is submitted to %s %s with target=%q, so the response opens in %s rather than the page itself. This often means an embedded third-party flow, such as payment or single sign-on, or a legacy integration; the response is worth examining on its own.", page.URL, input.Method, input.Action, input.FormTarget, opensDescription(input.SubmitsInto)),
+				Severity:    SeverityInfo,
+				URLs:        []string{page.URL},
+				Tags:        page.Tags,
+				Target:      page.Target,
+				ID:          findingID("form-window", key, input.Action, input.FormTarget),
+			})
+		}
+
+		for _, input := range page.Inputs {
+			for _, flag := range input.Flags {
+				finding := Finding{
+					URLs:   []string{page.URL},
+					Tags:   page.Tags,
+					Target: page.Target,
+					ID:     findingID("value-"+flag.Kind, key, input.Attr("name"), flag.Reason),
+				}
+				switch flag.Kind {
+				case ValueSecret, ValueSecretName:
+					finding.Title = "Possible secret in an input field on " + path
+					finding.Description = fmt.Sprintf("The input field `%s` on %s holds a value that may be a secret (%s). The value is sent to everyone who can load the page.", input.HTML, page.URL, flag.Reason)
+					finding.Mitigation = "Keep credentials on the server. If the value is a real credential, revoke it and issue a new one."
+					finding.Severity = SeverityHigh
+					finding.CWE = 200
+					if flag.Kind == ValueSecretName {
+						finding.Severity = SeverityMedium
+					}
+				case ValueDebugFlag:
+					finding.Title = "Debug or privilege switch in a hidden field on " + path
+					finding.Description = fmt.Sprintf("The hidden input field `%s` on %s: %s. Changing it before the form is submitted may turn on debugging output or extra privileges.", input.HTML, page.URL, flag.Reason)
+					finding.Mitigation = "Decide debugging and privileges on the server, from the session, rather than from form values."
+					finding.Severity = SeverityLow
+					finding.CWE = 489
+				default:
+					// CSRF tokens, view state and random-looking values are
+					// expected in hidden fields
+					continue
+				}
+				findings = append(findings, finding)
+			}
+		}
+	}
+
+	for _, conflict := range conflicts {
+		var variants []string
+		urls := make(map[string]bool)
+		for _, variant := range conflict.Variants {
+			var attributes []string
+			for _, attribute := range variant.Attributes {
+				attributes = append(attributes, fmt.Sprintf("%s=%q", attribute.Key, attribute.Val))
+			}
+			variants = append(variants, fmt.Sprintf("- `%s` on %d page(s), such as %s", strings.Join(attributes, " "), variant.PageCount, strings.Join(variant.Pages, ", ")))
+			for _, page := range variant.Pages {
+				urls[page] = true
+			}
+		}
+		var pages []string
+		for page := range urls {
+			pages = append(pages, page)
+		}
+		sort.Strings(pages)
+		var target string
+		for i, page := range pages {
+			if i == 0 {
+				target = targets[page]
+			} else if targets[page] != target {
+				target = ""
+			}
+		}
+
+		findings = append(findings, Finding{
+			Title:       fmt.Sprintf("Conflicting validation for the %s parameter of %s %s", conflict.Name, conflict.Method, conflict.Action),
+			Description: fmt.Sprintf("The %s parameter is submitted to %s %s from different pages, with different types or validation:\n\n%s\n\nThe server may not validate the parameter consistently either.", conflict.Name, conflict.Method, conflict.Action, strings.Join(variants, "\n")),
+			Mitigation:  "Validate the parameter on the server, the same way for every form that submits it.",
+			Severity:    SeverityLow,
+			CWE:         20,
+			URLs:        pages,
+			Target:      target,
+			ID:          findingID("conflict", conflict.Method, conflict.Action, conflict.Name),
+		})
+	}
+
+	return findings
+}
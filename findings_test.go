@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestFindingIDsKeepRequestsApart(t *testing.T) {
+	results := []PageResult{
+		{URL: "http://example.com/account", Inputs: []Input{{HTML: `<input name="q">`}}},
+		{URL: "http://example.com/account", Method: "POST", Source: "burp", Inputs: []Input{{HTML: `<input name="q">`}}},
+		{URL: "http://example.com/account", AuthProfile: "admin", Inputs: []Input{{HTML: `<input name="q">`}}},
+	}
+
+	ids := make(map[string]bool)
+	for _, finding := range collectFindings(results, nil) {
+		if ids[finding.ID] {
+			t.Errorf("finding %q has the ID of another finding", finding.Title)
+		}
+		ids[finding.ID] = true
+	}
+	if len(ids) != len(results) {
+		t.Errorf("got %d findings, want %d", len(ids), len(results))
+	}
+
+	// A plain GET keeps the ID it had before requests were told apart
+	if want := findingID("inputs", "http://example.com/account"); !ids[want] {
+		t.Errorf("the GET page's finding has a new ID")
+	}
+}
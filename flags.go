@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"time"
+)
+
+// FlagInfo is the metadata about a command-line flag that the help topics
+// and shell completions are built from.
+type FlagInfo struct {
+	// The help topic the flag is listed under
+	Topic string
+	// The values the flag can be set to, for completion; empty = any value
+	Values []string
+	// Whether the flag's value is the path to a file, for completion
+	File bool
+}
+
+// The metadata of every command-line flag, by name
+var flagInfo = make(map[string]FlagInfo)
+
+// Function stringFlag defines a string flag, along with its metadata.
+func stringFlag(name string, value string, usage string, info FlagInfo) *string {
+	flagInfo[name] = info
+	return flag.String(name, value, usage)
+}
+
+// Function boolFlag defines a boolean flag, along with its metadata.
+func boolFlag(name string, value bool, usage string, info FlagInfo) *bool {
+	flagInfo[name] = info
+	return flag.Bool(name, value, usage)
+}
+
+// Function intFlag defines an integer flag, along with its metadata.
+func intFlag(name string, value int, usage string, info FlagInfo) *int {
+	flagInfo[name] = info
+	return flag.Int(name, value, usage)
+}
+
+// Function int64Flag defines a 64-bit integer flag, along with its metadata.
+func int64Flag(name string, value int64, usage string, info FlagInfo) *int64 {
+	flagInfo[name] = info
+	return flag.Int64(name, value, usage)
+}
+
+// Function float64Flag defines a floating-point flag, along with its metadata.
+func float64Flag(name string, value float64, usage string, info FlagInfo) *float64 {
+	flagInfo[name] = info
+	return flag.Float64(name, value, usage)
+}
+
+// Function durationFlag defines a duration flag, along with its metadata.
+func durationFlag(name string, value time.Duration, usage string, info FlagInfo) *time.Duration {
+	flagInfo[name] = info
+	return flag.Duration(name, value, usage)
+}
+
+// Function listFlag defines a flag that can be repeated, along with its metadata.
+func listFlag(name string, usage string, info FlagInfo) *StringList {
+	flagInfo[name] = info
+	list := new(StringList)
+	flag.Var(list, name, usage)
+	return list
+}
+
+// Function isBoolFlag checks whether a flag is a boolean flag, which is
+// given without a value.
+func isBoolFlag(f *flag.Flag) bool {
+	boolFlag, ok := f.Value.(interface {
+		IsBoolFlag() bool
+	})
+	return ok && boolFlag.IsBoolFlag()
+}
+
+// Function topicFlags returns the flags listed under a help topic, in
+// alphabetical order.
+func topicFlags(topic string) []*flag.Flag {
+	var flags []*flag.Flag
+	flag.VisitAll(func(f *flag.Flag) {
+		if flagInfo[f.Name].Topic == topic {
+			flags = append(flags, f)
+		}
+	})
+	return flags
+}
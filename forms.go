@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// The warnings given for input fields whose form is not what the markup
+// appears to say
+const (
+	warningNestedForm = "inside a form nested in another form; browsers ignore the nested form, so the field is submitted with the outer one"
+	warningClosedForm = "after a nested form's end tag, which closed the outer form early; the field is not submitted with the form it appears to be in"
+	warningDetached   = "the form it belongs to was closed early by the markup around it (such as a table), so the field is submitted with that form without being inside it"
+)
+
+// formIndex holds what is needed to find the form each input field of a
+// document belongs to.
+type formIndex struct {
+	// The elements of the document with an id, keyed by the id, keeping the
+	// first element for ids used more than once
+	ids map[string]*html.Node
+	// The forms that the parser associated input fields with, where that is
+	// not the form they are in (see scanForms)
+	pointers map[*html.Node]*html.Node
+	// Warnings for the input fields whose form was attributed from markup that
+	// was ambiguous or broken
+	warnings map[*html.Node]string
+}
+
+// scannedField is an input field found by scanForms.
+type scannedField struct {
+	// The element's code, to match it up with its node in the document tree
+	key string
+	// The form element pointer when the field was inserted, as the index of
+	// the form among the forms in the document; -1 if it was not set, in which
+	// case the field belongs to the form it is in, if any
+	form int
+	// Why the field's form is not what the markup appears to say, if it is not
+	warning string
+}
+
+// Function scanForms goes through the tokens of a document, keeping track of
+// the parser's form element pointer as the HTML5 parsing algorithm does. A
+// form start tag while a form is open is ignored, and only a form end tag
+// unsets the pointer, so the input fields after a form that was closed early
+// by the markup around it (such as a table) still belong to it, even though
+// they are not inside it in the document tree. It returns the number of
+// forms in the document tree, and the input fields in the order they appear.
+func scanForms(source []byte) (forms int, fields []scannedField) {
+	tokenizer := html.NewTokenizer(bytes.NewReader(source))
+	pointer := -1
+	// The depth of template elements, whose forms do not set the pointer
+	templates := 0
+	// The form start tags that were ignored since the pointer was set, and
+	// the end tags still to come for them once the pointer is unset
+	nested, closing := 0, 0
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.DataAtom {
+			case atom.Template:
+				templates++
+			case atom.Form:
+				if templates > 0 {
+					forms++
+				} else if pointer >= 0 {
+					nested++
+				} else {
+					pointer = forms
+					forms++
+				}
+			case atom.Input, atom.Button:
+				field := scannedField{key: renderElement(elementName(token.DataAtom, token.Data), tokenAttributes(token.Attr)), form: -1}
+				if templates == 0 && !hasAttribute(token.Attr, "form") {
+					field.form = pointer
+					if pointer >= 0 && nested > 0 {
+						field.warning = warningNestedForm
+					} else if pointer < 0 && closing > 0 {
+						field.warning = warningClosedForm
+					}
+				}
+				fields = append(fields, field)
+			}
+		case html.EndTagToken:
+			token := tokenizer.Token()
+			switch token.DataAtom {
+			case atom.Template:
+				if templates > 0 {
+					templates--
+				}
+			case atom.Form:
+				if templates > 0 {
+					continue
+				}
+				if pointer >= 0 {
+					pointer = -1
+					closing, nested = nested, 0
+				} else if closing > 0 {
+					closing--
+				}
+			}
+		}
+	}
+}
+
+// Function newFormIndex indexes the forms of a document. If the source of
+// the document is given, the input fields are matched up with what
+// scanForms found in it, to attribute them to their forms the way a browser
+// does, warning about those whose markup was ambiguous; otherwise, each
+// input field belongs to the form it is in.
+func newFormIndex(ctx context.Context, document *html.Node, source []byte, limits walkLimits) *formIndex {
+	index := &formIndex{
+		ids:      make(map[string]*html.Node),
+		pointers: make(map[*html.Node]*html.Node),
+		warnings: make(map[*html.Node]string),
+	}
+
+	var forms []*html.Node
+	fieldNodes := make(map[string][]*html.Node)
+	walk(ctx, document, limits, func(node *html.Node, depth int) bool {
+		if node.Type != html.ElementNode {
+			return true
+		}
+		for _, attribute := range node.Attr {
+			if attribute.Key == "id" && attribute.Val != "" {
+				if _, exists := index.ids[attribute.Val]; !exists {
+					index.ids[attribute.Val] = node
+				}
+			}
+		}
+		switch node.DataAtom {
+		case atom.Form:
+			forms = append(forms, node)
+		case atom.Input, atom.Button:
+			key := renderElement(elementName(node.DataAtom, node.Data), tokenAttributes(node.Attr))
+			fieldNodes[key] = append(fieldNodes[key], node)
+		}
+		return true
+	})
+	if source == nil {
+		return index
+	}
+
+	// The forms are in the same order in the tree as in the source; if they
+	// cannot be matched up, such as for a document that was cut short, fall
+	// back on the tree
+	formCount, fields := scanForms(source)
+	if formCount != len(forms) {
+		return index
+	}
+	for _, field := range fields {
+		// Fields can be moved about in the tree (such as out of a table), but
+		// identical fields stay in the same order
+		nodes := fieldNodes[field.key]
+		if len(nodes) == 0 {
+			continue
+		}
+		node := nodes[0]
+		fieldNodes[field.key] = nodes[1:]
+
+		warning := field.warning
+		if field.form >= 0 {
+			if form := forms[field.form]; form != enclosingForm(node) {
+				index.pointers[node] = form
+				if warning == "" {
+					warning = warningDetached
+				}
+			}
+		}
+		if warning != "" {
+			index.warnings[node] = warning
+		}
+	}
+	return index
+}
+
+// Function enclosingForm returns the form that a node is in, or nil if it is
+// not in one.
+func enclosingForm(node *html.Node) *html.Node {
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		if parent.Type == html.ElementNode && parent.DataAtom == atom.Form {
+			return parent
+		}
+	}
+	return nil
+}
+
+// Function elementName returns the name given to an element in Input.Element:
+// empty for input elements.
+func elementName(elementAtom atom.Atom, data string) string {
+	if elementAtom == atom.Input {
+		return ""
+	}
+	return data
+}
+
+// Function tokenAttributes converts the attributes of a token or node.
+func tokenAttributes(attributes []html.Attribute) []Attribute {
+	converted := make([]Attribute, 0, len(attributes))
+	for _, attribute := range attributes {
+		converted = append(converted, Attribute{Key: attribute.Key, Val: attribute.Val})
+	}
+	return converted
+}
+
+// Function hasAttribute reports whether an attribute is set.
+func hasAttribute(attributes []html.Attribute, key string) bool {
+	for _, attribute := range attributes {
+		if attribute.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func TestScanForms(t *testing.T) {
+	// Each field is given as its form, and its warning if it has one
+	type field struct {
+		form    int
+		warning string
+	}
+	tests := []struct {
+		name   string
+		source string
+		forms  int
+		fields []field
+	}{
+		{
+			name:   "no forms",
+			source: `<input name="q"><button>Go</button>`,
+			forms:  0,
+			fields: []field{{form: -1}, {form: -1}},
+		},
+		{
+			name:   "fields in and after a form",
+			source: `<form><input name="a"><button>Go</button></form><input name="b">`,
+			forms:  1,
+			fields: []field{{form: 0}, {form: 0}, {form: -1}},
+		},
+		{
+			name:   "second form",
+			source: `<form><input name="a"></form><form><input name="b"></form>`,
+			forms:  2,
+			fields: []field{{form: 0}, {form: 1}},
+		},
+		{
+			name:   "nested form",
+			source: `<form><form><input name="a"></form><input name="b"></form><input name="c">`,
+			forms:  1,
+			fields: []field{{form: 0, warning: warningNestedForm}, {form: -1, warning: warningClosedForm}, {form: -1}},
+		},
+		{
+			name:   "form left open by a table",
+			source: `<table><form><tr><td><input name="a"></td></tr></table><input name="b"></form>`,
+			forms:  1,
+			fields: []field{{form: 0}, {form: 0}},
+		},
+		{
+			name:   "form attribute",
+			source: `<form><input name="a" form="other"></form>`,
+			forms:  1,
+			fields: []field{{form: -1}},
+		},
+		{
+			name:   "form in a template",
+			source: `<template><form><input name="a"></form></template><input name="b">`,
+			forms:  1,
+			fields: []field{{form: -1}, {form: -1}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			forms, scanned := scanForms([]byte(test.source))
+			if forms != test.forms {
+				t.Errorf("found %d forms, want %d", forms, test.forms)
+			}
+			var fields []field
+			for _, f := range scanned {
+				fields = append(fields, field{form: f.form, warning: f.warning})
+			}
+			if !reflect.DeepEqual(fields, test.fields) {
+				t.Errorf("fields = %+v, want %+v", fields, test.fields)
+			}
+		})
+	}
+}
+
+func TestNewFormIndex(t *testing.T) {
+	// Each field, by name, is given as the id of the form it belongs to ("" =
+	// none), and its warning if it has one
+	type owner struct {
+		form    string
+		warning string
+	}
+	tests := []struct {
+		name      string
+		source    string
+		tokenized bool
+		fields    map[string]owner
+	}{
+		{
+			name:      "fields in and after a form",
+			source:    `<form id="f"><input name="a"></form><input name="b">`,
+			tokenized: true,
+			fields:    map[string]owner{"a": {form: "f"}, "b": {}},
+		},
+		{
+			name:      "form closed early by a table",
+			source:    `<table><form id="f"><tr><td><input name="a"></td></tr></table><input name="b"></form>`,
+			tokenized: true,
+			fields:    map[string]owner{"a": {form: "f", warning: warningDetached}, "b": {form: "f", warning: warningDetached}},
+		},
+		{
+			name:      "form closed early by a table, without the source",
+			source:    `<table><form id="f"><tr><td><input name="a"></td></tr></table><input name="b"></form>`,
+			tokenized: false,
+			fields:    map[string]owner{"a": {}, "b": {}},
+		},
+		{
+			name:      "nested form",
+			source:    `<form id="outer"><form id="inner"><input name="a"></form><input name="b"></form>`,
+			tokenized: true,
+			fields:    map[string]owner{"a": {form: "outer", warning: warningNestedForm}, "b": {warning: warningClosedForm}},
+		},
+		{
+			name:      "form attribute",
+			source:    `<form id="x"></form><form id="y"><input name="a" form="x"><input name="b" form="missing"></form>`,
+			tokenized: true,
+			fields:    map[string]owner{"a": {form: "x"}, "b": {}},
+		},
+		{
+			name:      "identical fields",
+			source:    `<table><form id="f"><tr><td><input name="a"></td></tr></table></form><form id="g"><input name="a"></form>`,
+			tokenized: true,
+			fields:    map[string]owner{"a": {form: "f", warning: warningDetached}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			document, err := html.Parse(strings.NewReader(test.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var source []byte
+			if test.tokenized {
+				source = []byte(test.source)
+			}
+			index := newFormIndex(context.Background(), document, source, walkLimits{})
+
+			// Only the first field of each name is checked
+			fields := make(map[string]owner)
+			walk(context.Background(), document, walkLimits{}, func(node *html.Node, depth int) bool {
+				if node.Type != html.ElementNode || node.DataAtom != atom.Input {
+					return true
+				}
+				name := attributeValue(node, "name")
+				if _, seen := fields[name]; seen {
+					return true
+				}
+				var field owner
+				if form := formOwner(node, index); form != nil {
+					field.form = attributeValue(form, "id")
+				}
+				field.warning = index.warnings[node]
+				fields[name] = field
+				return true
+			})
+			if !reflect.DeepEqual(fields, test.fields) {
+				t.Errorf("fields = %+v, want %+v", fields, test.fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// The attributes that hold the URL of an HTML fragment loaded in by
+// JavaScript, as used by htmx, intercooler, Unpoly and hand-written AJAX code
+var fragmentAttributes = map[string]bool{
+	"hx-get":          true,
+	"data-hx-get":     true,
+	"ic-get-from":     true,
+	"up-href":         true,
+	"data-url":        true,
+	"data-src":        true,
+	"data-href":       true,
+	"data-load":       true,
+	"data-remote":     true,
+	"data-remote-url": true,
+	"data-fragment":   true,
+	"data-partial":    true,
+}
+
+// Method addFragments queues up the same-origin URLs of the HTML fragments
+// that an element loads in. Besides the known fragment attributes, any data-*
+// attribute holding something that looks like a path is followed.
+// task is the task for the current page; the fragments are one level deeper.
+func (c *Crawler) addFragments(node *html.Node, baseURL *url.URL, task Task) {
+	for _, attribute := range node.Attr {
+		value := strings.TrimSpace(attribute.Val)
+		if value == "" || strings.ContainsAny(value, " \t\n{}<>") {
+			continue
+		}
+		if !fragmentAttributes[attribute.Key] && !(strings.HasPrefix(attribute.Key, "data-") && looksLikePath(value)) {
+			continue
+		}
+
+		fragmentURL, err := url.Parse(value)
+		if err != nil {
+			continue
+		}
+		fragmentURL = baseURL.ResolveReference(fragmentURL)
+
+		// Only fragments from the page's own origin are loaded in by browsers
+		// without CORS, so only those are followed
+		if !sameOrigin(fragmentURL, task.URL) {
+			continue
+		}
+
+		c.log.Debugf("[%s] Found %s fragment: %s", task.URL.String(), attribute.Key, fragmentURL.String())
+		c.addTask(Task{URL: fragmentURL, Depth: task.Depth + 1, Seed: task.Seed, FragmentOf: task.URL.String()})
+	}
+}
+
+// Function looksLikePath checks whether an attribute value looks like a URL
+// path, rather than some other data.
+func looksLikePath(value string) bool {
+	return strings.HasPrefix(value, "/") && !strings.HasPrefix(value, "//") ||
+		strings.HasPrefix(value, "./") ||
+		strings.HasPrefix(value, "http://") ||
+		strings.HasPrefix(value, "https://")
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math/rand"
+	"net/url"
+	"sync"
+)
+
+// Task is a single URL waiting to be processed.
+type Task struct {
+	URL *url.URL
+	// Depth is the number of links followed from the seed to reach the URL
+	Depth int
+	// Seed is the seed the URL was found from
+	Seed *Seed
+	// FragmentOf, if set, is the page that loads the URL in as an HTML fragment
+	FragmentOf string
+	// UserAgent and AcceptLanguage are chosen when the task is dispatched
+	UserAgent      string
+	AcceptLanguage string
+
+	// lease identifies a task handed out by a shared queue, until it is done
+	lease string
+}
+
+// Queue holds the tasks of a crawl that are waiting to be processed. A queue
+// can be shared by several crawlers, working through one crawl together.
+type Queue interface {
+	// Push adds a task to the queue
+	Push(task Task)
+	// Pop removes and returns the next task; ok is false if the queue is empty
+	Pop() (task Task, ok bool)
+	// Done marks a task returned by Pop as processed
+	Done(task Task)
+	// Len returns the number of tasks waiting
+	Len() int
+	// Busy reports whether other crawlers sharing the queue are still
+	// processing tasks, and so could queue up more
+	Busy() bool
+}
+
+// Frontier holds the tasks that have been queued but not yet processed.
+// Tasks are handed out in the order they were queued, unless a random
+// number generator is provided, in which case the next task is picked at
+// random from the pending tasks.
+type Frontier struct {
+	pending []Task
+	random  *rand.Rand
+	mutex   sync.Mutex
+}
+
+// Function NewFrontier creates an empty frontier. If random is nil, tasks
+// are handed out in first-in, first-out order.
+func NewFrontier(random *rand.Rand) *Frontier {
+	return &Frontier{
+		random: random,
+	}
+}
+
+// Method Push adds a task to the frontier.
+func (f *Frontier) Push(task Task) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.pending = append(f.pending, task)
+}
+
+// Method Pop removes and returns the next task. The second return value is
+// false if the frontier is empty.
+func (f *Frontier) Pop() (task Task, ok bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.pending) == 0 {
+		return
+	}
+
+	// Pick the next task
+	next := 0
+	if f.random != nil {
+		next = f.random.Intn(len(f.pending))
+	}
+	task = f.pending[next]
+
+	// Remove it from the pending tasks, keeping the remaining tasks in order
+	copy(f.pending[next:], f.pending[next+1:])
+	f.pending[len(f.pending)-1] = Task{}
+	f.pending = f.pending[:len(f.pending)-1]
+
+	return task, true
+}
+
+// Method Done does nothing, as a frontier is not shared.
+func (f *Frontier) Done(task Task) {}
+
+// Method Busy returns false, as a frontier is not shared.
+func (f *Frontier) Busy() bool {
+	return false
+}
+
+// Method Tasks returns a copy of the pending tasks, in the order they were queued.
+func (f *Frontier) Tasks() []Task {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]Task(nil), f.pending...)
+}
+
+// Method Len returns the number of pending tasks.
+func (f *Frontier) Len() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.pending)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// The default limit on the size of the responses read and parsed
+const defaultMaxBodySize = 10 * 1024 * 1024
+
+// The content types parsed as HTML
+var htmlContentTypes = map[string]bool{
+	"text/html":             true,
+	"application/xhtml+xml": true,
+}
+
+// Method htmlBody checks that a response is HTML, and not too big, before it
+// is read. It returns a reader for at most the MaxBodySize option's number of
+// bytes of the body, or an error describing why the response was skipped.
+// Responses without a Content-Type are sniffed.
+func (c *Crawler) htmlBody(response *http.Response) (io.Reader, error) {
+	// Skip responses that say they are too big, without downloading them
+	if c.options.MaxBodySize > 0 && response.ContentLength > c.options.MaxBodySize {
+		return nil, fmt.Errorf("response is %d bytes, over the limit of %d bytes", response.ContentLength, c.options.MaxBodySize)
+	}
+
+	body := bufio.NewReader(response.Body)
+
+	// Skip responses that are not HTML
+	contentType := response.Header.Get("Content-Type")
+	if contentType == "" {
+		sniff, _ := body.Peek(512)
+		contentType = http.DetectContentType(sniff)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	if !htmlContentTypes[mediaType] {
+		return nil, fmt.Errorf("content type %s is not HTML", mediaType)
+	}
+
+	// Limit responses that did not say how big they are
+	if c.options.MaxBodySize > 0 {
+		return &limitedBody{reader: io.LimitReader(body, c.options.MaxBodySize+1), limit: c.options.MaxBodySize}, nil
+	}
+	return body, nil
+}
+
+// limitedBody reads up to a limit, and records whether the body went past it.
+type limitedBody struct {
+	reader    io.Reader
+	limit     int64
+	read      int64
+	truncated bool
+}
+
+// Method Read reads from the body, stopping at the limit.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.read >= b.limit {
+		// Anything past the limit means the body was cut short
+		var extra [1]byte
+		if n, _ := b.reader.Read(extra[:]); n > 0 {
+			b.truncated = true
+		}
+		return 0, io.EOF
+	}
+	if remaining := b.limit - b.read; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := b.reader.Read(p)
+	b.read += int64(n)
+	return n, err
+}
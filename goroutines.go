@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// How often to warn about goroutines that still have not exited at shutdown
+const shutdownWarnInterval = 10 * time.Second
+
+// Goroutines tracks every goroutine started by a crawler, so that they can be
+// counted while the crawl runs, and waited for before it ends.
+type Goroutines struct {
+	// The work in progress, by kind, and the total number of goroutines running
+	fetching int64
+	parsing  int64
+	probing  int64
+	running  int64
+
+	wg sync.WaitGroup
+}
+
+// Method spawn runs a function in a new goroutine, counting it in the given
+// counter (and the total running) until it returns. A panic in the function
+// stops the crawl with a fatal error, rather than crashing the process, so
+// that the crawl still finishes, and its results are written out.
+func (c *Crawler) spawn(counter *int64, function func()) {
+	c.goroutines.wg.Add(1)
+	atomic.AddInt64(&c.goroutines.running, 1)
+	if counter != nil {
+		atomic.AddInt64(counter, 1)
+	}
+
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				c.log.Errorf("Stopping the crawl after a panic: %v\n%s", recovered, debug.Stack())
+				c.fail(fmt.Errorf("panic: %v", recovered))
+			}
+			if counter != nil {
+				atomic.AddInt64(counter, -1)
+			}
+			atomic.AddInt64(&c.goroutines.running, -1)
+			c.goroutines.wg.Done()
+		}()
+		function()
+	}()
+}
+
+// Method track counts a piece of work in the given counter, until the
+// returned function is first called.
+func (c *Crawler) track(counter *int64) (done func()) {
+	atomic.AddInt64(counter, 1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			atomic.AddInt64(counter, -1)
+		})
+	}
+}
+
+// Method shutdown blocks until every goroutine started by the crawler has
+// exited, so that none are left behind once the crawl ends. Goroutines that
+// take too long are reported, as they are most likely leaked.
+func (c *Crawler) shutdown() {
+	exited := make(chan struct{})
+	go func() {
+		c.goroutines.wg.Wait()
+		close(exited)
+	}()
+
+	ticker := time.NewTicker(shutdownWarnInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exited:
+			return
+		case <-ticker.C:
+			c.log.Warnf("Still waiting for %d goroutine(s) to exit: %d fetching, %d parsing, %d probing",
+				atomic.LoadInt64(&c.goroutines.running), atomic.LoadInt64(&c.goroutines.fetching),
+				atomic.LoadInt64(&c.goroutines.parsing), atomic.LoadInt64(&c.goroutines.probing))
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The help topics that the command-line flags are listed under
+const (
+	topicScope      = "scope"
+	topicAuth       = "auth"
+	topicCrawling   = "crawling"
+	topicExtraction = "extraction"
+	topicOutputs    = "outputs"
+	topicRendering  = "rendering"
+	topicLogging    = "logging"
+	topicServer     = "server"
+	topicConfig     = "config"
+)
+
+// HelpTopic is a page of help on one area of the program, shown with
+// `help <topic>` along with the flags listed under it.
+type HelpTopic struct {
+	Name    string
+	Summary string
+	Text    string
+}
+
+// The help topics, in the order they are listed
+var helpTopics = []HelpTopic{
+	{
+		Name:    topicScope,
+		Summary: "Which URLs are searched",
+		Text: `The crawl starts from the seed URLs given with -urls, -url-file, -import-burp
+and -import-zap. The scheme and host of each seed are added to the whitelist,
+and only links to whitelisted origins are followed; links to other origins
+are set aside as out of scope. In server mode, an origin can be added to the
+whitelist of a running scan, queuing up the URLs set aside for it.
+
+Larger scopes are described as targets in a -targets JSON file: each covers a
+set of origins, hosts or *.example.com wildcards, and can have its own auth
+profile, rate limit and tags. Every page is reported under the first target
+that covers it ("target" in the results); seeds no target covers are targets
+of their own, named after their origin:
+
+    [{"name": "shop", "hosts": ["https://shop.example.com", "*.cdn.example.com"],
+      "auth": "admin", "rate_limit": 2, "tags": ["client-a"]}]
+
+URLs given without a scheme are probed over https, and then http. Each line of
+a -url-file can also hold directives that apply to every page found from it:
+
+    https://admin.example.com/  tag=prod depth=2 auth=admin  # Admin console
+    https://app.example.com/dashboard  method=POST body=view=all&page=1
+
+method=, body= and content-type= request the URL itself that way, for entry
+points that are not reached with a GET; the pages found from it use GET.
+
+Seeds that fail the -precheck, and hosts that 5 requests in a row fail for,
+are diagnosed once (-diagnose=false turns this off): their DNS answers, TCP
+connection, TLS handshake and HTTP HEAD response are logged, with a verdict,
+to tell typos in the scope apart from hosts that are down or blocked.
+-failing-hosts-file writes them out.
+
+Each URL is only visited once, compared in a canonical form.
+-strip-session-params also ignores session ID and tracking parameters, and
+-max-similar skips the URLs of a pattern once its pages are found to share
+the same template. -sample-templates still fetches them for their links, but
+stops searching the pages with the same forms once enough have been, only
+counting them (-sample-template sets the number for a single pattern).`,
+	},
+	{
+		Name:    topicAuth,
+		Summary: "Authentication and request headers",
+		Text: `Headers to send with every request are given with -header. Headers that only
+some seeds should send, such as the session cookie for a logged-in area, are
+grouped into named auth profiles with -auth-profile, and used by a seed with
+the auth=<name> directive in a -url-file:
+
+    input-field-finder -auth-profile="admin=Cookie: session=abc123" -url-file=urls.txt
+
+    https://admin.example.com/  auth=admin
+
+The headers of an auth profile replace any -header of the same name.
+-signing signs the requests to the hosts in a JSON file, with AWS SigV4 (for
+API Gateway) or an HMAC scheme, for consoles that only accept signed requests.
+-user-agent, -accept-language and -random-agent set how the requests present
+themselves.
+
+Every page is recorded as authenticated or not: it is authenticated if it was
+requested with an auth profile, or with a Cookie or Authorization header.
+-auth-state=unauthenticated only reports the pages reachable without a
+session, and -auth-state=authenticated only those behind one.
+
+-shadow-crawl requests every authenticated page with input fields again once
+the crawl finishes, without the session, and lists which of its input fields
+are still served: a map of the functionality exposed without logging in.`,
+	},
+	{
+		Name:    topicCrawling,
+		Summary: "How fast, and in what order, pages are requested",
+		Text: `-concurrency sets how many requests and pages are handled at the same time,
+from 0 (one at a time) to 5. -jitter adds a random delay before each request,
+and -rate-limit caps the number of requests sent each second. Each host also
+starts at -ramp-start requests per second, which is raised while the host
+keeps up and lowered when it returns errors or slows down (-ramp-up=false
+turns this off).
+
+-window limits the crawl to times of day, such as -window=01:00-05:00, and
+-blackout rules out dates, such as -blackout=2026-12-24, both in -timezone.
+Outside of them, the crawl pauses, and resumes when the next window opens.
+
+The first Ctrl-C stops the crawl once the pages in progress are searched, and
+the second quits at once; either way, the results found so far are written
+out. -export-frontier saves the URLs still waiting to be searched, and
+-import-frontier carries the crawl on from them.
+
+-max-pages and -max-duration stop the crawl after a number of pages, or a
+length of time, the same way. Why the crawl stopped (completed, max-pages,
+deadline, signal or fatal-error) is logged, written to -summary-file, and
+sets the exit status: 0, 3, 3, 130 and 1, respectively.
+
+URLs are visited in the order they are found, unless -seed is set, in which
+case they are visited in a random order that is the same on every run with
+the same seed. Runs are only fully reproducible with -concurrency=0, since
+concurrent requests can finish in any order.
+
+-cache-dir keeps the responses fetched, so that a repeat scan only downloads
+the pages that changed, checked with conditional requests; with -cache-ttl,
+recently cached pages are reused without asking the server at all.
+
+A large crawl can be shared across several machines: every instance started
+with the same -redis server and -redis-key (and the same seeds and options)
+works through one queue of URLs, visiting each URL once between them, and
+reports the results found by all of them.`,
+	},
+	{
+		Name:    topicExtraction,
+		Summary: "What is searched for in each page",
+		Text: `Every <input> and <button> element in each HTML page is reported, along with
+the action and method of the form it belongs to: the form named by its form
+attribute, or else the form it is in, with a submit button's formaction and
+formmethod in place of the form's. Image inputs also list the coordinate
+parameters they submit. Fields in broken form markup, such as nested forms,
+are attributed to forms the way browsers parse them, with a warning. Forms
+and links that open in an iframe or a new window (target="_blank", a named
+target, or <base target>) are marked, along with their rel attributes, as
+they often lead to embedded third-party flows.
+
+Responses that are not HTML, or that are larger than -max-body-size, are
+skipped. -fragments also searches the HTML fragments that pages load in with
+JavaScript, and -probe-api reports the parameters of OpenAPI specs and
+GraphQL schemas as input fields. -api-only skips the input fields of HTML
+pages, and looks for the API endpoints that pages' scripts call instead,
+listing them (with those of -import-har) once the crawl finishes.
+
+The values of input fields are checked for credentials, such as AWS keys and
+JSON Web Tokens, and the values of hidden fields also for CSRF tokens, debug
+switches (such as debug=true) and random-looking secrets. Flagged values are
+marked with [!] under the input field, and listed in the "flags" of each
+input in -output files.
+
+Pages that take longer than -extraction-timeout to search, or that crash the
+parser, are quarantined rather than holding up the crawl. -max-node-depth
+and -max-nodes limit how much of a huge or deeply nested page is searched.`,
+	},
+	{
+		Name:    topicOutputs,
+		Summary: "Where the results are written",
+		Text: `Results are always printed to stdout, and log messages to stderr, so the two
+can be redirected apart. -output also writes the results to a file, as json,
+jsonl or csv, and -webhook-url posts them to a URL as they are found.
+
+-history records when each page, form and input field was first and last
+found, across scans, adding first_seen and last_seen times to the results;
+export -first-seen-since, and ?first_seen_since= in the scan API, only keep
+the input fields first seen since a date (2026-09-14) or within an age (30d).
+
+-manifest writes how every page was requested (its URL, method, headers, body
+and auth profile) once the crawl stops, so that other tools can request the
+same pages again.
+
+Once the crawl finishes, -baseline compares the results with an earlier
+scan, -risk lists the riskiest pages and hosts, scored from the severities
+of the findings on them (-risk-output writes them all), -conflicts lists the
+form fields declared differently on different pages, and -export-urls and
+-export-zap-context hand the crawl over to Burp Suite or OWASP ZAP.
+-defectdojo-output and -defectdojo-url turn the results into findings for
+DefectDojo: the pages with input fields (Info), credentials in field values
+(High), password fields sent over plain HTTP and hidden fields named like
+secrets (Medium), and debug switches in hidden fields and conflicting
+validation (Low).
+
+The export subcommand regenerates any of the formats from the results saved
+by an earlier scan, without crawling again. Exports of the same results are
+the same byte for byte, and -checksums records their hashes, so that a report
+issued again later can be checked with -verify:
+
+    input-field-finder export -format=csv -output=report.csv -checksums=SHA256SUMS results.json`,
+	},
+	{
+		Name:    topicRendering,
+		Summary: "How results are shown on the console",
+		Text: `Each page is printed with its URL and tags, along with any redirects and the
+page it is a fragment of, followed by its input fields as HTML:
+
+    [http://www.example.com/login] (prod)
+    	<input  type="password" name="pw"></input>
+
+-attributes and -exclude-attributes choose the attributes that are shown,
+on the console and in csv output; json output always has every attribute.
+-max-findings stops printing once that many input fields have been shown,
+writing the rest to -overflow-file instead, so that a huge site cannot flood
+the terminal.`,
+	},
+	{
+		Name:    topicLogging,
+		Summary: "Log messages, progress and metrics",
+		Text: `Warnings and errors are logged to stderr, or to -log-file. -v and -vv (or
+-log-level) also log what the crawl is doing. -progress prints a progress
+line at an interval, and -metrics-addr serves Prometheus metrics on the
+crawl at /metrics.
+
+Sending SIGUSR1 to a running crawl prints its stats, the URLs in progress and
+the request rate of each host to stderr, without stopping it. -status-file
+keeps the same snapshot in a file as JSON, rewritten every -status-interval.`,
+	},
+	{
+		Name:    topicServer,
+		Summary: "Running as a scan service",
+		Text: `With -serve, the program runs as a service: scans are submitted and followed
+over a JSON API, rather than given on the command line.
+
+    POST   /scans                    Submit a scan
+    GET    /scans                    List all scans and their status
+    GET    /scans/{id}               Get the status of a scan
+    DELETE /scans/{id}               Cancel a scan, stopping it at once
+    GET    /scans/{id}/results       Get the pages with input fields found
+    GET    /scans/{id}/risk          Get the riskiest pages and hosts
+    GET    /scans/{id}/conflicts     Get the conflicting input fields found
+    GET    /scans/{id}/api-surface   Get the API endpoints found
+    GET    /scans/{id}/templates     Get the form templates only counted
+    GET    /scans/{id}/manifest      Get how each page was requested
+    GET    /scans/{id}/out-of-scope  List the out-of-scope origins linked to
+    POST   /scans/{id}/whitelist     Add an origin to a running scan's whitelist
+    POST   /scans/{id}/ingest        Add the input fields of a browser page
+
+With -api-token (or IFF_API_TOKEN), every request must send the token as
+"Authorization: Bearer <token>"; without one, -serve must be a loopback
+address. -max-finished-scans limits how many finished scans are kept.
+
+For example:
+
+    curl -X POST http://127.0.0.1:8080/scans -d '{"seeds": ["https://www.example.com/"]}'`,
+	},
+	{
+		Name:    topicConfig,
+		Summary: "Configuration files and profiles",
+		Text: `The flags for a scan can be kept in a YAML file given with -config, so that
+they can be version-controlled for each target. Each key is the name of a
+flag, and flags that can be repeated, as well as urls, take a list:
+
+    urls:
+      - https://www.example.com/
+    header:
+      - "X-Scan: pentest-2024"
+    rate-limit: 5
+    output: results.json
+    profile: stealth
+    profiles:
+      stealth:
+        concurrency: 0
+        jitter: 2s
+        random-agent: true
+      aggressive:
+        concurrency: 5
+
+The profile named with -profile (or the file's profile setting) is applied
+over the rest of the file. Flags given on the command line take precedence
+over both, except for repeatable flags such as -header, whose values are
+combined. Relative file paths are relative to the configuration file.
+
+The targets in scope, and the headers of auth profiles, can be defined in the
+file too, at the top level only; -targets on the command line takes
+precedence over the file's targets:
+
+    targets:
+      shop:
+        hosts: [https://shop.example.com, "*.cdn.example.com"]
+        auth: admin
+        rate-limit: 2
+        tags: [client-a]
+    auth-profiles:
+      admin:
+        Cookie: session=abc123`,
+	},
+}
+
+// Function findTopic returns the help topic with the given name, if there is one.
+func findTopic(name string) (HelpTopic, bool) {
+	for _, topic := range helpTopics {
+		if topic.Name == name {
+			return topic, true
+		}
+	}
+	return HelpTopic{}, false
+}
+
+// Function runHelp runs the `help` subcommand. With no arguments, it lists
+// the help topics; otherwise, it shows the page for the topic (or flag)
+// given. It returns the exit status.
+func runHelp(args []string) int {
+	if len(args) == 0 {
+		printTopics()
+		return 0
+	}
+
+	if topic, exists := findTopic(args[0]); exists {
+		printTopic(topic)
+		return 0
+	}
+
+	// Also show the help for single flags, such as `help max-similar`
+	if f := flag.Lookup(strings.TrimLeft(args[0], "-")); f != nil {
+		printFlag(f)
+		fmt.Printf("\nSee '%s help %s' for related flags.\n", os.Args[0], flagInfo[f.Name].Topic)
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown help topic: %s\n\n", args[0])
+	printTopics()
+	return 1
+}
+
+// Function printTopics lists the help topics.
+func printTopics() {
+	fmt.Printf("Usage: %s help <topic>\n\nTopics:\n", os.Args[0])
+	for _, topic := range helpTopics {
+		fmt.Printf("  %-12s %s\n", topic.Name, topic.Summary)
+	}
+	fmt.Printf("\nRun '%s -h' to list every flag, or '%s completion bash|zsh|fish' for shell completions.\n", os.Args[0], os.Args[0])
+}
+
+// Function printTopic shows the page for a help topic, including its flags.
+func printTopic(topic HelpTopic) {
+	fmt.Printf("%s: %s\n\n%s\n\nFlags:\n", strings.ToUpper(topic.Name), topic.Summary, topic.Text)
+	for _, f := range topicFlags(topic.Name) {
+		printFlag(f)
+	}
+}
+
+// Function printFlag shows the usage of a flag, in the same layout as the
+// full list of flags.
+func printFlag(f *flag.Flag) {
+	valueName, usage := flag.UnquoteUsage(f)
+	if valueName != "" {
+		fmt.Printf("  -%s %s\n", f.Name, valueName)
+	} else {
+		fmt.Printf("  -%s\n", f.Name)
+	}
+
+	fmt.Printf("    \t%s", strings.Replace(usage, "\n", "\n    \t", -1))
+	switch f.DefValue {
+	case "", "0", "0s", "false", "[]":
+	default:
+		fmt.Printf(" (default %s)", f.DefValue)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The format and version of history files
+const (
+	historyFormat  = "input-field-finder/history"
+	historyVersion = 1
+)
+
+// Seen is when something was first and last found, across every crawl that
+// recorded to the same history.
+type Seen struct {
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// History is the project store of a series of crawls of the same targets:
+// when each page, form and input field was first and last found. Each crawl
+// that records to it marks what it finds as seen, and the results it
+// reports carry the times, so that what is new can be told apart from what
+// was already there.
+type History struct {
+	Path   string
+	Pages  map[string]*Seen
+	Forms  map[string]*Seen
+	Inputs map[string]*Seen
+	mutex  sync.Mutex
+}
+
+// historyFile is the layout of a history file.
+type historyFile struct {
+	Format  string           `json:"format"`
+	Version int              `json:"version"`
+	Pages   map[string]*Seen `json:"pages"`
+	Forms   map[string]*Seen `json:"forms"`
+	Inputs  map[string]*Seen `json:"inputs"`
+}
+
+// Function loadHistory reads the history file at the given path. A file that
+// does not exist yet is an empty history, created when it is first saved.
+func loadHistory(path string) (*History, error) {
+	history := &History{
+		Path:   path,
+		Pages:  make(map[string]*Seen),
+		Forms:  make(map[string]*Seen),
+		Inputs: make(map[string]*Seen),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file historyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid history file %s: %s", path, err.Error())
+	}
+	if file.Format != historyFormat {
+		return nil, fmt.Errorf("%s is not a history file", path)
+	}
+	if file.Version > historyVersion {
+		return nil, fmt.Errorf("%s was written by a newer version (history version %d)", path, file.Version)
+	}
+	for key, seen := range file.Pages {
+		history.Pages[key] = seen
+	}
+	for key, seen := range file.Forms {
+		history.Forms[key] = seen
+	}
+	for key, seen := range file.Inputs {
+		history.Inputs[key] = seen
+	}
+	return history, nil
+}
+
+// Method Save writes the history to its file. The lock is held until the
+// file is written, as the scans of a server share the history and can save
+// it at the same time, and the file is replaced in one step, so that a crash
+// part of the way through does not lose the history.
+func (h *History) Save() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	data, err := json.MarshalIndent(historyFile{
+		Format:  historyFormat,
+		Version: historyVersion,
+		Pages:   h.Pages,
+		Forms:   h.Forms,
+		Inputs:  h.Inputs,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(h.Path, append(data, '\n'), 0644)
+}
+
+// Method see marks a key as seen at the given time, and returns when it was
+// first and last seen.
+func (h *History) see(records map[string]*Seen, key string, now time.Time) (first *time.Time, last *time.Time) {
+	seen, exists := records[key]
+	if !exists {
+		seen = &Seen{FirstSeen: now}
+		records[key] = seen
+	}
+	if seen.LastSeen.Before(now) {
+		seen.LastSeen = now
+	}
+	firstSeen, lastSeen := seen.FirstSeen, seen.LastSeen
+	return &firstSeen, &lastSeen
+}
+
+// Method Record marks a page, its forms and its input fields as seen now,
+// and sets when each was first and last seen on the result. Pages are keyed
+// by their canonical URL, forms by their method and action, and input fields
+// by their name (or id), as when comparing against a baseline.
+func (h *History) Record(result *PageResult, stripSession bool) {
+	key := result.URL
+	if pageURL, err := url.Parse(result.URL); err == nil {
+		key = canonicalURL(pageURL, stripSession)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	result.FirstSeen, result.LastSeen = h.see(h.Pages, key, now)
+	inputs := make([]Input, len(result.Inputs))
+	_, inputKeys := keyInputs(result.Inputs)
+	for i, input := range result.Inputs {
+		input.FirstSeen, input.LastSeen = h.see(h.Inputs, key+" "+inputKeys[i], now)
+		if input.Action != "" {
+			input.FormFirstSeen, _ = h.see(h.Forms, key+" "+strings.ToUpper(input.Method)+" "+input.Action, now)
+		}
+		inputs[i] = input
+	}
+	result.Inputs = inputs
+}
+
+// Method UseHistory records what the crawl finds in a history, and reports
+// when each page, form and input field was first and last seen. The history
+// is saved once the crawl finishes.
+func (c *Crawler) UseHistory(history *History) {
+	c.history = history
+}
+
+// Method saveHistory writes the crawl's history to its file, if it has one.
+func (c *Crawler) saveHistory() {
+	if c.history == nil {
+		return
+	}
+	if err := c.history.Save(); err != nil {
+		c.log.Errorf("Unable to save the history to %s: %s", c.history.Path, err.Error())
+	}
+}
+
+// Function parseSince parses the start of an age filter: a date, such as
+// "2026-09-14", a time in RFC 3339 format, or an age before now, such as
+// "30d" or "12h".
+func parseSince(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if since, err := time.Parse(time.RFC3339, value); err == nil {
+		return since, nil
+	}
+	if since, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return since, nil
+	}
+	if strings.HasSuffix(value, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil && days >= 0 {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	if age, err := time.ParseDuration(value); err == nil && age >= 0 {
+		return now.Add(-age), nil
+	}
+	return time.Time{}, errors.New("invalid time " + value + ": must be a date (2026-09-14), a time (2026-09-14T09:00:00Z), or an age (30d, 12h)")
+}
+
+// Function firstSeenSince keeps only the input fields first seen at or after
+// since, leaving out the pages with none left. Input fields from crawls that
+// did not record to a history have no first-seen time, and are left out.
+func firstSeenSince(pages []PageResult, since time.Time) []PageResult {
+	kept := []PageResult{}
+	for _, page := range pages {
+		var inputs []Input
+		for _, input := range page.Inputs {
+			if input.FirstSeen != nil && !input.FirstSeen.Before(since) {
+				inputs = append(inputs, input)
+			}
+		}
+		if len(inputs) > 0 {
+			page.Inputs = inputs
+			kept = append(kept, page)
+		}
+	}
+	return kept
+}
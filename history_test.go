@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestHistorySaveWhileRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	history, err := loadHistory(path)
+	if err != nil {
+		t.Fatalf("loadHistory: %s", err)
+	}
+
+	// Scans sharing the history record and save it at the same time
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				result := PageResult{URL: fmt.Sprintf("https://www.example.com/%d/%d", i, j), Inputs: []Input{{HTML: `<input name="q">`, Attributes: []Attribute{{Key: "name", Val: "q"}}}}}
+				history.Record(&result, false)
+				if err := history.Save(); err != nil {
+					t.Errorf("Save: %s", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	saved, err := loadHistory(path)
+	if err != nil {
+		t.Fatalf("the history saved is not valid: %s", err)
+	}
+	if len(saved.Pages) != 8*20 {
+		t.Errorf("got %d page(s) in the history saved, expected %d", len(saved.Pages), 8*20)
+	}
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*"))
+	if len(files) != 1 {
+		t.Errorf("temporary files were left behind: %v", files)
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm() != 0644 {
+		t.Errorf("the history was saved with the mode %s, expected %s", info.Mode().Perm(), os.FileMode(0644))
+	}
+}
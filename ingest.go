@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/net/html"
+)
+
+// The source of the pages pushed by the companion browser extension
+const SourceBrowser = "browser"
+
+// IngestedPage is a page seen while browsing by hand, as pushed to
+// `POST /scans/{id}/ingest` by a browser extension: the page's URL, and the
+// outer HTML of its forms (and of any input fields outside of them).
+type IngestedPage struct {
+	URL   string   `json:"url"`
+	Forms []string `json:"forms"`
+	// Authenticated is whether the page was seen while logged in
+	Authenticated bool `json:"authenticated,omitempty"`
+}
+
+// Method Ingest merges the input fields of a page seen while browsing by hand
+// into the crawl's results, as if the crawl had found them: only the input
+// fields not already reported for the page are added. Pages that are not on
+// the whitelist are refused. It returns the page as it was added to the
+// results, with only the input fields added.
+func (c *Crawler) Ingest(page IngestedPage) (PageResult, error) {
+	pageURL, err := url.Parse(strings.TrimSpace(page.URL))
+	if err != nil || (pageURL.Scheme != "http" && pageURL.Scheme != "https") || pageURL.Host == "" {
+		return PageResult{}, errors.New("the url must be an http:// or https:// URL with a host")
+	}
+	pageURL.Fragment = ""
+	if !c.isWhitelisted(pageURL) {
+		return PageResult{}, errors.New("the page is not on the scan's whitelist")
+	}
+
+	// Search the forms the same way as a page fetched by the crawl
+	source := []byte(strings.Join(page.Forms, "\n"))
+	var inputs []Input
+	if panicErr := isolate(func() {
+		document, err := html.Parse(strings.NewReader(string(source)))
+		if err == nil {
+			inputs = c.getInputs(context.Background(), document, source, pageURL)
+		}
+	}); panicErr != nil {
+		return PageResult{}, panicErr
+	}
+
+	// Leave out the input fields already reported for the page
+	key := canonicalURL(pageURL, c.options.StripSessionParams)
+	known := make(map[string]bool)
+	for _, result := range c.Results() {
+		if resultURL, err := url.Parse(result.URL); err == nil && canonicalURL(resultURL, c.options.StripSessionParams) == key {
+			for _, input := range result.Inputs {
+				known[input.HTML] = true
+			}
+		}
+	}
+	added := []Input{}
+	for _, input := range inputs {
+		if !known[input.HTML] {
+			known[input.HTML] = true
+			added = append(added, input)
+		}
+	}
+	result := PageResult{
+		URL:           pageURL.String(),
+		Source:        SourceBrowser,
+		Authenticated: page.Authenticated,
+		Inputs:        added,
+	}
+	c.keyToTarget(&result)
+	if len(added) == 0 {
+		return result, nil
+	}
+	atomic.AddInt64(&c.stats.inputsFound, int64(len(added)))
+
+	// Pass the page on to the sinks while the crawl is running; once it has
+	// finished, they are closed, so the page is only kept with the results
+	c.lifecycle.Lock()
+	running := !c.finished
+	if running {
+		c.URLsInProcess.Add(1)
+	}
+	c.lifecycle.Unlock()
+	if running {
+		defer c.URLsInProcess.Done()
+		c.addResult(result)
+	} else if matchesAuthState(result, c.options.AuthState) {
+		if c.history != nil {
+			c.history.Record(&result, c.options.StripSessionParams)
+		}
+		c.results.mutex.Lock()
+		c.results.Pages = append(c.results.Pages, result)
+		c.results.mutex.Unlock()
+		c.saveHistory()
+	}
+	c.log.Infof("[%s] Ingested %d input field(s) seen in the browser", result.URL, len(added))
+	return result, nil
+}
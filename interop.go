@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// burpItems is a sitemap exported from Burp Suite (Target > Site map >
+// "Save selected items"). Only the fields needed to seed a crawl are read.
+type burpItems struct {
+	Items []struct {
+		URL    string `xml:"url"`
+		Method string `xml:"method"`
+	} `xml:"item"`
+}
+
+// zapReport is an XML report exported from OWASP ZAP. The URLs of the sites
+// and of every alert instance are read.
+type zapReport struct {
+	Sites []struct {
+		Name string   `xml:"name,attr"`
+		URIs []string `xml:"alerts>alertitem>instances>instance>uri"`
+	} `xml:"site"`
+}
+
+// Function loadBurpSitemap reads the seeds from a Burp Suite sitemap export.
+// Only the URLs of GET requests are kept: the bodies of the other requests
+// are not read, and sending them again, such as form submissions, could
+// change the application's state. Such requests can be given as seeds with
+// method and body directives instead.
+func loadBurpSitemap(path string) ([]Seed, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var sitemap burpItems
+	if err := xml.Unmarshal(data, &sitemap); err != nil {
+		return nil, fmt.Errorf("invalid Burp sitemap: %s", err.Error())
+	}
+
+	var urls []string
+	for _, item := range sitemap.Items {
+		if item.Method == "" || strings.EqualFold(item.Method, "GET") {
+			urls = append(urls, item.URL)
+		}
+	}
+	return importedSeeds(urls)
+}
+
+// Function loadZAPExport reads the seeds from an OWASP ZAP export: either an
+// XML report, or a list of URLs with one per line (Export > "Export All URLs
+// to File").
+func loadZAPExport(path string) ([]Seed, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		var report zapReport
+		if err := xml.Unmarshal(data, &report); err != nil {
+			return nil, fmt.Errorf("invalid ZAP report: %s", err.Error())
+		}
+		for _, site := range report.Sites {
+			urls = append(urls, site.Name)
+			urls = append(urls, site.URIs...)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			urls = append(urls, scanner.Text())
+		}
+	}
+	return importedSeeds(urls)
+}
+
+// Function importedSeeds turns the URLs read from another tool's export into
+// seeds, skipping blank lines, duplicates and anything that is not an http or
+// https URL.
+func importedSeeds(urls []string) ([]Seed, error) {
+	var seeds []Seed
+	seen := make(map[string]bool)
+	for _, text := range urls {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		seedURL, err := url.Parse(text)
+		if err != nil || (seedURL.Scheme != "http" && seedURL.Scheme != "https") || seedURL.Host == "" {
+			logger.Warnf("Skipping imported URL: %s", text)
+			continue
+		}
+		seedURL.Fragment = ""
+		if seedURL.Path == "" {
+			seedURL.Path = "/"
+		}
+
+		if seen[seedURL.String()] {
+			continue
+		}
+		seen[seedURL.String()] = true
+		seeds = append(seeds, newSeed(seedURL))
+	}
+
+	if len(seeds) == 0 {
+		return nil, errors.New("no http or https URLs found")
+	}
+	return seeds, nil
+}
+
+// Method recordRequested adds the URL of a page requested with GET, and the
+// URL it redirected to, to the crawl's requested URLs, as they were sent.
+// Seeds requested with another method are left out, as their URLs alone do
+// not say how to request them.
+func (c *Crawler) recordRequested(request *http.Request, response *http.Response) {
+	if request.Method == http.MethodGet {
+		c.requested.Add(request.URL.String())
+	}
+	if final := response.Request; final != nil && final.Method == http.MethodGet {
+		c.requested.Add(final.URL.String())
+	}
+}
+
+// Method RequestedURLs returns the URL of every page requested with GET during
+// the crawl, as it was sent, sorted. Unlike the visited URLs, these are not
+// in canonical form, and leave out the URLs that were queued but never
+// requested, such as those of scripts searched for endpoints.
+func (c *Crawler) RequestedURLs() []string {
+	urls := c.requested.Keys()
+	sort.Strings(urls)
+	return urls
+}
+
+// Function writeURLList writes the pages requested by a crawl to the file at
+// the given path, one URL per line, for importing into Burp Suite or ZAP.
+// Pages with named input fields are also listed with those fields added as
+// query parameters, so that the tools know which parameters to test.
+func writeURLList(path string, crawler *Crawler) error {
+	urls := crawler.RequestedURLs()
+	for _, page := range crawler.Results() {
+		pageURL, err := url.Parse(page.URL)
+		if err != nil {
+			continue
+		}
+
+		query := pageURL.Query()
+		added := false
+		for _, input := range page.Inputs {
+			if name := input.Attr("name"); name != "" {
+				if _, exists := query[name]; !exists {
+					query.Set(name, "")
+					added = true
+				}
+			}
+		}
+		if added {
+			pageURL.RawQuery = query.Encode()
+			urls = append(urls, pageURL.String())
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, urlString := range urls {
+		fmt.Fprintln(writer, urlString)
+	}
+	return writer.Flush()
+}
+
+// zapContext is a context file that can be imported into OWASP ZAP
+// (File > Import Context), holding the crawl's scope.
+type zapContext struct {
+	XMLName xml.Name `xml:"configuration"`
+	Context struct {
+		Name       string   `xml:"name"`
+		Desc       string   `xml:"desc"`
+		InScope    bool     `xml:"inscope"`
+		IncRegexes []string `xml:"incregexes"`
+	} `xml:"context"`
+}
+
+// Function writeZAPContext writes the scope of a crawl to the file at the
+// given path, as a ZAP context that includes every host of the crawl's targets.
+func writeZAPContext(path string, crawler *Crawler) error {
+	var context zapContext
+	context.Context.Name = "input-field-finder"
+	context.Context.Desc = "Scope exported by input-field-finder"
+	context.Context.InScope = true
+	seen := make(map[string]bool)
+	for _, pattern := range crawler.scopePatterns() {
+		if !seen[pattern.regexp()] {
+			seen[pattern.regexp()] = true
+			context.Context.IncRegexes = append(context.Context.IncRegexes, pattern.regexp())
+		}
+	}
+
+	data, err := xml.MarshalIndent(context, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
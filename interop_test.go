@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteURLListListsTheRequestedURLs(t *testing.T) {
+	crawler := NewCrawler(nil, DefaultOptions())
+	for _, key := range []string{"POST http://www.example.com/login", "http://www.example.com/search?a=1&b=2", "http://www.example.com/app.js"} {
+		crawler.visited.Add(key)
+	}
+
+	// A POST seed, and a page whose query parameters are not in canonical order
+	post, _ := http.NewRequest(http.MethodPost, "http://www.example.com/login", nil)
+	crawler.recordRequested(post, &http.Response{Request: post})
+	get, _ := http.NewRequest(http.MethodGet, "http://www.example.com/search?b=2&a=1", nil)
+	crawler.recordRequested(get, &http.Response{Request: get})
+
+	path := filepath.Join(t.TempDir(), "urls.txt")
+	if err := writeURLList(path, crawler); err != nil {
+		t.Fatalf("writeURLList: %s", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if urls := strings.TrimSpace(string(data)); urls != "http://www.example.com/search?b=2&a=1" {
+		t.Errorf("got the URLs:\n%s\nexpected only the page requested with GET, as it was sent", urls)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// The patterns of the API calls found in JavaScript. Go's regular
+// expressions cannot match the closing quote to the opening one, so the
+// URLs found are checked with looksLikeEndpoint.
+var (
+	// fetch("/api/users", {method: "POST"})
+	jsFetch = regexp.MustCompile("\\bfetch\\(\\s*[\"'`]([^\"'`\\s]+)[\"'`]")
+	// The method of a fetch call, from the start of the rest of the call
+	jsFetchMethod = regexp.MustCompile(`^\s*,\s*\{[^}]*?\bmethod\s*:\s*["'](\w+)["']`)
+	// axios.post("/api/users"), $.get("/api/users"), this.http.put(...)
+	jsMethodCall = regexp.MustCompile("\\.(get|post|put|patch|delete|getJSON)\\(\\s*[\"'`]([^\"'`\\s]+)[\"'`]")
+	// xhr.open("POST", "/api/users")
+	jsXHROpen = regexp.MustCompile("\\.open\\(\\s*[\"'](GET|POST|PUT|PATCH|DELETE|get|post|put|patch|delete)[\"']\\s*,\\s*[\"'`]([^\"'`\\s]+)[\"'`]")
+	// Any other string that looks like the path of an API
+	jsAPIPath = regexp.MustCompile("[\"'`]((?:https?://[^/\"'`\\s]+)?/(?:api|rest|rpc|graphql|v[0-9]+)(?:[/?][^\"'`\\s]*)?)[\"'`]")
+	// A template literal placeholder, such as ${user.id}
+	jsPlaceholder = regexp.MustCompile(`\$\{\s*([^}]*?)\s*\}`)
+)
+
+// The extensions of the static files that scripts refer to, which are not
+// API endpoints
+var staticExtensions = map[string]bool{
+	".js": true, ".mjs": true, ".map": true, ".css": true, ".html": true, ".htm": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".ico": true, ".webp": true,
+	".woff": true, ".woff2": true, ".ttf": true, ".eot": true,
+}
+
+// Function looksLikeEndpoint reports whether a URL found in JavaScript could
+// be an API endpoint: an absolute URL or an absolute path, to something
+// other than a static file.
+func looksLikeEndpoint(value string) bool {
+	if !strings.HasPrefix(value, "/") && !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+		return false
+	}
+	if strings.HasPrefix(value, "//") && !strings.Contains(strings.TrimPrefix(value, "//"), "/") {
+		return false
+	}
+	valuePath := value
+	if i := strings.IndexAny(valuePath, "?#"); i >= 0 {
+		valuePath = valuePath[:i]
+	}
+	return !staticExtensions[strings.ToLower(path.Ext(valuePath))]
+}
+
+// Function mineEndpoints lists the API endpoints that a script calls. URLs
+// are resolved against the page the script runs on. Template literal
+// placeholders in a path, such as `/api/users/${id}`, are kept as {id} and
+// listed as parameters, along with the parameters of any query string.
+func mineEndpoints(source string, pageURL *url.URL, foundIn string) []APIEndpoint {
+	var endpoints []APIEndpoint
+	called := make(map[string]bool)
+
+	add := func(method string, literal string) {
+		if !looksLikeEndpoint(literal) {
+			return
+		}
+		// Placeholders in the query string are values, named by their keys
+		query := ""
+		if i := strings.Index(literal, "?"); i >= 0 {
+			literal, query = literal[:i], jsPlaceholder.ReplaceAllString(literal[i:], "x")
+		}
+		var parameters []string
+		literal = jsPlaceholder.ReplaceAllStringFunc(literal, func(placeholder string) string {
+			name := jsPlaceholder.FindStringSubmatch(placeholder)[1]
+			if i := strings.LastIndexAny(name, ".]"); i >= 0 {
+				name = name[i+1:]
+			}
+			if name == "" {
+				name = "param"
+			}
+			parameters = addUnique(parameters, name)
+			return "{" + name + "}"
+		})
+		literal += query
+		// Keep the braces of the placeholders as they are, rather than escaped
+		reference, err := url.Parse(strings.NewReplacer("{", "%7B", "}", "%7D").Replace(literal))
+		if err != nil {
+			return
+		}
+		resolved := pageURL.ResolveReference(reference)
+		if resolved.Scheme != "http" && resolved.Scheme != "https" {
+			return
+		}
+		for name := range resolved.Query() {
+			parameters = addUnique(parameters, name)
+		}
+		endpoints = append(endpoints, APIEndpoint{
+			Method:     strings.ToUpper(method),
+			URL:        fmt.Sprintf("%s://%s%s", resolved.Scheme, resolved.Host, resolved.Path),
+			Parameters: parameters,
+			Sources:    []string{EndpointJavaScript},
+			FoundIn:    []string{foundIn},
+		})
+	}
+
+	for _, match := range jsFetch.FindAllStringSubmatchIndex(source, -1) {
+		literal := source[match[2]:match[3]]
+		method := http.MethodGet
+		rest := source[match[1]:]
+		if len(rest) > 200 {
+			rest = rest[:200]
+		}
+		if methodMatch := jsFetchMethod.FindStringSubmatch(rest); methodMatch != nil {
+			method = methodMatch[1]
+		}
+		add(method, literal)
+		called[literal] = true
+	}
+	for _, match := range jsMethodCall.FindAllStringSubmatch(source, -1) {
+		method := match[1]
+		if method == "getJSON" {
+			method = http.MethodGet
+		}
+		add(method, match[2])
+		called[match[2]] = true
+	}
+	for _, match := range jsXHROpen.FindAllStringSubmatch(source, -1) {
+		add(match[1], match[2])
+		called[match[2]] = true
+	}
+
+	// Strings that are not called in a way that shows the method
+	for _, match := range jsAPIPath.FindAllStringSubmatch(source, -1) {
+		if !called[match[1]] {
+			add("", match[1])
+			called[match[1]] = true
+		}
+	}
+	return endpoints
+}
+
+// Method getScripts searches the inline scripts of a page for the API
+// endpoints they call, and returns the URLs of the whitelisted scripts the
+// page loads that have not been searched yet, to be fetched with
+// mineScript. The search stops early once ctx is done.
+func (c *Crawler) getScripts(ctx context.Context, document *html.Node, task Task) (scripts []*url.URL) {
+	pageURL := task.URL
+	baseURL := documentBase(ctx, document, pageURL, c.walkLimits())
+	c.log.Debugf("[%s] Processing HTML for scripts", pageURL.String())
+
+	walk(ctx, document, c.walkLimits(), func(node *html.Node, depth int) bool {
+		if node.Type != html.ElementNode || node.DataAtom != atom.Script {
+			return true
+		}
+		source := ""
+		for _, attribute := range node.Attr {
+			if attribute.Key == "src" {
+				source = strings.TrimSpace(attribute.Val)
+			}
+		}
+		if source == "" {
+			var inline strings.Builder
+			for child := node.FirstChild; child != nil; child = child.NextSibling {
+				if child.Type == html.TextNode {
+					inline.WriteString(child.Data)
+				}
+			}
+			c.addScriptEndpoints(mineEndpoints(inline.String(), pageURL, pageURL.String()+" (inline script)"), task.Seed)
+			return false
+		}
+
+		reference, err := url.Parse(source)
+		if err != nil {
+			return false
+		}
+		scriptURL := baseURL.ResolveReference(reference)
+		scriptURL.Fragment = ""
+		if c.isWhitelisted(scriptURL) && c.visited.Add(canonicalURL(scriptURL, c.options.StripSessionParams)) {
+			scripts = append(scripts, scriptURL)
+		}
+		return false
+	})
+	return
+}
+
+// Method mineScript fetches a script loaded by a page, and searches it for
+// the API endpoints it calls. task is the task for the page.
+func (c *Crawler) mineScript(scriptURL *url.URL, task Task) {
+	scriptTask := task
+	scriptTask.URL = scriptURL
+	request, err := c.newRequest(scriptTask)
+	if err != nil {
+		c.log.Errorf("[%s] %s", scriptURL.String(), err.Error())
+		return
+	}
+	atomic.AddInt64(&c.stats.requests, 1)
+	response, err := c.client.Do(request)
+	if err != nil {
+		atomic.AddInt64(&c.stats.errors, 1)
+		c.log.Errorf("[%s] %s", scriptURL.String(), err.Error())
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		io.Copy(ioutil.Discard, io.LimitReader(response.Body, 4096))
+		c.log.Infof("[%s] Skipping the script: %s", scriptURL.String(), response.Status)
+		return
+	}
+
+	var reader io.Reader = response.Body
+	if c.options.MaxBodySize > 0 {
+		reader = io.LimitReader(response.Body, c.options.MaxBodySize)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		atomic.AddInt64(&c.stats.errors, 1)
+		c.log.Errorf("[%s] %s", scriptURL.String(), err.Error())
+		return
+	}
+	c.log.Debugf("[%s] Processing the script for API endpoints", scriptURL.String())
+	c.addScriptEndpoints(mineEndpoints(string(data), task.URL, scriptURL.String()), task.Seed)
+}
+
+// Method addScriptEndpoints records the API endpoints found in a script. The
+// first time a whitelisted endpoint with parameters is found, its parameters
+// are also reported as input fields, as those of OpenAPI specs are.
+func (c *Crawler) addScriptEndpoints(endpoints []APIEndpoint, seed *Seed) {
+	for _, endpoint := range endpoints {
+		if !c.addEndpoint(endpoint) || len(endpoint.Parameters) == 0 {
+			continue
+		}
+		endpointURL, err := url.Parse(endpoint.URL)
+		if err != nil || !c.isWhitelisted(endpointURL) {
+			continue
+		}
+
+		var inputs []Input
+		for _, parameter := range endpoint.Parameters {
+			in := "query"
+			if strings.Contains(endpoint.URL, "{"+parameter+"}") {
+				in = "path"
+			}
+			inputs = append(inputs, apiInput(EndpointJavaScript,
+				Attribute{Key: "name", Val: parameter},
+				Attribute{Key: "in", Val: in},
+				Attribute{Key: "method", Val: endpoint.Method},
+			))
+		}
+		result := PageResult{URL: endpoint.URL, Inputs: inputs, Tags: seed.Tags}
+		result.Authenticated, result.AuthProfile = c.isAuthenticated(seed, endpointURL), c.authProfile(seed, endpointURL)
+		atomic.AddInt64(&c.stats.inputsFound, int64(len(inputs)))
+		c.addResult(result)
+	}
+}
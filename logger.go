@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log message.
+type Level int
+
+// Log levels, from most to least verbose
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// The names of the log levels, as used in flags and log lines
+var levelNames = map[Level]string{
+	LevelDebug: "DEBUG",
+	LevelInfo:  "INFO",
+	LevelWarn:  "WARN",
+	LevelError: "ERROR",
+}
+
+// Function parseLevel converts a level name (debug, info, warn or error) into a Level.
+func parseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	if strings.EqualFold(name, "warning") {
+		return LevelWarn, nil
+	}
+	return LevelWarn, fmt.Errorf("unknown log level: %s", name)
+}
+
+// Logger writes leveled log messages. Logs are kept apart from results, which
+// are written to stdout, so that results can be parsed by other tools.
+type Logger struct {
+	level  Level
+	prefix string
+	output *logOutput
+}
+
+// The destination shared by a logger and the loggers derived from it
+type logOutput struct {
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+// The logger used by the program; configured by the command-line flags
+var logger = NewLogger(os.Stderr, LevelWarn)
+
+// Function NewLogger creates a logger writing messages at or above the given level.
+func NewLogger(writer io.Writer, level Level) *Logger {
+	return &Logger{
+		level:  level,
+		output: &logOutput{writer: writer},
+	}
+}
+
+// Method WithPrefix returns a logger that adds the given prefix to every
+// message, such as the ID of the scan it belongs to.
+func (l *Logger) WithPrefix(prefix string) *Logger {
+	return &Logger{
+		level:  l.level,
+		prefix: l.prefix + "[" + prefix + "] ",
+		output: l.output,
+	}
+}
+
+// Method Enabled reports whether messages at the given level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+// Method logf writes a message at the given level, if it is enabled.
+func (l *Logger) logf(level Level, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	message := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+	line := fmt.Sprintf("%s [%s] %s%s\n", time.Now().Format("2006/01/02 15:04:05"), levelNames[level], l.prefix, message)
+
+	l.output.mutex.Lock()
+	defer l.output.mutex.Unlock()
+	io.WriteString(l.output.writer, line)
+}
+
+// Method Debugf writes a debug message.
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logf(LevelDebug, format, args...)
+}
+
+// Method Infof writes an informational message.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(LevelInfo, format, args...)
+}
+
+// Method Warnf writes a warning message.
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.logf(LevelWarn, format, args...)
+}
+
+// Method Errorf writes an error message.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(LevelError, format, args...)
+}
@@ -4,69 +4,117 @@
 package main
 
 import (
-	"bufio"
-	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"strings"
 	"sync"
-
-	"golang.org/x/net/html"
-	"golang.org/x/net/html/atom"
 )
 
-// HTTP client that ignores TLS errors
-var client = http.Client{
-	Transport: &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-	},
-}
-
-// Visited tracks visited URLs, to avoid redundancy & loops
-type Visited struct {
-	URLs  map[string]bool
-	mutex sync.RWMutex
-}
-
-var visited Visited
-
-// Whitelist is a group of targets that are allowed to be spidered and searched.
-// Targets can be either domains or IP addresses, and must contain the scheme (http or https, in this case). Example: http://www.example.com or https://127.0.0.1:8080
-type Whitelist struct {
-	Targets []*url.URL
-}
-
-var whitelist Whitelist
-
-// Set a limit to the number of concurrent workers
-var maxWorkers chan struct{}
-
-// Concurrency limit value, changed by the concurrency flag
-var concurrencyLimit int
-
-// URLsInProcess is a wait group to ensure that all URLs are processed
-var URLsInProcess sync.WaitGroup
-
 // The command-line flags
-var flagStartURL = flag.String("urls", "", "URL or comma-separated list of URLs to search. The domain and scheme will be used as the whitelist.")
-var flagURLFile = flag.String("url-file", "", "The location (relative or absolute path) of a file of newline-separated URLs to search.")
-var flagConcurrency = flag.Int("concurrency", 3, "The level of concurrency in network requests and internal data processing. 0 - 5; 0 = no concurrency, 5 = very high level of concurrency.")
-var flagVerbose = flag.Bool("v", false, "Enable verbose logging to the console.")
-var flagVerbose2 = flag.Bool("vv", false, "Enable doubly-verbose logging to the console.")
+var flagConfig = stringFlag("config", "", "A YAML file of flags to set for the scan, such as the seeds, headers, rate limit and outputs, along with the targets in scope, auth profiles, and named profiles of further flags. Flags given on the command line take precedence.", FlagInfo{Topic: topicConfig, File: true})
+var flagProfile = stringFlag("profile", "", "The profile in the -config file to use (e.g. stealth). Defaults to the file's profile setting.", FlagInfo{Topic: topicConfig})
+var flagStartURL = stringFlag("urls", "", "URL or comma-separated list of URLs to search. The domain and scheme will be used as the whitelist.", FlagInfo{Topic: topicScope})
+var flagURLFile = stringFlag("url-file", "", "The location (relative or absolute path) of a file of newline-separated URLs to search. Lines can hold comments and directives; see the README.", FlagInfo{Topic: topicScope, File: true})
+var flagTargets = stringFlag("targets", "", "A JSON file of the targets in scope, each with the hosts it covers (origins, hosts or *.example.com wildcards), and optionally an auth profile, a rate limit and tags. Each page is reported under the first target that covers it.", FlagInfo{Topic: topicScope, File: true})
+var flagImportBurp = stringFlag("import-burp", "", "The location of a Burp Suite sitemap export (XML) to search the URLs of.", FlagInfo{Topic: topicScope, File: true})
+var flagImportZAP = stringFlag("import-zap", "", "The location of an OWASP ZAP export to search the URLs of: an XML report, or a file of URLs.", FlagInfo{Topic: topicScope, File: true})
+var flagExportURLs = stringFlag("export-urls", "", "Write the URLs of the pages requested with GET to this file, one per line, for importing into Burp Suite or ZAP. Pages with input fields are also listed with the fields as query parameters.", FlagInfo{Topic: topicOutputs, File: true})
+var flagImportFrontier = stringFlag("import-frontier", "", "A frontier file written by -export-frontier, to carry on the crawl from: its visited URLs are not visited again, and its pending URLs are searched.", FlagInfo{Topic: topicScope, File: true})
+var flagManifest = stringFlag("manifest", "", "Write how every page was requested (its URL, method, headers, body and auth profile) to this file once the crawl stops, as JSON lines, so that other tools can request the same pages.", FlagInfo{Topic: topicOutputs, File: true})
+var flagExportFrontier = stringFlag("export-frontier", "", "Write the URLs visited and still waiting to be searched to this file once the crawl stops, as JSON lines, to carry on with -import-frontier. Press Ctrl-C to stop the crawl early.", FlagInfo{Topic: topicOutputs, File: true})
+var flagExportZAPContext = stringFlag("export-zap-context", "", "Write the scope of the crawl to this file, as a context that can be imported into OWASP ZAP.", FlagInfo{Topic: topicOutputs, File: true})
+var flagAuthProfiles = listFlag("auth-profile", "A header to send for the seeds using the named auth profile, in the form \"name=Header: value\". Can be repeated.", FlagInfo{Topic: topicAuth})
+var flagSigning = stringFlag("signing", "", "A JSON file of the hosts whose requests must be signed, with AWS SigV4 or an HMAC scheme, and how. SigV4 credentials and HMAC secrets not in the file are read from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, and SIGNING_SECRET, environment variables.", FlagInfo{Topic: topicAuth, File: true})
+var flagHeaders = listFlag("header", "A header to send with every request, in the form \"Header: value\". Can be repeated.", FlagInfo{Topic: topicAuth})
+var flagUserAgent = stringFlag("user-agent", "", "The User-Agent header to send with every request. Defaults to the Go HTTP client's user agent.", FlagInfo{Topic: topicAuth})
+var flagAcceptLanguage = stringFlag("accept-language", "", "The Accept-Language header to send with every request (e.g. en-US,en;q=0.9).", FlagInfo{Topic: topicAuth})
+var flagAuthState = stringFlag("auth-state", "", "Only report the pages requested with a session (authenticated), or without one (unauthenticated). A page has a session if it is requested with an auth profile, or a Cookie or Authorization header.", FlagInfo{Topic: topicAuth, Values: []string{AuthStateAuthenticated, AuthStateUnauthenticated}})
+var flagShadowCrawl = boolFlag("shadow-crawl", false, "After the crawl, request every page found with a session again without one, reporting which of its input fields are still served without logging in.", FlagInfo{Topic: topicAuth})
+var flagShadowOutput = stringFlag("shadow-output", "", "Write the results of -shadow-crawl to this file, as JSON.", FlagInfo{Topic: topicOutputs, File: true})
+var flagRandomAgent = boolFlag("random-agent", false, "Send a different realistic browser User-Agent (and Accept-Language, unless -accept-language is set) with each request.", FlagInfo{Topic: topicAuth})
+var flagProbeBoth = boolFlag("probe-both", false, "For URLs given without a scheme, search over both https and http if both respond, rather than only the first to respond.", FlagInfo{Topic: topicScope})
+var flagMaxRedirects = intFlag("max-redirects", 10, "The maximum number of redirects to follow for each request. 0 = do not follow redirects.", FlagInfo{Topic: topicScope})
+var flagFollowCrossOriginRedirects = boolFlag("follow-cross-origin-redirects", false, "Follow redirects to origins (scheme and host) that are not on the whitelist.", FlagInfo{Topic: topicScope})
+var flagMaxBodySize = int64Flag("max-body-size", defaultMaxBodySize, "The maximum number of bytes of each response to read. Larger responses are skipped if they say how big they are, or only searched up to the limit otherwise. 0 = no limit.", FlagInfo{Topic: topicExtraction})
+var flagCacheDir = stringFlag("cache-dir", "", "A directory to cache the responses fetched in, so that repeat scans of the same site only download the pages that changed.", FlagInfo{Topic: topicCrawling, File: true})
+var flagCacheTTL = durationFlag("cache-ttl", 0, "How long cached responses are reused for without asking the server whether they changed (e.g. 1h). 0 = always ask.", FlagInfo{Topic: topicCrawling})
+var flagStripSessionParams = boolFlag("strip-session-params", false, "Ignore session ID and tracking query parameters (such as jsessionid, PHPSESSID and utm_source) when checking whether a URL has already been visited.", FlagInfo{Topic: topicScope})
+var flagSampleTemplates = intFlag("sample-templates", 0, "The number of pages searched for input fields for each form template (pages of the same URL pattern with the same forms); the rest are still fetched for their links, but only counted. 0 = no limit.", FlagInfo{Topic: topicScope})
+var flagTemplateSamples = listFlag("sample-template", "The number of pages searched for each form template of a URL pattern, in the form \"pattern=count\", in place of -sample-templates. Can be repeated.", FlagInfo{Topic: topicScope})
+var flagTemplatesOutput = stringFlag("templates-output", "", "Write the form templates whose pages were only counted by -sample-templates to this file, as JSON.", FlagInfo{Topic: topicOutputs, File: true})
+var flagMaxPages = intFlag("max-pages", 0, "The number of pages requested before the crawl stops, leaving the rest of its URLs unsearched (see -export-frontier). 0 = no limit.", FlagInfo{Topic: topicScope})
+var flagMaxDuration = durationFlag("max-duration", 0, "How long the crawl runs for before it stops, such as 2h, leaving the rest of its URLs unsearched (see -export-frontier). 0 = no limit.", FlagInfo{Topic: topicScope})
+var flagSummaryFile = stringFlag("summary-file", "", "Write why the crawl stopped (completed, max-pages, deadline, signal or fatal-error), whether its results are complete, and its stats, to this file once it stops, as JSON.", FlagInfo{Topic: topicOutputs, File: true})
+var flagMaxSimilar = intFlag("max-similar", 0, "The number of pages searched for each URL pattern (such as /product?id=...) once they are found to share the same template; the rest are skipped. 0 = no limit.", FlagInfo{Topic: topicScope})
+var flagExtractionTimeout = durationFlag("extraction-timeout", defaultExtractionTimeout, "The time limit for reading and searching each page (e.g. 10s). Pages that take longer, or crash the parser, are skipped and quarantined. 0 = no limit.", FlagInfo{Topic: topicExtraction})
+var flagMaxNodeDepth = intFlag("max-node-depth", defaultMaxNodeDepth, "The deepest level of HTML element nesting searched in each page; deeper elements are skipped. 0 = no limit.", FlagInfo{Topic: topicExtraction})
+var flagMaxNodes = intFlag("max-nodes", defaultMaxNodes, "The number of HTML nodes searched in each page; the rest of the page is skipped. 0 = no limit.", FlagInfo{Topic: topicExtraction})
+var flagQuarantineFile = stringFlag("quarantine-file", "", "Write the pages that could not be searched (see -extraction-timeout) to this file, as JSON lines, for analysing offline.", FlagInfo{Topic: topicOutputs, File: true})
+var flagAPIOnly = boolFlag("api-only", false, "Skip the input fields of HTML pages, and look for API endpoints instead: in the scripts that pages load, and in OpenAPI specs and GraphQL schemas as with -probe-api. The endpoints found are listed once the crawl finishes.", FlagInfo{Topic: topicExtraction})
+var flagImportHAR = stringFlag("import-har", "", "A HAR capture of a browser's network traffic (from its developer tools, or a proxy), whose XHR and fetch requests are added to the API endpoints found.", FlagInfo{Topic: topicExtraction, File: true})
+var flagAPIReport = stringFlag("api-report", "", "Write the API endpoints found to this file, as JSON, with their methods, parameters and where they were found.", FlagInfo{Topic: topicOutputs, File: true})
+var flagFragments = boolFlag("fragments", false, "Also search the HTML fragments that pages load in with JavaScript, from same-origin URLs in attributes such as hx-get, data-url and data-src.", FlagInfo{Topic: topicExtraction})
+var flagProbeAPI = boolFlag("probe-api", false, "Look for OpenAPI (Swagger) specs and GraphQL endpoints at common locations on each whitelisted host, reporting the parameters of their operations as input fields.", FlagInfo{Topic: topicExtraction})
+var flagDiagnose = boolFlag("diagnose", true, "Check the DNS, TCP connection, TLS handshake and HTTP response of hosts that keep failing, and of seeds that fail the pre-check, and log what they show.", FlagInfo{Topic: topicScope})
+var flagFailingHostsFile = stringFlag("failing-hosts-file", "", "Write the hosts that kept failing during the crawl, with their diagnoses (see -diagnose), to this file, as JSON lines.", FlagInfo{Topic: topicOutputs, File: true})
+var flagPrecheck = boolFlag("precheck", true, "Before crawling, check that every URL resolves and responds, reporting the URLs that are down together and skipping them.", FlagInfo{Topic: topicScope})
+var flagStrict = boolFlag("strict", false, "Stop at the first invalid line in the -url-file, rather than skipping invalid lines.", FlagInfo{Topic: topicScope})
+var flagConcurrency = intFlag("concurrency", 3, "The level of concurrency in network requests and internal data processing. 0 - 5; 0 = no concurrency, 5 = very high level of concurrency.", FlagInfo{Topic: topicCrawling, Values: []string{"0", "1", "2", "3", "4", "5"}})
+var flagVerbose = boolFlag("v", false, "Enable verbose logging. Short for -log-level=info.", FlagInfo{Topic: topicLogging})
+var flagVerbose2 = boolFlag("vv", false, "Enable doubly-verbose logging. Short for -log-level=debug.", FlagInfo{Topic: topicLogging})
+var flagLogLevel = stringFlag("log-level", "warn", "The minimum level of messages to log: debug, info, warn or error.", FlagInfo{Topic: topicLogging, Values: []string{"debug", "info", "warn", "error"}})
+var flagLogFile = stringFlag("log-file", "", "A file to append log messages to, instead of stderr. Results are always written to stdout.", FlagInfo{Topic: topicLogging, File: true})
+var flagSeed = int64Flag("seed", 0, "Visit URLs in a random order, reproducible with the same seed. Also seeds the request jitter. 0 = visit URLs in the order they are found.", FlagInfo{Topic: topicCrawling})
+var flagJitter = durationFlag("jitter", 0, "The maximum random delay to add before each request (e.g. 500ms).", FlagInfo{Topic: topicCrawling})
+var flagRateLimit = float64Flag("rate-limit", 0, "The maximum number of requests to send each second, across all workers (e.g. 2, or 0.5 for one request every 2 seconds). 0 = no limit.", FlagInfo{Topic: topicCrawling})
+var flagRampUp = boolFlag("ramp-up", true, "Start each host at -ramp-start requests per second, raising the rate while it keeps up and backing off when it returns errors or slows down. Use -ramp-up=false to send requests as fast as the other limits allow.", FlagInfo{Topic: topicCrawling})
+var flagRampStart = float64Flag("ramp-start", defaultRampStart, "The number of requests per second each host starts at with -ramp-up.", FlagInfo{Topic: topicCrawling})
+var flagRampMax = float64Flag("ramp-max", 0, "The highest number of requests per second -ramp-up raises a host to. 0 = no limit.", FlagInfo{Topic: topicCrawling})
+var flagWindows = listFlag("window", "A time of day the crawl is allowed to send requests in, such as 01:00-05:00. Windows can run past midnight (22:00-02:00). The crawl pauses outside of them, and resumes when the next one opens. Can be repeated.", FlagInfo{Topic: topicCrawling})
+var flagBlackouts = listFlag("blackout", "A date the crawl is not allowed to send requests on, such as 2026-12-24, or a range of dates, such as 2026-12-24..2026-12-26. Can be repeated.", FlagInfo{Topic: topicCrawling})
+var flagTimeZone = stringFlag("timezone", "", "The time zone of the -window times and -blackout dates, such as America/New_York; usually the target's. Defaults to the local time zone.", FlagInfo{Topic: topicCrawling})
+var flagRedis = stringFlag("redis", "", "A Redis server to share the crawl through, as host:port or redis://[:password@]host[:port][/database]. Every instance started with the same -redis and -redis-key works through the same queue of URLs, visited URLs and results.", FlagInfo{Topic: topicCrawling})
+var flagRedisKey = stringFlag("redis-key", defaultRedisKey, "The prefix of the Redis keys the shared crawl is stored under. Use a new key for each crawl.", FlagInfo{Topic: topicCrawling})
+var flagWebhookURL = stringFlag("webhook-url", "", "A URL to POST the input fields found to as JSON, as they are found.", FlagInfo{Topic: topicOutputs})
+var flagWebhookPerInput = boolFlag("webhook-per-input", false, "POST each input field to the webhook on its own, rather than all of a page's input fields together.", FlagInfo{Topic: topicOutputs})
+var flagOutput = stringFlag("output", "", "A file to write the input fields found to.", FlagInfo{Topic: topicOutputs, File: true})
+var flagOutputFormat = stringFlag("output-format", FormatJSON, "The format of the output file: json, jsonl or csv.", FlagInfo{Topic: topicOutputs, Values: []string{FormatJSON, FormatJSONL, FormatCSV}})
+var flagHistory = stringFlag("history", "", "A history file to record when each page, form and input field was first and last found in, across crawls, adding first_seen and last_seen times to the results. Created if it does not exist.", FlagInfo{Topic: topicOutputs, File: true})
+var flagBaseline = stringFlag("baseline", "", "A previous JSON or JSON Lines output file to compare the input fields found against, reporting new, removed and changed pages and input fields.", FlagInfo{Topic: topicOutputs, File: true})
+var flagDiffOutput = stringFlag("diff-output", "", "A file to write the changes since the baseline to, as JSON.", FlagInfo{Topic: topicOutputs, File: true})
+var flagFailOnChange = boolFlag("fail-on-change", false, "Exit with a status of 2 if anything changed since the baseline.", FlagInfo{Topic: topicOutputs})
+var flagMaxFindings = intFlag("max-findings", 0, "The maximum number of input fields to print to the console; further input fields are written to the overflow file instead. 0 = no limit.", FlagInfo{Topic: topicRendering})
+var flagOverflowFile = stringFlag("overflow-file", "overflow.jsonl", "The JSON Lines file to write input fields past -max-findings to.", FlagInfo{Topic: topicRendering, File: true})
+var flagAttributes = stringFlag("attributes", "", "Comma-separated list of the only input attributes to show on the console and in CSV output (e.g. name,type,id,value). JSON output always includes every attribute.", FlagInfo{Topic: topicRendering})
+var flagExcludeAttributes = stringFlag("exclude-attributes", "", "Comma-separated list of input attributes to leave out of the console and CSV output (e.g. style,class).", FlagInfo{Topic: topicRendering})
+var flagConflicts = boolFlag("conflicts", false, "After the crawl, report input fields that are submitted to the same form action with different types or validation on different pages.", FlagInfo{Topic: topicOutputs})
+var flagRisk = boolFlag("risk", false, "After the crawl, list the riskiest pages and hosts, scored from the severities of the findings on them.", FlagInfo{Topic: topicOutputs})
+var flagRiskTop = intFlag("risk-top", 10, "The number of pages and hosts listed by -risk.", FlagInfo{Topic: topicOutputs})
+var flagRiskOutput = stringFlag("risk-output", "", "Write the risk score of every page and host to this file, as JSON, riskiest first.", FlagInfo{Topic: topicOutputs, File: true})
+var flagConflictsOutput = stringFlag("conflicts-output", "", "Write the input fields with conflicting types or validation to this file, as JSON.", FlagInfo{Topic: topicOutputs, File: true})
+var flagDefectDojoOutput = stringFlag("defectdojo-output", "", "Write the findings of the crawl to this file, in DefectDojo's generic findings import format.", FlagInfo{Topic: topicOutputs, File: true})
+var flagDefectDojoURL = stringFlag("defectdojo-url", "", "The base URL of a DefectDojo instance to import the findings of the crawl into (e.g. https://defectdojo.example.com). Requires -defectdojo-engagement.", FlagInfo{Topic: topicOutputs})
+var flagDefectDojoToken = stringFlag("defectdojo-token", "", "The DefectDojo API v2 key to import findings with. Defaults to the DEFECTDOJO_API_KEY environment variable.", FlagInfo{Topic: topicOutputs})
+var flagDefectDojoEngagement = intFlag("defectdojo-engagement", 0, "The ID of the DefectDojo engagement to import the findings into.", FlagInfo{Topic: topicOutputs})
+var flagMetricsAddr = stringFlag("metrics-addr", "", "An address to serve Prometheus metrics on, at /metrics (e.g. 127.0.0.1:9090).", FlagInfo{Topic: topicLogging})
+var flagProgress = durationFlag("progress", 0, "Print a progress line to stderr at this interval (e.g. 10s). 0 = no progress reporting.", FlagInfo{Topic: topicLogging})
+var flagStatusFile = stringFlag("status-file", "", "A file to keep a JSON snapshot of the crawl's status in (stats, active URLs and per-host request rates), rewritten every -status-interval. The status is also printed to stderr on SIGUSR1.", FlagInfo{Topic: topicLogging, File: true})
+var flagStatusInterval = durationFlag("status-interval", defaultStatusInterval, "How often the -status-file is rewritten (e.g. 30s).", FlagInfo{Topic: topicLogging})
+var flagServe = stringFlag("serve", "", "Run as a long-lived service, exposing the scan API on the given address (e.g. 127.0.0.1:8080).", FlagInfo{Topic: topicServer})
+var flagMaxScans = intFlag("max-scans", 4, "In server mode, the maximum number of scans to run at the same time.", FlagInfo{Topic: topicServer})
+var flagAPIToken = stringFlag("api-token", "", "In server mode, the token clients must send with every request, as \"Authorization: Bearer <token>\". Defaults to the IFF_API_TOKEN environment variable. Required unless -serve is on a loopback address.", FlagInfo{Topic: topicServer})
+var flagMaxFinishedScans = intFlag("max-finished-scans", 100, "In server mode, the most finished scans to keep; the ones that finished first are forgotten past this. 0 keeps them all.", FlagInfo{Topic: topicServer})
 
 // Function main is the entry point for the application. It parses the flags
-// provided by the user and calls the router function for any URLs
-// passed into the URL queue.
+// provided by the user and either starts the scan server or crawls the
+// URLs provided.
 func main() {
-	// Change output location of logs
-	log.SetOutput(os.Stdout)
-
 	// Configure the usage message
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
@@ -80,324 +128,655 @@ func main() {
 		fmt.Fprintf(os.Stderr, "\t%s -concurrency=0 -urls=http://127.0.0.1:8080/\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\t%s -concurrency=5 -urls=http://127.0.0.1:8080/\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\t%s -urls=http://127.0.0.1,http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -urls=www.example.com,127.0.0.1:8080\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\t%s -url-file=/root/urls.txt\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\t%s -url-file=urls.txt\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -auth-profile=\"admin=Cookie: session=abc123\" -url-file=urls.txt\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -auth-state=unauthenticated -url-file=urls.txt\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -shadow-crawl -header=\"Cookie: session=abc123\" -urls=http://www.example.com/\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\t%s -v -urls=http://www.example.com/example/\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\t%s -vv -urls=http://www.example.com/example/page/1?id=2#heading\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -config=scan.yaml\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -config=scan.yaml -profile=stealth -output=results.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -rate-limit=2 -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -concurrency=0 -seed=42 -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -webhook-url=https://hooks.example.com/findings -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -output=results.json -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -baseline=results.json -fail-on-change -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -max-findings=1000 -overflow-file=rest.jsonl -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -exclude-attributes=style,class -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -progress=10s -metrics-addr=127.0.0.1:9090 -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -status-file=status.json -status-interval=30s -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -log-level=debug -log-file=crawl.log -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -random-agent -header=\"X-Scan: pentest-2024\" -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -strip-session-params -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -failing-hosts-file=failing.jsonl -url-file=urls.txt\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -max-similar=20 -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -sample-templates=50 -templates-output=templates.json -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -targets=targets.json -auth-profile=\"admin=Cookie: session=abc123\" -url-file=urls.txt\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -cache-dir=.iff-cache -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -import-burp=sitemap.xml -export-zap-context=scope.context\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -window=01:00-05:00 -timezone=America/New_York -blackout=2026-12-24..2026-12-26 -urls=https://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -probe-api -urls=https://api.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -fragments -urls=https://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -api-only -import-har=capture.har -api-report=api.json -urls=https://app.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -export-frontier=frontier.jsonl -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -import-frontier=frontier.jsonl -export-frontier=frontier.jsonl\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -max-pages=500 -max-duration=2h -summary-file=summary.json -export-frontier=frontier.jsonl -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -manifest=manifest.jsonl -auth-profile=\"admin=Cookie: session=abc123\" -url-file=urls.txt\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -redis=redis.internal:6379 -redis-key=example-2024 -url-file=urls.txt\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -history=history.json -output=results.json -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -risk -risk-output=risk.json -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -conflicts -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -defectdojo-url=https://defectdojo.example.com -defectdojo-engagement=12 -urls=http://www.example.com/\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s -serve=127.0.0.1:8080\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s help scope\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s completion bash\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s export -format=csv -output=report.csv -checksums=SHA256SUMS results.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nRun '%s help' to list the help topics.\n", os.Args[0])
+	}
+
+	// Check for subcommands, which come before any flags
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "help":
+			os.Exit(runHelp(os.Args[2:]))
+		case "completion":
+			os.Exit(runCompletion(os.Args[2:]))
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		}
 	}
 
 	// Parse the command-line flags provided
 	flag.Parse()
 
-	// Ensure that we have required flags
-	if *flagStartURL == "" && *flagURLFile == "" {
-		// Default values provided
+	// Fill in the rest of the flags from the configuration file, if any
+	var configTargets []Target
+	if *flagConfig != "" {
+		config, err := loadConfig(*flagConfig)
+		if err == nil {
+			err = config.Apply(*flagProfile)
+		}
+		if err != nil {
+			logger.Errorf("Unable to load the configuration file: %s", err.Error())
+			os.Exit(1)
+		}
+		configTargets = config.Targets
+	} else if *flagProfile != "" {
+		logger.Errorf("-profile requires -config.")
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	// Set up the visited URLs
-	visited = Visited{
-		URLs: make(map[string]bool),
+	// Set up logging, keeping log messages apart from the results on stdout
+	level, err := parseLevel(*flagLogLevel)
+	if err != nil {
+		logger.Errorf("%s", err.Error())
+		flag.Usage()
+		os.Exit(1)
 	}
+	if *flagVerbose2 {
+		level = LevelDebug
+	} else if *flagVerbose && level > LevelInfo {
+		level = LevelInfo
+	}
+	var logWriter io.Writer = os.Stderr
+	if *flagLogFile != "" {
+		logFile, err := os.OpenFile(*flagLogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			logger.Errorf("Unable to open the log file: %s", err.Error())
+			os.Exit(1)
+		}
+		defer logFile.Close()
+		logWriter = logFile
+	}
+	logger = NewLogger(logWriter, level)
+
+	// Check for server mode
+	if *flagServe != "" {
+		server := NewServer(*flagMaxScans)
+		server.MaxFinished = *flagMaxFinishedScans
+		if server.Token = *flagAPIToken; server.Token == "" {
+			server.Token = os.Getenv("IFF_API_TOKEN")
+		}
+		// Anyone who can reach the API can send requests anywhere, with
+		// headers and signatures of their choosing
+		if server.Token == "" && !isLoopbackAddress(*flagServe) {
+			logger.Errorf("-serve on %s, which is not a loopback address, requires -api-token (or the IFF_API_TOKEN environment variable).", *flagServe)
+			os.Exit(1)
+		}
+		if *flagHistory != "" {
+			history, err := loadHistory(*flagHistory)
+			if err != nil {
+				logger.Errorf("Unable to load the history: %s", err.Error())
+				os.Exit(1)
+			}
+			server.UseHistory(history)
+		}
+		if *flagMetricsAddr != "" {
+			serveMetrics(*flagMetricsAddr, MetricsHandler{Crawlers: server.Crawlers})
+		}
 
-	// Set the concurrency limit for requests and internal data processing
-	switch *flagConcurrency {
-	case 0:
-		// No concurrency
-		concurrencyLimit = 1
-	case 1:
-		concurrencyLimit = 2
-	case 2:
-		concurrencyLimit = 5
-	case 4:
-		concurrencyLimit = 20
-	case 5:
-		concurrencyLimit = 50
-	default:
-		// Default, == value of 3
-		concurrencyLimit = 10
+		logger.Infof("Scan API listening on %s", *flagServe)
+		if err := http.ListenAndServe(*flagServe, server); err != nil {
+			logger.Errorf("%s", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *flagDiffOutput != "" && *flagBaseline == "" {
+		logger.Errorf("-diff-output requires -baseline.")
+		flag.Usage()
+		os.Exit(1)
 	}
-	maxWorkers = make(chan struct{}, concurrencyLimit)
+
+	var dojoToken string
+	if *flagDefectDojoURL != "" {
+		if *flagDefectDojoEngagement <= 0 {
+			logger.Errorf("-defectdojo-url requires -defectdojo-engagement.")
+			flag.Usage()
+			os.Exit(1)
+		}
+		var err error
+		if dojoToken, err = defectDojoToken(*flagDefectDojoToken); err != nil {
+			logger.Errorf("%s", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	// Ensure that we have required flags
+	if *flagStartURL == "" && *flagURLFile == "" && *flagImportBurp == "" && *flagImportZAP == "" && *flagImportFrontier == "" {
+		// Default values provided
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var seeds []Seed
 
 	// Check for values in the `-urls` flag
 	if *flagStartURL != "" {
-		// Prepare the starting URLs
-		startURLs := strings.Split(*flagStartURL, ",")
-
-		// Iterate through the URLs and add them to the whitelist
-		for _, urlValue := range startURLs {
+		// Iterate through the URLs and add them to the seeds
+		for _, urlValue := range strings.Split(*flagStartURL, ",") {
 			// Check if the start URL is valid
-			validURL, err := url.Parse(urlValue)
-			if err != nil || validURL.String() == "" {
-				log.Println("[ERROR] Invalid URL provided.")
+			validURL, err := parseSeedURL(urlValue)
+			if err != nil {
+				logger.Errorf("Invalid URL provided.")
 				flag.Usage()
 				os.Exit(1)
 			}
-
-			// Remove hashes from the URL
-			validURL.Fragment = ""
-
-			// Add the URL to the whitelist
-			whitelist.Targets = append(whitelist.Targets, validURL)
-
-			// Queue up the URL
-			addURL(validURL)
+			seeds = append(seeds, newSeed(validURL))
 		}
 	}
 
 	// Check for values in the `-url-file` flag
 	if *flagURLFile != "" {
-		// Attempt to open the URL file
-		file, err := os.Open(*flagURLFile)
+		fileSeeds, invalid, err := loadSeedFile(*flagURLFile, *flagStrict)
 		if err != nil {
-			// Error opening the file
-			log.Printf("[ERROR] Unable to open the file: %s\n", *flagURLFile)
+			// Error reading the file
+			logger.Errorf("Unable to read the file: %s", *flagURLFile)
 			flag.Usage()
 			os.Exit(1)
 		}
 
-		// Ensure the file is closed
-		defer file.Close()
-
-		// Initialize the file scanner
-		scanner := bufio.NewScanner(file)
-
-		// Iterate through the lines of the file
-		for scanner.Scan() {
-			// Grab the next URL
-			nextLine := scanner.Text()
-			validURL, err := url.Parse(nextLine)
-			if err != nil {
-				// Invalid URL provided
-				log.Printf("[ERROR] Invalid URL provided: %s\n", nextLine)
-				flag.Usage()
-				os.Exit(1)
-			}
-
-			// Remove hashes from the URL
-			validURL.Fragment = ""
+		// Report every invalid line, rather than stopping at the first one
+		for _, lineError := range invalid {
+			logger.Warnf("[%s] %s", *flagURLFile, lineError.Error())
+		}
+		if len(invalid) > 0 && *flagStrict {
+			logger.Errorf("Invalid URL in %s; stopping, as -strict is set.", *flagURLFile)
+			os.Exit(1)
+		}
+		if len(invalid) > 0 {
+			logger.Warnf("Skipped %d invalid line(s) in %s; continuing with %d valid URL(s).", len(invalid), *flagURLFile, len(fileSeeds))
+		}
 
-			// Add the URL to the whitelist
-			whitelist.Targets = append(whitelist.Targets, validURL)
+		seeds = append(seeds, fileSeeds...)
+	}
 
-			// Queue up the URL
-			addURL(validURL)
+	// Check for exports from other tools
+	if *flagImportBurp != "" {
+		toolSeeds, err := loadBurpSitemap(*flagImportBurp)
+		if err != nil {
+			logger.Errorf("Unable to import %s: %s", *flagImportBurp, err.Error())
+			os.Exit(1)
+		}
+		seeds = append(seeds, toolSeeds...)
+	}
+	if *flagImportZAP != "" {
+		toolSeeds, err := loadZAPExport(*flagImportZAP)
+		if err != nil {
+			logger.Errorf("Unable to import %s: %s", *flagImportZAP, err.Error())
+			os.Exit(1)
 		}
+		seeds = append(seeds, toolSeeds...)
 	}
 
-	// Wait for all URLs to be processed
-	URLsInProcess.Wait()
-}
+	if len(seeds) == 0 && *flagImportFrontier == "" {
+		logger.Errorf("No valid URLs provided.")
+		os.Exit(1)
+	}
 
-// Function dataRouter requests the given URL, and passes it to various helper functions.
-// It returns any errors it receives throughout this process.
-// Output functionality currently occurs in the helper functions.
-func dataRouter(urlValue *url.URL) (err error) {
-	// Set up an internal wait group for processing responses locally in a concurrent manner
-	var wg sync.WaitGroup
+	options := Options{
+		Concurrency:     *flagConcurrency,
+		Seed:            *flagSeed,
+		Jitter:          Duration(*flagJitter),
+		RateLimit:       *flagRateLimit,
+		RampUp:          *flagRampUp,
+		RampStart:       *flagRampStart,
+		RampMax:         *flagRampMax,
+		Windows:         *flagWindows,
+		Blackouts:       *flagBlackouts,
+		TimeZone:        *flagTimeZone,
+		WebhookURL:      *flagWebhookURL,
+		WebhookPerInput: *flagWebhookPerInput,
+		UserAgent:       *flagUserAgent,
+		AcceptLanguage:  *flagAcceptLanguage,
+		RandomAgent:     *flagRandomAgent,
+		ProbeBoth:       *flagProbeBoth,
+		MaxRedirects:    *flagMaxRedirects,
+		MaxBodySize:     *flagMaxBodySize,
+		Precheck:        *flagPrecheck,
+		Diagnose:        *flagDiagnose,
+		MaxSimilar:      *flagMaxSimilar,
+		MaxPages:        *flagMaxPages,
+		MaxDuration:     Duration(*flagMaxDuration),
+		SampleTemplates: *flagSampleTemplates,
+		MaxNodeDepth:    *flagMaxNodeDepth,
+		MaxNodes:        *flagMaxNodes,
+		ProbeAPI:        *flagProbeAPI,
+		APIOnly:         *flagAPIOnly,
+		Fragments:       *flagFragments,
+
+		ExtractionTimeout:          Duration(*flagExtractionTimeout),
+		StripSessionParams:         *flagStripSessionParams,
+		FollowCrossOriginRedirects: *flagFollowCrossOriginRedirects,
+
+		AuthState: *flagAuthState,
+		CacheDir:  *flagCacheDir,
+		CacheTTL:  Duration(*flagCacheTTL),
+	}
+	for _, value := range *flagHeaders {
+		key, headerValue, err := parseHeaderFlag(value)
+		if err != nil {
+			logger.Errorf("%s", err.Error())
+			flag.Usage()
+			os.Exit(1)
+		}
+		if options.Headers == nil {
+			options.Headers = make(http.Header)
+		}
+		options.Headers.Add(key, headerValue)
+	}
+	for _, value := range *flagTemplateSamples {
+		pattern, limit, err := parseTemplateSampleFlag(value)
+		if err != nil {
+			logger.Errorf("%s", err.Error())
+			flag.Usage()
+			os.Exit(1)
+		}
+		if options.TemplateSamples == nil {
+			options.TemplateSamples = make(map[string]int)
+		}
+		options.TemplateSamples[pattern] = limit
+	}
+	for _, value := range *flagAuthProfiles {
+		name, key, headerValue, err := parseAuthProfileFlag(value)
+		if err != nil {
+			logger.Errorf("%s", err.Error())
+			flag.Usage()
+			os.Exit(1)
+		}
+		if options.AuthProfiles == nil {
+			options.AuthProfiles = make(map[string]AuthProfile)
+		}
+		if _, exists := options.AuthProfiles[name]; !exists {
+			options.AuthProfiles[name] = AuthProfile{Headers: make(http.Header)}
+		}
+		options.AuthProfiles[name].Headers.Add(key, headerValue)
+	}
+	if *flagSigning != "" {
+		signing, err := loadSigning(*flagSigning)
+		if err != nil {
+			logger.Errorf("%s", err.Error())
+			os.Exit(1)
+		}
+		options.Signing = signing
+	}
+	if *flagTargets != "" {
+		targets, err := loadTargets(*flagTargets)
+		if err != nil {
+			logger.Errorf("%s", err.Error())
+			os.Exit(1)
+		}
+		options.Targets = targets
+	} else if configTargets != nil {
+		options.Targets = configTargets
+	}
+	if err := options.Validate(); err != nil {
+		logger.Errorf("%s", err.Error())
+		flag.Usage()
+		os.Exit(1)
+	}
+	if err := checkSeeds(seeds, options); err != nil {
+		logger.Errorf("%s", err.Error())
+		os.Exit(1)
+	}
 
-	defer URLsInProcess.Done() // clean up
+	// Load the baseline before crawling, so that a bad file is found straight away
+	var baseline []PageResult
+	if *flagBaseline != "" {
+		var err error
+		if baseline, err = loadResults(*flagBaseline); err != nil {
+			logger.Errorf("%s", err.Error())
+			os.Exit(1)
+		}
+	}
 
-	// Increment the concurrency limit
-	maxWorkers <- struct{}{}
+	// Load the history to record the crawl in
+	var history *History
+	if *flagHistory != "" {
+		var err error
+		if history, err = loadHistory(*flagHistory); err != nil {
+			logger.Errorf("Unable to load the history: %s", err.Error())
+			os.Exit(1)
+		}
+	}
 
-	defer func() {
-		<-maxWorkers
-	}() // Clean up
+	// Load the state of an earlier crawl to carry on from
+	var checkpoint *Checkpoint
+	if *flagImportFrontier != "" {
+		var err error
+		if checkpoint, err = loadFrontier(*flagImportFrontier); err != nil {
+			logger.Errorf("Unable to import the frontier: %s", err.Error())
+			os.Exit(1)
+		}
+		var checkpointSeeds []Seed
+		for _, task := range checkpoint.Pending {
+			checkpointSeeds = append(checkpointSeeds, *task.Seed)
+		}
+		if err := checkSeeds(checkpointSeeds, options); err != nil {
+			logger.Errorf("%s in %s", err.Error(), *flagImportFrontier)
+			os.Exit(1)
+		}
+	}
 
-	// Get the first URL's document body
-	response, err := client.Get(urlValue.String())
-	if err != nil {
-		log.Printf("[ERROR] [%s] %s\n", urlValue.String(), err.Error())
-		return
+	// Crawl the URLs, printing out results as they are found
+	filter := NewAttributeFilter(*flagAttributes, *flagExcludeAttributes)
+	crawler := NewCrawler(seeds, options)
+	if checkpoint != nil {
+		crawler.ImportFrontier(checkpoint)
 	}
-	defer response.Body.Close() // Make sure the response gets closed
-	document, err := html.Parse(response.Body)
-	if err != nil {
-		log.Printf("[ERROR] [%s] %s\n", urlValue.String(), err.Error())
-		return
+	if history != nil {
+		crawler.UseHistory(history)
+	}
+	if *flagImportHAR != "" {
+		endpoints, err := loadHAR(*flagImportHAR)
+		if err != nil {
+			logger.Errorf("Unable to import %s: %s", *flagImportHAR, err.Error())
+			os.Exit(1)
+		}
+		crawler.AddEndpoints(endpoints)
+	}
+	if *flagRedis != "" {
+		client, err := NewRedisClient(*flagRedis)
+		if err != nil {
+			logger.Errorf("Unable to connect to Redis at %s: %s", *flagRedis, err.Error())
+			os.Exit(1)
+		}
+		crawler.UseRedis(client, *flagRedisKey)
+	}
+	crawler.AddSink(&ConsoleSink{
+		MaxFindings:  *flagMaxFindings,
+		OverflowPath: *flagOverflowFile,
+		Filter:       filter,
+	})
+	if *flagOutput != "" {
+		fileSink, err := NewFileSink(*flagOutput, *flagOutputFormat)
+		if err != nil {
+			logger.Errorf("%s", err.Error())
+			flag.Usage()
+			os.Exit(1)
+		}
+		fileSink.Filter = filter
+		crawler.AddSink(fileSink)
 	}
 
-	// Run the spidering function on the html document
-	wg.Add(1)
+	// Report on the crawl while it runs
+	if *flagMetricsAddr != "" {
+		serveMetrics(*flagMetricsAddr, MetricsHandler{Crawlers: func() map[string]*Crawler {
+			return map[string]*Crawler{"": crawler}
+		}})
+	}
+	progressDone := make(chan struct{})
+	var progressExited sync.WaitGroup
+	if *flagProgress > 0 {
+		progressExited.Add(1)
+		go func() {
+			defer progressExited.Done()
+			reportProgress(crawler, *flagProgress, progressDone)
+		}()
+	}
+	progressExited.Add(1)
 	go func() {
-		defer wg.Done()
-		getAnchors(document, urlValue)
+		defer progressExited.Done()
+		reportStatus(crawler, *flagStatusFile, *flagStatusInterval, progressDone)
 	}()
 
-	// Search for input fields in the html document
-	wg.Add(1)
+	// The record of where the crawl stopped is written once, by whichever of
+	// the crawl finishing and the second interrupt comes first
+	var stateWritten sync.Once
+	writeState := func() {
+		stateWritten.Do(func() {
+			writeCrawlState(crawler)
+		})
+	}
+
+	// Stop the crawl on the first interrupt, finishing the pages in progress
+	// so that nothing is lost, and quit at once on the second
+	interrupts := make(chan os.Signal, 2)
+	signal.Notify(interrupts, os.Interrupt)
 	go func() {
-		defer wg.Done()
-		getInputs(document, urlValue)
+		<-interrupts
+		logger.Warnf("Stopping the crawl once the pages in progress are searched; interrupt again to quit at once")
+		crawler.Stop()
+		<-interrupts
+		logger.Warnf("Quitting; the results found so far are kept")
+		crawler.Abort()
+		writeState()
+		os.Exit(130)
 	}()
 
-	// Wait for all the concurrent processes to finish
-	wg.Wait()
+	crawler.Run()
+	close(progressDone)
+	progressExited.Wait()
+	writeState()
+	termination := crawler.Termination()
+
+	// List the API surface found
+	if *flagAPIOnly || *flagAPIReport != "" {
+		endpoints := crawler.APISurface()
+		if *flagAPIOnly {
+			printAPISurface(endpoints)
+		}
+		if *flagAPIReport != "" {
+			if err := writeAPISurface(endpoints, *flagAPIReport); err != nil {
+				logger.Errorf("Unable to write %s: %s", *flagAPIReport, err.Error())
+			}
+		}
+	}
 
-	return
-}
+	// Report the fields declared differently on different pages
+	if *flagConflicts || *flagConflictsOutput != "" {
+		conflicts := findConflicts(crawler.Results())
+		if *flagConflicts {
+			printConflicts(conflicts)
+		}
+		if *flagConflictsOutput != "" {
+			if err := writeConflicts(conflicts, *flagConflictsOutput); err != nil {
+				logger.Errorf("Unable to write %s: %s", *flagConflictsOutput, err.Error())
+			}
+		}
+	}
 
-// Function getAnchors parses out the links from anchor elements found in the
-// provided HTML node.
-// It uses the provided worker pool to perform the task concurrently for the calling function,
-// returning a worker back to the pool upon completion.
-// urlValue is the current URL that it is working with; this is used for contextual logging.
-func getAnchors(document *html.Node, currentURL *url.URL) {
-	// VERBOSE 2
-	if *flagVerbose2 {
-		fmt.Printf("[VERBOSE] [%s] Processing HTML for links\n", currentURL.String())
-	}
-
-	// Recursively search the document tree for anchor values
-	var nodeSearch func(*html.Node)
-	nodeSearch = func(node *html.Node) {
-		if node.Type == html.ElementNode && node.DataAtom == atom.A {
-			// We've found an anchor tag, get the href value
-			for _, attribute := range node.Attr {
-				if attribute.Key == "href" {
-
-					// Check for useless links
-					if attribute.Val == "#" || attribute.Val == "" {
-						continue
-					}
-
-					// Make sure it's a valid URL
-					urlValue, err := url.Parse(attribute.Val)
-					if err != nil || urlValue.String() == "" {
-						log.Printf("[ERROR] [%s] Error parsing URL: %s\n", currentURL.String(), attribute.Val)
-						continue
-					}
-
-					// Check for relative URLs
-					if urlValue.Scheme == "" && urlValue.String()[:1] == "/" {
-						// Path relative to root domain, add the appropriate scheme and domain
-						urlValue.Scheme = currentURL.Scheme
-						urlValue.Host = currentURL.Host
-					} else if urlValue.Scheme == "" && urlValue.String()[:2] == "//" {
-						// Path relative to scheme, add the appropriate scheme
-						urlValue.Scheme = currentURL.Scheme
-					}
-
-					// Queue up the URL
-					addURL(urlValue)
-				}
+	// Score the pages and hosts by the findings on them
+	if *flagRisk || *flagRiskOutput != "" {
+		report := rollUpRisk(crawler.Results())
+		if *flagRisk {
+			printRisk(report.Top(*flagRiskTop), len(report.Pages))
+		}
+		if *flagRiskOutput != "" {
+			if err := writeRisk(report, *flagRiskOutput); err != nil {
+				logger.Errorf("Unable to write %s: %s", *flagRiskOutput, err.Error())
 			}
 		}
-		// recurse down the tree
-		for child := node.FirstChild; child != nil; child = child.NextSibling {
-			nodeSearch(child)
+	}
+
+	if *flagTemplatesOutput != "" {
+		if err := writeTemplateSamples(*flagTemplatesOutput, crawler.TemplateSamples()); err != nil {
+			logger.Errorf("Unable to write %s: %s", *flagTemplatesOutput, err.Error())
 		}
+	}
 
+	// Map the functionality that is served without logging in
+	if *flagShadowCrawl || *flagShadowOutput != "" {
+		shadows := crawler.ShadowCrawl()
+		if *flagShadowCrawl {
+			printShadow(shadows)
+		}
+		if *flagShadowOutput != "" {
+			if err := writeShadow(shadows, *flagShadowOutput); err != nil {
+				logger.Errorf("Unable to write %s: %s", *flagShadowOutput, err.Error())
+			}
+		}
 	}
 
-	nodeSearch(document)
-}
+	// Export the results for other tools
+	if *flagExportURLs != "" {
+		if err := writeURLList(*flagExportURLs, crawler); err != nil {
+			logger.Errorf("Unable to write %s: %s", *flagExportURLs, err.Error())
+		}
+	}
+	if *flagExportZAPContext != "" {
+		if err := writeZAPContext(*flagExportZAPContext, crawler); err != nil {
+			logger.Errorf("Unable to write %s: %s", *flagExportZAPContext, err.Error())
+		}
+	}
 
-// Function addURL passes the URL back to the data router for processing
-// if it is whitelisted, and has not already been visited.
-func addURL(urlValue *url.URL) {
-	// Make sure the URL is in the whitelisted domains list
-	if isWhitelisted(urlValue) {
-		// Rebuild the url string, removing any hashes from the link
-		urlValue.Fragment = ""
-		urlString := urlValue.String()
-
-		// Check for trailing slash
-		var urlStringNoSlash string
-		if strings.HasSuffix(urlString, "/") {
-			urlStringNoSlash = urlString[:len(urlString)-1]
-		} else {
-			urlStringNoSlash = urlString
-		}
-
-		// Make sure the URL has not been visited
-		visited.mutex.Lock()
-		defer visited.mutex.Unlock()
-		_, exists := visited.URLs[urlString]
-		_, existsNoSlash := visited.URLs[urlStringNoSlash]
-		if !exists && !existsNoSlash {
-			// VERBOSE
-			if *flagVerbose || *flagVerbose2 {
-				fmt.Printf("[VERBOSE] [%s] URL found\n", urlString)
+	// Hand the findings over to vulnerability management
+	if *flagDefectDojoOutput != "" || *flagDefectDojoURL != "" {
+		results := crawler.Results()
+		findings := collectFindings(results, findConflicts(results))
+		if *flagDefectDojoOutput != "" {
+			if err := writeDefectDojo(*flagDefectDojoOutput, findings); err != nil {
+				logger.Errorf("Unable to write %s: %s", *flagDefectDojoOutput, err.Error())
+			}
+		}
+		if *flagDefectDojoURL != "" {
+			if err := pushDefectDojo(*flagDefectDojoURL, dojoToken, *flagDefectDojoEngagement, findings); err != nil {
+				logger.Errorf("Unable to import the findings into DefectDojo: %s", err.Error())
+			} else {
+				logger.Infof("Imported %d finding(s) into DefectDojo engagement %d", len(findings), *flagDefectDojoEngagement)
 			}
-			// Add the URL to visited now, to prevent race issues
-			visited.URLs[urlValue.String()] = true
+		}
+	}
 
-			// Increment the global wait group
-			URLsInProcess.Add(1)
+	// Report the changes since the baseline
+	if *flagBaseline != "" {
+		diff := diffResults(baseline, crawler.Results())
+		printDiff(diff, *flagBaseline)
 
-			// Start processing the URL on a separate thread
-			go dataRouter(urlValue)
+		if *flagDiffOutput != "" {
+			if err := writeDiff(diff, *flagDiffOutput); err != nil {
+				logger.Errorf("%s", err.Error())
+				os.Exit(1)
+			}
 		}
-
+		if *flagFailOnChange && !diff.Empty() && termination.ExitCode() == 0 {
+			os.Exit(2)
+		}
+	}
+	if code := termination.ExitCode(); code != 0 {
+		os.Exit(code)
 	}
-	return
 }
 
-// Function isWhitelisted checks if a provided URL is on the whitelist.
-func isWhitelisted(urlValue *url.URL) (whitelisted bool) {
-	// Assume false
-	whitelisted = false
+// Function writeCrawlState logs why the crawl stopped, and writes the files
+// that record where it stopped: the summary, the frontier, the manifest, and
+// the pages and hosts that were set aside. It is called both once the crawl
+// finishes and when it is aborted, so that they are written either way.
+func writeCrawlState(crawler *Crawler) {
+	termination := crawler.Termination()
+	logTermination(termination)
+	if *flagSummaryFile != "" {
+		if err := writeSummary(*flagSummaryFile, termination); err != nil {
+			logger.Errorf("Unable to write %s: %s", *flagSummaryFile, err.Error())
+		}
+	}
 
-	// Check scheme & host against whitelisted values
-	for _, target := range whitelist.Targets {
-		if strings.ToLower(urlValue.Scheme) == strings.ToLower(target.Scheme) && strings.ToLower(urlValue.Host) == strings.ToLower(target.Host) {
-			// URL is whitelisted
-			whitelisted = true
-			return
+	if *flagExportFrontier != "" {
+		if err := writeFrontier(*flagExportFrontier, crawler); err != nil {
+			logger.Errorf("Unable to write %s: %s", *flagExportFrontier, err.Error())
 		}
 	}
 
-	return
-}
+	if *flagManifest != "" {
+		if err := writeManifest(*flagManifest, crawler); err != nil {
+			logger.Errorf("Unable to write %s: %s", *flagManifest, err.Error())
+		}
+	}
 
-// Function getInputs parses out the input elements from the provided HTML node.
-// It uses the worker pool to perform the task concurrently from the calling function,
-// returning the worker to the pool upon completion.
-// urlValue is the current URL that it is working with; this is used for contextual logging.
-func getInputs(document *html.Node, urlValue *url.URL) {
-	// VERBOSE 2
-	if *flagVerbose2 {
-		fmt.Printf("[VERBOSE] [%s] Processing HTML for inputs\n", urlValue.String())
+	if *flagQuarantineFile != "" {
+		if err := writeQuarantine(*flagQuarantineFile, crawler.Quarantined()); err != nil {
+			logger.Errorf("Unable to write %s: %s", *flagQuarantineFile, err.Error())
+		}
 	}
 
-	// Create a slice to hold all the input fields for the current URL
-	var inputs []string
+	if *flagFailingHostsFile != "" {
+		if err := writeFailingHosts(*flagFailingHostsFile, crawler.FailingHosts()); err != nil {
+			logger.Errorf("Unable to write %s: %s", *flagFailingHostsFile, err.Error())
+		}
+	}
+}
 
-	// Recursively search the document tree for input fields
-	var nodeSearch func(*html.Node)
-	nodeSearch = func(node *html.Node) {
-		if node.Type == html.ElementNode && node.DataAtom == atom.Input {
-			// We've found an input tag
-			// Recreate the input code
-			var input = "<input "
-			for _, attribute := range node.Attr {
-				input = input + fmt.Sprintf(" %s=\"%s\"", attribute.Key, attribute.Val)
-			}
-			input = input + "></input>"
+// Function serveMetrics serves the metrics handler at /metrics on the given
+// address, in the background.
+func serveMetrics(address string, handler http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
 
-			// Remove newline characters
-			cleanInput := strings.Replace(input, "\n", "", -1)
+	go func() {
+		if err := http.ListenAndServe(address, mux); err != nil {
+			logger.Errorf("[metrics] %s", err.Error())
+		}
+	}()
+}
 
-			// Add the input tag to the inputs slice
-			inputs = append(inputs, cleanInput)
+// Function parseSeedURL parses and validates a starting URL.
+// URLs without a scheme, such as `www.example.com/login`, are returned with
+// an empty scheme, to be probed for when the crawl starts.
+func parseSeedURL(rawURL string) (*url.URL, error) {
+	if rawURL != "" && !strings.Contains(rawURL, "://") {
+		validURL, err := url.Parse("http://" + rawURL)
+		if err != nil || validURL.Host == "" {
+			return nil, errors.New("invalid URL provided: " + rawURL)
 		}
-		// recurse down the tree
-		for child := node.FirstChild; child != nil; child = child.NextSibling {
-			nodeSearch(child)
+		validURL.Scheme = ""
+		validURL.Fragment = ""
+		if validURL.Path == "" {
+			validURL.Path = "/"
 		}
+		return validURL, nil
 	}
-	nodeSearch(document)
 
-	// Output the input elements found on the current URL, if any are found
-	if len(inputs) > 0 {
-		fmt.Printf("[%s]\n", urlValue.String())
-		for _, input := range inputs {
-			fmt.Printf("\t%s\n", input)
-		}
-		// Extra line for spacing
-		fmt.Println()
+	validURL, err := url.Parse(rawURL)
+	if err != nil || validURL.String() == "" {
+		return nil, errors.New("invalid URL provided: " + rawURL)
 	}
+
+	// Remove hashes from the URL
+	validURL.Fragment = ""
+
+	return validURL, nil
 }
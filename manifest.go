@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The format and version of manifest files
+const (
+	manifestFormat  = "input-field-finder/manifest"
+	manifestVersion = 1
+)
+
+// How a page was fetched and read. Pages are never rendered by a browser, so
+// the crawler only ever sees what is in the response itself.
+const (
+	// The response's HTML as served, without running its JavaScript
+	RenderStatic = "static"
+	// An HTML fragment, requested the way the page's JavaScript would (see
+	// Options.Fragments)
+	RenderFragment = "fragment"
+)
+
+// ManifestEntry is how a page was requested, in full, so that another tool
+// can send the same request again: its method, headers and body, along with
+// the auth profile the headers came from, and how its response was read.
+type ManifestEntry struct {
+	// Key is the canonical URL of the page (see canonicalURL)
+	Key string `json:"key"`
+	// URL is the URL requested, as it was sent
+	URL         string      `json:"url"`
+	Method      string      `json:"method"`
+	Headers     http.Header `json:"headers"`
+	Body        string      `json:"body,omitempty"`
+	AuthProfile string      `json:"auth_profile,omitempty"`
+	Target      string      `json:"target,omitempty"`
+	// Signing is the scheme the request was signed with as it was sent, if
+	// its host needs signed requests; the signature itself is made afresh
+	// for each request, so it is not recorded
+	Signing string `json:"signing,omitempty"`
+	Render  string `json:"render"`
+	// FragmentOf is the page that loads the page in, for fragments
+	FragmentOf string `json:"fragment_of,omitempty"`
+	Depth      int    `json:"depth"`
+	// Requested is when the request was last sent
+	Requested time.Time `json:"requested"`
+}
+
+// Manifest is how every page of a crawl was requested, by canonical URL.
+type Manifest struct {
+	Entries map[string]ManifestEntry
+	mutex   sync.Mutex
+}
+
+// manifestRecord is a line of a manifest file: the header, or an entry.
+type manifestRecord struct {
+	Type    string     `json:"type"`
+	Format  string     `json:"format,omitempty"`
+	Version int        `json:"version,omitempty"`
+	Created *time.Time `json:"created,omitempty"`
+	*ManifestEntry
+}
+
+// Method recordRequest adds a page's request to the crawl's manifest, just
+// before it is sent. Later requests for the same page replace earlier ones.
+func (c *Crawler) recordRequest(task Task, request *http.Request) {
+	entry := ManifestEntry{
+		Key:         canonicalURL(task.URL, c.options.StripSessionParams),
+		URL:         request.URL.String(),
+		Method:      request.Method,
+		Headers:     request.Header.Clone(),
+		AuthProfile: c.authProfile(task.Seed, task.URL),
+		Render:      RenderStatic,
+		FragmentOf:  task.FragmentOf,
+		Depth:       task.Depth,
+		Requested:   time.Now().UTC(),
+	}
+	if task.isSeedRequest() {
+		entry.Body = task.Seed.Body
+	}
+	if task.FragmentOf != "" {
+		entry.Render = RenderFragment
+	}
+	if target := c.targetFor(task.URL); target != nil {
+		entry.Target = target.Name
+	}
+	if c.signer != nil {
+		if config, signed := c.signer.config(request.URL); signed {
+			entry.Signing = config.Scheme
+		}
+	}
+
+	c.manifest.mutex.Lock()
+	c.manifest.Entries[entry.Key] = entry
+	c.manifest.mutex.Unlock()
+}
+
+// Method Manifest returns how every page of the crawl was requested, sorted
+// by canonical URL.
+func (c *Crawler) Manifest() []ManifestEntry {
+	c.manifest.mutex.Lock()
+	defer c.manifest.mutex.Unlock()
+
+	entries := make([]ManifestEntry, 0, len(c.manifest.Entries))
+	for _, entry := range c.manifest.Entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
+
+// Method ExportManifest writes the crawl's manifest to w, as JSON lines: a
+// header, then how each page was requested, sorted by canonical URL.
+func (c *Crawler) ExportManifest(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+
+	created := time.Now().UTC()
+	if err := encoder.Encode(manifestRecord{Type: "header", Format: manifestFormat, Version: manifestVersion, Created: &created}); err != nil {
+		return err
+	}
+	for _, entry := range c.Manifest() {
+		entry := entry
+		if err := encoder.Encode(manifestRecord{Type: "request", ManifestEntry: &entry}); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// Function writeManifest writes the manifest of a crawl to the file at the
+// given path. The file holds the headers of the auth profiles, so it is only
+// readable by its owner.
+func writeManifest(path string, crawler *Crawler) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := crawler.ExportManifest(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The settings of the politeness ramp-up
+const (
+	// The rate each new host starts at, in requests per second
+	defaultRampStart = 2.0
+	// The lowest rate a host is backed off to
+	minRampRate = 0.1
+	// The number of responses the health of a host is judged on
+	rampWindow = 20
+	// How much the rate is raised after a healthy window, and lowered after
+	// an unhealthy one or a response asking to slow down
+	rampUpFactor  = 1.5
+	rampOffFactor = 0.5
+	// A window is unhealthy if more of its requests than this fail, or if its
+	// responses are this many times slower than the host's were (see baseline)
+	rampErrorRate = 0.1
+	rampSlowdown  = 2.0
+)
+
+// Politeness is an HTTP transport that sends requests to each host at a rate
+// of its own. Each host starts at a low rate, which is raised while the host
+// keeps up, and lowered as soon as it returns errors, asks to slow down, or
+// takes much longer to respond than it did.
+type Politeness struct {
+	// The transport that sends the requests
+	Next http.RoundTripper
+	// The rate each host starts at, and the highest it is raised to (0 = no
+	// limit), in requests per second
+	Start float64
+	Max   float64
+	// The log to report changes of rate to
+	Log *Logger
+
+	hosts map[string]*hostThrottle
+	mutex sync.Mutex
+}
+
+// hostThrottle is the rate and recent health of one host.
+type hostThrottle struct {
+	rate float64
+	// The earliest time the next request can be sent
+	next time.Time
+	// The responses of the current window: how many, how many failed, and
+	// how long they took in all
+	responses int
+	failures  int
+	elapsed   time.Duration
+	// The average response time the host is judged against: that of its
+	// fastest window, or of the window it was last backed off for slowness
+	baseline time.Duration
+	// When the rate was last lowered
+	slowed time.Time
+	mutex  sync.Mutex
+}
+
+// Function NewPoliteness creates a transport that ramps the rate of requests
+// to each host up from start requests per second, to no more than max (0 =
+// no limit), through the next transport.
+func NewPoliteness(start float64, max float64, log *Logger, next http.RoundTripper) *Politeness {
+	return &Politeness{
+		Next:  next,
+		Start: start,
+		Max:   max,
+		Log:   log,
+		hosts: make(map[string]*hostThrottle),
+	}
+}
+
+// Method host returns the throttle of a host, starting it off if it is new.
+func (p *Politeness) host(host string) *hostThrottle {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	throttle, exists := p.hosts[host]
+	if !exists {
+		throttle = &hostThrottle{rate: p.Start}
+		p.hosts[host] = throttle
+	}
+	return throttle
+}
+
+// Method Rates returns the current rate of each host, in requests per second.
+func (p *Politeness) Rates() map[string]float64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	rates := make(map[string]float64, len(p.hosts))
+	for host, throttle := range p.hosts {
+		throttle.mutex.Lock()
+		rates[host] = throttle.rate
+		throttle.mutex.Unlock()
+	}
+	return rates
+}
+
+// Method reserve books the next free slot to send a request to the host in,
+// and returns how long to wait for it.
+func (t *hostThrottle) reserve() time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	wait := t.next.Sub(now)
+	t.next = t.next.Add(time.Duration(float64(time.Second) / t.rate))
+	return wait
+}
+
+// Method RoundTrip sends a request once the slot for its host comes up, or
+// gives up if the request is cancelled first, and adjusts the host's rate
+// from the response.
+func (p *Politeness) RoundTrip(request *http.Request) (*http.Response, error) {
+	host := canonicalHost(request.URL)
+	throttle := p.host(host)
+	if wait := throttle.reserve(); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-request.Context().Done():
+			timer.Stop()
+			return nil, request.Context().Err()
+		}
+	}
+
+	started := time.Now()
+	response, err := p.Next.RoundTrip(request)
+	if err != nil && errors.Is(err, context.Canceled) {
+		// The crawl gave up on the request; it says nothing about the host
+		return response, err
+	}
+	p.record(host, throttle, response, time.Since(started))
+	return response, err
+}
+
+// Method record adds a response (nil if the request failed) to the host's
+// window, and adjusts the host's rate once the window is full, or at once if
+// the host asked to slow down.
+func (p *Politeness) record(host string, t *hostThrottle, response *http.Response, elapsed time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// Back off at once when asked to, but only once for the requests that
+	// were already sent at the old rate
+	if response != nil && (response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable) {
+		if time.Since(t.slowed) > time.Second {
+			t.slowDown()
+			p.Log.Warnf("[%s] Got %s; backing off to %.2f requests/sec", host, response.Status, t.rate)
+			return
+		}
+	}
+
+	t.responses++
+	t.elapsed += elapsed
+	if response == nil || response.StatusCode >= 500 {
+		t.failures++
+	}
+	if t.responses < rampWindow {
+		return
+	}
+
+	average := t.elapsed / time.Duration(t.responses)
+	errorRate := float64(t.failures) / float64(t.responses)
+	if t.baseline == 0 {
+		t.baseline = average
+	}
+	switch {
+	case errorRate > rampErrorRate:
+		t.slowDown()
+		p.Log.Warnf("[%s] %.0f%% of recent requests failed; backing off to %.2f requests/sec", host, errorRate*100, t.rate)
+	case float64(average) > float64(t.baseline)*rampSlowdown:
+		t.slowDown()
+		p.Log.Warnf("[%s] Responses are %.1f times slower than they were (%s, from %s); backing off to %.2f requests/sec",
+			host, float64(average)/float64(t.baseline), average.Round(time.Millisecond), t.baseline.Round(time.Millisecond), t.rate)
+		// Judge the host by its new speed from now on, so that a host that
+		// stays slow is only backed off again if it slows down further
+		t.baseline = average
+	default:
+		if average < t.baseline {
+			t.baseline = average
+		}
+		if p.Max <= 0 || t.rate < p.Max {
+			t.rate *= rampUpFactor
+			if p.Max > 0 && t.rate > p.Max {
+				t.rate = p.Max
+			}
+			p.Log.Debugf("[%s] Host is keeping up; ramping up to %.2f requests/sec", host, t.rate)
+		}
+	}
+	t.responses, t.failures, t.elapsed = 0, 0, 0
+}
+
+// Method slowDown lowers the host's rate, and starts a new window.
+func (t *hostThrottle) slowDown() {
+	t.rate *= rampOffFactor
+	if t.rate < minRampRate {
+		t.rate = minRampRate
+	}
+	t.slowed = time.Now()
+	t.responses, t.failures, t.elapsed = 0, 0, 0
+}
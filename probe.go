@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// The schemes tried for seeds given without one, in order of preference
+var probeSchemes = []string{"https", "http"}
+
+// Timeout for each probe
+const probeTimeout = 10 * time.Second
+
+// DeadSeed is a seed that failed its pre-check, and was not searched.
+type DeadSeed struct {
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+	// Diagnosis is why the seed's host fails, if the Diagnose option is set
+	Diagnosis *HostDiagnosis `json:"diagnosis,omitempty"`
+}
+
+// Method probeSeeds checks the seeds before the crawl starts, returning the
+// seeds to search. Probes for different seeds run concurrently.
+//
+// For seeds given without a scheme, https and then http are tried. The seed
+// is kept with the first scheme that responds, or with every scheme that
+// responds if the ProbeBoth option is set.
+//
+// If the Precheck option is set, the other seeds are checked to make sure
+// they resolve and respond. Seeds that fail are reported together, up front,
+// rather than as errors scattered through the crawl.
+func (c *Crawler) probeSeeds(seeds []Seed) []Seed {
+	probed := make([][]Seed, len(seeds))
+	dead := make([]*DeadSeed, len(seeds))
+
+	var wg sync.WaitGroup
+	for i, seed := range seeds {
+		if seed.URL.Scheme != "" && !c.options.Precheck {
+			probed[i] = []Seed{seed}
+			continue
+		}
+
+		i, seed := i, seed
+		wg.Add(1)
+		c.spawn(&c.goroutines.probing, func() {
+			defer wg.Done()
+			if seed.URL.Scheme == "" {
+				probed[i], dead[i] = c.probeSeed(seed)
+			} else if err := c.probe(seed.URL); err != nil {
+				dead[i] = &DeadSeed{URL: seed.URL.String(), Reason: err.Error()}
+				if c.options.Diagnose {
+					dead[i].Diagnosis = c.diagnose(seed.URL)
+				}
+			} else {
+				probed[i] = []Seed{seed}
+			}
+		})
+	}
+	wg.Wait()
+
+	// Keep the seeds in the order they were given
+	var result []Seed
+	for i := range seeds {
+		result = append(result, probed[i]...)
+		if dead[i] != nil {
+			c.deadSeeds = append(c.deadSeeds, *dead[i])
+		}
+	}
+
+	// Summarise the seeds that will not be searched
+	if len(c.deadSeeds) > 0 {
+		c.log.Warnf("[PRECHECK] %d of %d seed(s) are down, and will not be searched:", len(c.deadSeeds), len(seeds))
+		for _, deadSeed := range c.deadSeeds {
+			c.log.Warnf("[PRECHECK] \t%s: %s", deadSeed.URL, deadSeed.Reason)
+			if deadSeed.Diagnosis != nil {
+				c.logDiagnosis(deadSeed.Diagnosis)
+			}
+		}
+	}
+	return result
+}
+
+// Method DeadSeeds returns the seeds that failed their pre-check.
+func (c *Crawler) DeadSeeds() []DeadSeed {
+	return c.deadSeeds
+}
+
+// Method probeSeed tries each scheme for a seed given without one.
+func (c *Crawler) probeSeed(seed Seed) (probed []Seed, dead *DeadSeed) {
+	var lastErr error
+	for _, scheme := range probeSchemes {
+		schemeURL := *seed.URL
+		schemeURL.Scheme = scheme
+
+		if lastErr = c.probe(&schemeURL); lastErr != nil {
+			c.log.Infof("[%s] No response: %s", schemeURL.String(), lastErr.Error())
+			continue
+		}
+		c.log.Infof("[%s] Responded; adding it to the whitelist", schemeURL.String())
+
+		schemeSeed := seed
+		schemeSeed.URL = &schemeURL
+		probed = append(probed, schemeSeed)
+
+		if !c.options.ProbeBoth {
+			break
+		}
+	}
+
+	if len(probed) == 0 {
+		dead = &DeadSeed{
+			URL:    seed.URL.Host + seed.URL.RequestURI(),
+			Reason: "no response over https or http (" + lastErr.Error() + ")",
+		}
+		if c.options.Diagnose {
+			schemeURL := *seed.URL
+			schemeURL.Scheme = probeSchemes[0]
+			dead.Diagnosis = c.diagnose(&schemeURL)
+		}
+	}
+	return
+}
+
+// Method probe checks whether the URL's host resolves, and whether the URL
+// gets any HTTP response at all; error statuses still count, as the server
+// is there to be searched.
+func (c *Crawler) probe(probeURL *url.URL) error {
+	// Resolve the host first, to tell typos apart from servers that are down
+	if host := probeURL.Hostname(); net.ParseIP(host) == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+		defer cancel()
+		if _, err := dnsCache.Lookup(ctx, host); err != nil {
+			return fmt.Errorf("does not resolve: %s", err.Error())
+		}
+	}
+
+	request, err := http.NewRequest(http.MethodGet, probeURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	c.applyHeaders(request, Task{URL: probeURL, UserAgent: c.options.UserAgent, AcceptLanguage: c.options.AcceptLanguage, Seed: &Seed{}})
+
+	client := *c.client
+	client.Timeout = probeTimeout
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("no response: %s", err.Error())
+	}
+	defer response.Body.Close()
+
+	// Read a little of the body, so the connection can be reused
+	io.CopyN(ioutil.Discard, response.Body, 4096)
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimiter is an HTTP transport that spaces requests out evenly, so that
+// no more than a set number are sent each second, however many workers are
+// sending them.
+type RateLimiter struct {
+	// The transport that sends the requests
+	Next http.RoundTripper
+
+	// The time between requests, and the earliest time the next one can be sent
+	interval time.Duration
+	next     time.Time
+	mutex    sync.Mutex
+}
+
+// Function NewRateLimiter creates a transport that sends no more than
+// perSecond requests each second through the next transport.
+func NewRateLimiter(perSecond float64, next http.RoundTripper) *RateLimiter {
+	return &RateLimiter{
+		Next:     next,
+		interval: time.Duration(float64(time.Second) / perSecond),
+	}
+}
+
+// Method reserve books the next free slot to send a request in, and returns
+// how long to wait for it.
+func (l *RateLimiter) reserve() time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	return wait
+}
+
+// Method RoundTrip sends a request once its slot comes up, or gives up if the
+// request is cancelled first.
+func (l *RateLimiter) RoundTrip(request *http.Request) (*http.Response, error) {
+	if wait := l.reserve(); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-request.Context().Done():
+			timer.Stop()
+			return nil, request.Context().Err()
+		}
+	}
+	return l.Next.RoundTrip(request)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// The context key for the redirect chain of a request
+type redirectChainKey struct{}
+
+// redirectChain records the URLs a request was redirected through.
+type redirectChain struct {
+	URLs  []string
+	mutex sync.Mutex
+}
+
+// Function withRedirectChain returns a copy of the request that records its
+// redirects in the returned chain, starting with the request's own URL.
+func withRedirectChain(request *http.Request) (*http.Request, *redirectChain) {
+	chain := &redirectChain{URLs: []string{request.URL.String()}}
+	return request.WithContext(context.WithValue(request.Context(), redirectChainKey{}, chain)), chain
+}
+
+// Method checkRedirect applies the crawler's redirect policy. Redirects past
+// the MaxRedirects option, or to origins that are not whitelisted (unless
+// FollowCrossOriginRedirects is set), are not followed and the redirect
+// response itself is returned instead, so that requests never leave the
+// scope of the crawl by accident.
+func (c *Crawler) checkRedirect(request *http.Request, via []*http.Request) error {
+	from := via[len(via)-1].URL
+
+	if len(via) > c.options.MaxRedirects {
+		c.log.Warnf("[%s] Not following redirect to %s: stopped after %d redirect(s)", from.String(), request.URL.String(), c.options.MaxRedirects)
+		return http.ErrUseLastResponse
+	}
+	if !c.options.FollowCrossOriginRedirects && !sameOrigin(from, request.URL) && !c.isWhitelisted(request.URL) {
+		c.log.Warnf("[%s] Not following redirect to %s: not on the whitelist", from.String(), request.URL.String())
+		return http.ErrUseLastResponse
+	}
+
+	if chain, ok := request.Context().Value(redirectChainKey{}).(*redirectChain); ok {
+		chain.mutex.Lock()
+		chain.URLs = append(chain.URLs, request.URL.String())
+		chain.mutex.Unlock()
+	}
+	c.log.Debugf("[%s] Following redirect to %s", from.String(), request.URL.String())
+	return nil
+}
+
+// Function sameOrigin checks whether two URLs share a scheme and host.
+func sameOrigin(a *url.URL, b *url.URL) bool {
+	return fmt.Sprintf("%s://%s", a.Scheme, a.Host) == fmt.Sprintf("%s://%s", b.Scheme, b.Host)
+}
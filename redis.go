@@ -0,0 +1,626 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The default prefix of the Redis keys a shared crawl is stored under
+const defaultRedisKey = "iff"
+
+// How often a crawler with nothing to do checks the shared queue for URLs
+// queued by other crawlers
+const sharedPollInterval = 500 * time.Millisecond
+
+// The time limit for connecting to the Redis server, and for each command
+const redisTimeout = 10 * time.Second
+
+// How long a task handed out by the shared queue is leased to the crawler
+// that took it. The crawler renews its leases while it is running, so only
+// the leases of a crawler that was killed or crashed run out, and their
+// tasks are then queued up again for the others.
+const redisLeaseTTL = 2 * time.Minute
+
+// Queues up the tasks whose leases ran out again, at the front of the queue.
+// KEYS are the queue, the lease expiry times and the leased tasks, and
+// ARGV[1] the time now, in milliseconds.
+const redisReclaimScript = `local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+for _, lease in ipairs(expired) do
+	local task = redis.call('HGET', KEYS[3], lease)
+	if task then
+		redis.call('LPUSH', KEYS[1], task)
+	end
+	redis.call('HDEL', KEYS[3], lease)
+	redis.call('ZREM', KEYS[2], lease)
+end
+`
+
+// Pops the next task off the queue, leasing it in the same step, so that no
+// crawler can see an empty queue and nothing in process while a task is
+// changing hands. ARGV[2] is when the lease runs out, and ARGV[3] its ID.
+// Returns the number of tasks reclaimed, and the task, if any.
+const redisPopScript = redisReclaimScript + `local task = redis.call('LPOP', KEYS[1])
+if task then
+	redis.call('ZADD', KEYS[2], ARGV[2], ARGV[3])
+	redis.call('HSET', KEYS[3], ARGV[3], task)
+end
+return {#expired, task}`
+
+// Returns the number of tasks reclaimed, and the number of tasks leased
+const redisBusyScript = redisReclaimScript + `return {#expired, redis.call('ZCARD', KEYS[2])}`
+
+// Releases the lease of a task that is done. KEYS are the lease expiry times
+// and the leased tasks, and ARGV[1] the lease's ID.
+const redisDoneScript = `redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+return 1`
+
+// RedisClient is a minimal client for the Redis protocol (RESP), with just
+// enough to share a crawl between several instances of the program. Commands
+// are sent one at a time over a single connection, which is opened again
+// after an error.
+type RedisClient struct {
+	address  string
+	password string
+	database int
+
+	conn   net.Conn
+	reader *bufio.Reader
+	mutex  sync.Mutex
+}
+
+// redisError is an error reply from the Redis server.
+type redisError string
+
+// Method Error returns the error message from the server.
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// Function NewRedisClient connects to the Redis server at the given address,
+// either host:port or a URL in the form redis://[:password@]host[:port][/database].
+func NewRedisClient(rawURL string) (*RedisClient, error) {
+	client := &RedisClient{address: rawURL}
+
+	if strings.Contains(rawURL, "://") {
+		redisURL, err := url.Parse(rawURL)
+		if err != nil || redisURL.Scheme != "redis" || redisURL.Hostname() == "" {
+			return nil, errors.New("invalid Redis URL: " + rawURL)
+		}
+		client.address = redisURL.Host
+		if redisURL.Port() == "" {
+			client.address = net.JoinHostPort(redisURL.Hostname(), "6379")
+		}
+		if password, set := redisURL.User.Password(); set {
+			client.password = password
+		}
+		if database := strings.Trim(redisURL.Path, "/"); database != "" {
+			if client.database, err = strconv.Atoi(database); err != nil {
+				return nil, errors.New("invalid Redis database: " + database)
+			}
+		}
+	}
+
+	if _, err := client.Do("PING"); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Method connect opens the connection to the server, logging in and picking
+// the database if needed. The client's lock must be held.
+func (r *RedisClient) connect() error {
+	conn, err := net.DialTimeout("tcp", r.address, redisTimeout)
+	if err != nil {
+		return err
+	}
+	r.conn, r.reader = conn, bufio.NewReader(conn)
+
+	if r.password != "" {
+		if _, err := r.command("AUTH", r.password); err != nil {
+			r.disconnect()
+			return err
+		}
+	}
+	if r.database != 0 {
+		if _, err := r.command("SELECT", strconv.Itoa(r.database)); err != nil {
+			r.disconnect()
+			return err
+		}
+	}
+	return nil
+}
+
+// Method disconnect closes the connection to the server. The client's lock
+// must be held.
+func (r *RedisClient) disconnect() {
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.conn, r.reader = nil, nil
+}
+
+// Method Do sends a command to the server and returns its reply: a string,
+// an int64, nil, or a []interface{} of replies. Error replies are returned
+// as errors.
+func (r *RedisClient) Do(args ...string) (interface{}, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.conn == nil {
+		if err := r.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := r.command(args...)
+	if _, isReply := err.(redisError); err != nil && !isReply {
+		// The connection is in an unknown state, so start again with the next command
+		r.disconnect()
+	}
+	return reply, err
+}
+
+// Method command writes a command and reads its reply. The client's lock
+// must be held.
+func (r *RedisClient) command(args ...string) (interface{}, error) {
+	r.conn.SetDeadline(time.Now().Add(redisTimeout))
+
+	request := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		request += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(r.conn, request); err != nil {
+		return nil, err
+	}
+	return r.readReply()
+}
+
+// Method readReply reads a single reply from the server.
+func (r *RedisClient) readReply() (interface{}, error) {
+	line, err := r.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(r.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:length]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		replies := make([]interface{}, count)
+		for i := range replies {
+			if replies[i], err = r.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return replies, nil
+	}
+	return nil, errors.New("redis: unexpected reply: " + line)
+}
+
+// Function redisInt converts a reply to an integer.
+func redisInt(reply interface{}, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	switch value := reply.(type) {
+	case int64:
+		return value, nil
+	case string:
+		return strconv.ParseInt(value, 10, 64)
+	case nil:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("redis: unexpected reply: %v", reply)
+}
+
+// Function redisInts converts an array reply to integers.
+func redisInts(reply interface{}, err error) ([]int64, error) {
+	if err != nil {
+		return nil, err
+	}
+	replies, ok := reply.([]interface{})
+	if !ok && reply != nil {
+		return nil, fmt.Errorf("redis: unexpected reply: %v", reply)
+	}
+	values := make([]int64, len(replies))
+	for i, value := range replies {
+		if values[i], err = redisInt(value, nil); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// Function redisStrings converts an array reply to strings.
+func redisStrings(reply interface{}, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	replies, ok := reply.([]interface{})
+	if !ok && reply != nil {
+		return nil, fmt.Errorf("redis: unexpected reply: %v", reply)
+	}
+	values := make([]string, 0, len(replies))
+	for _, value := range replies {
+		if text, ok := value.(string); ok {
+			values = append(values, text)
+		}
+	}
+	return values, nil
+}
+
+// sharedTask is a task as stored in the shared queue. The seed is stored in
+// full, so that a crawler can handle tasks from seeds that it was not given.
+type sharedTask struct {
+	URL        string `json:"url"`
+	Depth      int    `json:"depth"`
+	SeedURL    string `json:"seed_url"`
+	Seed       Seed   `json:"seed"`
+	FragmentOf string `json:"fragment_of,omitempty"`
+}
+
+// RedisQueue is a queue stored in Redis, shared by every crawler using the
+// same Redis server and key. Tasks are handed out in the order they were
+// queued. Each task being processed is leased to the crawler that took it,
+// so that a crawler only finishes once none of them can find more, and so
+// that the tasks of a crawler that stops without finishing them are handed
+// out again once their leases run out.
+type RedisQueue struct {
+	client *RedisClient
+	key    string
+	log    *Logger
+
+	// Finds the seed a task came from, among the crawler's seeds
+	findSeed func(urlString string) *Seed
+	// The seeds of tasks queued by other crawlers, by URL
+	otherSeeds map[string]*Seed
+
+	// The crawler's ID, which its lease IDs start with, and how long leases
+	// last for
+	id       string
+	leaseTTL time.Duration
+	// The leases the crawler holds, renewed while there are any, and the
+	// number it has taken out
+	leases     map[string]bool
+	leaseCount int64
+	renewing   bool
+
+	mutex sync.Mutex
+}
+
+// Method keys returns the Redis keys of the queue, the lease expiry times,
+// and the leased tasks.
+func (q *RedisQueue) keys() []string {
+	return []string{q.key + ":queue", q.key + ":leases", q.key + ":leased"}
+}
+
+// Function redisMilliseconds returns a time as milliseconds since 1970.
+func redisMilliseconds(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
+
+// Method Push adds a task to the end of the shared queue.
+func (q *RedisQueue) Push(task Task) {
+	data, err := json.Marshal(sharedTask{
+		URL:        task.URL.String(),
+		Depth:      task.Depth,
+		SeedURL:    task.Seed.URL.String(),
+		Seed:       *task.Seed,
+		FragmentOf: task.FragmentOf,
+	})
+	if err == nil {
+		_, err = q.client.Do("RPUSH", q.key+":queue", string(data))
+	}
+	if err != nil {
+		q.log.Errorf("[redis] [%s] Unable to queue the URL: %s", task.URL.String(), err.Error())
+	}
+}
+
+// Method Pop removes and returns the task at the front of the shared queue,
+// leasing it to the crawler until it is done. The tasks of other crawlers
+// whose leases ran out are queued up again first.
+func (q *RedisQueue) Pop() (task Task, ok bool) {
+	q.mutex.Lock()
+	q.leaseCount++
+	lease := fmt.Sprintf("%s:%d", q.id, q.leaseCount)
+	q.mutex.Unlock()
+
+	now := time.Now()
+	args := append([]string{"EVAL", redisPopScript, "3"}, q.keys()...)
+	reply, err := q.client.Do(append(args, redisMilliseconds(now), redisMilliseconds(now.Add(q.leaseTTL)), lease)...)
+	if err != nil {
+		q.log.Errorf("[redis] Unable to fetch the next URL: %s", err.Error())
+		return
+	}
+	replies, _ := reply.([]interface{})
+	if len(replies) == 0 {
+		return
+	}
+	q.logReclaimed(replies[0])
+	if len(replies) < 2 {
+		return
+	}
+	data, isString := replies[1].(string)
+	if !isString {
+		return
+	}
+	task.lease = lease
+	q.hold(lease)
+
+	var queued sharedTask
+	if err := json.Unmarshal([]byte(data), &queued); err != nil {
+		q.log.Errorf("[redis] Skipping an invalid task in the queue: %s", err.Error())
+		q.Done(task)
+		return
+	}
+	if task.URL, err = url.Parse(queued.URL); err != nil {
+		q.log.Errorf("[redis] [%s] Skipping an invalid URL in the queue: %s", queued.URL, err.Error())
+		q.Done(task)
+		return
+	}
+	task.Depth, task.FragmentOf = queued.Depth, queued.FragmentOf
+	task.Seed = q.seed(queued)
+	return task, true
+}
+
+// Method seed returns the seed of a task from the shared queue.
+func (q *RedisQueue) seed(queued sharedTask) *Seed {
+	if seed := q.findSeed(queued.SeedURL); seed != nil {
+		return seed
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if seed, exists := q.otherSeeds[queued.SeedURL]; exists {
+		return seed
+	}
+	seed := queued.Seed
+	seed.URL, _ = url.Parse(queued.SeedURL)
+	if seed.URL == nil {
+		seed.URL = &url.URL{}
+	}
+	q.otherSeeds[queued.SeedURL] = &seed
+	return &seed
+}
+
+// Method Done releases the lease of a task, as it is no longer in process.
+func (q *RedisQueue) Done(task Task) {
+	if task.lease == "" {
+		return
+	}
+	q.mutex.Lock()
+	delete(q.leases, task.lease)
+	q.mutex.Unlock()
+
+	if _, err := q.client.Do("EVAL", redisDoneScript, "2", q.key+":leases", q.key+":leased", task.lease); err != nil {
+		q.log.Errorf("[redis] Unable to mark a URL as processed: %s", err.Error())
+	}
+}
+
+// Method hold records a lease the crawler holds, renewing its leases in the
+// background while it holds any.
+func (q *RedisQueue) hold(lease string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.leases[lease] = true
+	if !q.renewing {
+		q.renewing = true
+		go q.renew()
+	}
+}
+
+// Method renew pushes back when the crawler's leases run out, every third of
+// their time, until it holds none. Leases that ran out regardless, such as
+// while the Redis server could not be reached, may have been handed out to
+// other crawlers, which then search the same pages again.
+func (q *RedisQueue) renew() {
+	ticker := time.NewTicker(q.leaseTTL / 3)
+	defer ticker.Stop()
+	for range ticker.C {
+		q.mutex.Lock()
+		if len(q.leases) == 0 {
+			q.renewing = false
+			q.mutex.Unlock()
+			return
+		}
+		args := []string{"ZADD", q.key + ":leases", "XX", "CH"}
+		expiry := redisMilliseconds(time.Now().Add(q.leaseTTL))
+		for lease := range q.leases {
+			args = append(args, expiry, lease)
+		}
+		q.mutex.Unlock()
+
+		held := int64((len(args) - 4) / 2)
+		renewed, err := redisInt(q.client.Do(args...))
+		if err != nil {
+			q.log.Errorf("[redis] Unable to renew the leases of the URLs in process: %s", err.Error())
+		} else if renewed < held {
+			q.log.Warnf("[redis] %d URL(s) in process were handed out to other crawlers, as their leases ran out", held-renewed)
+		}
+	}
+}
+
+// Method logReclaimed logs the number of tasks that were queued up again, as
+// the crawlers they were leased to stopped without finishing them.
+func (q *RedisQueue) logReclaimed(reply interface{}) {
+	if reclaimed, _ := redisInt(reply, nil); reclaimed > 0 {
+		q.log.Warnf("[redis] Queued up %d URL(s) again, whose crawlers stopped without searching them", reclaimed)
+	}
+}
+
+// Method Len returns the number of tasks in the shared queue.
+func (q *RedisQueue) Len() int {
+	length, err := redisInt(q.client.Do("LLEN", q.key+":queue"))
+	if err != nil {
+		q.log.Errorf("[redis] Unable to check the queue: %s", err.Error())
+	}
+	return int(length)
+}
+
+// Method Busy reports whether any crawler sharing the queue is processing a
+// task, that is, holds a lease that has not run out. The tasks whose leases
+// ran out are queued up again, in which case the crawl is busy too. If the
+// server cannot be reached, the crawl is assumed to be busy, so that it is
+// not cut short.
+func (q *RedisQueue) Busy() bool {
+	args := append([]string{"EVAL", redisBusyScript, "3"}, q.keys()...)
+	replies, err := redisInts(q.client.Do(append(args, redisMilliseconds(time.Now()))...))
+	if err != nil || len(replies) != 2 {
+		if err == nil {
+			err = errors.New("unexpected reply")
+		}
+		q.log.Errorf("[redis] Unable to check the crawlers' progress: %s", err.Error())
+		return true
+	}
+	q.logReclaimed(replies[0])
+	return replies[0] > 0 || replies[1] > 0
+}
+
+// RedisVisited is a set of visited URLs stored in Redis, shared by every
+// crawler using the same Redis server and key.
+type RedisVisited struct {
+	client *RedisClient
+	// The key of the set itself, such as "<key>:visited"
+	key string
+	log *Logger
+}
+
+// Method Add adds a URL to the shared set, returning false if it was already
+// in the set, or could not be added.
+func (v *RedisVisited) Add(key string) bool {
+	added, err := redisInt(v.client.Do("SADD", v.key, key))
+	if err != nil {
+		v.log.Errorf("[redis] [%s] Unable to mark the URL as visited, so skipping it: %s", key, err.Error())
+		return false
+	}
+	return added == 1
+}
+
+// Method Len returns the number of URLs in the shared set.
+func (v *RedisVisited) Len() int {
+	length, err := redisInt(v.client.Do("SCARD", v.key))
+	if err != nil {
+		v.log.Errorf("[redis] Unable to count the visited URLs: %s", err.Error())
+	}
+	return int(length)
+}
+
+// Method Keys returns every URL in the shared set.
+func (v *RedisVisited) Keys() []string {
+	keys, err := redisStrings(v.client.Do("SMEMBERS", v.key))
+	if err != nil {
+		v.log.Errorf("[redis] Unable to fetch the visited URLs: %s", err.Error())
+	}
+	return keys
+}
+
+// RedisSink adds page results to a list in Redis, shared by every crawler
+// using the same Redis server and key.
+type RedisSink struct {
+	client *RedisClient
+	key    string
+}
+
+// Method Write adds a page result to the shared results.
+func (s *RedisSink) Write(result PageResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Do("RPUSH", s.key+":results", string(data))
+	return err
+}
+
+// Method Close does nothing, as every result is sent as it is written.
+func (s *RedisSink) Close() error {
+	return nil
+}
+
+// Method UseRedis shares the crawl with every other crawler using the same
+// Redis server and key: the queue of URLs, the visited and requested URLs,
+// and the results are all kept in Redis. Each crawler should be given the same seeds and
+// options. It must be called before Run.
+func (c *Crawler) UseRedis(client *RedisClient, key string) {
+	c.shared, c.sharedKey = client, key
+	c.frontier = &RedisQueue{
+		client:     client,
+		key:        key,
+		log:        c.log,
+		findSeed:   c.findSeed,
+		otherSeeds: make(map[string]*Seed),
+		id:         newJobID(),
+		leaseTTL:   redisLeaseTTL,
+		leases:     make(map[string]bool),
+	}
+	c.visited = &RedisVisited{client: client, key: key + ":visited", log: c.log}
+	c.requested = &RedisVisited{client: client, key: key + ":requested", log: c.log}
+	c.AddSink(&RedisSink{client: client, key: key})
+}
+
+// Method findSeed returns the crawler's seed with the given URL, or nil if
+// there is none.
+func (c *Crawler) findSeed(urlString string) *Seed {
+	for i := range c.seeds {
+		if c.seeds[i].URL.String() == urlString {
+			return &c.seeds[i]
+		}
+	}
+	return nil
+}
+
+// Method sharedResults returns the results found by every crawler sharing
+// the crawl.
+func (c *Crawler) sharedResults() ([]PageResult, error) {
+	values, err := redisStrings(c.shared.Do("LRANGE", c.sharedKey+":results", "0", "-1"))
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]PageResult, 0, len(values))
+	for _, value := range values {
+		var page PageResult
+		if err := json.Unmarshal([]byte(value), &page); err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+// Function testRedisQueue returns a queue of a crawler sharing the crawl
+// under the given key, through the Redis server in IFF_TEST_REDIS (such as
+// redis://127.0.0.1:6379/15), with short leases. The test is skipped if the
+// variable is not set.
+func testRedisQueue(t *testing.T, key string) *RedisQueue {
+	address := os.Getenv("IFF_TEST_REDIS")
+	if address == "" {
+		t.Skip("set IFF_TEST_REDIS to the URL of a Redis server to test shared crawls")
+	}
+	client, err := NewRedisClient(address)
+	if err != nil {
+		t.Fatalf("Unable to connect to %s: %s", address, err)
+	}
+	crawler := NewCrawler(nil, DefaultOptions())
+	crawler.UseRedis(client, key)
+	queue := crawler.frontier.(*RedisQueue)
+	queue.leaseTTL = 300 * time.Millisecond
+	return queue
+}
+
+func TestRedisQueueReclaimsLeasesOfStoppedCrawlers(t *testing.T) {
+	key := "iff-test-" + newJobID()
+	crashed := testRedisQueue(t, key)
+	running := testRedisQueue(t, key)
+	other := testRedisQueue(t, key)
+	defer crashed.client.Do("DEL", key+":queue", key+":leases", key+":leased")
+
+	pageURL, _ := url.Parse("http://www.example.com/page")
+	seed := newSeed(pageURL)
+	crashed.Push(Task{URL: pageURL, Seed: &seed})
+	if _, ok := crashed.Pop(); !ok {
+		t.Fatalf("the task was not handed out")
+	}
+	// Forget the lease without releasing it, as a crawler that was killed
+	// would, so that it is no longer renewed
+	crashed.mutex.Lock()
+	crashed.leases = make(map[string]bool)
+	crashed.mutex.Unlock()
+
+	otherURL, _ := url.Parse("http://www.example.com/other")
+	running.Push(Task{URL: otherURL, Seed: &seed})
+	held, ok := running.Pop()
+	if !ok {
+		t.Fatalf("the second task was not handed out")
+	}
+
+	if !other.Busy() {
+		t.Errorf("the queue was not busy while both tasks were leased")
+	}
+	time.Sleep(3 * crashed.leaseTTL)
+
+	// The lease that was not renewed ran out, and its task is handed out
+	// again; the lease of the crawler still running was renewed
+	reclaimed, ok := other.Pop()
+	if !ok || reclaimed.URL.String() != pageURL.String() {
+		t.Fatalf("the task of the stopped crawler was not handed out again: %v", reclaimed.URL)
+	}
+	if _, ok := other.Pop(); ok {
+		t.Errorf("a task was handed out twice while its lease was renewed")
+	}
+	other.Done(reclaimed)
+	if !other.Busy() {
+		t.Errorf("the queue was not busy while the running crawler held a lease")
+	}
+	running.Done(held)
+	if other.Busy() || other.Len() != 0 {
+		t.Errorf("the queue was still busy once every task was done")
+	}
+}
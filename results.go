@@ -0,0 +1,461 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Report is the JSON document written by the JSON output format, and
+// returned by the scan API's results endpoint.
+type Report struct {
+	Results []PageResult `json:"results"`
+}
+
+// Function sortResults sorts page results by URL, and the results for the
+// same URL (such as with and without a session) by their JSON encoding, so
+// that the same results are always written out in the same order.
+func sortResults(pages []PageResult) {
+	keys := make([]string, len(pages))
+	for i, page := range pages {
+		encoded, _ := json.Marshal(page)
+		keys[i] = string(encoded)
+	}
+	sorted := make([]int, len(pages))
+	for i := range sorted {
+		sorted[i] = i
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := pages[sorted[i]], pages[sorted[j]]
+		if a.URL != b.URL {
+			return a.URL < b.URL
+		}
+		return keys[sorted[i]] < keys[sorted[j]]
+	})
+
+	original := append([]PageResult(nil), pages...)
+	for i, index := range sorted {
+		pages[i] = original[index]
+	}
+}
+
+// Function resultRequest returns how a page result was found: the method it
+// was requested with, or that of the API operation it stands for ("" for
+// GET), and where it came from, such as "browser" or "openapi" ("" for a
+// page found by the crawl).
+func resultRequest(result PageResult) (method string, source string) {
+	method, source = result.Method, result.Source
+	for _, input := range result.Inputs {
+		if input.Source != "" {
+			if method == "" {
+				method = input.Attr("method")
+			}
+			if source == "" {
+				source = input.Source
+			}
+			break
+		}
+	}
+	if method = strings.ToUpper(method); method == http.MethodGet {
+		method = ""
+	}
+	return method, source
+}
+
+// Function resultIdentity returns what tells a page result apart from the
+// other results for the same URL (such as a seed requested with POST and its
+// page requested with GET, the operations of an API path, pages pushed from
+// the browser, or the same page requested with different auth profiles): how
+// it was found (see resultRequest), and its auth profile. Only the parts that
+// are set are returned, so a page crawled with GET and no auth profile has
+// none.
+func resultIdentity(result PageResult) []string {
+	method, source := resultRequest(result)
+
+	var parts []string
+	if method != "" {
+		parts = append(parts, "method="+method)
+	}
+	if source != "" {
+		parts = append(parts, "source="+source)
+	}
+	if result.AuthProfile != "" {
+		parts = append(parts, "auth="+result.AuthProfile)
+	}
+	return parts
+}
+
+// Function resultKey identifies a page result: its URL, and its identity
+// among the other results for that URL (see resultIdentity).
+func resultKey(result PageResult) string {
+	return strings.Join(append([]string{result.URL}, resultIdentity(result)...), " ")
+}
+
+// PageResult holds the input fields found on a single page.
+type PageResult struct {
+	URL string `json:"url"`
+	// Tags are the tags of the seed the page was found from
+	Tags []string `json:"tags,omitempty"`
+	// Target is the name of the target the page belongs to
+	Target string `json:"target,omitempty"`
+	// Redirects are the URLs requested to reach the page, if it was
+	// redirected, from the URL found to the page's URL
+	Redirects []string `json:"redirects,omitempty"`
+	// FragmentOf is the page that loads this page in as an HTML fragment,
+	// if it was found that way
+	FragmentOf string `json:"fragment_of,omitempty"`
+	// Authenticated is whether the page was requested with a session: the
+	// headers of an auth profile, or a Cookie or Authorization header
+	Authenticated bool `json:"authenticated"`
+	// AuthProfile is the auth profile the page was requested with, if any
+	AuthProfile string `json:"auth_profile,omitempty"`
+	// Source is where the page came from, if it was not found by the crawl,
+	// such as "browser" for pages pushed by the browser extension
+	Source string `json:"source,omitempty"`
+	// Method is the method the page was requested with, if it was not GET,
+	// for the seeds requested with a method and body of their own
+	Method string `json:"method,omitempty"`
+	// Links are the links on the page that open somewhere other than the
+	// page itself, or that have a rel attribute
+	Links []Link `json:"links,omitempty"`
+	// FirstSeen and LastSeen are when the page was first and last found,
+	// if the crawl recorded to a history
+	FirstSeen *time.Time `json:"first_seen,omitempty"`
+	LastSeen  *time.Time `json:"last_seen,omitempty"`
+	Inputs    []Input    `json:"inputs"`
+}
+
+// Input is a single input element found on a page.
+type Input struct {
+	// HTML is the recreated input element code
+	HTML string `json:"html"`
+	// Element is the name of the element, if it is not an input element,
+	// such as "button"
+	Element string `json:"element,omitempty"`
+	// Attributes are the attributes of the input element, in document order
+	Attributes []Attribute `json:"attributes"`
+	// Action and Method are where and how the input field's form is
+	// submitted, if it belongs to a form. For a submit button with a
+	// formaction or formmethod, they are where and how clicking it submits
+	// the form.
+	Action string `json:"action,omitempty"`
+	Method string `json:"method,omitempty"`
+	// FormTarget and FormRel are the target and rel of the input field's
+	// form, if it has them, with a submit button's formtarget in place of the
+	// form's target (see formWindow), and SubmitsInto is where the form is
+	// submitted into, if not the page itself, such as an iframe or a new
+	// window (see OpensNewWindow and the rest)
+	FormTarget  string `json:"form_target,omitempty"`
+	FormRel     string `json:"form_rel,omitempty"`
+	SubmitsInto string `json:"submits_into,omitempty"`
+	// Coordinates are the parameters an image input submits, with the x and
+	// y coordinates of the click, such as "map.x" and "map.y"
+	Coordinates []string `json:"coordinates,omitempty"`
+	// FormWarning, if set, is why the form the input field belongs to is not
+	// what the markup appears to say, such as for nested forms
+	FormWarning string `json:"form_warning,omitempty"`
+	// Source is where an input field that is not an HTML element came from,
+	// such as "openapi" or "graphql" for API parameters
+	Source string `json:"source,omitempty"`
+	// Flags mark the value of the input field as possibly interesting,
+	// such as a token or API key in a hidden field (see inspectValue)
+	Flags []ValueFlag `json:"flags,omitempty"`
+	// FirstSeen and LastSeen are when the input field was first and last
+	// found, and FormFirstSeen when its form was first found, if the crawl
+	// recorded to a history
+	FirstSeen     *time.Time `json:"first_seen,omitempty"`
+	LastSeen      *time.Time `json:"last_seen,omitempty"`
+	FormFirstSeen *time.Time `json:"form_first_seen,omitempty"`
+	// Count is the number of times the input field is repeated exactly on
+	// the page, if it is more than once (see collapseDuplicates)
+	Count int `json:"count,omitempty"`
+}
+
+// Attribute is a single key/value attribute of an element.
+type Attribute struct {
+	Key string `json:"key"`
+	Val string `json:"value"`
+}
+
+// Method Attr returns the value of the given attribute, or "" if it is not set.
+func (i Input) Attr(key string) string {
+	for _, attribute := range i.Attributes {
+		if attribute.Key == key {
+			return attribute.Val
+		}
+	}
+	return ""
+}
+
+// Function collapseDuplicates merges the input fields that are repeated
+// exactly within a page, such as the same hidden token in several identical
+// forms, into the first of them, with a count of how many times it appears.
+// Input fields that only differ in their form, or in any other detail, are
+// kept apart, so that nothing is lost.
+func collapseDuplicates(inputs []Input) []Input {
+	var collapsed []Input
+	positions := make(map[string]int)
+	for _, input := range inputs {
+		encoded, err := json.Marshal(input)
+		if err != nil {
+			collapsed = append(collapsed, input)
+			continue
+		}
+		if position, exists := positions[string(encoded)]; exists {
+			if collapsed[position].Count == 0 {
+				collapsed[position].Count = 1
+			}
+			collapsed[position].Count++
+			continue
+		}
+		positions[string(encoded)] = len(collapsed)
+		collapsed = append(collapsed, input)
+	}
+	return collapsed
+}
+
+// Function newInput creates an Input from an input or button element node.
+func newInput(node *html.Node) Input {
+	input := Input{Element: elementName(node.DataAtom, node.Data), Attributes: tokenAttributes(node.Attr)}
+	input.HTML = renderElement(input.Element, input.Attributes)
+
+	// An image input submits the coordinates of the click, rather than a value
+	if node.DataAtom == atom.Input && strings.EqualFold(strings.TrimSpace(input.Attr("type")), "image") {
+		if name := input.Attr("name"); name != "" {
+			input.Coordinates = []string{name + ".x", name + ".y"}
+		} else {
+			input.Coordinates = []string{"x", "y"}
+		}
+	}
+	return input
+}
+
+// Function formOwner returns the form an input element belongs to, or nil if
+// it does not belong to one. As in the HTML standard, an element with a form
+// attribute belongs to the form with that id, wherever it is in the
+// document, and to no form at all if that id is not a form's; other elements
+// belong to the form the parser associated them with (see scanForms), which
+// is the form they are in unless the markup was broken.
+func formOwner(node *html.Node, forms *formIndex) *html.Node {
+	for _, attribute := range node.Attr {
+		if attribute.Key != "form" {
+			continue
+		}
+		if owner := forms.ids[attribute.Val]; owner != nil && owner.DataAtom == atom.Form {
+			return owner
+		}
+		return nil
+	}
+
+	if owner, exists := forms.pointers[node]; exists {
+		return owner
+	}
+	return enclosingForm(node)
+}
+
+// Function isSubmitter reports whether an element submits its form when
+// clicked: a button (other than a reset or plain button), or a submit or
+// image input.
+func isSubmitter(node *html.Node) bool {
+	var elementType string
+	for _, attribute := range node.Attr {
+		if attribute.Key == "type" {
+			elementType = strings.ToLower(strings.TrimSpace(attribute.Val))
+		}
+	}
+	switch node.DataAtom {
+	case atom.Button:
+		return elementType != "reset" && elementType != "button"
+	case atom.Input:
+		return elementType == "submit" || elementType == "image"
+	}
+	return false
+}
+
+// Function formTarget returns where and how the form an input element
+// belongs to (see formOwner) would be submitted: the form's action, resolved
+// against the base URL (the page itself, if it has no action), and its
+// method. A submit button's formaction and formmethod take the place of the
+// form's. Both are empty if the element does not belong to a form.
+func formTarget(node *html.Node, baseURL *url.URL, forms *formIndex) (action string, method string) {
+	form := formOwner(node, forms)
+	if form == nil {
+		return "", ""
+	}
+
+	actionURL := baseURL
+	method = "GET"
+	apply := func(attributes []html.Attribute, actionKey string, methodKey string) {
+		for _, attribute := range attributes {
+			switch attribute.Key {
+			case actionKey:
+				if parsed, err := url.Parse(strings.TrimSpace(attribute.Val)); err == nil && attribute.Val != "" {
+					actionURL = baseURL.ResolveReference(parsed)
+				}
+			case methodKey:
+				if strings.EqualFold(strings.TrimSpace(attribute.Val), "post") {
+					method = "POST"
+				} else if strings.EqualFold(strings.TrimSpace(attribute.Val), "get") {
+					method = "GET"
+				}
+			}
+		}
+	}
+	apply(form.Attr, "action", "method")
+	if isSubmitter(node) {
+		apply(node.Attr, "formaction", "formmethod")
+	}
+	return actionURL.String(), method
+}
+
+// Function renderInput recreates the input code from the given attributes.
+func renderInput(attributes []Attribute) string {
+	return renderElement("", attributes)
+}
+
+// Function renderElement recreates the code of an input field's element from
+// the given attributes; an empty element name is an input element.
+func renderElement(element string, attributes []Attribute) string {
+	if element == "" {
+		element = "input"
+	}
+	var input = "<" + element + " "
+	for _, attribute := range attributes {
+		input = input + fmt.Sprintf(" %s=\"%s\"", attribute.Key, attribute.Val)
+	}
+	input = input + "></" + element + ">"
+
+	// Remove newline characters
+	return strings.Replace(input, "\n", "", -1)
+}
+
+// AttributeFilter chooses which input attributes are shown in outputs that
+// are read by people, such as the console and CSV files. Input fields are
+// always captured with all of their attributes, so JSON outputs stay complete.
+type AttributeFilter struct {
+	// Allow, if not empty, is the only attributes shown
+	Allow map[string]bool
+	// Deny is attributes that are never shown
+	Deny map[string]bool
+}
+
+// Function NewAttributeFilter creates a filter from comma-separated lists of
+// attributes to allow and deny. It returns nil if both lists are empty.
+func NewAttributeFilter(allow string, deny string) *AttributeFilter {
+	filter := &AttributeFilter{
+		Allow: attributeSet(allow),
+		Deny:  attributeSet(deny),
+	}
+	if len(filter.Allow) == 0 && len(filter.Deny) == 0 {
+		return nil
+	}
+	return filter
+}
+
+// Function attributeSet splits a comma-separated list of attribute names into a set.
+func attributeSet(list string) map[string]bool {
+	set := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			set[name] = true
+		}
+	}
+	return set
+}
+
+// Method Apply returns a copy of the input with only the chosen attributes,
+// and its code recreated from them. A nil filter returns the input unchanged.
+func (f *AttributeFilter) Apply(input Input) Input {
+	if f == nil {
+		return input
+	}
+
+	filtered := input
+	filtered.Attributes = nil
+	for _, attribute := range input.Attributes {
+		key := strings.ToLower(attribute.Key)
+		if f.Deny[key] || (len(f.Allow) > 0 && !f.Allow[key]) {
+			continue
+		}
+		filtered.Attributes = append(filtered.Attributes, attribute)
+	}
+	filtered.HTML = renderElement(filtered.Element, filtered.Attributes)
+	return filtered
+}
+
+// Method ApplyPage applies the filter to every input of a page result.
+func (f *AttributeFilter) ApplyPage(result PageResult) PageResult {
+	if f == nil {
+		return result
+	}
+
+	filtered := result
+	filtered.Inputs = make([]Input, len(result.Inputs))
+	for i, input := range result.Inputs {
+		filtered.Inputs[i] = f.Apply(input)
+	}
+	return filtered
+}
+
+// Function printPageResult outputs the input elements found on a page to the console.
+func printPageResult(result PageResult) {
+	if len(result.Tags) > 0 {
+		fmt.Printf("[%s] (%s)\n", result.URL, strings.Join(result.Tags, ", "))
+	} else {
+		fmt.Printf("[%s]\n", result.URL)
+	}
+	if len(result.Redirects) > 0 {
+		fmt.Printf("\t(redirected: %s)\n", strings.Join(result.Redirects, " -> "))
+	}
+	if result.FragmentOf != "" {
+		fmt.Printf("\t(fragment of: %s)\n", result.FragmentOf)
+	}
+	if result.Source == SourceBrowser {
+		fmt.Printf("\t(seen in the browser)\n")
+	}
+	if result.Method != "" {
+		fmt.Printf("\t(requested with %s)\n", result.Method)
+	}
+	// Targets added for a seed's origin are named after it, which the
+	// page's URL already shows
+	if resultURL, err := url.Parse(result.URL); result.Target != "" && (err != nil || result.Target != origin(resultURL)) {
+		fmt.Printf("\t(target: %s)\n", result.Target)
+	}
+	if result.AuthProfile != "" {
+		fmt.Printf("\t(authenticated: %s)\n", result.AuthProfile)
+	} else if result.Authenticated {
+		fmt.Printf("\t(authenticated)\n")
+	}
+	for _, input := range result.Inputs {
+		fmt.Printf("\t%s\n", input.HTML)
+		if input.Count > 1 {
+			fmt.Printf("\t\t(repeated %d times)\n", input.Count)
+		}
+		if input.SubmitsInto != "" {
+			fmt.Printf("\t\t(submits into %s: target=%q)\n", opensDescription(input.SubmitsInto), input.FormTarget)
+		}
+		if len(input.Coordinates) > 0 {
+			fmt.Printf("\t\t(submits the click coordinates: %s)\n", strings.Join(input.Coordinates, ", "))
+		}
+		if input.FormWarning != "" {
+			fmt.Printf("\t\t(form: %s)\n", input.FormWarning)
+		}
+		for _, flag := range input.Flags {
+			fmt.Printf("\t\t[!] %s: %s\n", flag.Kind, flag.Reason)
+		}
+	}
+	for _, link := range result.Links {
+		if link.Opens != "" {
+			fmt.Printf("\t(link to %s opens in %s: target=%q)\n", link.URL, opensDescription(link.Opens), link.Target)
+		}
+	}
+	// Extra line for spacing
+	fmt.Println()
+}
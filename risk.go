@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The weight of a finding of each severity in a risk score. Each step up is
+// worth several of the one below, so that a single serious finding outranks
+// a page full of informational ones.
+var severityWeights = map[Severity]int{
+	SeverityInfo:     1,
+	SeverityLow:      5,
+	SeverityMedium:   20,
+	SeverityHigh:     50,
+	SeverityCritical: 100,
+}
+
+// PageRisk is the composite risk of a page: the sum of the weights of the
+// findings on it, the most serious of them, and how many there are of each
+// severity.
+type PageRisk struct {
+	URL      string         `json:"url"`
+	Target   string         `json:"target,omitempty"`
+	Score    int            `json:"score"`
+	Severity string         `json:"severity"`
+	Findings map[string]int `json:"findings"`
+	severity Severity
+}
+
+// HostRisk is the composite risk of a host, over the pages found on it. A
+// finding on several of its pages, such as conflicting validation, only
+// counts once.
+type HostRisk struct {
+	Host     string         `json:"host"`
+	Score    int            `json:"score"`
+	Severity string         `json:"severity"`
+	Pages    int            `json:"pages"`
+	Findings map[string]int `json:"findings"`
+	severity Severity
+}
+
+// RiskReport is the risk of each page and host of a crawl, riskiest first.
+type RiskReport struct {
+	Pages []PageRisk `json:"pages"`
+	Hosts []HostRisk `json:"hosts"`
+}
+
+// Function rollUpRisk scores each page and host of a crawl from the findings
+// made from its results (see collectFindings). Pages and hosts are ordered by
+// their most serious finding, then by their score, so that the riskiest come
+// first; ties are broken by URL and host, so the order is always the same.
+func rollUpRisk(results []PageResult) RiskReport {
+	pages := make(map[string]*PageRisk)
+	hosts := make(map[string]*HostRisk)
+	hostPages := make(map[string]map[string]bool)
+	targets := make(map[string]string)
+	for _, result := range results {
+		targets[result.URL] = result.Target
+	}
+
+	for _, finding := range collectFindings(results, findConflicts(results)) {
+		weight := severityWeights[finding.Severity]
+		counted := make(map[string]bool)
+		for _, pageURL := range finding.URLs {
+			page, exists := pages[pageURL]
+			if !exists {
+				page = &PageRisk{URL: pageURL, Target: targets[pageURL], Findings: make(map[string]int)}
+				pages[pageURL] = page
+			}
+			page.severity = maxSeverity(page.severity, finding.Severity)
+			page.Score += weight
+			page.Findings[finding.Severity.String()]++
+
+			host := pageURL
+			if parsed, err := url.Parse(pageURL); err == nil {
+				host = canonicalHost(parsed)
+			}
+			if hostPages[host] == nil {
+				hostPages[host] = make(map[string]bool)
+			}
+			hostPages[host][pageURL] = true
+			if counted[host] {
+				continue
+			}
+			counted[host] = true
+			hostRisk, exists := hosts[host]
+			if !exists {
+				hostRisk = &HostRisk{Host: host, Findings: make(map[string]int)}
+				hosts[host] = hostRisk
+			}
+			hostRisk.severity = maxSeverity(hostRisk.severity, finding.Severity)
+			hostRisk.Score += weight
+			hostRisk.Findings[finding.Severity.String()]++
+		}
+	}
+
+	report := RiskReport{Pages: []PageRisk{}, Hosts: []HostRisk{}}
+	for _, page := range pages {
+		page.Severity = page.severity.String()
+		report.Pages = append(report.Pages, *page)
+	}
+	for host, hostRisk := range hosts {
+		hostRisk.Severity = hostRisk.severity.String()
+		hostRisk.Pages = len(hostPages[host])
+		report.Hosts = append(report.Hosts, *hostRisk)
+	}
+	sort.Slice(report.Pages, func(i, j int) bool {
+		a, b := report.Pages[i], report.Pages[j]
+		if a.severity != b.severity {
+			return a.severity > b.severity
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.URL < b.URL
+	})
+	sort.Slice(report.Hosts, func(i, j int) bool {
+		a, b := report.Hosts[i], report.Hosts[j]
+		if a.severity != b.severity {
+			return a.severity > b.severity
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Host < b.Host
+	})
+	return report
+}
+
+// Function maxSeverity returns the more serious of two severities.
+func maxSeverity(a Severity, b Severity) Severity {
+	if b > a {
+		return b
+	}
+	return a
+}
+
+// Method Top returns the report cut down to the riskiest pages and hosts;
+// 0 = all of them.
+func (r RiskReport) Top(count int) RiskReport {
+	if count > 0 && len(r.Pages) > count {
+		r.Pages = r.Pages[:count]
+	}
+	if count > 0 && len(r.Hosts) > count {
+		r.Hosts = r.Hosts[:count]
+	}
+	return r
+}
+
+// Function sortByRisk orders page results riskiest first, as rollUpRisk
+// orders the pages, with the pages that have no findings last, by URL.
+func sortByRisk(pages []PageResult) {
+	sortResults(pages)
+	rank := make(map[string]int)
+	for i, page := range rollUpRisk(pages).Pages {
+		rank[page.URL] = i + 1
+	}
+	sort.SliceStable(pages, func(i, j int) bool {
+		a, b := rank[pages[i].URL], rank[pages[j].URL]
+		if a == 0 || b == 0 {
+			return a != 0 && b == 0
+		}
+		return a < b
+	})
+}
+
+// Function severityCounts lists how many findings there are of each
+// severity, most serious first, such as "1 High, 3 Info".
+func severityCounts(findings map[string]int) string {
+	var counts []string
+	for severity := SeverityCritical; severity >= SeverityInfo; severity-- {
+		if count := findings[severity.String()]; count > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", count, severity.String()))
+		}
+	}
+	return strings.Join(counts, ", ")
+}
+
+// Function printRisk outputs the riskiest pages and hosts to the console.
+func printRisk(report RiskReport, total int) {
+	if len(report.Pages) == 0 {
+		fmt.Printf("[RISK] No findings to score\n\n")
+		return
+	}
+
+	fmt.Printf("[RISK] The %d riskiest of %d page(s) with findings\n\n", len(report.Pages), total)
+	for _, page := range report.Pages {
+		fmt.Printf("[%s] %d (%s)\n", page.Severity, page.Score, page.URL)
+		fmt.Printf("\t%s\n", severityCounts(page.Findings))
+	}
+	fmt.Println()
+
+	fmt.Printf("[RISK] The riskiest hosts\n\n")
+	for _, host := range report.Hosts {
+		fmt.Printf("[%s] %d (%s, %d page(s))\n", host.Severity, host.Score, host.Host, host.Pages)
+		fmt.Printf("\t%s\n", severityCounts(host.Findings))
+	}
+	fmt.Println()
+}
+
+// Function writeRisk writes the risk of every page and host to the file at
+// the given path, as JSON.
+func writeRisk(report RiskReport, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(report); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// TemplateSample is how the pages of a form template were searched: the URL
+// pattern they share (see urlPattern), the fingerprint of the form fields
+// they share (see formFingerprint), the number of pages searched in full,
+// and the number only counted once enough had been searched.
+type TemplateSample struct {
+	Pattern     string `json:"pattern"`
+	Fingerprint string `json:"fingerprint"`
+	Searched    int    `json:"searched"`
+	Counted     int    `json:"counted"`
+	// Example is the first page that was only counted
+	Example string `json:"example,omitempty"`
+}
+
+// Sampling tracks the pages found for each form template, to stop searching
+// the pages of a template for input fields once enough of them have been.
+type Sampling struct {
+	Templates map[string]*TemplateSample
+	mutex     sync.Mutex
+}
+
+// Function formFingerprint returns a hash of the form fields of a document:
+// the method and action pattern of each form, and the element, name and type
+// of each field, in the order they appear in. Pages with the same forms get
+// the same fingerprint, regardless of the values their fields hold, so the
+// product pages of a catalog, each with its own add-to-cart form, share one.
+// The fingerprint is only valid if the document has any fields.
+// The search stops early once ctx is done.
+func formFingerprint(ctx context.Context, document *html.Node, limits walkLimits, pageURL *url.URL) (uint64, bool) {
+	hash := fnv.New64a()
+	fields := 0
+	walk(ctx, document, limits, func(node *html.Node, depth int) bool {
+		if node.Type != html.ElementNode {
+			return true
+		}
+		switch node.DataAtom {
+		case atom.Form:
+			action := attributeValue(node, "action")
+			if actionURL, err := pageURL.Parse(strings.TrimSpace(action)); err == nil {
+				action = urlPattern(actionURL)
+			}
+			fmt.Fprintf(hash, "form %s %s\n", strings.ToLower(attributeValue(node, "method")), action)
+		case atom.Input, atom.Button, atom.Select, atom.Textarea:
+			fields++
+			fmt.Fprintf(hash, "%s %s %s\n", node.Data, attributeValue(node, "name"), strings.ToLower(attributeValue(node, "type")))
+		}
+		return true
+	})
+	return hash.Sum64(), fields > 0
+}
+
+// Method isSampling checks whether the crawl only counts the pages of form
+// templates that have been searched enough.
+func (c *Crawler) isSampling() bool {
+	return c.options.SampleTemplates > 0 || len(c.options.TemplateSamples) > 0
+}
+
+// Method sampleLimit returns the number of pages of a URL pattern's form
+// templates searched in full; 0 = every page.
+func (c *Crawler) sampleLimit(pattern string) int {
+	if limit, exists := c.options.TemplateSamples[pattern]; exists {
+		return limit
+	}
+	return c.options.SampleTemplates
+}
+
+// Method sampleTemplate adds a page to its form template, and checks whether
+// enough pages of the template have already been searched, in which case the
+// page is only counted, and not searched for input fields. Its links are
+// still followed.
+func (c *Crawler) sampleTemplate(pageURL *url.URL, fingerprint uint64) bool {
+	pattern := urlPattern(pageURL)
+	limit := c.sampleLimit(pattern)
+	if limit <= 0 {
+		return false
+	}
+	key := pattern + " " + strconv.FormatUint(fingerprint, 16)
+
+	c.sampling.mutex.Lock()
+	defer c.sampling.mutex.Unlock()
+
+	template, exists := c.sampling.Templates[key]
+	if !exists {
+		template = &TemplateSample{Pattern: pattern, Fingerprint: strconv.FormatUint(fingerprint, 16)}
+		c.sampling.Templates[key] = template
+	}
+	if template.Searched < limit {
+		template.Searched++
+		return false
+	}
+
+	if template.Counted == 0 {
+		template.Example = pageURL.String()
+		c.log.Infof("[%s] %d pages share the same forms; counting the rest of the pages like them, without searching them", pattern, template.Searched)
+	}
+	template.Counted++
+	atomic.AddInt64(&c.stats.sampled, 1)
+	c.log.Debugf("[%s] Counted: same forms as pages already searched", pageURL.String())
+	return true
+}
+
+// Method TemplateSamples returns the form templates with pages that were only
+// counted, those with the most first.
+func (c *Crawler) TemplateSamples() []TemplateSample {
+	c.sampling.mutex.Lock()
+	defer c.sampling.mutex.Unlock()
+
+	samples := []TemplateSample{}
+	for _, template := range c.sampling.Templates {
+		if template.Counted > 0 {
+			samples = append(samples, *template)
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].Counted != samples[j].Counted {
+			return samples[i].Counted > samples[j].Counted
+		}
+		if samples[i].Pattern != samples[j].Pattern {
+			return samples[i].Pattern < samples[j].Pattern
+		}
+		return samples[i].Fingerprint < samples[j].Fingerprint
+	})
+	return samples
+}
+
+// Function parseTemplateSampleFlag parses a -sample-template flag, in the
+// form "pattern=count". The pattern is split from the count at the last "=",
+// as patterns do not hold one.
+func parseTemplateSampleFlag(value string) (pattern string, limit int, err error) {
+	i := strings.LastIndex(value, "=")
+	if i <= 0 {
+		return "", 0, errors.New("invalid -sample-template " + value + ": must be in the form pattern=count")
+	}
+	limit, err = strconv.Atoi(strings.TrimSpace(value[i+1:]))
+	if err != nil || limit < 0 {
+		return "", 0, errors.New("invalid -sample-template " + value + ": the count must be a number of pages")
+	}
+	return strings.TrimSpace(value[:i]), limit, nil
+}
+
+// Function writeTemplateSamples writes the form templates with pages that
+// were only counted to the file at the given path, as JSON.
+func writeTemplateSamples(path string, samples []TemplateSample) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(samples); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The layout of blackout dates
+const blackoutLayout = "2006-01-02"
+
+// How far ahead to look for the next time the crawl is allowed to run
+const scheduleHorizon = 400
+
+// timeWindow is a time of day that requests can be sent in, in minutes since
+// midnight. Windows that end before they start run past midnight.
+type timeWindow struct {
+	start int
+	end   int
+}
+
+// Method contains checks whether a time of day, in minutes since midnight,
+// is in the window. The start is in the window, and the end is not.
+func (w timeWindow) contains(minute int) bool {
+	if w.start < w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// dateRange is a range of dates that no requests can be sent on, from the
+// first to the last, inclusive.
+type dateRange struct {
+	first time.Time
+	last  time.Time
+}
+
+// Schedule is when a crawl is allowed to send requests: in any of its time
+// windows, on any day outside of its blackout dates, in its time zone.
+type Schedule struct {
+	windows   []timeWindow
+	blackouts []dateRange
+	location  *time.Location
+}
+
+// Function ParseSchedule parses the times a crawl is allowed to run in.
+// Windows are given as "01:00-05:00", in the time of day of the zone, and
+// can run past midnight ("22:00-02:00"). Blackouts are given as dates,
+// "2026-12-24", or ranges of dates, "2026-12-24..2026-12-26". The zone is an
+// IANA time zone name, such as "America/New_York", or "" for the local time
+// zone. With no windows, the crawl can run at any time outside of the
+// blackouts. It returns nil if there are neither windows nor blackouts.
+func ParseSchedule(windows []string, blackouts []string, zone string) (*Schedule, error) {
+	location := time.Local
+	if zone != "" {
+		var err error
+		if location, err = time.LoadLocation(zone); err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %s", zone, err.Error())
+		}
+	}
+	if len(windows) == 0 && len(blackouts) == 0 {
+		return nil, nil
+	}
+
+	schedule := &Schedule{location: location}
+	for _, value := range windows {
+		parts := strings.Split(strings.TrimSpace(value), "-")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid window %q: must be in the form 01:00-05:00", value)
+		}
+		start, err := parseTimeOfDay(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid window %q: %s", value, err.Error())
+		}
+		end, err := parseTimeOfDay(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid window %q: %s", value, err.Error())
+		}
+		if start == end || (start == 0 && end == 24*60) {
+			return nil, fmt.Errorf("invalid window %q: must not be empty or last the whole day", value)
+		}
+		schedule.windows = append(schedule.windows, timeWindow{start: start, end: end % (24 * 60)})
+	}
+	for _, value := range blackouts {
+		parts := strings.SplitN(strings.TrimSpace(value), "..", 2)
+		first, err := time.ParseInLocation(blackoutLayout, strings.TrimSpace(parts[0]), location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blackout %q: dates must be in the form 2026-12-24", value)
+		}
+		last := first
+		if len(parts) == 2 {
+			if last, err = time.ParseInLocation(blackoutLayout, strings.TrimSpace(parts[1]), location); err != nil {
+				return nil, fmt.Errorf("invalid blackout %q: dates must be in the form 2026-12-24", value)
+			}
+			if last.Before(first) {
+				return nil, fmt.Errorf("invalid blackout %q: must not end before it starts", value)
+			}
+		}
+		schedule.blackouts = append(schedule.blackouts, dateRange{first: first, last: last})
+	}
+	return schedule, nil
+}
+
+// Function parseTimeOfDay parses a time of day, such as "01:00", into
+// minutes since midnight. "24:00" is the end of the day.
+func parseTimeOfDay(value string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 2 || len(parts[1]) != 2 {
+		return 0, errors.New("times must be in the form 01:00")
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, errors.New("times must be in the form 01:00")
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || hour < 0 || hour > 24 || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, errors.New("times must be between 00:00 and 24:00")
+	}
+	return hour*60 + minute, nil
+}
+
+// Method Open checks whether requests can be sent at the given time.
+func (s *Schedule) Open(t time.Time) bool {
+	t = t.In(s.location)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location)
+	for _, blackout := range s.blackouts {
+		if !day.Before(blackout.first) && !day.After(blackout.last) {
+			return false
+		}
+	}
+	if len(s.windows) == 0 {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	for _, window := range s.windows {
+		if window.contains(minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// Method NextOpen returns the first time from t on that requests can be
+// sent, or the zero time if there is none within the next year or so (such
+// as when the blackouts never end).
+func (s *Schedule) NextOpen(t time.Time) time.Time {
+	if s.Open(t) {
+		return t
+	}
+
+	// The schedule can only open at midnight, once a blackout is over, or at
+	// the start of a window. The starts are times of day on the clock, which
+	// are not a fixed time after midnight on the days the clocks change
+	t = t.In(s.location)
+	for day := 0; day <= scheduleHorizon; day++ {
+		candidates := []time.Time{time.Date(t.Year(), t.Month(), t.Day()+day, 0, 0, 0, 0, s.location)}
+		for _, window := range s.windows {
+			candidates = append(candidates, time.Date(t.Year(), t.Month(), t.Day()+day, window.start/60, window.start%60, 0, 0, s.location))
+		}
+		var earliest time.Time
+		for _, candidate := range candidates {
+			if candidate.After(t) && s.Open(candidate) && (earliest.IsZero() || candidate.Before(earliest)) {
+				earliest = candidate
+			}
+		}
+		if !earliest.IsZero() {
+			return earliest
+		}
+	}
+	return time.Time{}
+}
+
+// Method waitForWindow pauses the crawl while it is outside of its schedule,
+// until the schedule opens again or the crawl is asked to stop. It returns
+// false if the crawl was asked to stop, or if the schedule never opens again.
+func (c *Crawler) waitForWindow() bool {
+	if c.schedule == nil {
+		return true
+	}
+	defer c.setPausedUntil(time.Time{})
+
+	for !c.Stopping() {
+		now := time.Now()
+		next := c.schedule.NextOpen(now)
+		if next.IsZero() {
+			c.log.Errorf("The crawl is outside of its windows, and they do not open again within a year; stopping")
+			c.fail(errors.New("the crawl windows do not open again within a year"))
+			return false
+		}
+		if !next.After(now) {
+			if !c.PausedUntil().IsZero() {
+				c.log.Infof("The crawl window is open; resuming")
+			}
+			return true
+		}
+		if !c.PausedUntil().Equal(next) {
+			c.log.Infof("Outside of the crawl windows; pausing until %s", next.Format(time.RFC3339))
+			c.setPausedUntil(next)
+		}
+
+		// Wake up to check on a stop request, as well as the window opening
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-timer.C:
+		case <-c.wake:
+			timer.Stop()
+		}
+	}
+	return false
+}
+
+// Method PausedUntil returns when the crawl will resume, if it is paused
+// outside of its schedule, or the zero time.
+func (c *Crawler) PausedUntil() time.Time {
+	c.paused.mutex.Lock()
+	defer c.paused.mutex.Unlock()
+	return c.paused.until
+}
+
+// Method setPausedUntil records when the crawl will resume; the zero time
+// means it is not paused.
+func (c *Crawler) setPausedUntil(until time.Time) {
+	c.paused.mutex.Lock()
+	c.paused.until = until
+	c.paused.mutex.Unlock()
+}
+
+// ScheduleGate is an HTTP transport that only sends requests while a crawl's
+// schedule is open. Requests made outside of it, such as by the seed
+// pre-check or the API probes, wait for it to open again.
+type ScheduleGate struct {
+	// The transport that sends the requests
+	Next     http.RoundTripper
+	Schedule *Schedule
+}
+
+// Method RoundTrip sends a request once the schedule is open, or gives up if
+// the request is cancelled first.
+func (g ScheduleGate) RoundTrip(request *http.Request) (*http.Response, error) {
+	for {
+		now := time.Now()
+		next := g.Schedule.NextOpen(now)
+		if next.IsZero() {
+			return nil, errors.New("the crawl's schedule does not open again")
+		}
+		if !next.After(now) {
+			return g.Next.RoundTrip(request)
+		}
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-timer.C:
+		case <-request.Context().Done():
+			timer.Stop()
+			return nil, request.Context().Err()
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Function testSchedule parses a schedule in America/New_York, failing the
+// test if it is invalid.
+func testSchedule(t *testing.T, windows []string, blackouts []string) (*Schedule, *time.Location) {
+	schedule, err := ParseSchedule(windows, blackouts, "America/New_York")
+	if err != nil {
+		t.Fatalf("ParseSchedule(%q, %q): %s", windows, blackouts, err)
+	}
+	return schedule, schedule.location
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	tests := []struct {
+		windows   []string
+		blackouts []string
+		zone      string
+	}{
+		{[]string{"01:00"}, nil, ""},
+		{[]string{"01:00-01:00"}, nil, ""},
+		{[]string{"00:00-24:00"}, nil, ""},
+		{[]string{"25:00-02:00"}, nil, ""},
+		{[]string{"01:5-02:00"}, nil, ""},
+		{[]string{"01:00-02:60"}, nil, ""},
+		{nil, []string{"2026-13-01"}, ""},
+		{nil, []string{"2026-12-26..2026-12-24"}, ""},
+		{nil, nil, "Mars/Olympus_Mons"},
+	}
+	for _, test := range tests {
+		if _, err := ParseSchedule(test.windows, test.blackouts, test.zone); err == nil {
+			t.Errorf("ParseSchedule(%q, %q, %q) was accepted", test.windows, test.blackouts, test.zone)
+		}
+	}
+	if schedule, err := ParseSchedule(nil, nil, ""); schedule != nil || err != nil {
+		t.Errorf("got %v, %v for an empty schedule, expected none", schedule, err)
+	}
+}
+
+func TestScheduleOpen(t *testing.T) {
+	schedule, location := testSchedule(t, []string{"01:00-05:00", "22:00-02:00"}, []string{"2026-12-24..2026-12-26"})
+	tests := []struct {
+		time time.Time
+		open bool
+	}{
+		{time.Date(2026, 10, 14, 1, 0, 0, 0, location), true},
+		{time.Date(2026, 10, 14, 4, 59, 0, 0, location), true},
+		{time.Date(2026, 10, 14, 5, 0, 0, 0, location), false},
+		{time.Date(2026, 10, 14, 12, 0, 0, 0, location), false},
+		{time.Date(2026, 10, 14, 23, 30, 0, 0, location), true},
+		{time.Date(2026, 10, 15, 0, 30, 0, 0, location), true},
+		{time.Date(2026, 12, 24, 3, 0, 0, 0, location), false},
+		{time.Date(2026, 12, 26, 23, 0, 0, 0, location), false},
+		{time.Date(2026, 12, 27, 0, 0, 0, 0, location), true},
+		// The same instant in UTC, which is still in the window in New York
+		{time.Date(2026, 10, 14, 6, 30, 0, 0, time.UTC), true},
+	}
+	for _, test := range tests {
+		if open := schedule.Open(test.time); open != test.open {
+			t.Errorf("Open(%s) = %t, expected %t", test.time, open, test.open)
+		}
+	}
+}
+
+func TestScheduleNextOpen(t *testing.T) {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone data: %s", err)
+	}
+	tests := []struct {
+		windows   []string
+		blackouts []string
+		from      time.Time
+		next      time.Time
+	}{
+		// Already open
+		{[]string{"01:00-05:00"}, nil, time.Date(2026, 10, 14, 2, 0, 0, 0, location), time.Date(2026, 10, 14, 2, 0, 0, 0, location)},
+		// Later the same day, and the next day
+		{[]string{"01:00-05:00"}, nil, time.Date(2026, 10, 14, 0, 30, 0, 0, location), time.Date(2026, 10, 14, 1, 0, 0, 0, location)},
+		{[]string{"01:00-05:00"}, nil, time.Date(2026, 10, 14, 6, 0, 0, 0, location), time.Date(2026, 10, 15, 1, 0, 0, 0, location)},
+		// Past midnight
+		{[]string{"22:00-02:00"}, nil, time.Date(2026, 10, 14, 3, 0, 0, 0, location), time.Date(2026, 10, 14, 22, 0, 0, 0, location)},
+		// Once a blackout is over
+		{nil, []string{"2026-12-24..2026-12-26"}, time.Date(2026, 12, 24, 10, 0, 0, 0, location), time.Date(2026, 12, 27, 0, 0, 0, 0, location)},
+		{[]string{"01:00-05:00"}, []string{"2026-12-24..2026-12-26"}, time.Date(2026, 12, 26, 3, 0, 0, 0, location), time.Date(2026, 12, 27, 1, 0, 0, 0, location)},
+		// The clocks go back an hour at 02:00 on 2026-11-01, so the day is
+		// 25 hours long, and 03:00 is four hours after midnight
+		{[]string{"03:00-05:00"}, nil, time.Date(2026, 11, 1, 0, 30, 0, 0, location), time.Date(2026, 11, 1, 3, 0, 0, 0, location)},
+		// The clocks go forward an hour at 02:00 on 2026-03-08, so 04:00 is
+		// three hours after midnight
+		{[]string{"04:00-05:00"}, nil, time.Date(2026, 3, 8, 0, 30, 0, 0, location), time.Date(2026, 3, 8, 4, 0, 0, 0, location)},
+		// A blackout that never ends within the horizon
+		{nil, []string{"2026-01-01..2099-12-31"}, time.Date(2026, 10, 14, 0, 0, 0, 0, location), time.Time{}},
+	}
+	for _, test := range tests {
+		schedule, err := ParseSchedule(test.windows, test.blackouts, "America/New_York")
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q, %q): %s", test.windows, test.blackouts, err)
+		}
+		if next := schedule.NextOpen(test.from); !next.Equal(test.next) {
+			t.Errorf("%q %q: NextOpen(%s) = %s, expected %s", test.windows, test.blackouts, test.from, next, test.next)
+		}
+	}
+}
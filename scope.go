@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The number of example URLs returned for each out-of-scope origin
+const outOfScopeExamples = 5
+
+// OutOfScope holds the URLs found that were not on the whitelist, grouped by
+// origin, so that they can be crawled if their origin is added to the
+// whitelist later on.
+type OutOfScope struct {
+	ByOrigin map[string]*outOfScopeOrigin
+	mutex    sync.Mutex
+}
+
+// The URLs found for a single out-of-scope origin
+type outOfScopeOrigin struct {
+	tasks   []Task
+	seen    map[string]bool
+	dropped int
+}
+
+// OutOfScopeOrigin summarises the URLs found for an out-of-scope origin.
+type OutOfScopeOrigin struct {
+	Origin   string   `json:"origin"`
+	URLs     int      `json:"urls"`
+	Dropped  int      `json:"dropped,omitempty"`
+	Examples []string `json:"examples"`
+}
+
+// Function origin returns the scheme and host of a URL, in lower case and
+// without a default port.
+func origin(urlValue *url.URL) string {
+	return strings.ToLower(urlValue.Scheme) + "://" + canonicalHost(urlValue)
+}
+
+// Method bufferOutOfScope keeps a task for a URL that is not on the
+// whitelist, up to the OutOfScopeBuffer option's number of URLs per origin.
+func (c *Crawler) bufferOutOfScope(task Task) {
+	if c.options.OutOfScopeBuffer <= 0 || (task.URL.Scheme != "http" && task.URL.Scheme != "https") {
+		return
+	}
+
+	c.outOfScope.mutex.Lock()
+	defer c.outOfScope.mutex.Unlock()
+
+	key := origin(task.URL)
+	buffered, exists := c.outOfScope.ByOrigin[key]
+	if !exists {
+		buffered = &outOfScopeOrigin{seen: make(map[string]bool)}
+		c.outOfScope.ByOrigin[key] = buffered
+	}
+
+	urlString := task.URL.String()
+	if buffered.seen[urlString] {
+		return
+	}
+	if len(buffered.tasks) >= c.options.OutOfScopeBuffer {
+		buffered.dropped++
+		return
+	}
+	buffered.seen[urlString] = true
+	buffered.tasks = append(buffered.tasks, task)
+}
+
+// Method OutOfScope summarises the out-of-scope URLs found so far, with the
+// origins with the most URLs first.
+func (c *Crawler) OutOfScope() []OutOfScopeOrigin {
+	c.outOfScope.mutex.Lock()
+	defer c.outOfScope.mutex.Unlock()
+
+	origins := make([]OutOfScopeOrigin, 0, len(c.outOfScope.ByOrigin))
+	for key, buffered := range c.outOfScope.ByOrigin {
+		summary := OutOfScopeOrigin{
+			Origin:   key,
+			URLs:     len(buffered.tasks),
+			Dropped:  buffered.dropped,
+			Examples: []string{},
+		}
+		for i := 0; i < len(buffered.tasks) && i < outOfScopeExamples; i++ {
+			summary.Examples = append(summary.Examples, buffered.tasks[i].URL.String())
+		}
+		origins = append(origins, summary)
+	}
+
+	sort.Slice(origins, func(i, j int) bool {
+		if origins[i].URLs != origins[j].URLs {
+			return origins[i].URLs > origins[j].URLs
+		}
+		return origins[i].Origin < origins[j].Origin
+	})
+	return origins
+}
+
+// Method ExpandWhitelist adds a target to the whitelist while the crawl is
+// running, and immediately queues up the out-of-scope URLs found for its
+// origin. It returns the number of URLs queued.
+func (c *Crawler) ExpandWhitelist(target *url.URL) (int, error) {
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return 0, errors.New("the target must be an http:// or https:// URL with a host")
+	}
+
+	// Hold off the dispatcher finishing until the URLs are queued
+	c.lifecycle.Lock()
+	defer c.lifecycle.Unlock()
+	if c.finished {
+		return 0, errors.New("the scan has already finished")
+	}
+
+	c.log.Infof("[%s] Added to the whitelist, as part of target %s", origin(target), c.scope.addOrigin(target).Name)
+
+	// Take the buffered URLs for the origin
+	c.outOfScope.mutex.Lock()
+	buffered := c.outOfScope.ByOrigin[origin(target)]
+	delete(c.outOfScope.ByOrigin, origin(target))
+	c.outOfScope.mutex.Unlock()
+	if c.options.ProbeAPI {
+		seed := &Seed{MaxDepth: -1}
+		if buffered != nil && len(buffered.tasks) > 0 {
+			seed = buffered.tasks[0].Seed
+		}
+		c.startAPIProbe(target, seed)
+	}
+	if buffered == nil {
+		return 0, nil
+	}
+
+	queued := 0
+	for _, task := range buffered.tasks {
+		if c.addTask(task) {
+			queued++
+		}
+	}
+	return queued, nil
+}
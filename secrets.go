@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// The kinds of values flagged in input fields
+const (
+	// A value matching the format of a known kind of credential
+	ValueSecret = "secret"
+	// A value in a field named like a password, key or secret
+	ValueSecretName = "secret-name"
+	// A CSRF token, or similar per-session nonce
+	ValueCSRFToken = "csrf-token"
+	// A server-side state blob, such as ASP.NET's __VIEWSTATE
+	ValueState = "state"
+	// A switch for debugging, testing or privileges, such as debug=true
+	ValueDebugFlag = "debug-flag"
+	// A random-looking value not covered by the other kinds
+	ValueHighEntropy = "high-entropy"
+)
+
+// ValueFlag marks the value of an input field as possibly interesting, such
+// as a token, API key or debug switch left in a hidden field.
+type ValueFlag struct {
+	Kind   string `json:"kind"`
+	Reason string `json:"reason"`
+	// Entropy is the Shannon entropy of the value, in bits per character
+	Entropy float64 `json:"entropy,omitempty"`
+}
+
+// The formats of well-known credentials, checked in the value of every input
+// field
+var secretPatterns = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"an AWS access key ID", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"a Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{"a GitHub token", regexp.MustCompile(`\bgh[pousr]_[0-9A-Za-z]{36,}\b`)},
+	{"a Slack token", regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z\-]{10,}\b`)},
+	{"a Stripe secret key", regexp.MustCompile(`\b[sr]k_live_[0-9A-Za-z]{16,}\b`)},
+	{"a JSON Web Token", regexp.MustCompile(`\beyJ[0-9A-Za-z_\-]+\.eyJ[0-9A-Za-z_\-]+\.[0-9A-Za-z_\-]*`)},
+	{"a private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+}
+
+// The names of hidden fields, checked case-insensitively
+var (
+	csrfName   = regexp.MustCompile(`(?i)(csrf|xsrf|authenticity_token|requestverificationtoken|nonce|^_?token$|form_key|formkey)`)
+	stateName  = regexp.MustCompile(`(?i)^__(viewstate|viewstategenerator|eventvalidation|eventtarget|eventargument)`)
+	secretName = regexp.MustCompile(`(?i)(passw(or)?d|passwd|secret|api[_\-]?key|access[_\-]?key|private[_\-]?key|client[_\-]?secret|credential|auth[_\-]?key)`)
+	debugName  = regexp.MustCompile(`(?i)(debug|test|trace|verbose|dev(elop(er|ment))?$|staging|is_?admin|admin|role|priv(ilege)?s?|bypass|internal|preview)`)
+)
+
+// The values that switch something on or off
+var debugValues = map[string]bool{
+	"true": true, "false": true, "1": true, "0": true, "yes": true, "no": true, "on": true, "off": true,
+	"y": true, "n": true, "enabled": true, "disabled": true, "admin": true, "user": true,
+}
+
+// The shortest value, and the lowest entropy in bits per character, counted
+// as random-looking; hex strings top out at 4 bits per character
+const (
+	entropyMinLength = 16
+	entropyThreshold = 3.5
+)
+
+// Function shannonEntropy returns the Shannon entropy of a string, in bits
+// per character.
+func shannonEntropy(value string) float64 {
+	if value == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	total := 0
+	for _, character := range value {
+		counts[character]++
+		total++
+	}
+	var entropy float64
+	for _, count := range counts {
+		probability := float64(count) / float64(total)
+		entropy -= probability * math.Log2(probability)
+	}
+	return entropy
+}
+
+// Function inspectValue flags the value of an input field if it looks like
+// a credential, or, for hidden fields, a token, debug switch or random
+// secret. Values that are expected in hidden fields, such as CSRF tokens and
+// view state, are labelled as such, so that they can be told apart from the
+// values that are not.
+func inspectValue(input Input) []ValueFlag {
+	value := strings.TrimSpace(input.Attr("value"))
+	if value == "" {
+		return nil
+	}
+	name := input.Attr("name")
+	if name == "" {
+		name = input.Attr("id")
+	}
+	entropy := math.Round(shannonEntropy(value)*100) / 100
+
+	var flags []ValueFlag
+	for _, secret := range secretPatterns {
+		if secret.pattern.MatchString(value) {
+			flags = append(flags, ValueFlag{Kind: ValueSecret, Reason: "looks like " + secret.name, Entropy: entropy})
+		}
+	}
+
+	// The rest of the checks are only for hidden fields, whose values are
+	// set by the server rather than the user
+	if !strings.EqualFold(input.Attr("type"), "hidden") {
+		return flags
+	}
+
+	switch {
+	case stateName.MatchString(name):
+		flags = append(flags, ValueFlag{Kind: ValueState, Reason: "server-side state in " + name})
+	case csrfName.MatchString(name):
+		flags = append(flags, ValueFlag{Kind: ValueCSRFToken, Reason: "anti-CSRF token in " + name, Entropy: entropy})
+	case secretName.MatchString(name):
+		flags = append(flags, ValueFlag{Kind: ValueSecretName, Reason: "hidden field named " + name, Entropy: entropy})
+	case debugName.MatchString(name) && debugValues[strings.ToLower(value)]:
+		flags = append(flags, ValueFlag{Kind: ValueDebugFlag, Reason: fmt.Sprintf("%s=%s may switch on debugging or extra privileges", name, value)})
+	case len(flags) == 0 && len(value) >= entropyMinLength && entropy >= entropyThreshold:
+		flags = append(flags, ValueFlag{Kind: ValueHighEntropy, Reason: "random-looking value", Entropy: entropy})
+	}
+	return flags
+}
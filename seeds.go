@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Seed is a starting URL, along with the options that apply to it and to
+// every page found from it.
+type Seed struct {
+	URL *url.URL `json:"-"`
+	// Tags are added to the results of every page found from the seed
+	Tags []string `json:"tags,omitempty"`
+	// MaxDepth is the number of links to follow away from the seed; -1 = no limit
+	MaxDepth int `json:"max_depth"`
+	// Auth is the name of the auth profile used to request pages found from the seed
+	Auth string `json:"auth,omitempty"`
+	// Method, Body and ContentType, if set, are how the seed's own URL is
+	// requested, for entry points that are not reached with a GET, such as a
+	// POST that returns a dashboard. The pages found from it are requested
+	// with GET as usual
+	Method      string `json:"method,omitempty"`
+	Body        string `json:"body,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// The content type sent with a seed's body when none is given
+const defaultSeedContentType = "application/x-www-form-urlencoded"
+
+// Method isSeedRequest checks whether a task is for its seed's own URL,
+// which is requested with the seed's method and body, if it has them.
+func (t Task) isSeedRequest() bool {
+	return t.Depth == 0 && t.FragmentOf == "" && t.Seed != nil && t.Seed.Method != "" &&
+		t.Seed.URL != nil && t.URL.String() == t.Seed.URL.String()
+}
+
+// The values of the AuthState option
+const (
+	AuthStateAuthenticated   = "authenticated"
+	AuthStateUnauthenticated = "unauthenticated"
+)
+
+// Function matchesAuthState checks whether a page result is kept by the
+// AuthState option: every page is kept if it is "".
+func matchesAuthState(result PageResult, state string) bool {
+	switch state {
+	case AuthStateAuthenticated:
+		return result.Authenticated
+	case AuthStateUnauthenticated:
+		return !result.Authenticated
+	}
+	return true
+}
+
+// AuthProfile is a named set of headers (such as Cookie or Authorization)
+// sent with every request for the pages found from the seeds that use it.
+type AuthProfile struct {
+	Headers http.Header `json:"headers"`
+}
+
+// Function newSeed creates a seed for a URL, with no limit on the depth.
+func newSeed(seedURL *url.URL) Seed {
+	return Seed{URL: seedURL, MaxDepth: -1}
+}
+
+// LineError is a problem with a single line of a URL file.
+type LineError struct {
+	Line int
+	Text string
+	Err  error
+}
+
+// Method Error describes the problem, including the line number.
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s: %q", e.Line, e.Err.Error(), e.Text)
+}
+
+// Function loadSeedFile reads the seeds in the file at the given path.
+// Each line holds a URL, optionally followed by space-separated directives
+// for that URL:
+//
+//	# Comments start with a hash; blank lines are ignored
+//	https://www.example.com/              tag=prod tag=public
+//	https://admin.example.com/  depth=2  auth=admin  # Trailing comments work too
+//	https://app.example.com/dashboard  method=POST  body=view=all&page=1
+//
+// Invalid lines are collected and returned alongside the valid seeds, so that
+// one typo does not stop the rest from being searched. If strict is true,
+// reading stops at the first invalid line instead.
+// The error is only set if the file itself cannot be read.
+func loadSeedFile(path string, strict bool) (seeds []Seed, invalid []*LineError, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	// Iterate through the lines of the file
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+
+		seed, ok, err := parseSeedLine(text)
+		if err != nil {
+			invalid = append(invalid, &LineError{Line: line, Text: text, Err: err})
+			if strict {
+				break
+			}
+			continue
+		}
+		if ok {
+			seeds = append(seeds, seed)
+		}
+	}
+
+	return seeds, invalid, scanner.Err()
+}
+
+// Function parseSeedLine parses a single line of a seed file. It returns false
+// if the line is blank or only holds a comment.
+func parseSeedLine(text string) (seed Seed, ok bool, err error) {
+	// Remove comments; a hash only starts a comment at the start of the line or
+	// after whitespace, so that URL fragments are left alone
+	fields := strings.Fields(text)
+	for i, field := range fields {
+		if strings.HasPrefix(field, "#") {
+			fields = fields[:i]
+			break
+		}
+	}
+	if len(fields) == 0 {
+		return seed, false, nil
+	}
+
+	seedURL, err := parseFileURL(fields[0])
+	if err != nil {
+		return seed, false, err
+	}
+	seed = newSeed(seedURL)
+
+	// Apply the directives
+	for _, directive := range fields[1:] {
+		parts := strings.SplitN(directive, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return seed, false, fmt.Errorf("invalid directive %q; expected key=value", directive)
+		}
+
+		switch strings.ToLower(parts[0]) {
+		case "tag", "tags":
+			for _, tag := range strings.Split(parts[1], ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					seed.Tags = append(seed.Tags, tag)
+				}
+			}
+		case "depth":
+			depth, err := strconv.Atoi(parts[1])
+			if err != nil || depth < 0 {
+				return seed, false, fmt.Errorf("invalid depth %q; expected a number of 0 or more", parts[1])
+			}
+			seed.MaxDepth = depth
+		case "auth":
+			seed.Auth = parts[1]
+		case "method":
+			method := strings.ToUpper(parts[1])
+			if strings.IndexFunc(method, func(r rune) bool { return r < 'A' || r > 'Z' }) >= 0 {
+				return seed, false, fmt.Errorf("invalid method %q", parts[1])
+			}
+			seed.Method = method
+		case "body":
+			seed.Body = parts[1]
+		case "content-type":
+			seed.ContentType = parts[1]
+		default:
+			return seed, false, fmt.Errorf("unknown directive %q", parts[0])
+		}
+	}
+
+	if (seed.Body != "" || seed.ContentType != "") && seed.Method == "" {
+		seed.Method = http.MethodPost
+	}
+	if seed.Body != "" && seed.ContentType == "" {
+		seed.ContentType = defaultSeedContentType
+	}
+	return seed, true, nil
+}
+
+// Function parseFileURL parses a URL from a URL file. Unlike URLs passed on the
+// command line, these are checked for a supported scheme and a host, as a
+// line missing them is almost always a mistake. URLs without any scheme are
+// allowed, and probed for when the crawl starts.
+func parseFileURL(text string) (*url.URL, error) {
+	seed, err := parseSeedURL(text)
+	if err != nil {
+		return nil, errors.New("invalid URL")
+	}
+	if seed.Scheme != "" && seed.Scheme != "http" && seed.Scheme != "https" {
+		return nil, errors.New("URL must start with http://, https://, or have no scheme")
+	}
+	if seed.Host == "" {
+		return nil, errors.New("URL is missing a host")
+	}
+	return seed, nil
+}
+
+// Function checkSeeds makes sure every auth profile used by the seeds exists.
+func checkSeeds(seeds []Seed, options Options) error {
+	for _, seed := range seeds {
+		if seed.Auth == "" {
+			continue
+		}
+		if _, exists := options.AuthProfiles[seed.Auth]; !exists {
+			return fmt.Errorf("unknown auth profile %q for %s", seed.Auth, seed.URL.String())
+		}
+	}
+	return nil
+}
+
+// Function parseAuthProfileFlag parses an auth profile header given on the
+// command line, in the form "name=Header: value".
+func parseAuthProfileFlag(value string) (name string, key string, headerValue string, err error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", "", fmt.Errorf("invalid auth profile %q; expected name=Header: value", value)
+	}
+	header := strings.SplitN(parts[1], ":", 2)
+	if len(header) != 2 || strings.TrimSpace(header[0]) == "" {
+		return "", "", "", fmt.Errorf("invalid auth profile %q; expected name=Header: value", value)
+	}
+	return parts[0], strings.TrimSpace(header[0]), strings.TrimSpace(header[1]), nil
+}
+
+// StringList is a flag that can be repeated, collecting each value given.
+type StringList []string
+
+// Method String returns the values, comma-separated.
+func (l *StringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Method Set adds a value.
+func (l *StringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
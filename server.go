@@ -0,0 +1,677 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job states
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	// A running job that is waiting for its crawl window to open
+	JobPaused    = "paused"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	// A job cancelled with `DELETE /scans/{id}`
+	JobCancelled = "cancelled"
+)
+
+// The most bytes of a request body accepted by the API, such as a scan or a
+// page pushed to `POST /scans/{id}/ingest`
+const maxRequestSize = 10 * 1024 * 1024
+
+// ScanRequest is the body accepted by `POST /scans`.
+type ScanRequest struct {
+	Seeds   []string `json:"seeds"`
+	Options *Options `json:"options,omitempty"`
+}
+
+// Job is a single crawl submitted to the server.
+type Job struct {
+	ID       string
+	Seeds    []string
+	Options  Options
+	Status   string
+	Error    string
+	Created  time.Time
+	Started  time.Time
+	Finished time.Time
+
+	crawler *Crawler
+	mutex   sync.RWMutex
+}
+
+// JobStatus is the JSON representation of a job's current state.
+type JobStatus struct {
+	ID           string            `json:"id"`
+	Status       string            `json:"status"`
+	Error        string            `json:"error,omitempty"`
+	Seeds        []string          `json:"seeds"`
+	Options      Options           `json:"options"`
+	Created      time.Time         `json:"created"`
+	Started      *time.Time        `json:"started,omitempty"`
+	Finished     *time.Time        `json:"finished,omitempty"`
+	PausedUntil  *time.Time        `json:"paused_until,omitempty"`
+	PagesVisited int               `json:"pages_visited"`
+	PagesFound   int               `json:"pages_with_inputs"`
+	Stats        *StatsSnapshot    `json:"stats,omitempty"`
+	DeadSeeds    []DeadSeed        `json:"dead_seeds,omitempty"`
+	Quarantined  []QuarantinedPage `json:"quarantined,omitempty"`
+	FailingHosts []FailingHost     `json:"failing_hosts,omitempty"`
+	Termination  *Termination      `json:"termination,omitempty"`
+}
+
+// Method redacted returns a copy of the options with their credentials
+// replaced, for the status of a scan, which any client of the API can read.
+func (o Options) redacted() Options {
+	if o.Signing != nil {
+		signing := make(map[string]SigningConfig, len(o.Signing))
+		for host, config := range o.Signing {
+			signing[host] = config.redacted()
+		}
+		o.Signing = signing
+	}
+	o.Headers = redactHeaders(o.Headers)
+	if o.AuthProfiles != nil {
+		profiles := make(map[string]AuthProfile, len(o.AuthProfiles))
+		for name, profile := range o.AuthProfiles {
+			profile.Headers = redactHeaders(profile.Headers)
+			profiles[name] = profile
+		}
+		o.AuthProfiles = profiles
+	}
+	return o
+}
+
+// Method status returns a snapshot of the job's current state. The scan's
+// options are shown with their credentials redacted.
+func (j *Job) status() JobStatus {
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+
+	status := JobStatus{
+		ID:      j.ID,
+		Status:  j.Status,
+		Error:   j.Error,
+		Seeds:   j.Seeds,
+		Options: j.Options.redacted(),
+		Created: j.Created,
+	}
+	if !j.Started.IsZero() {
+		started := j.Started
+		status.Started = &started
+	}
+	if !j.Finished.IsZero() {
+		finished := j.Finished
+		status.Finished = &finished
+	}
+	if j.crawler != nil {
+		status.PagesVisited = j.crawler.PagesVisited()
+		status.PagesFound = len(j.crawler.Results())
+		if !j.Started.IsZero() {
+			stats := j.crawler.Stats()
+			status.Stats = &stats
+		}
+		if j.Status == JobCompleted {
+			status.DeadSeeds = j.crawler.DeadSeeds()
+		}
+		if until := j.crawler.PausedUntil(); j.Status == JobRunning && !until.IsZero() {
+			status.Status, status.PausedUntil = JobPaused, &until
+		}
+		status.Quarantined = j.crawler.Quarantined()
+		status.FailingHosts = j.crawler.FailingHosts()
+		if termination := j.crawler.Termination(); termination.Finished != nil {
+			status.Termination = &termination
+		}
+	}
+	return status
+}
+
+// Server exposes an HTTP API for submitting and monitoring crawls.
+type Server struct {
+	// Token is what clients must send, as "Authorization: Bearer <token>",
+	// for every request; "" lets any client in, which is only safe on a
+	// loopback address (see isLoopbackAddress)
+	Token string
+	// MaxFinished is the most finished scans kept; once there are more, the
+	// ones that finished first are forgotten. 0 keeps them all
+	MaxFinished int
+
+	// Limits the number of crawls running at the same time
+	running chan struct{}
+
+	jobs struct {
+		ByID  map[string]*Job
+		mutex sync.RWMutex
+	}
+	// The history every scan records to, if any
+	history *History
+}
+
+// Function NewServer creates a server that runs at most maxScans crawls at a time.
+func NewServer(maxScans int) *Server {
+	if maxScans < 1 {
+		maxScans = 1
+	}
+	server := &Server{
+		running: make(chan struct{}, maxScans),
+	}
+	server.jobs.ByID = make(map[string]*Job)
+	return server
+}
+
+// Method UseHistory records what every scan finds in a history, shared by
+// all of them, and saved as each scan finishes.
+func (s *Server) UseHistory(history *History) {
+	s.history = history
+}
+
+// Method ServeHTTP routes API requests to the appropriate handler, once the
+// client has sent the server's token, if it has one.
+//
+//	POST   /scans                   submit a new crawl
+//	GET    /scans                   list all crawls
+//	GET    /scans/{id}              get the status of a crawl
+//	DELETE /scans/{id}              cancel a crawl, stopping it at once, and forget it
+//	GET  /scans/{id}/results      get the pages with input fields found by a crawl;
+//	                              ?auth=authenticated|unauthenticated filters them;
+//	                              ?first_seen_since=30d only returns the new input fields
+//	                              ?sort=risk lists the riskiest pages first
+//	GET  /scans/{id}/risk         get the risk scores of the pages and hosts, riskiest first;
+//	                              ?top=10 only returns the riskiest ten of each
+//	GET  /scans/{id}/conflicts    get the input fields declared differently on different pages
+//	GET  /scans/{id}/api-surface  get the API endpoints found
+//	GET  /scans/{id}/manifest     get how each page was requested, as JSON lines
+//	GET  /scans/{id}/templates    get the form templates whose pages were only counted
+//	GET  /scans/{id}/out-of-scope list the origins found that are not whitelisted
+//	POST /scans/{id}/whitelist    add an origin to the whitelist of a running crawl
+//	POST /scans/{id}/ingest       add the input fields of a page seen while browsing by hand
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Token != "" {
+		expected := []byte("Bearer " + s.Token)
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="input-field-finder"`)
+			writeError(w, http.StatusUnauthorized, "a valid API token is required")
+			return
+		}
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+
+	if parts[0] != "scans" || len(parts) > 3 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		s.handleCreate(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		s.handleList(w, r)
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		if job := s.job(w, parts[1]); job != nil {
+			writeJSON(w, http.StatusOK, job.status())
+		}
+	case len(parts) == 2 && r.Method == http.MethodDelete:
+		if job := s.job(w, parts[1]); job != nil {
+			s.handleDelete(w, job)
+		}
+	case len(parts) == 3 && parts[2] == "results" && r.Method == http.MethodGet:
+		if job := s.job(w, parts[1]); job != nil {
+			s.handleResults(w, r, job)
+		}
+	case len(parts) == 3 && parts[2] == "risk" && r.Method == http.MethodGet:
+		if job := s.job(w, parts[1]); job != nil {
+			top := 0
+			if value := r.URL.Query().Get("top"); value != "" {
+				var err error
+				if top, err = strconv.Atoi(value); err != nil || top < 0 {
+					writeError(w, http.StatusBadRequest, "top must be a number of pages")
+					return
+				}
+			}
+			writeJSON(w, http.StatusOK, rollUpRisk(job.crawler.Results()).Top(top))
+		}
+	case len(parts) == 3 && parts[2] == "conflicts" && r.Method == http.MethodGet:
+		if job := s.job(w, parts[1]); job != nil {
+			conflicts := findConflicts(job.crawler.Results())
+			if conflicts == nil {
+				conflicts = []Conflict{}
+			}
+			writeJSON(w, http.StatusOK, conflicts)
+		}
+	case len(parts) == 3 && parts[2] == "api-surface" && r.Method == http.MethodGet:
+		if job := s.job(w, parts[1]); job != nil {
+			writeJSON(w, http.StatusOK, APISurfaceReport{Endpoints: job.crawler.APISurface()})
+		}
+	case len(parts) == 3 && parts[2] == "templates" && r.Method == http.MethodGet:
+		if job := s.job(w, parts[1]); job != nil {
+			writeJSON(w, http.StatusOK, job.crawler.TemplateSamples())
+		}
+	case len(parts) == 3 && parts[2] == "manifest" && r.Method == http.MethodGet:
+		if job := s.job(w, parts[1]); job != nil {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			if err := job.crawler.ExportManifest(w); err != nil {
+				job.crawler.log.Errorf("Unable to write the manifest: %s", err.Error())
+			}
+		}
+	case len(parts) == 3 && parts[2] == "out-of-scope" && r.Method == http.MethodGet:
+		if job := s.job(w, parts[1]); job != nil {
+			writeJSON(w, http.StatusOK, job.crawler.OutOfScope())
+		}
+	case len(parts) == 3 && parts[2] == "whitelist" && r.Method == http.MethodPost:
+		if job := s.job(w, parts[1]); job != nil {
+			s.handleWhitelist(w, r, job)
+		}
+	case len(parts) == 3 && parts[2] == "ingest" && r.Method == http.MethodPost:
+		if job := s.job(w, parts[1]); job != nil {
+			s.handleIngest(w, r, job)
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// Method job looks up a job by ID, writing a 404 response if it does not exist.
+func (s *Server) job(w http.ResponseWriter, id string) *Job {
+	s.jobs.mutex.RLock()
+	job, exists := s.jobs.ByID[id]
+	s.jobs.mutex.RUnlock()
+
+	if !exists {
+		writeError(w, http.StatusNotFound, "scan not found")
+		return nil
+	}
+	return job
+}
+
+// Method handleCreate validates a scan request and starts the crawl.
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	// Options left out of the request keep their default values
+	options := DefaultOptions()
+	request := ScanRequest{Options: &options}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+	if len(request.Seeds) == 0 {
+		writeError(w, http.StatusBadRequest, "at least one seed URL is required")
+		return
+	}
+
+	if request.Options != nil {
+		options = *request.Options
+	}
+
+	if err := options.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Validate the seeds before accepting the job; seeds can have the same
+	// directives as the lines of a URL file
+	var seeds []Seed
+	for _, line := range request.Seeds {
+		seed, ok, err := parseSeedLine(line)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid seed %q: %s", line, err.Error()))
+			return
+		}
+		if ok {
+			seeds = append(seeds, seed)
+		}
+	}
+	if len(seeds) == 0 {
+		writeError(w, http.StatusBadRequest, "at least one seed URL is required")
+		return
+	}
+	if err := checkSeeds(seeds, options); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job := &Job{
+		ID:      newJobID(),
+		Seeds:   request.Seeds,
+		Options: options,
+		Status:  JobQueued,
+		Created: time.Now(),
+		crawler: NewCrawler(seeds, options),
+	}
+	job.crawler.log = logger.WithPrefix("scan " + job.ID)
+	if s.history != nil {
+		job.crawler.UseHistory(s.history)
+	}
+
+	s.jobs.mutex.Lock()
+	s.jobs.ByID[job.ID] = job
+	s.jobs.mutex.Unlock()
+
+	go s.run(job)
+
+	writeJSON(w, http.StatusCreated, job.status())
+}
+
+// Method Crawlers returns the crawler of every job, keyed by job ID, for metrics.
+func (s *Server) Crawlers() map[string]*Crawler {
+	s.jobs.mutex.RLock()
+	defer s.jobs.mutex.RUnlock()
+
+	crawlers := make(map[string]*Crawler, len(s.jobs.ByID))
+	for id, job := range s.jobs.ByID {
+		crawlers[id] = job.crawler
+	}
+	return crawlers
+}
+
+// Method handleList returns the status of every job, oldest first.
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	s.jobs.mutex.RLock()
+	statuses := make([]JobStatus, 0, len(s.jobs.ByID))
+	for _, job := range s.jobs.ByID {
+		statuses = append(statuses, job.status())
+	}
+	s.jobs.mutex.RUnlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Created.Before(statuses[j].Created)
+	})
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// Method handleResults returns the pages with input fields found by a job.
+// Results are available while the job is still running. The auth query
+// parameter only returns the pages requested with, or without, a session,
+// and first_seen_since only the input fields first seen since then (see
+// parseSince), for servers that record to a history.
+func (s *Server) handleResults(w http.ResponseWriter, r *http.Request, job *Job) {
+	state := r.URL.Query().Get("auth")
+	if state != "" && state != AuthStateAuthenticated && state != AuthStateUnauthenticated {
+		writeError(w, http.StatusBadRequest, "auth must be "+AuthStateAuthenticated+" or "+AuthStateUnauthenticated)
+		return
+	}
+	results := []PageResult{}
+	for _, result := range job.crawler.Results() {
+		if matchesAuthState(result, state) {
+			results = append(results, result)
+		}
+	}
+	if value := r.URL.Query().Get("first_seen_since"); value != "" {
+		since, err := parseSince(value, time.Now())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		results = firstSeenSince(results, since)
+	}
+	switch r.URL.Query().Get("sort") {
+	case "":
+	case OrderURL:
+		sortResults(results)
+	case OrderRisk:
+		sortByRisk(results)
+	default:
+		writeError(w, http.StatusBadRequest, "sort must be "+OrderURL+" or "+OrderRisk)
+		return
+	}
+
+	status := job.status()
+	writeJSON(w, http.StatusOK, struct {
+		ID      string       `json:"id"`
+		Status  string       `json:"status"`
+		Results []PageResult `json:"results"`
+	}{
+		ID:      status.ID,
+		Status:  status.Status,
+		Results: results,
+	})
+}
+
+// WhitelistRequest is the body accepted by `POST /scans/{id}/whitelist`.
+// Without confirm set, nothing is changed, and the response previews the
+// URLs that would be queued.
+type WhitelistRequest struct {
+	Target  string `json:"target"`
+	Confirm bool   `json:"confirm"`
+}
+
+// Method handleWhitelist adds an origin to the whitelist of a running job,
+// queueing up the URLs already found for it.
+func (s *Server) handleWhitelist(w http.ResponseWriter, r *http.Request, job *Job) {
+	var request WhitelistRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+	target, err := url.Parse(request.Target)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		writeError(w, http.StatusBadRequest, "the target must be an http:// or https:// URL with a host")
+		return
+	}
+	target = &url.URL{Scheme: strings.ToLower(target.Scheme), Host: strings.ToLower(target.Host)}
+
+	if status := job.status().Status; status != JobQueued && status != JobRunning && status != JobPaused {
+		writeError(w, http.StatusConflict, "the scan is not running")
+		return
+	}
+
+	// Preview the change until it is confirmed
+	if !request.Confirm {
+		pending := OutOfScopeOrigin{Origin: origin(target), Examples: []string{}}
+		for _, found := range job.crawler.OutOfScope() {
+			if found.Origin == pending.Origin {
+				pending = found
+			}
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Target    string           `json:"target"`
+			Confirmed bool             `json:"confirmed"`
+			Pending   OutOfScopeOrigin `json:"pending"`
+		}{
+			Target:  origin(target),
+			Pending: pending,
+		})
+		return
+	}
+
+	queued, err := job.crawler.ExpandWhitelist(target)
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Target    string `json:"target"`
+		Confirmed bool   `json:"confirmed"`
+		Queued    int    `json:"queued"`
+	}{
+		Target:    origin(target),
+		Confirmed: true,
+		Queued:    queued,
+	})
+}
+
+// Method handleIngest merges the input fields of a page seen while browsing
+// by hand, as pushed by the browser extension, into a job's results. The job
+// must have started, so that its whitelist is known; it can have finished.
+func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request, job *Job) {
+	var page IngestedPage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&page); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+	if status := job.status().Status; status == JobQueued {
+		writeError(w, http.StatusConflict, "the scan has not started yet")
+		return
+	}
+
+	// The page is returned with only the input fields that were new
+	result, err := job.crawler.Ingest(page)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Method handleDelete cancels a job: its crawl is stopped at once, with its
+// outputs flushed, and it is forgotten straight away. The response is the
+// job's status as it was cancelled.
+func (s *Server) handleDelete(w http.ResponseWriter, job *Job) {
+	job.mutex.Lock()
+	if job.Status == JobQueued || job.Status == JobRunning {
+		job.Status = JobCancelled
+		if job.Finished.IsZero() {
+			job.Finished = time.Now()
+		}
+	}
+	job.mutex.Unlock()
+	if job.crawler != nil {
+		job.crawler.Cancel()
+		job.crawler.log.Infof("Cancelled")
+	}
+
+	s.jobs.mutex.Lock()
+	delete(s.jobs.ByID, job.ID)
+	s.jobs.mutex.Unlock()
+
+	writeJSON(w, http.StatusOK, job.status())
+}
+
+// Method prune forgets the jobs that finished first, once there are more
+// than MaxFinished finished jobs.
+func (s *Server) prune() {
+	if s.MaxFinished <= 0 {
+		return
+	}
+
+	s.jobs.mutex.Lock()
+	defer s.jobs.mutex.Unlock()
+
+	var finished []*Job
+	for _, job := range s.jobs.ByID {
+		job.mutex.RLock()
+		done := !job.Finished.IsZero()
+		job.mutex.RUnlock()
+		if done {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= s.MaxFinished {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].Finished.Before(finished[j].Finished)
+	})
+	for _, job := range finished[:len(finished)-s.MaxFinished] {
+		delete(s.jobs.ByID, job.ID)
+	}
+}
+
+// Method run waits for a free slot and then runs the job's crawl to completion.
+func (s *Server) run(job *Job) {
+	s.running <- struct{}{}
+	defer func() {
+		<-s.running
+	}()
+	defer s.prune()
+
+	// The job may have been cancelled while it was queued
+	job.mutex.Lock()
+	if job.Status == JobCancelled {
+		job.mutex.Unlock()
+		return
+	}
+	job.Status = JobRunning
+	job.Started = time.Now()
+	job.mutex.Unlock()
+
+	job.crawler.log.Infof("Started")
+
+	// A panic in one crawl should not bring down the whole server
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			job.mutex.Lock()
+			job.Status = JobFailed
+			job.Error = fmt.Sprint(recovered)
+			job.Finished = time.Now()
+			job.mutex.Unlock()
+			job.crawler.log.Errorf("%v", recovered)
+		}
+	}()
+
+	job.crawler.Run()
+
+	termination := job.crawler.Termination()
+	job.mutex.Lock()
+	switch {
+	case termination.Reason == StopFatalError:
+		job.Status, job.Error = JobFailed, termination.Error
+	case job.Status != JobCancelled:
+		job.Status = JobCompleted
+	}
+	if job.Status != JobCancelled {
+		job.Finished = time.Now()
+	}
+	job.mutex.Unlock()
+
+	job.crawler.log.Infof("Finished: %s", termination.Reason)
+}
+
+// Function isLoopbackAddress checks whether the address the API listens on,
+// such as "127.0.0.1:8080", can only be reached from the same machine. An
+// address without a host, such as ":8080", listens on every interface.
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Function newJobID returns a random identifier for a job.
+func newJobID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		// Fall back to a time-based identifier
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
+
+// Function writeJSON writes the given value as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		logger.Errorf("Unable to write response: %s", err.Error())
+	}
+}
+
+// Function writeError writes a JSON error response.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{Error: message})
+}
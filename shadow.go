@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// The outcomes of requesting a page found with a session again without one
+const (
+	// Every input field on the page is served without a session
+	ShadowExposed = "exposed"
+	// Some of the page's input fields are served without a session
+	ShadowPartial = "partial"
+	// None of the page's input fields are served without a session
+	ShadowProtected = "protected"
+	// The page could not be requested or searched
+	ShadowError = "error"
+)
+
+// ShadowResult is what became of a page found with a session when it was
+// requested again without one, and which of its input fields were still
+// served.
+type ShadowResult struct {
+	URL         string `json:"url"`
+	AuthProfile string `json:"auth_profile,omitempty"`
+	Outcome     string `json:"outcome"`
+	// StatusCode is the status of the response without a session, after
+	// any redirects
+	StatusCode int `json:"status_code,omitempty"`
+	// RedirectedTo is where the page redirected to without a session, such
+	// as a login page, if it did
+	RedirectedTo string `json:"redirected_to,omitempty"`
+	// Exposed are the input fields served without a session, and Protected
+	// the ones that were not
+	Exposed   []Input `json:"exposed,omitempty"`
+	Protected []Input `json:"protected,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Function shadowKey identifies an input field across two fetches of a page,
+// ignoring its value, which can change between requests (e.g. a CSRF token).
+func shadowKey(input Input) string {
+	name := input.Attr("name")
+	if name == "" {
+		name = input.Attr("id")
+	}
+	if name == "" {
+		return input.HTML
+	}
+	return strings.Join([]string{input.Method, input.Action, name, strings.ToLower(input.Attr("type"))}, " ")
+}
+
+// Method ShadowCrawl requests every page found with a session (see
+// isAuthenticated) again without one, through a clean client (see
+// shadowClient) with no auth profile and none of the headers that carry
+// credentials, and reports which of their input fields are still served. This maps the functionality exposed without logging in. Pages found
+// without a session, and API parameters, are left out. It is run once the
+// crawl has finished.
+func (c *Crawler) ShadowCrawl() []ShadowResult {
+	var pages []PageResult
+	for _, page := range c.Results() {
+		if !page.Authenticated {
+			continue
+		}
+		for _, input := range page.Inputs {
+			if input.Source == "" {
+				pages = append(pages, page)
+				break
+			}
+		}
+	}
+
+	client := c.shadowClient()
+	shadows := make([]ShadowResult, len(pages))
+	workers := make(chan struct{}, concurrencyLimit(c.options.Concurrency))
+	var wg sync.WaitGroup
+	for i := range pages {
+		// Pick the user agent here, so that the random number generator is
+		// only used from one goroutine
+		userAgent, language := c.options.UserAgent, c.options.AcceptLanguage
+		if c.options.RandomAgent {
+			var randomLanguage string
+			userAgent, randomLanguage = randomAgent(c.random)
+			if language == "" {
+				language = randomLanguage
+			}
+		}
+
+		workers <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			shadows[i] = c.shadowFetch(client, pages[i], userAgent, language)
+		}(i)
+	}
+	wg.Wait()
+
+	sort.Slice(shadows, func(i, j int) bool {
+		if shadows[i].URL != shadows[j].URL {
+			return shadows[i].URL < shadows[j].URL
+		}
+		return shadows[i].AuthProfile < shadows[j].AuthProfile
+	})
+	return shadows
+}
+
+// Method shadowClient returns the client the shadow crawl requests pages
+// with. It sends them straight through the network transport, below the
+// signing and the cache, so that they carry no signature and are never
+// answered with a response fetched with a session, and it has no cookie jar.
+// The crawl has finished by the time it is used, so it keeps to the crawl's
+// windows and rate limit on its own.
+func (c *Crawler) shadowClient() *http.Client {
+	var roundTripper http.RoundTripper = hostCounter{crawler: c, next: networkTransport{crawler: c}}
+	if c.options.RateLimit > 0 {
+		roundTripper = NewRateLimiter(c.options.RateLimit, roundTripper)
+	}
+	if c.schedule != nil {
+		roundTripper = ScheduleGate{Next: roundTripper, Schedule: c.schedule}
+	}
+	return &http.Client{
+		Transport:     roundTripper,
+		CheckRedirect: c.checkRedirect,
+	}
+}
+
+// Method shadowFetch requests a single page without a session, and compares
+// the input fields served with those found with a session.
+func (c *Crawler) shadowFetch(client *http.Client, page PageResult, userAgent string, language string) ShadowResult {
+	shadow := ShadowResult{URL: page.URL, AuthProfile: page.AuthProfile}
+
+	var inputs []Input
+	for _, input := range page.Inputs {
+		if input.Source == "" {
+			inputs = append(inputs, input)
+		}
+	}
+	fail := func(err error) ShadowResult {
+		atomic.AddInt64(&c.stats.errors, 1)
+		c.log.Warnf("[shadow] [%s] %s", page.URL, err.Error())
+		shadow.Outcome = ShadowError
+		shadow.Error = err.Error()
+		return shadow
+	}
+
+	pageURL, err := url.Parse(page.URL)
+	if err != nil {
+		return fail(err)
+	}
+	request, err := http.NewRequest(http.MethodGet, page.URL, nil)
+	if err != nil {
+		return fail(err)
+	}
+	c.applyRequestContext(request, Task{
+		URL:            pageURL,
+		Seed:           &Seed{URL: pageURL},
+		FragmentOf:     page.FragmentOf,
+		UserAgent:      userAgent,
+		AcceptLanguage: language,
+	})
+	for header := range request.Header {
+		if credentialHeader.MatchString(header) {
+			request.Header.Del(header)
+		}
+	}
+
+	atomic.AddInt64(&c.stats.requests, 1)
+	response, err := client.Do(request)
+	if err != nil {
+		return fail(err)
+	}
+	defer response.Body.Close()
+	shadow.StatusCode = response.StatusCode
+	if finalURL := response.Request.URL; finalURL.String() != page.URL {
+		shadow.RedirectedTo = finalURL.String()
+	}
+
+	// A page that is no longer HTML, such as a JSON error, serves no input fields
+	var served []Input
+	if body, err := c.htmlBody(response); err == nil {
+		ctx, cancel := c.extractionContext()
+		defer cancel()
+
+		var source bytes.Buffer
+		var document *html.Node
+		if panicErr := isolate(func() {
+			document, err = html.Parse(contextReader{ctx: ctx, reader: io.TeeReader(body, &source)})
+			if err == nil {
+				served = c.getInputs(ctx, document, source.Bytes(), response.Request.URL)
+			}
+		}); panicErr != nil {
+			return fail(panicErr)
+		}
+		if ctx.Err() != nil {
+			return fail(fmt.Errorf("timed out after %s", time.Duration(c.options.ExtractionTimeout)))
+		}
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	servedKeys := make(map[string]bool)
+	for _, input := range served {
+		servedKeys[shadowKey(input)] = true
+	}
+	for _, input := range inputs {
+		if servedKeys[shadowKey(input)] {
+			shadow.Exposed = append(shadow.Exposed, input)
+		} else {
+			shadow.Protected = append(shadow.Protected, input)
+		}
+	}
+	switch {
+	case len(shadow.Protected) == 0:
+		shadow.Outcome = ShadowExposed
+	case len(shadow.Exposed) == 0:
+		shadow.Outcome = ShadowProtected
+	default:
+		shadow.Outcome = ShadowPartial
+	}
+	c.log.Debugf("[shadow] [%s] %s without a session: %d of %d input field(s) served", page.URL, shadow.Outcome, len(shadow.Exposed), len(inputs))
+	return shadow
+}
+
+// Function printShadow outputs the results of the shadow crawl to the
+// console, listing the pages that serve input fields without a session.
+func printShadow(shadows []ShadowResult) {
+	counts := make(map[string]int)
+	for _, shadow := range shadows {
+		counts[shadow.Outcome]++
+	}
+	fmt.Printf("[SHADOW] %d page(s) found with a session requested again without one: %d exposed, %d partly exposed, %d protected, %d failed\n\n",
+		len(shadows), counts[ShadowExposed], counts[ShadowPartial], counts[ShadowProtected], counts[ShadowError])
+
+	for _, shadow := range shadows {
+		if shadow.Outcome != ShadowExposed && shadow.Outcome != ShadowPartial {
+			continue
+		}
+		fmt.Printf("[%s] [%s] (%d of %d input field(s) served without a session)\n", strings.ToUpper(shadow.Outcome), shadow.URL, len(shadow.Exposed), len(shadow.Exposed)+len(shadow.Protected))
+		if shadow.AuthProfile != "" {
+			fmt.Printf("\t(found with auth profile: %s)\n", shadow.AuthProfile)
+		}
+		if shadow.RedirectedTo != "" {
+			fmt.Printf("\t(redirected: %s)\n", shadow.RedirectedTo)
+		}
+		for _, input := range shadow.Exposed {
+			fmt.Printf("\t%s\n", input.HTML)
+		}
+		fmt.Println()
+	}
+}
+
+// Function writeShadow writes the results of the shadow crawl to the file at
+// the given path, as JSON.
+func writeShadow(shadows []ShadowResult, path string) error {
+	if shadows == nil {
+		shadows = []ShadowResult{}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(shadows); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
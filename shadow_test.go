@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// formTransport answers every request with a page with a login form, and
+// records the headers of the requests sent through it.
+type formTransport struct {
+	headers []http.Header
+}
+
+// Method RoundTrip records the request's headers, and answers it.
+func (t *formTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	t.headers = append(t.headers, request.Header.Clone())
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/html"}},
+		Body:       ioutil.NopCloser(strings.NewReader(`<form action="/login"><input name="user"></form>`)),
+		Request:    request,
+	}, nil
+}
+
+func TestShadowCrawlSendsNoCredentials(t *testing.T) {
+	options := DefaultOptions()
+	options.Headers = http.Header{
+		"Cookie":          {"session=header-cookie"},
+		"X-Session-Token": {"header-session-token"},
+		"X-Scanner":       {"input-field-finder"},
+	}
+	options.AuthProfiles = map[string]AuthProfile{
+		"admin": {Headers: http.Header{"X-Api-Key": {"profile-api-key"}}},
+	}
+	options.Targets = []Target{{Name: "app", Hosts: []string{"app.example.com"}, Auth: "admin"}}
+	options.Signing = map[string]SigningConfig{
+		"app.example.com": {Scheme: SignHMAC, KeyID: "key", Secret: "secret", Header: "X-Signature"},
+	}
+	crawler := NewCrawler(nil, options)
+	recorder := &formTransport{}
+	crawler.network = recorder
+
+	crawler.results.Pages = []PageResult{{
+		URL:           "http://app.example.com/account",
+		Authenticated: true,
+		AuthProfile:   "admin",
+		Inputs:        []Input{{HTML: `<input name="user">`, Action: "http://app.example.com/login", Method: http.MethodGet, Attributes: []Attribute{{Key: "name", Val: "user"}}}},
+	}}
+	shadows := crawler.ShadowCrawl()
+
+	if len(recorder.headers) != 1 {
+		t.Fatalf("sent %d request(s), expected 1", len(recorder.headers))
+	}
+	headers := recorder.headers[0]
+	for _, name := range []string{"Cookie", "X-Session-Token", "X-Api-Key", "X-Signature", "Authorization", "X-Timestamp"} {
+		if value := headers.Get(name); value != "" {
+			t.Errorf("the page was requested with %s: %s", name, value)
+		}
+	}
+	if headers.Get("X-Scanner") != "input-field-finder" {
+		t.Errorf("the page was not requested with the configured headers that carry no credentials: %v", headers)
+	}
+	if len(shadows) != 1 || shadows[0].Outcome != ShadowExposed {
+		t.Errorf("got %+v, expected the page to be exposed", shadows)
+	}
+}
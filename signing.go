@@ -0,0 +1,460 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The request signing schemes
+const (
+	SignSigV4 = "sigv4"
+	SignHMAC  = "hmac"
+)
+
+// The defaults of the HMAC signing scheme
+const (
+	defaultHMACStringToSign    = "{method}\n{path}\n{timestamp}\n{body_sha256}"
+	defaultHMACHeader          = "Authorization"
+	defaultHMACValue           = "HMAC {key_id}:{signature}"
+	defaultHMACTimestampHeader = "X-Timestamp"
+)
+
+// The placeholders of HMAC templates, such as {method}
+var signPlaceholder = regexp.MustCompile(`\{([a-z0-9_]+)\}`)
+
+// The placeholders that can be used in the string to sign, and in the value
+// of the signature header
+var (
+	hmacStringFields = map[string]bool{"method": true, "host": true, "path": true, "query": true, "timestamp": true, "nonce": true, "content_type": true, "body_sha256": true, "key_id": true}
+	hmacValueFields  = map[string]bool{"key_id": true, "signature": true, "timestamp": true, "nonce": true}
+)
+
+// SigningConfig is how the requests to a host are signed: with AWS
+// Signature Version 4, for APIs behind API Gateway and other AWS services,
+// or with an HMAC of parts of the request, for tools with a scheme of their
+// own.
+type SigningConfig struct {
+	// Scheme is SignSigV4 or SignHMAC
+	Scheme string `json:"scheme"`
+
+	// The region and service of a SigV4 signature, such as "us-east-1" and
+	// "execute-api", and the credentials to sign with
+	Region       string `json:"region,omitempty"`
+	Service      string `json:"service,omitempty"`
+	AccessKey    string `json:"access_key,omitempty"`
+	SecretKey    string `json:"secret_key,omitempty"`
+	SessionToken string `json:"session_token,omitempty"`
+
+	// KeyID and Secret are the key of an HMAC signature, and Algorithm its
+	// hash: "sha256" (the default), "sha512" or "sha1". The signature is
+	// encoded as "base64" (the default) or "hex"
+	KeyID     string `json:"key_id,omitempty"`
+	Secret    string `json:"secret,omitempty"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Encoding  string `json:"encoding,omitempty"`
+	// StringToSign is the template of what is signed, from {method},
+	// {host}, {path} (with the query string), {query}, {timestamp}, {nonce},
+	// {content_type}, {body_sha256} and {key_id}; see defaultHMACStringToSign
+	StringToSign string `json:"string_to_sign,omitempty"`
+	// Header is the header the signature is sent in, and Value the template
+	// of its value, from {key_id}, {signature}, {timestamp} and {nonce}
+	Header string `json:"header,omitempty"`
+	Value  string `json:"value,omitempty"`
+	// TimestampHeader is the header the time of the request is sent in, in
+	// seconds since 1970, and NonceHeader the header a random nonce is sent
+	// in, if one is needed ("" = none)
+	TimestampHeader string `json:"timestamp_header,omitempty"`
+	NonceHeader     string `json:"nonce_header,omitempty"`
+}
+
+// Method Validate checks that a signing configuration is complete.
+func (s SigningConfig) Validate() error {
+	switch s.Scheme {
+	case SignSigV4:
+		if s.Region == "" || s.Service == "" {
+			return errors.New("sigv4 signing needs a region and a service")
+		}
+		if s.AccessKey == "" || s.SecretKey == "" {
+			return errors.New("sigv4 signing needs an access key and a secret key")
+		}
+	case SignHMAC:
+		if s.Secret == "" {
+			return errors.New("hmac signing needs a secret")
+		}
+		switch s.Algorithm {
+		case "", "sha256", "sha512", "sha1":
+		default:
+			return errors.New("hmac algorithm must be sha256, sha512 or sha1")
+		}
+		switch s.Encoding {
+		case "", "base64", "hex":
+		default:
+			return errors.New("hmac encoding must be base64 or hex")
+		}
+		if err := checkPlaceholders(s.StringToSign, hmacStringFields); err != nil {
+			return fmt.Errorf("invalid string to sign: %s", err.Error())
+		}
+		if err := checkPlaceholders(s.Value, hmacValueFields); err != nil {
+			return fmt.Errorf("invalid header value: %s", err.Error())
+		}
+	default:
+		return errors.New("signing scheme must be " + SignSigV4 + " or " + SignHMAC)
+	}
+	return nil
+}
+
+// The value the secrets of a signing configuration are replaced with when it
+// is shown, such as in a scan's status
+const redactedSecret = "[redacted]"
+
+// Method redacted returns the signing configuration with its secret key,
+// session token and HMAC secret replaced, so that it can be shown without
+// giving the credentials away. The access key and key ID are kept, to tell
+// which credentials are in use.
+func (s SigningConfig) redacted() SigningConfig {
+	for _, secret := range []*string{&s.SecretKey, &s.SessionToken, &s.Secret} {
+		if *secret != "" {
+			*secret = redactedSecret
+		}
+	}
+	return s
+}
+
+// Function checkPlaceholders checks that a template only uses the
+// placeholders allowed.
+func checkPlaceholders(template string, allowed map[string]bool) error {
+	for _, match := range signPlaceholder.FindAllStringSubmatch(template, -1) {
+		if !allowed[match[1]] {
+			return fmt.Errorf("unknown placeholder {%s}", match[1])
+		}
+	}
+	return nil
+}
+
+// Function validateSigning checks the signing configuration of each host.
+// Hosts are given as a hostname, or hostname:port, and "*.example.com"
+// covers every subdomain of example.com.
+func validateSigning(signing map[string]SigningConfig) error {
+	for host, config := range signing {
+		if host == "" || strings.ContainsAny(host, "/ ") || strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+			return fmt.Errorf("invalid signing host %q: must be a hostname, such as api.example.com or *.example.com", host)
+		}
+		if err := config.Validate(); err != nil {
+			return fmt.Errorf("signing for %s: %s", host, err.Error())
+		}
+	}
+	return nil
+}
+
+// Function loadSigning reads the signing configuration of each host from a
+// JSON file, in the same form as the signing scan option:
+//
+//	{"api.example.com": {"scheme": "sigv4", "region": "us-east-1", "service": "execute-api"}}
+//
+// SigV4 credentials that are not in the file are read from the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment
+// variables, and HMAC secrets from SIGNING_SECRET, so that they do not have
+// to be written down with the rest of the scan.
+func loadSigning(path string) (map[string]SigningConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs map[string]SigningConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("invalid signing file %s: %s", path, err.Error())
+	}
+	signing := make(map[string]SigningConfig, len(configs))
+	for host, config := range configs {
+		switch config.Scheme {
+		case SignSigV4:
+			if config.AccessKey == "" && config.SecretKey == "" {
+				config.AccessKey, config.SecretKey = os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+				if config.SessionToken == "" {
+					config.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+				}
+			}
+		case SignHMAC:
+			if config.Secret == "" {
+				config.Secret = os.Getenv("SIGNING_SECRET")
+			}
+		}
+		signing[strings.ToLower(host)] = config
+	}
+	return signing, validateSigning(signing)
+}
+
+// Signer is an HTTP transport that signs the requests to the hosts it has a
+// signing configuration for. It sits right above the network, below the rate
+// limits and the cache, so that each request is signed with the time it is
+// actually sent at, and redirects are signed for the host they go to.
+type Signer struct {
+	// The transport that sends the requests
+	Next http.RoundTripper
+	// The signing configuration of each host
+	Hosts map[string]SigningConfig
+}
+
+// Method config returns the signing configuration for a host, if any: that
+// of the host and port, then of the hostname, then of the closest wildcard.
+func (s Signer) config(requestURL *url.URL) (SigningConfig, bool) {
+	if config, exists := s.Hosts[strings.ToLower(requestURL.Host)]; exists {
+		return config, true
+	}
+	hostname := strings.ToLower(requestURL.Hostname())
+	if config, exists := s.Hosts[hostname]; exists {
+		return config, true
+	}
+	for labels := strings.Split(hostname, "."); len(labels) > 1; labels = labels[1:] {
+		if config, exists := s.Hosts["*."+strings.Join(labels[1:], ".")]; exists {
+			return config, true
+		}
+	}
+	return SigningConfig{}, false
+}
+
+// Method RoundTrip signs a copy of the request, if its host has a signing
+// configuration, and sends it.
+func (s Signer) RoundTrip(request *http.Request) (*http.Response, error) {
+	config, exists := s.config(request.URL)
+	if !exists {
+		return s.Next.RoundTrip(request)
+	}
+
+	// Read the body to hash it, leaving a copy for the request to send
+	signed := request.Clone(request.Context())
+	var body []byte
+	if request.Body != nil && request.Body != http.NoBody {
+		var err error
+		if body, err = ioutil.ReadAll(request.Body); err != nil {
+			return nil, err
+		}
+		request.Body.Close()
+		signed.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	now := time.Now().UTC()
+	switch config.Scheme {
+	case SignSigV4:
+		signSigV4(signed, body, config, now)
+	case SignHMAC:
+		if err := signHMAC(signed, body, config, now); err != nil {
+			return nil, err
+		}
+	}
+	return s.Next.RoundTrip(signed)
+}
+
+// Function requestHost returns the host a request is sent to, as it appears
+// in its Host header.
+func requestHost(request *http.Request) string {
+	if request.Host != "" {
+		return request.Host
+	}
+	return request.URL.Host
+}
+
+// Function sha256Hex returns the SHA-256 hash of data, in hex.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Function hmacSum returns the HMAC of data with the given key and hash.
+func hmacSum(newHash func() hash.Hash, key []byte, data string) []byte {
+	mac := hmac.New(newHash, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Function awsEscape percent-encodes a value the way SigV4 expects: every
+// byte apart from letters, digits and -_.~ is encoded, including slashes.
+func awsEscape(value string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		b := value[i]
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') || b == '-' || b == '_' || b == '.' || b == '~' {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+// Function sigV4Path returns the canonical form of a request's path for a
+// SigV4 signature: each segment is encoded once, and then once more for every
+// service but S3.
+func sigV4Path(escapedPath string, service string) string {
+	segments := strings.Split(escapedPath, "/")
+	for i, segment := range segments {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segment = unescaped
+		}
+		segments[i] = awsEscape(segment)
+		if service != "s3" {
+			segments[i] = awsEscape(segments[i])
+		}
+	}
+	if path := strings.Join(segments, "/"); path != "" {
+		return path
+	}
+	return "/"
+}
+
+// Function sigV4Query returns the canonical form of a query string for a
+// SigV4 signature: its parameters encoded, and sorted by name and then value.
+func sigV4Query(rawQuery string) string {
+	var parameters []string
+	query, _ := url.ParseQuery(rawQuery)
+	for name, values := range query {
+		for _, value := range values {
+			parameters = append(parameters, awsEscape(name)+"="+awsEscape(value))
+		}
+	}
+	sort.Strings(parameters)
+	return strings.Join(parameters, "&")
+}
+
+// Function signSigV4 signs a request with AWS Signature Version 4, adding
+// the X-Amz-Date, X-Amz-Security-Token (with temporary credentials) and
+// Authorization headers.
+func signSigV4(request *http.Request, body []byte, config SigningConfig, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	if config.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", config.SessionToken)
+	}
+	if config.Service == "s3" {
+		request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	// The Host header, and the headers set here or that describe the body
+	headers := map[string]string{"host": requestHost(request)}
+	for name, values := range request.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" {
+			headers[lower] = strings.Join(strings.Fields(strings.Join(values, ",")), " ")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		sigV4Path(request.URL.EscapedPath(), config.Service),
+		sigV4Query(request.URL.RawQuery),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + config.Region + "/" + config.Service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSum(sha256.New, []byte("AWS4"+config.SecretKey), day)
+	key = hmacSum(sha256.New, key, config.Region)
+	key = hmacSum(sha256.New, key, config.Service)
+	key = hmacSum(sha256.New, key, "aws4_request")
+	signature := hex.EncodeToString(hmacSum(sha256.New, key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		config.AccessKey, scope, signedHeaders, signature))
+}
+
+// Function signHMAC signs a request with an HMAC of the parts of the request
+// named in the configuration's string to sign, adding the timestamp, nonce
+// and signature headers.
+func signHMAC(request *http.Request, body []byte, config SigningConfig, now time.Time) error {
+	fields := map[string]string{
+		"method":       request.Method,
+		"host":         requestHost(request),
+		"path":         request.URL.EscapedPath(),
+		"query":        request.URL.RawQuery,
+		"timestamp":    strconv.FormatInt(now.Unix(), 10),
+		"content_type": request.Header.Get("Content-Type"),
+		"body_sha256":  sha256Hex(body),
+		"key_id":       config.KeyID,
+	}
+	if fields["path"] == "" {
+		fields["path"] = "/"
+	}
+	if request.URL.RawQuery != "" {
+		fields["path"] += "?" + request.URL.RawQuery
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	fields["nonce"] = hex.EncodeToString(nonce)
+
+	fill := func(template string) string {
+		return signPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+			return fields[strings.Trim(placeholder, "{}")]
+		})
+	}
+
+	newHash := sha256.New
+	switch config.Algorithm {
+	case "sha512":
+		newHash = sha512.New
+	case "sha1":
+		newHash = sha1.New
+	}
+	stringToSign := config.StringToSign
+	if stringToSign == "" {
+		stringToSign = defaultHMACStringToSign
+	}
+	sum := hmacSum(newHash, []byte(config.Secret), fill(stringToSign))
+	if config.Encoding == "hex" {
+		fields["signature"] = hex.EncodeToString(sum)
+	} else {
+		fields["signature"] = base64.StdEncoding.EncodeToString(sum)
+	}
+
+	header, value, timestampHeader := config.Header, config.Value, config.TimestampHeader
+	if header == "" {
+		header = defaultHMACHeader
+	}
+	if value == "" {
+		value = defaultHMACValue
+	}
+	if timestampHeader == "" {
+		timestampHeader = defaultHMACTimestampHeader
+	}
+	request.Header.Set(timestampHeader, fields["timestamp"])
+	if config.NonceHeader != "" {
+		request.Header.Set(config.NonceHeader, fields["nonce"])
+	}
+	request.Header.Set(header, fill(value))
+	return nil
+}
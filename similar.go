@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"math/bits"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/html"
+)
+
+// Path segments that look like identifiers, rather than part of the site's
+// structure: numbers, UUIDs, and long hexadecimal strings
+var identifierSegment = regexp.MustCompile(`^(\d+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{16,})$`)
+
+// The number of bits two page fingerprints can differ by, and still be
+// counted as the same template
+const similarThreshold = 3
+
+// Similarity tracks the pages fetched for each URL pattern, to spot when the
+// URLs of a pattern all serve the same template.
+type Similarity struct {
+	Patterns map[string]*patternBucket
+	mutex    sync.Mutex
+}
+
+// The pages fetched for a single URL pattern
+type patternBucket struct {
+	// The fingerprint of the first page fetched, that the rest are compared to
+	reference uint64
+	// The number of pages fetched that match the reference
+	similar int
+	// Set once MaxSimilar pages match, after which the pattern is skipped
+	capped bool
+}
+
+// Function urlPattern returns the pattern a URL belongs to: its origin and
+// path, with identifier-like path segments replaced, and the names (but not
+// the values) of its query parameters. For example, /product/12?id=3&page=2
+// and /product/99?page=1&id=4 share the pattern /product/{id}?id&page.
+func urlPattern(urlValue *url.URL) string {
+	segments := strings.Split(urlValue.EscapedPath(), "/")
+	for i, segment := range segments {
+		if identifierSegment.MatchString(segment) {
+			segments[i] = "{id}"
+		}
+	}
+
+	var names []string
+	for name := range urlValue.Query() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return origin(urlValue) + strings.Join(segments, "/") + "?" + strings.Join(names, "&")
+}
+
+// Function structureHash returns a similarity hash (simhash) of the structure
+// of a document: the element names along each path from the root of the
+// document. Pages built from the same template get hashes that differ by only
+// a few bits, regardless of the text and attribute values they hold.
+// The search stops early once ctx is done.
+func structureHash(ctx context.Context, document *html.Node, limits walkLimits) uint64 {
+	var weights [64]int
+
+	// Search the document tree, hashing each element's path; paths holds the
+	// path to the node at each depth
+	paths := []string{""}
+	walk(ctx, document, limits, func(node *html.Node, depth int) bool {
+		paths = append(paths[:depth+1], paths[depth])
+		if node.Type == html.ElementNode {
+			path := paths[depth] + ">" + node.Data
+			paths[depth+1] = path
+
+			hash := fnv.New64a()
+			hash.Write([]byte(path))
+			sum := hash.Sum64()
+			for bit := uint(0); bit < 64; bit++ {
+				if sum&(1<<bit) != 0 {
+					weights[bit]++
+				} else {
+					weights[bit]--
+				}
+			}
+		}
+		return true
+	})
+
+	var fingerprint uint64
+	for bit := uint(0); bit < 64; bit++ {
+		if weights[bit] > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+	return fingerprint
+}
+
+// Method isCapped checks whether enough pages matching the URL's pattern have
+// been found to share a template, and so the URL can be skipped.
+func (c *Crawler) isCapped(urlValue *url.URL) bool {
+	if c.options.MaxSimilar <= 0 {
+		return false
+	}
+
+	c.similarity.mutex.Lock()
+	defer c.similarity.mutex.Unlock()
+	bucket, exists := c.similarity.Patterns[urlPattern(urlValue)]
+	return exists && bucket.capped
+}
+
+// Method recordStructure adds the fingerprint of a fetched page to its URL
+// pattern. Once MaxSimilar pages of the pattern share a template, the rest of
+// the pattern's URLs are skipped.
+func (c *Crawler) recordStructure(urlValue *url.URL, fingerprint uint64) {
+	if c.options.MaxSimilar <= 0 {
+		return
+	}
+
+	pattern := urlPattern(urlValue)
+
+	c.similarity.mutex.Lock()
+	defer c.similarity.mutex.Unlock()
+
+	bucket, exists := c.similarity.Patterns[pattern]
+	if !exists {
+		bucket = &patternBucket{reference: fingerprint}
+		c.similarity.Patterns[pattern] = bucket
+	}
+	if bucket.capped || bits.OnesCount64(bucket.reference^fingerprint) > similarThreshold {
+		return
+	}
+
+	bucket.similar++
+	if bucket.similar >= c.options.MaxSimilar {
+		bucket.capped = true
+		c.log.Infof("[%s] %d pages share the same template; skipping the rest of the URLs like it", pattern, bucket.similar)
+	}
+}
+
+// Method skipSimilar checks whether the URL of a task can be skipped, as
+// enough pages like it have already been searched.
+func (c *Crawler) skipSimilar(urlValue *url.URL) bool {
+	if !c.isCapped(urlValue) {
+		return false
+	}
+	atomic.AddInt64(&c.stats.similar, 1)
+	c.log.Debugf("[%s] Skipping: similar to pages already searched", urlValue.String())
+	return true
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Output file formats
+const (
+	FormatJSON  = "json"
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// Sink receives the pages found to contain input fields, as they are found.
+type Sink interface {
+	// Write outputs a single page result
+	Write(result PageResult) error
+	// Close flushes any buffered results; no writes may follow
+	Close() error
+}
+
+// abandoningSink is a sink that sends its results on in the background, and
+// can be told to give up on those it has not sent within a time limit, so
+// that closing it does not hang on an endpoint that is down.
+type abandoningSink interface {
+	// Abandon drops the results not sent within the limit from now
+	Abandon(limit time.Duration)
+}
+
+// ConsoleSink prints page results to the console.
+// Once MaxFindings input fields have been printed, further input fields are
+// written to the JSON Lines file at OverflowPath instead, to keep the console
+// output usable.
+type ConsoleSink struct {
+	// MaxFindings is the number of input fields to print; 0 = no limit
+	MaxFindings int
+	// OverflowPath is the file input fields past the limit are written to
+	OverflowPath string
+	// Filter chooses the attributes printed; the overflow file gets them all
+	Filter *AttributeFilter
+
+	printed    int
+	overflowed int
+	overflow   *FileSink
+	mutex      sync.Mutex
+}
+
+// Method Write prints a page result, without interleaving it with others.
+func (s *ConsoleSink) Write(result PageResult) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.MaxFindings <= 0 {
+		printPageResult(s.Filter.ApplyPage(result))
+		return nil
+	}
+
+	// Print as many of the input fields as the limit allows
+	remaining := s.MaxFindings - s.printed
+	if remaining > len(result.Inputs) {
+		remaining = len(result.Inputs)
+	}
+	if remaining > 0 {
+		printed := result
+		printed.Inputs = result.Inputs[:remaining]
+		printPageResult(s.Filter.ApplyPage(printed))
+		s.printed += remaining
+	}
+	if remaining == len(result.Inputs) {
+		return nil
+	}
+
+	// Send the rest to the overflow file, opening it on first use
+	if s.overflow == nil {
+		overflow, err := NewFileSink(s.OverflowPath, FormatJSONL)
+		if err != nil {
+			return err
+		}
+		s.overflow = overflow
+		fmt.Printf("[NOTICE] Reached the maximum of %d input fields; further input fields are written to %s instead of the console\n\n", s.MaxFindings, s.OverflowPath)
+	}
+	overflowed := result
+	overflowed.Inputs = result.Inputs[remaining:]
+	s.overflowed += len(overflowed.Inputs)
+	return s.overflow.Write(overflowed)
+}
+
+// Method Close closes the overflow file, if one was opened, and reports how
+// many input fields were not printed.
+func (s *ConsoleSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.overflow == nil {
+		return nil
+	}
+	fmt.Printf("[NOTICE] Output truncated: %d input field(s) were not printed, and can be found in %s\n\n", s.overflowed, s.OverflowPath)
+	return s.overflow.Close()
+}
+
+// FileSink writes page results to a file.
+// JSON Lines and CSV results are written as they are found. JSON results are
+// written as a single report when the sink is closed, sorted by URL, so that
+// the file can later be used as a baseline.
+type FileSink struct {
+	// Filter chooses the attributes written to CSV files
+	Filter *AttributeFilter
+	// Order sorts the pages of JSON files; nil = by URL (see sortResults)
+	Order func([]PageResult)
+
+	format string
+	file   io.WriteCloser
+	writer *bufio.Writer
+	csv    *csv.Writer
+	pages  []PageResult
+	mutex  sync.Mutex
+}
+
+// Function NewFileSink creates (or truncates) the file at the given path.
+func NewFileSink(path string, format string) (*FileSink, error) {
+	if format != FormatJSON && format != FormatJSONL && format != FormatCSV {
+		return nil, errors.New("unknown output format: " + format)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return newFileSink(file, format), nil
+}
+
+// Function newFileSink creates a sink that writes to file, in a format known
+// to be valid.
+func newFileSink(file io.WriteCloser, format string) *FileSink {
+	sink := &FileSink{
+		format: format,
+		file:   file,
+		writer: bufio.NewWriter(file),
+	}
+	if format == FormatCSV {
+		sink.csv = csv.NewWriter(sink.writer)
+		sink.csv.Write([]string{"url", "input", "authenticated", "target"})
+	}
+	return sink
+}
+
+// Method Write outputs a page result to the file.
+func (s *FileSink) Write(result PageResult) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch s.format {
+	case FormatJSONL:
+		encoder := json.NewEncoder(s.writer)
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(result)
+	case FormatCSV:
+		for _, input := range result.Inputs {
+			s.csv.Write([]string{result.URL, s.Filter.Apply(input).HTML, strconv.FormatBool(result.Authenticated), result.Target})
+		}
+		return s.csv.Error()
+	default:
+		s.pages = append(s.pages, result)
+		return nil
+	}
+}
+
+// Method Close writes out any buffered results and closes the file.
+func (s *FileSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch s.format {
+	case FormatJSON:
+		if s.Order != nil {
+			s.Order(s.pages)
+		} else {
+			sortResults(s.pages)
+		}
+		encoder := json.NewEncoder(s.writer)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(Report{Results: s.pages}); err != nil {
+			s.file.Close()
+			return err
+		}
+	case FormatCSV:
+		s.csv.Flush()
+	}
+
+	if err := s.writer.Flush(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// WebhookPayload is the JSON body posted to the webhook.
+// The text field makes the payload readable by Slack-style incoming webhooks.
+type WebhookPayload struct {
+	Text   string  `json:"text"`
+	URL    string  `json:"url"`
+	Inputs []Input `json:"inputs"`
+}
+
+// WebhookSink posts page results as JSON to a remote endpoint as they are found.
+// Posting happens in the background, so that slow endpoints do not hold up the crawl.
+type WebhookSink struct {
+	url      string
+	perInput bool
+	client   *http.Client
+	queue    chan WebhookPayload
+	done     chan struct{}
+
+	// Canceled to drop the payloads still queued; see Abandon
+	ctx     context.Context
+	abandon context.CancelFunc
+}
+
+// Function NewWebhookSink creates a sink posting to the given URL. If perInput
+// is true, each input field is posted on its own; otherwise each page's input
+// fields are posted together.
+func NewWebhookSink(url string, perInput bool) *WebhookSink {
+	sink := &WebhookSink{
+		url:      url,
+		perInput: perInput,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		queue:    make(chan WebhookPayload, 1000),
+		done:     make(chan struct{}),
+	}
+	sink.ctx, sink.abandon = context.WithCancel(context.Background())
+	go sink.post()
+	return sink
+}
+
+// Method Write queues a page result to be posted.
+func (s *WebhookSink) Write(result PageResult) error {
+	if !s.perInput {
+		s.queue <- WebhookPayload{
+			Text:   fmt.Sprintf("%d input field(s) found on %s", len(result.Inputs), result.URL),
+			URL:    result.URL,
+			Inputs: result.Inputs,
+		}
+		return nil
+	}
+
+	for _, input := range result.Inputs {
+		s.queue <- WebhookPayload{
+			Text:   fmt.Sprintf("Input field found on %s: %s", result.URL, input.HTML),
+			URL:    result.URL,
+			Inputs: []Input{input},
+		}
+	}
+	return nil
+}
+
+// Method Close waits for all queued results to be posted.
+func (s *WebhookSink) Close() error {
+	close(s.queue)
+	<-s.done
+	return nil
+}
+
+// Method Abandon drops the payloads that are not posted within the limit,
+// including any post in progress by then, so that Close returns soon after.
+func (s *WebhookSink) Abandon(limit time.Duration) {
+	time.AfterFunc(limit, s.abandon)
+}
+
+// Method post sends queued payloads to the webhook until the queue is closed.
+// Failed posts are retried once before being dropped. Once abandoned, the
+// rest of the queue is dropped, and counted.
+func (s *WebhookSink) post() {
+	defer close(s.done)
+	defer s.abandon()
+
+	dropped := 0
+	for payload := range s.queue {
+		if s.ctx.Err() != nil {
+			dropped++
+			continue
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			logger.Errorf("[webhook] %s", err.Error())
+			continue
+		}
+
+		for attempt := 1; attempt <= 2 && s.ctx.Err() == nil; attempt++ {
+			if err = s.send(body); err == nil {
+				break
+			}
+		}
+		if err != nil && s.ctx.Err() != nil {
+			dropped++
+		} else if err != nil {
+			logger.Errorf("[webhook] Unable to post results for %s: %s", payload.URL, err.Error())
+		}
+	}
+	if dropped > 0 {
+		logger.Warnf("[webhook] Dropped %d queued payload(s) that were not posted in time", dropped)
+	}
+}
+
+// Method send posts a single JSON body to the webhook.
+func (s *WebhookSink) send(body []byte) error {
+	request, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status: %s", response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Stats counts the work done by a crawler. The counters are updated atomically.
+type Stats struct {
+	requests     int64
+	pagesFetched int64
+	inputsFound  int64
+	errors       int64
+	skipped      int64
+	similar      int64
+	sampled      int64
+	quarantined  int64
+	// When the crawl started (a time.Time), set once Run starts; it is read
+	// while the crawl starts up, such as by the scan API, so it is atomic too
+	started atomic.Value
+}
+
+// Method markStarted records that the crawl starts now.
+func (s *Stats) markStarted() {
+	s.started.Store(time.Now())
+}
+
+// Method startedAt returns when the crawl started, or the zero time if it has
+// not yet.
+func (s *Stats) startedAt() time.Time {
+	started, _ := s.started.Load().(time.Time)
+	return started
+}
+
+// StatsSnapshot is a point-in-time copy of a crawler's stats.
+type StatsSnapshot struct {
+	Requests          int64   `json:"requests"`
+	PagesFetched      int64   `json:"pages_fetched"`
+	InputsFound       int64   `json:"inputs_found"`
+	Errors            int64   `json:"errors"`
+	Skipped           int64   `json:"skipped"`
+	Similar           int64   `json:"similar_skipped"`
+	Sampled           int64   `json:"template_sampled"`
+	Quarantined       int64   `json:"quarantined"`
+	Cached            int64   `json:"cached"`
+	QueueDepth        int     `json:"queue_depth"`
+	InFlight          int64   `json:"in_flight"`
+	Fetching          int64   `json:"fetching"`
+	Parsing           int64   `json:"parsing"`
+	Goroutines        int64   `json:"goroutines"`
+	ElapsedSeconds    float64 `json:"elapsed_seconds"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+}
+
+// Method Stats returns a snapshot of the crawler's current stats.
+func (c *Crawler) Stats() StatsSnapshot {
+	snapshot := StatsSnapshot{
+		Requests:     atomic.LoadInt64(&c.stats.requests),
+		PagesFetched: atomic.LoadInt64(&c.stats.pagesFetched),
+		InputsFound:  atomic.LoadInt64(&c.stats.inputsFound),
+		Errors:       atomic.LoadInt64(&c.stats.errors),
+		Skipped:      atomic.LoadInt64(&c.stats.skipped),
+		Similar:      atomic.LoadInt64(&c.stats.similar),
+		Sampled:      atomic.LoadInt64(&c.stats.sampled),
+		Quarantined:  atomic.LoadInt64(&c.stats.quarantined),
+		QueueDepth:   c.frontier.Len(),
+		Cached:       c.cache.Hits(),
+		InFlight:     atomic.LoadInt64(&c.inFlight),
+		Fetching:     atomic.LoadInt64(&c.goroutines.fetching),
+		Parsing:      atomic.LoadInt64(&c.goroutines.parsing),
+		Goroutines:   atomic.LoadInt64(&c.goroutines.running),
+	}
+	if started := c.stats.startedAt(); !started.IsZero() {
+		snapshot.ElapsedSeconds = time.Since(started).Seconds()
+	}
+	if snapshot.ElapsedSeconds > 0 {
+		snapshot.RequestsPerSecond = float64(snapshot.Requests) / snapshot.ElapsedSeconds
+	}
+	return snapshot
+}
+
+// Function reportProgress prints a progress line for the crawler to stderr
+// at the given interval, until the done channel is closed.
+func reportProgress(crawler *Crawler, interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastRequests int64
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			stats := crawler.Stats()
+
+			// Report the rate over the last interval, rather than the whole run
+			rate := float64(stats.Requests-lastRequests) / interval.Seconds()
+			lastRequests = stats.Requests
+
+			fmt.Fprintf(os.Stderr, "[PROGRESS] %d pages fetched, %d queued, %d in flight, %d inputs found, %d errors, %.1f requests/sec\n",
+				stats.PagesFetched, stats.QueueDepth, stats.InFlight, stats.InputsFound, stats.Errors, rate)
+		}
+	}
+}
+
+// MetricsHandler serves crawler stats in the Prometheus text exposition format.
+// Crawlers returns the crawlers to report on, keyed by scan ID; a single
+// crawler can be reported with an empty ID, in which case no scan label is added.
+type MetricsHandler struct {
+	Crawlers func() map[string]*Crawler
+}
+
+// The metrics exposed, in the order they are written
+var metrics = []struct {
+	name   string
+	kind   string
+	help   string
+	values func(StatsSnapshot) float64
+}{
+	{"iff_requests_total", "counter", "Requests sent.", func(s StatsSnapshot) float64 { return float64(s.Requests) }},
+	{"iff_pages_fetched_total", "counter", "Pages fetched and parsed.", func(s StatsSnapshot) float64 { return float64(s.PagesFetched) }},
+	{"iff_inputs_found_total", "counter", "Input fields found.", func(s StatsSnapshot) float64 { return float64(s.InputsFound) }},
+	{"iff_errors_total", "counter", "Errors fetching or parsing pages.", func(s StatsSnapshot) float64 { return float64(s.Errors) }},
+	{"iff_pages_skipped_total", "counter", "Responses skipped for not being HTML, or being too big.", func(s StatsSnapshot) float64 { return float64(s.Skipped) }},
+	{"iff_pages_similar_skipped_total", "counter", "URLs skipped for sharing a template with enough pages already searched.", func(s StatsSnapshot) float64 { return float64(s.Similar) }},
+	{"iff_pages_template_sampled_total", "counter", "Pages only counted, not searched, for having the same forms as enough pages already searched.", func(s StatsSnapshot) float64 { return float64(s.Sampled) }},
+	{"iff_pages_quarantined_total", "counter", "Pages that could not be searched, as searching them took too long or crashed.", func(s StatsSnapshot) float64 { return float64(s.Quarantined) }},
+	{"iff_responses_cached_total", "counter", "Responses served from the -cache-dir, rather than downloaded.", func(s StatsSnapshot) float64 { return float64(s.Cached) }},
+	{"iff_queue_depth", "gauge", "URLs queued and waiting to be fetched.", func(s StatsSnapshot) float64 { return float64(s.QueueDepth) }},
+	{"iff_in_flight", "gauge", "URLs currently being fetched or processed.", func(s StatsSnapshot) float64 { return float64(s.InFlight) }},
+	{"iff_fetches_in_flight", "gauge", "Requests sent whose responses have not been fully read yet.", func(s StatsSnapshot) float64 { return float64(s.Fetching) }},
+	{"iff_parsers_running", "gauge", "Goroutines searching fetched pages for links and input fields.", func(s StatsSnapshot) float64 { return float64(s.Parsing) }},
+	{"iff_goroutines", "gauge", "Goroutines started by the crawl that have not exited yet.", func(s StatsSnapshot) float64 { return float64(s.Goroutines) }},
+	{"iff_requests_per_second", "gauge", "Average requests per second since the crawl started.", func(s StatsSnapshot) float64 { return s.RequestsPerSecond }},
+}
+
+// Method ServeHTTP writes the metrics for every crawler.
+func (h MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	crawlers := h.Crawlers()
+
+	// Take a single snapshot per crawler, so that all metrics agree
+	ids := make([]string, 0, len(crawlers))
+	snapshots := make(map[string]StatsSnapshot, len(crawlers))
+	for id, crawler := range crawlers {
+		ids = append(ids, id)
+		snapshots[id] = crawler.Stats()
+	}
+	sort.Strings(ids)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetrics(w, ids, snapshots)
+}
+
+// Function writeMetrics writes the snapshots in the Prometheus text exposition format.
+func writeMetrics(w io.Writer, ids []string, snapshots map[string]StatsSnapshot) {
+	for _, metric := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", metric.name, metric.kind)
+		for _, id := range ids {
+			if id == "" {
+				fmt.Fprintf(w, "%s %g\n", metric.name, metric.values(snapshots[id]))
+			} else {
+				fmt.Fprintf(w, "%s{scan=%q} %g\n", metric.name, id, metric.values(snapshots[id]))
+			}
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The default interval the -status-file is rewritten at
+const defaultStatusInterval = 10 * time.Second
+
+// activity tracks what a crawler is doing right now: the URLs being
+// processed, and the number of requests sent to each host.
+type activity struct {
+	// The URLs being processed, and when they were picked up
+	urls map[string]time.Time
+	// The number of requests sent to each host
+	hosts map[string]int64
+	mutex sync.Mutex
+}
+
+// ActiveURL is a URL being processed, and for how long it has been.
+type ActiveURL struct {
+	URL     string  `json:"url"`
+	Seconds float64 `json:"seconds"`
+}
+
+// HostRate is the number of requests sent to a host, and how fast they are
+// being sent.
+type HostRate struct {
+	Host     string `json:"host"`
+	Requests int64  `json:"requests"`
+	// RequestsPerSecond is the average since the crawl started
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	// RecentPerSecond is the average since the last status, or since the
+	// crawl started for the first one
+	RecentPerSecond float64 `json:"recent_per_second"`
+	// Limit is the host's current rate under the politeness ramp-up, if it
+	// is on
+	Limit float64 `json:"limit,omitempty"`
+}
+
+// Status is a snapshot of what a crawler is doing, for operators of long
+// runs to check on.
+type Status struct {
+	Time  time.Time     `json:"time"`
+	Stats StatsSnapshot `json:"stats"`
+	// PausedUntil is when the crawl resumes, while it is outside of its
+	// crawl windows
+	PausedUntil *time.Time  `json:"paused_until,omitempty"`
+	Active      []ActiveURL `json:"active"`
+	Hosts       []HostRate  `json:"hosts"`
+}
+
+// hostCounter is an HTTP transport that counts the requests sent to each
+// host. It sits below the rate limit and the cache, so that only the
+// requests actually sent are counted, when they are sent.
+type hostCounter struct {
+	crawler *Crawler
+	// The transport that sends the requests
+	next http.RoundTripper
+}
+
+// Method RoundTrip counts a request against its host, and sends it.
+func (h hostCounter) RoundTrip(request *http.Request) (*http.Response, error) {
+	activity := &h.crawler.activity
+	activity.mutex.Lock()
+	if activity.hosts == nil {
+		activity.hosts = make(map[string]int64)
+	}
+	activity.hosts[canonicalHost(request.URL)]++
+	activity.mutex.Unlock()
+	return h.next.RoundTrip(request)
+}
+
+// Method markActive records that a URL is being processed, returning the
+// function to call once it is done.
+func (c *Crawler) markActive(urlValue *url.URL) func() {
+	key := urlValue.String()
+
+	c.activity.mutex.Lock()
+	if c.activity.urls == nil {
+		c.activity.urls = make(map[string]time.Time)
+	}
+	c.activity.urls[key] = time.Now()
+	c.activity.mutex.Unlock()
+
+	return func() {
+		c.activity.mutex.Lock()
+		delete(c.activity.urls, key)
+		c.activity.mutex.Unlock()
+	}
+}
+
+// StatusReporter takes status snapshots of a crawler, working out the recent
+// request rate of each host from the previous snapshot.
+type StatusReporter struct {
+	Crawler *Crawler
+
+	// The time and per-host requests of the previous snapshot
+	last      time.Time
+	lastHosts map[string]int64
+	mutex     sync.Mutex
+}
+
+// Method Status returns a snapshot of what the crawler is doing. The URLs
+// that have been processed the longest come first, as do the busiest hosts.
+func (r *StatusReporter) Status() Status {
+	c := r.Crawler
+	now := time.Now()
+	status := Status{Time: now, Stats: c.Stats(), Active: []ActiveURL{}, Hosts: []HostRate{}}
+	if until := c.PausedUntil(); !until.IsZero() {
+		status.PausedUntil = &until
+	}
+
+	c.activity.mutex.Lock()
+	for activeURL, started := range c.activity.urls {
+		status.Active = append(status.Active, ActiveURL{URL: activeURL, Seconds: now.Sub(started).Seconds()})
+	}
+	hosts := make(map[string]int64, len(c.activity.hosts))
+	for host, requests := range c.activity.hosts {
+		hosts[host] = requests
+	}
+	c.activity.mutex.Unlock()
+
+	var limits map[string]float64
+	if c.politeness != nil {
+		limits = c.politeness.Rates()
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	since, previous := r.last, r.lastHosts
+	if since.IsZero() {
+		since = c.stats.startedAt()
+	}
+	for host, requests := range hosts {
+		rate := HostRate{Host: host, Requests: requests, Limit: limits[host]}
+		if status.Stats.ElapsedSeconds > 0 {
+			rate.RequestsPerSecond = float64(requests) / status.Stats.ElapsedSeconds
+		}
+		if interval := now.Sub(since).Seconds(); !since.IsZero() && interval > 0 {
+			rate.RecentPerSecond = float64(requests-previous[host]) / interval
+		}
+		status.Hosts = append(status.Hosts, rate)
+	}
+	r.last, r.lastHosts = now, hosts
+
+	sort.Slice(status.Active, func(i, j int) bool {
+		if status.Active[i].Seconds != status.Active[j].Seconds {
+			return status.Active[i].Seconds > status.Active[j].Seconds
+		}
+		return status.Active[i].URL < status.Active[j].URL
+	})
+	sort.Slice(status.Hosts, func(i, j int) bool {
+		if status.Hosts[i].Requests != status.Hosts[j].Requests {
+			return status.Hosts[i].Requests > status.Hosts[j].Requests
+		}
+		return status.Hosts[i].Host < status.Hosts[j].Host
+	})
+	return status
+}
+
+// Function printStatus writes a status snapshot to w, for a person to read.
+func printStatus(w io.Writer, status Status) {
+	stats := status.Stats
+	fmt.Fprintf(w, "[STATUS] %s, after %s\n", status.Time.Format(time.RFC3339), time.Duration(stats.ElapsedSeconds*float64(time.Second)).Round(time.Second))
+	fmt.Fprintf(w, "\t%d requests (%.1f/sec), %d pages fetched, %d inputs found, %d errors, %d skipped, %d quarantined, %d cached\n",
+		stats.Requests, stats.RequestsPerSecond, stats.PagesFetched, stats.InputsFound, stats.Errors, stats.Skipped+stats.Similar, stats.Quarantined, stats.Cached)
+	fmt.Fprintf(w, "\t%d queued, %d in flight (%d fetching, %d parsing), %d goroutines\n",
+		stats.QueueDepth, stats.InFlight, stats.Fetching, stats.Parsing, stats.Goroutines)
+	if status.PausedUntil != nil {
+		fmt.Fprintf(w, "\tPaused outside of the crawl windows until %s\n", status.PausedUntil.Format(time.RFC3339))
+	}
+
+	fmt.Fprintf(w, "\tActive URLs:\n")
+	if len(status.Active) == 0 {
+		fmt.Fprintf(w, "\t\t(none)\n")
+	}
+	for _, active := range status.Active {
+		fmt.Fprintf(w, "\t\t%s (%.1fs)\n", active.URL, active.Seconds)
+	}
+
+	fmt.Fprintf(w, "\tHosts:\n")
+	if len(status.Hosts) == 0 {
+		fmt.Fprintf(w, "\t\t(none)\n")
+	}
+	for _, host := range status.Hosts {
+		fmt.Fprintf(w, "\t\t%s: %d requests, %.2f/sec recently, %.2f/sec overall", host.Host, host.Requests, host.RecentPerSecond, host.RequestsPerSecond)
+		if host.Limit > 0 {
+			fmt.Fprintf(w, ", ramped up to %.2f/sec", host.Limit)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w)
+}
+
+// Function writeStatusFile writes a status snapshot to the file at the given
+// path, as JSON. The file is replaced in one step, so that it can be read at
+// any time without seeing half of a snapshot.
+func writeStatusFile(path string, status Status) error {
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(path, append(data, '\n'), 0600)
+}
+
+// Function replaceFile writes data to the file at the given path in one step:
+// it is written to a temporary file next to it first, which then replaces
+// it, so that readers never see half of the file, and a crash part of the
+// way through leaves the old file as it was.
+func replaceFile(path string, data []byte, perm os.FileMode) error {
+	temporary, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	if _, err := temporary.Write(data); err != nil {
+		temporary.Close()
+		os.Remove(temporary.Name())
+		return err
+	}
+	if err := temporary.Chmod(perm); err != nil {
+		temporary.Close()
+		os.Remove(temporary.Name())
+		return err
+	}
+	if err := temporary.Close(); err != nil {
+		os.Remove(temporary.Name())
+		return err
+	}
+	return os.Rename(temporary.Name(), path)
+}
+
+// Function reportStatus dumps the crawler's status to stderr whenever a
+// status signal (SIGUSR1) is received, and, if path is set, rewrites the
+// status file at the given interval and on each signal, until the done
+// channel is closed.
+func reportStatus(crawler *Crawler, path string, interval time.Duration, done chan struct{}) {
+	reporter := &StatusReporter{Crawler: crawler}
+	signals := notifyStatusSignal()
+	defer stopStatusSignal(signals)
+
+	var tick <-chan time.Time
+	if path != "" && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	write := func(status Status) {
+		if path == "" {
+			return
+		}
+		if err := writeStatusFile(path, status); err != nil {
+			logger.Errorf("Unable to write the status file: %s", err.Error())
+		}
+	}
+	write(reporter.Status())
+
+	for {
+		select {
+		case <-done:
+			// Leave the final status behind
+			write(reporter.Status())
+			return
+		case <-signals:
+			status := reporter.Status()
+			printStatus(os.Stderr, status)
+			write(status)
+		case <-tick:
+			write(reporter.Status())
+		}
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Function notifyStatusSignal returns a channel that receives SIGUSR1, the
+// signal that asks for a status dump.
+func notifyStatusSignal() chan os.Signal {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	return signals
+}
+
+// Function stopStatusSignal stops delivering status signals to the channel.
+func stopStatusSignal(signals chan os.Signal) {
+	signal.Stop(signals)
+}
@@ -0,0 +1,17 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+)
+
+// Function notifyStatusSignal returns a channel that never receives
+// anything, as Windows has no SIGUSR1; use -status-file instead.
+func notifyStatusSignal() chan os.Signal {
+	return make(chan os.Signal)
+}
+
+// Function stopStatusSignal does nothing, as no signals are delivered.
+func stopStatusSignal(signals chan os.Signal) {}
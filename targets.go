@@ -0,0 +1,389 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Target is a part of the scope of a crawl, such as one application or one
+// client of a multi-tenant scan: the hosts it covers, the auth profile its
+// pages are requested with, how politely its hosts are crawled, and the tags
+// its findings are filed under. Every page found is keyed to the first
+// target that covers it.
+type Target struct {
+	// Name identifies the target in the results; it defaults to its first host
+	Name string `json:"name"`
+	// Hosts are the origins and hosts the target covers: an origin, such as
+	// "https://www.example.com", covers only that scheme and host; a host,
+	// such as "www.example.com", covers it over both http and https; and
+	// "*.example.com" (or "https://*.example.com") covers every subdomain of
+	// example.com, but not example.com itself
+	Hosts []string `json:"hosts"`
+	// Auth is the auth profile the target's pages are requested with, unless
+	// the seed they were found from has one of its own
+	Auth string `json:"auth,omitempty"`
+	// RateLimit is the most requests sent each second to the target's
+	// hosts, in all, on top of the crawl's own rate limit; 0 = no limit
+	RateLimit float64 `json:"rate_limit,omitempty"`
+	// Tags are added to the results of every page of the target
+	Tags []string `json:"tags,omitempty"`
+}
+
+// hostPattern is one of the hosts a target covers. An empty scheme covers
+// both http and https; a wildcard pattern covers the subdomains of its host.
+// The host is lower-cased, without a trailing dot or brackets, and the port
+// is empty for the default port of the scheme.
+type hostPattern struct {
+	scheme   string
+	host     string
+	port     string
+	wildcard bool
+}
+
+// Function defaultPort returns the port URLs of a scheme use when they do
+// not give one.
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+// Function parseHostPattern parses one of the hosts of a target; see
+// Target.Hosts.
+func parseHostPattern(value string) (hostPattern, error) {
+	var pattern hostPattern
+	rest := strings.ToLower(strings.TrimSpace(value))
+	if i := strings.Index(rest, "://"); i >= 0 {
+		pattern.scheme, rest = rest[:i], rest[i+3:]
+		if pattern.scheme != "http" && pattern.scheme != "https" {
+			return pattern, fmt.Errorf("invalid target host %q: the scheme must be http or https", value)
+		}
+	}
+	rest = strings.TrimSuffix(rest, "/")
+	if strings.HasPrefix(rest, "*.") {
+		pattern.wildcard, rest = true, rest[2:]
+	}
+	invalid := fmt.Errorf("invalid target host %q: must be an origin or a host, such as https://www.example.com, www.example.com or *.example.com", value)
+	if rest == "" || strings.ContainsAny(rest, "/?#@* ") {
+		return pattern, invalid
+	}
+
+	// The host is canonicalized the same way whether or not a scheme is
+	// given, so that www.example.com:443 and https://www.example.com cover
+	// the same https URLs
+	host := rest
+	if hostname, port, err := net.SplitHostPort(rest); err == nil {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return pattern, invalid
+		}
+		host, pattern.port = hostname, port
+	}
+	pattern.host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if pattern.host == "" || strings.ContainsAny(pattern.host, "[]") {
+		return pattern, invalid
+	}
+	if pattern.scheme != "" && pattern.port == defaultPort(pattern.scheme) {
+		pattern.port = ""
+	}
+	return pattern, nil
+}
+
+// Method hostPort returns the host and port of the pattern, as in a URL.
+func (p hostPattern) hostPort() string {
+	host := p.host
+	if strings.Contains(host, ":") {
+		// IPv6 addresses keep their brackets
+		host = "[" + host + "]"
+	}
+	if p.port != "" {
+		host += ":" + p.port
+	}
+	return host
+}
+
+// Method matches checks whether a URL is covered by the pattern.
+func (p hostPattern) matches(urlValue *url.URL) bool {
+	scheme := strings.ToLower(urlValue.Scheme)
+	if p.scheme != "" && scheme != p.scheme {
+		return false
+	}
+	if p.scheme == "" && scheme != "http" && scheme != "https" {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(urlValue.Hostname()), ".")
+	if p.wildcard && !strings.HasSuffix(host, "."+p.host) {
+		return false
+	}
+	if !p.wildcard && host != p.host {
+		return false
+	}
+
+	// Ports left out are the default port of the URL's scheme
+	port, patternPort := urlValue.Port(), p.port
+	if port == "" {
+		port = defaultPort(scheme)
+	}
+	if patternPort == "" {
+		patternPort = defaultPort(scheme)
+	}
+	return port == patternPort
+}
+
+// Method origin returns the single origin the pattern covers, or "" if it
+// covers more than one.
+func (p hostPattern) origin() string {
+	if p.scheme == "" || p.wildcard {
+		return ""
+	}
+	return p.scheme + "://" + p.hostPort()
+}
+
+// Method String returns the pattern in the form it is configured in.
+func (p hostPattern) String() string {
+	value := p.hostPort()
+	if p.wildcard {
+		value = "*." + value
+	}
+	if p.scheme != "" {
+		value = p.scheme + "://" + value
+	}
+	return value
+}
+
+// Method regexp returns a regular expression matching the URLs the pattern
+// covers.
+func (p hostPattern) regexp() string {
+	scheme := "https?"
+	if p.scheme != "" {
+		scheme = regexp.QuoteMeta(p.scheme)
+	}
+	host := regexp.QuoteMeta(p.hostPort())
+	if p.wildcard {
+		host = `[^/:]+\.` + host
+	}
+	return scheme + "://" + host + "(/.*)?"
+}
+
+// scopeTarget is a target of a running crawl, ready to match URLs against.
+type scopeTarget struct {
+	Target
+	patterns []hostPattern
+	// Spaces out the requests to the target's hosts, if it has a rate limit
+	limiter *RateLimiter
+}
+
+// Method covers checks whether a URL is covered by any of the target's hosts.
+func (t *scopeTarget) covers(urlValue *url.URL) bool {
+	for _, pattern := range t.patterns {
+		if pattern.matches(urlValue) {
+			return true
+		}
+	}
+	return false
+}
+
+// Function newScopeTarget prepares a target for matching URLs against. The
+// target must be valid; see validateTargets.
+func newScopeTarget(target Target) *scopeTarget {
+	prepared := &scopeTarget{Target: target}
+	for _, host := range target.Hosts {
+		if pattern, err := parseHostPattern(host); err == nil {
+			prepared.patterns = append(prepared.patterns, pattern)
+		}
+	}
+	if prepared.Name == "" && len(prepared.patterns) > 0 {
+		prepared.Name = prepared.patterns[0].String()
+	}
+	return prepared
+}
+
+// Scope is the targets that are allowed to be spidered and searched: the
+// configured targets, in order, followed by one for the origin of each seed
+// that none of them covers. Targets can be added while a crawl is running.
+type Scope struct {
+	Targets []*scopeTarget
+	mutex   sync.RWMutex
+}
+
+// Method addOrigin adds a target for a single origin, named after it, unless
+// the origin is already covered by a target. It returns the target that
+// covers the origin.
+func (s *Scope) addOrigin(originURL *url.URL) *scopeTarget {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, target := range s.Targets {
+		if target.covers(originURL) {
+			return target
+		}
+	}
+	target := newScopeTarget(Target{Name: origin(originURL), Hosts: []string{origin(originURL)}})
+	s.Targets = append(s.Targets, target)
+	return target
+}
+
+// Method targetFor returns the first target that covers a URL, or nil if the
+// URL is out of scope.
+func (c *Crawler) targetFor(urlValue *url.URL) *scopeTarget {
+	if urlValue == nil {
+		return nil
+	}
+
+	c.scope.mutex.RLock()
+	defer c.scope.mutex.RUnlock()
+	for _, target := range c.scope.Targets {
+		if target.covers(urlValue) {
+			return target
+		}
+	}
+	return nil
+}
+
+// Method keyToTarget records the target a result belongs to, and adds the
+// target's tags to those of the result.
+func (c *Crawler) keyToTarget(result *PageResult) {
+	resultURL, err := url.Parse(result.URL)
+	if err != nil {
+		return
+	}
+	target := c.targetFor(resultURL)
+	if target == nil {
+		return
+	}
+	result.Target = target.Name
+
+	// The result's tags are shared with its seed; copy them before adding any
+	tags := append([]string(nil), result.Tags...)
+	for _, tag := range target.Tags {
+		known := false
+		for _, existing := range tags {
+			if existing == tag {
+				known = true
+				break
+			}
+		}
+		if !known {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > 0 {
+		result.Tags = tags
+	}
+}
+
+// Method Targets returns the targets of the crawl, in the order URLs are
+// matched against them.
+func (c *Crawler) Targets() []Target {
+	c.scope.mutex.RLock()
+	defer c.scope.mutex.RUnlock()
+
+	targets := make([]Target, 0, len(c.scope.Targets))
+	for _, target := range c.scope.Targets {
+		targets = append(targets, target.Target)
+	}
+	return targets
+}
+
+// targetLimits is an HTTP transport that holds each request to the rate limit
+// of the target it belongs to, if the target has one.
+type targetLimits struct {
+	crawler *Crawler
+	next    http.RoundTripper
+}
+
+// Method RoundTrip sends a request through its target's rate limiter, or
+// straight on if its target has none.
+func (t targetLimits) RoundTrip(request *http.Request) (*http.Response, error) {
+	if target := t.crawler.targetFor(request.URL); target != nil && target.limiter != nil {
+		return target.limiter.RoundTrip(request)
+	}
+	return t.next.RoundTrip(request)
+}
+
+// Function validateTargets checks that each target has a unique name, valid
+// hosts, and an auth profile that exists.
+func validateTargets(targets []Target, profiles map[string]AuthProfile) error {
+	names := make(map[string]bool)
+	for i, target := range targets {
+		if len(target.Hosts) == 0 {
+			return fmt.Errorf("target %d (%s) has no hosts", i+1, target.Name)
+		}
+		for _, host := range target.Hosts {
+			if _, err := parseHostPattern(host); err != nil {
+				return err
+			}
+		}
+		name := newScopeTarget(target).Name
+		if names[name] {
+			return fmt.Errorf("duplicate target name %q", name)
+		}
+		names[name] = true
+		if target.Auth != "" {
+			if _, exists := profiles[target.Auth]; !exists {
+				return fmt.Errorf("unknown auth profile %q for target %s", target.Auth, name)
+			}
+		}
+		if target.RateLimit < 0 {
+			return fmt.Errorf("target %s: rate limit must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// Function loadTargets reads the targets of a crawl from a JSON file, in the
+// same form as the targets scan option:
+//
+//	[{"name": "shop", "hosts": ["https://shop.example.com", "*.cdn.example.com"], "auth": "admin", "rate_limit": 2, "tags": ["client-a"]}]
+func loadTargets(path string) ([]Target, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var targets []Target
+	if err := json.Unmarshal(data, &targets); err != nil {
+		return nil, fmt.Errorf("invalid targets file %s: %s", path, err.Error())
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("the targets file " + path + " has no targets")
+	}
+	return targets, nil
+}
+
+// Method Scope returns the hosts of every target of the crawl, sorted, in
+// the form they are configured in (an origin, a host, or a wildcard host).
+func (c *Crawler) Scope() []string {
+	seen := make(map[string]bool)
+	for _, pattern := range c.scopePatterns() {
+		seen[pattern.String()] = true
+	}
+	return sortedKeys(seen)
+}
+
+// Method scopePatterns returns the hosts of every target of the crawl.
+func (c *Crawler) scopePatterns() []hostPattern {
+	c.scope.mutex.RLock()
+	defer c.scope.mutex.RUnlock()
+
+	var patterns []hostPattern
+	for _, target := range c.scope.Targets {
+		patterns = append(patterns, target.patterns...)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		return patterns[i].String() < patterns[j].String()
+	})
+	return patterns
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestHostPatternMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		url     string
+		matches bool
+	}{
+		// The same host, with and without a scheme
+		{"https://Example.com:443", "https://example.com/login", true},
+		{"Example.com:443", "https://example.com/login", true},
+		{"https://example.com.", "https://example.com/login", true},
+		{"example.com.", "https://example.com/login", true},
+		{"example.com.", "http://EXAMPLE.com./login", true},
+		{"https://example.com", "https://example.com:443/login", true},
+		{"example.com", "https://example.com:443/login", true},
+		{"example.com", "http://example.com:80/login", true},
+
+		// A port that is only the default for one of the schemes
+		{"example.com:443", "http://example.com/login", false},
+		{"example.com:443", "http://example.com:443/login", true},
+		{"https://example.com:443", "http://example.com:443/login", false},
+		{"example.com:8443", "https://example.com:8443/login", true},
+		{"Example.com.:8443", "https://example.com:8443/login", true},
+		{"example.com:8443", "https://example.com/login", false},
+		{"https://example.com:8443", "https://example.com/login", false},
+
+		// Wildcards
+		{"*.Example.com.", "https://www.example.com/", true},
+		{"https://*.example.com:443", "https://www.example.com/", true},
+		{"*.example.com:443", "https://www.example.com/", true},
+		{"*.example.com", "https://example.com/", false},
+
+		// IPv6 addresses
+		{"[::1]:8080", "http://[::1]:8080/", true},
+		{"https://[::1]:443", "https://[::1]/", true},
+		{"[::1]", "http://[::1]:8080/", false},
+	}
+	for _, test := range tests {
+		pattern, err := parseHostPattern(test.pattern)
+		if err != nil {
+			t.Errorf("parseHostPattern(%q): %s", test.pattern, err)
+			continue
+		}
+		urlValue, _ := url.Parse(test.url)
+		if matches := pattern.matches(urlValue); matches != test.matches {
+			t.Errorf("%q matches %q = %t, expected %t", test.pattern, test.url, matches, test.matches)
+		}
+	}
+}
+
+func TestHostPatternString(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		origin  string
+	}{
+		{"https://Example.com:443/", "https://example.com", "https://example.com"},
+		{"Example.com.", "example.com", ""},
+		{"Example.com:443", "example.com:443", ""},
+		{"http://example.com.:8080", "http://example.com:8080", "http://example.com:8080"},
+		{"*.Example.com", "*.example.com", ""},
+		{"https://[::1]:443", "https://[::1]", "https://[::1]"},
+	}
+	for _, test := range tests {
+		pattern, err := parseHostPattern(test.pattern)
+		if err != nil {
+			t.Errorf("parseHostPattern(%q): %s", test.pattern, err)
+			continue
+		}
+		if value := pattern.String(); value != test.value {
+			t.Errorf("%q is shown as %q, expected %q", test.pattern, value, test.value)
+		}
+		if origin := pattern.origin(); origin != test.origin {
+			t.Errorf("%q has the origin %q, expected %q", test.pattern, origin, test.origin)
+		}
+	}
+}
+
+func TestParseHostPatternInvalid(t *testing.T) {
+	for _, value := range []string{"", "ftp://example.com", "example.com:", "example.com:http", "example.com:99999", "example.com/path", "user@example.com", "[]:80", "."} {
+		if _, err := parseHostPattern(value); err == nil {
+			t.Errorf("parseHostPattern(%q) was accepted", value)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// How long Abort gives the sinks that post their results in the background,
+// such as webhooks, to post what they have queued before it is dropped
+const abortSinkTimeout = 5 * time.Second
+
+// Why a crawl stopped
+const (
+	// Every URL found was searched
+	StopCompleted = "completed"
+	// The MaxPages limit was reached, with URLs still queued
+	StopMaxPages = "max-pages"
+	// The MaxDuration limit was reached, with URLs still queued
+	StopDeadline = "deadline"
+	// The crawl was asked to stop, such as with Ctrl-C
+	StopSignal = "signal"
+	// The crawl could not go on, such as when its crawl windows never open
+	StopFatalError = "fatal-error"
+	// The scan was cancelled through the scan API
+	StopCancelled = "cancelled"
+)
+
+// The exit codes of a crawl that did not complete, by why it stopped
+var stopExitCodes = map[string]int{
+	StopMaxPages:   3,
+	StopDeadline:   3,
+	StopSignal:     130,
+	StopFatalError: 1,
+	StopCancelled:  130,
+}
+
+// Termination is why a crawl stopped, and whether its results cover every
+// URL it found. The results of a crawl that did not complete are still
+// written out in full, up to the point it stopped at.
+type Termination struct {
+	Reason string `json:"reason"`
+	// Complete is set if the crawl searched every URL it found
+	Complete bool       `json:"complete"`
+	Error    string     `json:"error,omitempty"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	// Pending is the number of URLs left queued, and not searched; see
+	// ExportFrontier to carry on with them
+	Pending int           `json:"pending"`
+	Stats   StatsSnapshot `json:"stats"`
+}
+
+// Method ExitCode returns the exit code for a crawl that stopped this way: 0
+// if it completed, 3 if it stopped at its page or time limit, 130 if it was
+// asked to stop, and 1 on a fatal error.
+func (t Termination) ExitCode() int {
+	return stopExitCodes[t.Reason]
+}
+
+// The state of a crawl's ending: why it was asked to stop, and when it
+// finished
+type terminationState struct {
+	reason   string
+	err      error
+	finished time.Time
+	mutex    sync.Mutex
+}
+
+// Method StopFor stops the crawl from handing out any more URLs, as Stop
+// does, recording why. Only the first reason a crawl is stopped for is kept.
+func (c *Crawler) StopFor(reason string, err error) {
+	c.termination.mutex.Lock()
+	if c.termination.reason == "" {
+		c.termination.reason, c.termination.err = reason, err
+	}
+	c.termination.mutex.Unlock()
+	c.stop()
+}
+
+// Method fail stops the crawl on an error it cannot go on from.
+func (c *Crawler) fail(err error) {
+	c.StopFor(StopFatalError, err)
+}
+
+// Method Termination returns why the crawl stopped. The reason is empty while
+// the crawl is still running.
+func (c *Crawler) Termination() Termination {
+	c.termination.mutex.Lock()
+	var result Termination
+	if started := c.stats.startedAt(); !started.IsZero() {
+		result.Started = &started
+	}
+	if finished := c.termination.finished; !finished.IsZero() {
+		result.Finished = &finished
+		result.Reason = c.termination.reason
+	}
+	if c.termination.err != nil {
+		result.Error = c.termination.err.Error()
+	}
+	c.termination.mutex.Unlock()
+
+	result.Complete = result.Reason == StopCompleted
+	result.Stats = c.Stats()
+	result.Pending = result.Stats.QueueDepth
+	return result
+}
+
+// Method finish records the end of the crawl, once every URL in process has
+// been searched: it saves the history, flushes and closes the sinks, and
+// waits for the crawl's goroutines to exit. A crawl that was not stopped for
+// any other reason completed, as did one stopped with nothing left queued.
+func (c *Crawler) finish() {
+	c.URLsInProcess.Wait()
+	c.saveHistory()
+	c.closeSinks(0)
+
+	c.termination.mutex.Lock()
+	if c.termination.reason == "" || (c.termination.reason != StopFatalError && c.frontier.Len() == 0) {
+		c.termination.reason = StopCompleted
+	}
+	c.termination.finished = time.Now()
+	c.termination.mutex.Unlock()
+
+	// Make sure nothing is left running once the crawl ends
+	c.shutdown()
+}
+
+// Method writeSinks passes a page result on to the sinks, unless they have
+// already been closed.
+func (c *Crawler) writeSinks(result PageResult) {
+	c.sinkState.mutex.Lock()
+	defer c.sinkState.mutex.Unlock()
+	if c.sinkState.closed {
+		return
+	}
+	for _, sink := range c.sinks {
+		if err := sink.Write(result); err != nil {
+			c.log.Errorf("[%s] %s", result.URL, err.Error())
+		}
+	}
+}
+
+// Method closeSinks flushes and closes the sinks, once; results found after
+// they are closed are not written to them. With a limit, the sinks that post
+// their results in the background drop what they have not posted by then.
+func (c *Crawler) closeSinks(limit time.Duration) {
+	if limit > 0 {
+		for _, sink := range c.sinks {
+			if abandoning, ok := sink.(abandoningSink); ok {
+				abandoning.Abandon(limit)
+			}
+		}
+	}
+
+	c.sinkState.mutex.Lock()
+	defer c.sinkState.mutex.Unlock()
+	if c.sinkState.closed {
+		return
+	}
+	c.sinkState.closed = true
+	for _, sink := range c.sinks {
+		if err := sink.Close(); err != nil {
+			c.log.Errorf("%s", err.Error())
+		}
+	}
+}
+
+// Method Abort stops the crawl at once, without waiting for the pages in
+// progress, for a second Ctrl-C: the history is saved, and the sinks are
+// flushed and closed, with the results found so far, so that the process
+// can exit straight after. Webhooks are given abortSinkTimeout to post the
+// results they have queued. The crawl counts as finished from then on.
+func (c *Crawler) Abort() {
+	c.abort(StopSignal)
+}
+
+// Method Cancel stops the crawl at once, as Abort does, for a scan cancelled
+// through the scan API.
+func (c *Crawler) Cancel() {
+	c.abort(StopCancelled)
+}
+
+// Method abort stops the crawl at once for the given reason; see Abort.
+func (c *Crawler) abort(reason string) {
+	c.StopFor(reason, nil)
+	c.saveHistory()
+	c.closeSinks(abortSinkTimeout)
+
+	c.termination.mutex.Lock()
+	if c.termination.finished.IsZero() {
+		c.termination.finished = time.Now()
+	}
+	c.termination.mutex.Unlock()
+}
+
+// Function logTermination logs why the crawl stopped: as information if it
+// completed, and as a warning otherwise.
+func logTermination(t Termination) {
+	var elapsed time.Duration
+	if t.Started != nil && t.Finished != nil {
+		elapsed = t.Finished.Sub(*t.Started).Round(time.Second)
+	}
+	if t.Complete {
+		logger.Infof("Crawl %s after %s: %d pages fetched", t.Reason, elapsed, t.Stats.PagesFetched)
+		return
+	}
+	message := ""
+	if t.Error != "" {
+		message = " (" + t.Error + ")"
+	}
+	logger.Warnf("Crawl stopped after %s: %s%s; %d pages fetched, %d URLs left queued, so the results are incomplete", elapsed, t.Reason, message, t.Stats.PagesFetched, t.Pending)
+}
+
+// Function writeSummary writes why the crawl stopped, and its stats, to the
+// file at the given path, as JSON.
+func writeSummary(path string, t Termination) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
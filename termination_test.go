@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSpawnStopsTheCrawlOnPanic(t *testing.T) {
+	crawler := NewCrawler(nil, DefaultOptions())
+	crawler.spawn(&crawler.goroutines.parsing, func() {
+		panic("broken worker")
+	})
+	crawler.goroutines.wg.Wait()
+
+	if !crawler.Stopping() {
+		t.Fatalf("the crawl was not stopped")
+	}
+	crawler.finish()
+	termination := crawler.Termination()
+	if termination.Reason != StopFatalError || termination.Error != "panic: broken worker" {
+		t.Errorf("got reason %q and error %q, expected %q and %q", termination.Reason, termination.Error, StopFatalError, "panic: broken worker")
+	}
+	if termination.ExitCode() != 1 {
+		t.Errorf("got exit code %d, expected 1", termination.ExitCode())
+	}
+}
+
+func TestStatusWhileTheCrawlStarts(t *testing.T) {
+	crawler := NewCrawler(nil, DefaultOptions())
+	reporter := &StatusReporter{Crawler: crawler}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		crawler.Run()
+	}()
+
+	// As the scan API does while a scan starts; run with -race
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		crawler.Termination()
+		crawler.Stats()
+		reporter.Status()
+	}
+	if termination := crawler.Termination(); termination.Started == nil || termination.Reason != StopCompleted {
+		t.Errorf("got %+v, expected a completed crawl with its start", termination)
+	}
+}
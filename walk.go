@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+
+	"golang.org/x/net/html"
+)
+
+// The default limits on the documents searched
+const (
+	defaultMaxNodeDepth = 512
+	defaultMaxNodes     = 1000000
+)
+
+// walkLimits caps how much of a document tree is visited.
+type walkLimits struct {
+	// The deepest level of nesting visited; 0 = no limit
+	depth int
+	// The number of nodes visited; 0 = no limit
+	nodes int
+}
+
+// walkResult describes how much of a document tree was visited.
+type walkResult struct {
+	Nodes   int
+	TooDeep bool
+	TooMany bool
+}
+
+// Method walkLimits returns the limits set by the MaxNodeDepth and MaxNodes options.
+func (c *Crawler) walkLimits() walkLimits {
+	return walkLimits{depth: c.options.MaxNodeDepth, nodes: c.options.MaxNodes}
+}
+
+// Function walk visits the nodes of a document tree in document order,
+// passing each node's depth (the root is at depth 0). If visit returns false,
+// the node's children are skipped. The tree is walked iteratively rather
+// than recursively, so that deeply nested documents cannot exhaust the
+// stack. Nodes past the limits are not visited, and the walk stops early
+// once ctx is done.
+func walk(ctx context.Context, root *html.Node, limits walkLimits, visit func(node *html.Node, depth int) bool) (result walkResult) {
+	node, depth := root, 0
+	for node != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		if limits.nodes > 0 && result.Nodes >= limits.nodes {
+			result.TooMany = true
+			return
+		}
+		result.Nodes++
+
+		// Go down to the first child, unless the node is as deep as allowed
+		if visit(node, depth) && node.FirstChild != nil {
+			if limits.depth <= 0 || depth < limits.depth {
+				node = node.FirstChild
+				depth++
+				continue
+			}
+			result.TooDeep = true
+		}
+
+		// Otherwise go across to the next sibling, of the node or of its
+		// closest ancestor that has one
+		for node != root && node.NextSibling == nil {
+			node = node.Parent
+			depth--
+		}
+		if node == root {
+			return
+		}
+		node = node.NextSibling
+	}
+	return
+}
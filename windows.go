@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Where a form is submitted, or a link is opened, if not in the page itself
+const (
+	// A new window or tab: target="_blank", or a name that no frame on the
+	// page has, which opens a window of that name
+	OpensNewWindow = "new-window"
+	// An iframe (or frame) of the page, named by the target
+	OpensIframe = "iframe"
+	// The page's parent, or the top-level page, when the page is framed
+	OpensParent = "parent"
+	OpensTop    = "top"
+)
+
+// Function opensDescription describes where a form or link opens, for the
+// console.
+func opensDescription(opens string) string {
+	switch opens {
+	case OpensNewWindow:
+		return "a new window"
+	case OpensIframe:
+		return "an iframe"
+	case OpensParent:
+		return "the parent page"
+	case OpensTop:
+		return "the top-level page"
+	}
+	return opens
+}
+
+// browsingContexts is what decides where a page's forms and links open: the
+// names of its iframes and frames, and the default target from its
+// <base target>, if any.
+type browsingContexts struct {
+	frames     map[string]bool
+	baseTarget string
+}
+
+// Function findBrowsingContexts collects the frame names and default target
+// of a document.
+// The search stops early once ctx is done.
+func findBrowsingContexts(ctx context.Context, document *html.Node, limits walkLimits) browsingContexts {
+	contexts := browsingContexts{frames: make(map[string]bool)}
+	baseFound := false
+	walk(ctx, document, limits, func(node *html.Node, depth int) bool {
+		if node.Type != html.ElementNode {
+			return true
+		}
+		switch node.DataAtom {
+		case atom.Iframe, atom.Frame:
+			if name := attributeValue(node, "name"); name != "" {
+				contexts.frames[name] = true
+			}
+		case atom.Base:
+			// Only the first base element with a target counts
+			if target, exists := attributeLookup(node, "target"); exists && !baseFound {
+				contexts.baseTarget, baseFound = strings.TrimSpace(target), true
+			}
+		}
+		return true
+	})
+	return contexts
+}
+
+// Method opens returns where a target opens (see OpensNewWindow and the
+// rest), or "" for the page itself. Keywords are matched without regard to
+// case, and frame names exactly.
+func (b browsingContexts) opens(target string) string {
+	switch strings.ToLower(target) {
+	case "", "_self":
+		return ""
+	case "_blank":
+		return OpensNewWindow
+	case "_parent":
+		return OpensParent
+	case "_top":
+		return OpensTop
+	}
+	if b.frames[target] {
+		return OpensIframe
+	}
+	return OpensNewWindow
+}
+
+// Function formWindow returns the target and rel of the form an input
+// element belongs to (see formOwner). A submit button's formtarget takes the
+// place of the form's target, and the page's <base target> is used if
+// neither has one. Both are empty if the element does not belong to a form.
+func formWindow(node *html.Node, forms *formIndex, contexts browsingContexts) (target string, rel string) {
+	form := formOwner(node, forms)
+	if form == nil {
+		return "", ""
+	}
+
+	target = contexts.baseTarget
+	if value, exists := attributeLookup(form, "target"); exists {
+		target = strings.TrimSpace(value)
+	}
+	if isSubmitter(node) {
+		if value, exists := attributeLookup(node, "formtarget"); exists {
+			target = strings.TrimSpace(value)
+		}
+	}
+	return target, strings.TrimSpace(attributeValue(form, "rel"))
+}
+
+// Link is a link on a page that opens somewhere other than the page itself,
+// or that has a rel attribute, such as a login link that opens an embedded
+// third-party flow in a new window.
+type Link struct {
+	URL    string `json:"url"`
+	Target string `json:"target,omitempty"`
+	Rel    string `json:"rel,omitempty"`
+	// Opens is where the link opens, if not in the page itself; see
+	// OpensNewWindow and the rest
+	Opens string `json:"opens,omitempty"`
+}
+
+// Function attributeLookup returns the value of an element's attribute, and
+// whether it has the attribute at all.
+func attributeLookup(node *html.Node, key string) (string, bool) {
+	for _, attribute := range node.Attr {
+		if attribute.Key == key {
+			return attribute.Val, true
+		}
+	}
+	return "", false
+}
+
+// Function attributeValue returns the value of an element's attribute, or ""
+// if it does not have it.
+func attributeValue(node *html.Node, key string) string {
+	value, _ := attributeLookup(node, key)
+	return value
+}